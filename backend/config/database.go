@@ -34,6 +34,15 @@ func ConnectDB() {
 	DB = client
 }
 
+// DatabaseName is the database the app uses: MONGODB_DATABASE, or
+// chatgpt_clone. Tests point it at a throwaway database.
+func DatabaseName() string {
+	if name := os.Getenv("MONGODB_DATABASE"); name != "" {
+		return name
+	}
+	return "chatgpt_clone"
+}
+
 func GetCollection(collectionName string) *mongo.Collection {
-	return DB.Database("chatgpt_clone").Collection(collectionName)
+	return DB.Database(DatabaseName()).Collection(collectionName)
 }
\ No newline at end of file
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// IPExtractor decides which address c.RealIP() reports, and with it the
+// address rate limits, login lockouts and activity logs key on.
+//
+// With TRUSTED_PROXIES unset the TCP peer address is used and forwarding
+// headers are ignored, since any client can send them. Behind a reverse proxy
+// (e.g. Render's load balancer) set TRUSTED_PROXIES to a comma-separated list
+// of the proxy CIDRs; X-Forwarded-For is then walked from the right, skipping
+// only those ranges.
+func IPExtractor() (echo.IPExtractor, error) {
+	return NewIPExtractor(os.Getenv("TRUSTED_PROXIES"))
+}
+
+// NewIPExtractor builds the extractor for a comma-separated list of trusted
+// proxy CIDRs
+func NewIPExtractor(trustedProxies string) (echo.IPExtractor, error) {
+	if strings.TrimSpace(trustedProxies) == "" {
+		return echo.ExtractIPDirect(), nil
+	}
+
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, cidr := range strings.Split(trustedProxies, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid TRUSTED_PROXIES entry %q: %w", cidr, err)
+		}
+		options = append(options, echo.TrustIPRange(ipNet))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
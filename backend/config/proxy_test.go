@@ -0,0 +1,47 @@
+package config
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestNewIPExtractor(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies string
+		remoteAddr     string
+		forwardedFor   string
+		want           string
+	}{
+		{"direct ignores a forged header", "", "203.0.113.7:5000", "198.51.100.9", "203.0.113.7"},
+		{"direct ignores a private peer's header", "", "10.0.0.5:5000", "198.51.100.9", "10.0.0.5"},
+		{"trusted proxy forwards the client", "10.0.0.0/8", "10.0.0.5:5000", "203.0.113.7", "203.0.113.7"},
+		{"trusted proxy skips forged entries", "10.0.0.0/8", "10.0.0.5:5000", "198.51.100.9, 203.0.113.7", "203.0.113.7"},
+		{"chained trusted proxies", "10.0.0.0/8, 172.16.0.0/12", "10.0.0.5:5000", "203.0.113.7, 172.16.0.2", "203.0.113.7"},
+		{"untrusted peer is not forwarded", "10.0.0.0/8", "203.0.113.7:5000", "198.51.100.9", "203.0.113.7"},
+		{"private ranges are not trusted implicitly", "10.0.0.0/8", "192.168.1.2:5000", "198.51.100.9", "192.168.1.2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			extractor, err := NewIPExtractor(tt.trustedProxies)
+			if err != nil {
+				t.Fatalf("NewIPExtractor: %v", err)
+			}
+			req := httptest.NewRequest("POST", "/api/auth/login", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set(echo.HeaderXForwardedFor, tt.forwardedFor)
+			req.Header.Set(echo.HeaderXRealIP, "198.51.100.10")
+			if got := extractor(req); got != tt.want {
+				t.Fatalf("client IP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewIPExtractorRejectsInvalidRanges(t *testing.T) {
+	if _, err := NewIPExtractor("10.0.0.0/8, not-a-cidr"); err == nil {
+		t.Fatal("expected an error for an invalid CIDR")
+	}
+}
@@ -5,8 +5,10 @@ import (
 	"chatgpt-clone/backend/models"
 	"chatgpt-clone/backend/services"
 	"chatgpt-clone/backend/utils"
+	"errors"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -58,6 +60,10 @@ func CreateUser(c echo.Context) error {
 
 	user, err := services.CreateUserWithRole(input, creatorID)
 	if err != nil {
+		var quotaErr *services.QuotaError
+		if errors.As(err, &quotaErr) {
+			return utils.ErrorResponseWithData(c, quotaErr.Status, quotaErr.Message, quotaErr)
+		}
 		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
 	}
 
@@ -154,6 +160,10 @@ func UpdateUser(c echo.Context) error {
 
 	err = services.UpdateUserByID(userID, input)
 	if err != nil {
+		var quotaErr *services.QuotaError
+		if errors.As(err, &quotaErr) {
+			return utils.ErrorResponseWithData(c, quotaErr.Status, quotaErr.Message, quotaErr)
+		}
 		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
 	}
 
@@ -232,6 +242,172 @@ func DeactivateUser(c echo.Context) error {
 	return utils.SuccessResponse(c, "User deactivated successfully", nil)
 }
 
+// UnlockUser lifts a login lockout on a user account
+func UnlockUser(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Verify user belongs to the company
+	user, err := services.GetUserByID(userID)
+	if err != nil || user.CompanyID != companyID {
+		return utils.ErrorResponse(c, http.StatusNotFound, "User not found")
+	}
+
+	unlocked, err := services.UnlockAccount(companyID, user.Email)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to unlock user")
+	}
+	if !unlocked {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "User account is not locked")
+	}
+
+	// Log activity
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionAccountUnlocked,
+		models.ResourceUser,
+		userID.Hex(),
+		"Unlocked user account: "+user.Email,
+		true,
+		map[string]interface{}{"user_email": user.Email},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"POST",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "User unlocked successfully", nil)
+}
+
+// RevokeUserSessions signs a user out of every device
+func RevokeUserSessions(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+
+	userID, err := primitive.ObjectIDFromHex(c.Param("user_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	// Verify user belongs to the company
+	user, err := services.GetUserByID(userID)
+	if err != nil || user.CompanyID != companyID {
+		return utils.ErrorResponse(c, http.StatusNotFound, "User not found")
+	}
+
+	revoked, err := services.RevokeUserSessions(userID, models.SessionRevokedByAdmin, "")
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to revoke sessions")
+	}
+
+	// Log activity
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionRevokeSessions,
+		models.ResourceUser,
+		userID.Hex(),
+		"Revoked all sessions of user: "+user.Email,
+		true,
+		map[string]interface{}{"user_email": user.Email, "revoked": revoked},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"DELETE",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "User sessions revoked successfully", map[string]interface{}{"revoked": revoked})
+}
+
+// RevokeCompanySessions signs out every user of the caller's company except
+// the caller's own session. Super admins may target another company with the
+// :company_id route.
+func RevokeCompanySessions(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+	currentJTI, _ := c.Request().Context().Value(middleware.SessionIDKey).(string)
+
+	targetCompanyID := companyID
+	if companyIDStr := c.Param("company_id"); companyIDStr != "" {
+		id, err := primitive.ObjectIDFromHex(companyIDStr)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid company ID")
+		}
+		targetCompanyID = id
+	}
+
+	revoked, err := services.RevokeCompanySessions(targetCompanyID, models.SessionRevokedByAdmin, currentJTI)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to revoke sessions")
+	}
+
+	// Log activity
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionRevokeSessions,
+		models.ResourceCompany,
+		targetCompanyID.Hex(),
+		"Revoked all company sessions",
+		true,
+		map[string]interface{}{"revoked": revoked},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"DELETE",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "Company sessions revoked successfully", map[string]interface{}{"revoked": revoked})
+}
+
+// GetLockedUsers lists accounts currently locked out after failed logins
+func GetLockedUsers(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	lockouts, err := services.GetActiveLockouts(companyID)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve locked accounts")
+	}
+
+	return utils.SuccessResponse(c, "Locked accounts retrieved successfully", lockouts)
+}
+
 // GetUserStats retrieves user statistics
 func GetUserStats(c echo.Context) error {
 	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
@@ -287,6 +463,11 @@ func UpdateRolePermissions(c echo.Context) error {
 		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
 	}
 
+	isSuperAdmin, _ := c.Request().Context().Value(middleware.IsSuperAdminKey).(bool)
+	if err := services.CheckGrantable(input.Permissions, isSuperAdmin); err != nil {
+		return utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+	}
+
 	err = services.UpdateRolePermissions(roleID, input.Permissions)
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
@@ -295,6 +476,238 @@ func UpdateRolePermissions(c echo.Context) error {
 	return utils.SuccessResponse(c, "Role permissions updated successfully", nil)
 }
 
+// GetPermissionCatalogue lists every permission with its description and
+// group, and whether the caller may grant it
+func GetPermissionCatalogue(c echo.Context) error {
+	isSuperAdmin, _ := c.Request().Context().Value(middleware.IsSuperAdminKey).(bool)
+
+	type catalogueEntry struct {
+		models.PermissionInfo
+		Grantable bool `json:"grantable"`
+	}
+
+	permissions := make([]catalogueEntry, 0, len(models.PermissionCatalogue))
+	groups := []string{}
+	seenGroups := map[string]bool{}
+	for _, info := range models.PermissionCatalogue {
+		permissions = append(permissions, catalogueEntry{
+			PermissionInfo: info,
+			Grantable:      isSuperAdmin || !info.PlatformOnly,
+		})
+		if !seenGroups[info.Group] {
+			seenGroups[info.Group] = true
+			groups = append(groups, info.Group)
+		}
+	}
+
+	return utils.SuccessResponse(c, "Permissions retrieved successfully", map[string]interface{}{
+		"permissions": permissions,
+		"groups":      groups,
+	})
+}
+
+// GetRole retrieves a single role
+func GetRole(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	roleID, err := primitive.ObjectIDFromHex(c.Param("role_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid role ID")
+	}
+
+	role, err := services.GetRoleByID(roleID)
+	if err != nil || role.CompanyID != companyID {
+		return utils.ErrorResponse(c, http.StatusNotFound, "Role not found")
+	}
+
+	return utils.SuccessResponse(c, "Role retrieved successfully", role)
+}
+
+// CreateRole creates a custom role in the company
+func CreateRole(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+
+	var input services.CreateRoleInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	isSuperAdmin, _ := c.Request().Context().Value(middleware.IsSuperAdminKey).(bool)
+	if err := services.CheckGrantable(input.Permissions, isSuperAdmin); err != nil {
+		return utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+	}
+
+	role, err := services.CreateRole(companyID, input.Name, input.DisplayName, input.Description, input.Permissions)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	// Log activity
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionCreateRole,
+		models.ResourceRole,
+		role.ID.Hex(),
+		"Created role: "+role.Name,
+		true,
+		map[string]interface{}{"role": role.Name, "permissions": role.Permissions},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"POST",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "Role created successfully", role)
+}
+
+// UpdateRole renames or edits a role. System roles cannot be renamed.
+func UpdateRole(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+
+	roleID, err := primitive.ObjectIDFromHex(c.Param("role_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid role ID")
+	}
+
+	// Verify role belongs to company
+	existing, err := services.GetRoleByID(roleID)
+	if err != nil || existing.CompanyID != companyID {
+		return utils.ErrorResponse(c, http.StatusNotFound, "Role not found")
+	}
+
+	var input services.UpdateRoleInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	if input.Permissions != nil {
+		isSuperAdmin, _ := c.Request().Context().Value(middleware.IsSuperAdminKey).(bool)
+		if err := services.CheckGrantable(*input.Permissions, isSuperAdmin); err != nil {
+			return utils.ErrorResponse(c, http.StatusForbidden, err.Error())
+		}
+	}
+
+	role, err := services.UpdateCustomRole(roleID, input)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	// Log activity
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionUpdateRole,
+		models.ResourceRole,
+		role.ID.Hex(),
+		"Updated role: "+role.Name,
+		true,
+		map[string]interface{}{"previous_name": existing.Name, "role": role.Name, "permissions": role.Permissions},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"PUT",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "Role updated successfully", role)
+}
+
+// DeleteRole deletes a custom role. Users holding the role are moved to the
+// role given by ?reassign_to=<role_id>; without it, an assigned role is kept.
+func DeleteRole(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+
+	roleID, err := primitive.ObjectIDFromHex(c.Param("role_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid role ID")
+	}
+
+	// Verify role belongs to company
+	role, err := services.GetRoleByID(roleID)
+	if err != nil || role.CompanyID != companyID {
+		return utils.ErrorResponse(c, http.StatusNotFound, "Role not found")
+	}
+	if role.IsSystem {
+		return utils.ErrorResponse(c, http.StatusForbidden, "Cannot delete system role")
+	}
+
+	var reassignTo *primitive.ObjectID
+	if reassignStr := c.QueryParam("reassign_to"); reassignStr != "" {
+		id, err := primitive.ObjectIDFromHex(reassignStr)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid reassign_to role ID")
+		}
+		reassignTo = &id
+	}
+
+	reassigned, err := services.DeleteRoleAndReassign(roleID, reassignTo)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	metadata := map[string]interface{}{"role": role.Name, "reassigned_users": reassigned}
+	if reassignTo != nil {
+		metadata["reassigned_to"] = reassignTo.Hex()
+	}
+
+	// Log activity
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionDeleteRole,
+		models.ResourceRole,
+		role.ID.Hex(),
+		"Deleted role: "+role.Name,
+		true,
+		metadata,
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"DELETE",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "Role deleted successfully", map[string]interface{}{"reassigned_users": reassigned})
+}
+
 // GetCompanySettings retrieves company settings
 func GetCompanySettings(c echo.Context) error {
 	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
@@ -308,8 +721,10 @@ func GetCompanySettings(c echo.Context) error {
 	}
 
 	return utils.SuccessResponse(c, "Settings retrieved successfully", map[string]interface{}{
-		"company":  company,
-		"settings": company.Settings,
+		"company":       company,
+		"settings":      company.Settings,
+		"llm_providers": services.RegisteredProviders(),
+		"llm_upstreams": services.CircuitStatuses(),
 	})
 }
 
@@ -325,6 +740,33 @@ func UpdateCompanySettings(c echo.Context) error {
 		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
 	}
 
+	if settings.LLMProvider != "" {
+		if _, err := services.GetProvider(settings.LLMProvider); err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "Unknown LLM provider: "+settings.LLMProvider)
+		}
+	}
+	for _, hop := range settings.LLMFallbackChain {
+		if _, _, err := services.ParseRouteSpec(hop); err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid LLM fallback chain entry \""+hop+"\": "+err.Error())
+		}
+	}
+
+	if settings.MonthlyTokenBudget < 0 || settings.MonthlyRequestBudget < 0 ||
+		settings.UserMonthlyTokenBudget < 0 || settings.UserMonthlyRequestBudget < 0 {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Budgets cannot be negative")
+	}
+	for roleName, budget := range settings.RoleMonthlyTokenBudgets {
+		if budget < 0 {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "Budget for role "+roleName+" cannot be negative")
+		}
+	}
+	if settings.BudgetSoftLimitPercent < 0 || settings.BudgetSoftLimitPercent > 100 {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Budget soft limit must be between 0 and 100 percent")
+	}
+	if settings.SessionTimeout < 0 || settings.SessionTimeout > 1440 {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Session timeout must be between 0 and 1440 minutes")
+	}
+
 	err := services.UpdateCompanySettings(companyID, settings)
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update settings")
@@ -403,6 +845,162 @@ func GetCompanyAnalytics(c echo.Context) error {
 	return utils.SuccessResponse(c, "Analytics retrieved successfully", stats)
 }
 
+// GetUsage reports token usage for a date range (from/to as YYYY-MM-DD, UTC,
+// inclusive; default the last 30 days), optionally for a single user.
+func GetUsage(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	to := time.Now().UTC()
+	if toStr := c.QueryParam("to"); toStr != "" {
+		parsed, err := time.Parse(models.UsageDateLayout, toStr)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid 'to' date, expected YYYY-MM-DD")
+		}
+		to = parsed
+	}
+	from := to.AddDate(0, 0, -29)
+	if fromStr := c.QueryParam("from"); fromStr != "" {
+		parsed, err := time.Parse(models.UsageDateLayout, fromStr)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid 'from' date, expected YYYY-MM-DD")
+		}
+		from = parsed
+	}
+	if from.After(to) {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "'from' must not be after 'to'")
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Date range cannot exceed one year")
+	}
+
+	var userID *primitive.ObjectID
+	if userIDStr := c.QueryParam("user_id"); userIDStr != "" {
+		uid, err := primitive.ObjectIDFromHex(userIDStr)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+		}
+		userID = &uid
+	}
+
+	report, err := services.GetUsageReport(companyID, from.Format(models.UsageDateLayout), to.Format(models.UsageDateLayout), userID)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve usage")
+	}
+
+	return utils.SuccessResponse(c, "Usage retrieved successfully", report)
+}
+
+// GetBudgetOverrides lists the company's budget overrides
+func GetBudgetOverrides(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	includeExpired := c.QueryParam("include_expired") == "true"
+	overrides, err := services.GetBudgetOverrides(companyID, includeExpired)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve budget overrides")
+	}
+
+	return utils.SuccessResponse(c, "Budget overrides retrieved successfully", overrides)
+}
+
+// CreateBudgetOverride grants a temporary increase to a company or user budget
+func CreateBudgetOverride(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+
+	var input services.BudgetOverrideInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	override, err := services.CreateBudgetOverride(companyID, adminID, input)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionGrantOverride,
+		models.ResourceBudget,
+		override.ID.Hex(),
+		"Granted budget override: "+override.Reason,
+		true,
+		map[string]interface{}{
+			"user_id":        input.UserID,
+			"extra_tokens":   override.ExtraTokens,
+			"extra_requests": override.ExtraRequests,
+			"unlimited":      override.Unlimited,
+			"expires_at":     override.ExpiresAt,
+		},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"POST",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "Budget override granted successfully", override)
+}
+
+// DeleteBudgetOverride revokes a budget override
+func DeleteBudgetOverride(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+
+	overrideID, err := primitive.ObjectIDFromHex(c.Param("override_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid override ID")
+	}
+
+	if err := services.DeleteBudgetOverride(overrideID, companyID); err != nil {
+		return utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+	}
+
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionRevokeOverride,
+		models.ResourceBudget,
+		overrideID.Hex(),
+		"Revoked budget override",
+		true,
+		nil,
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"DELETE",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "Budget override revoked successfully", nil)
+}
+
 // ========== SUPER ADMIN COMPANY MANAGEMENT ==========
 
 // CreateCompanyBySuperAdmin creates a new company (super admin only)
@@ -509,6 +1107,28 @@ func UpdateCompanyBySuperAdmin(c echo.Context) error {
 	delete(updates, "_id")
 	delete(updates, "created_at")
 
+	if status, ok := updates["subscription_status"]; ok {
+		if s, _ := status.(string); !models.IsValidSubscriptionStatus(s) {
+			return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid subscription status")
+		}
+	}
+
+	// A tier change resets seats and quotas to the tier defaults; an explicit
+	// max_users in the same request still wins. Edit forms send the tier with
+	// every save, so an unchanged tier leaves the overrides alone.
+	if tier, ok := updates["subscription_tier"]; ok {
+		company, err := services.GetCompanyByID(companyID)
+		if err != nil {
+			return utils.ErrorResponse(c, http.StatusNotFound, "Company not found")
+		}
+		tierName, _ := tier.(string)
+		if tierName != company.SubscriptionTier {
+			if err := services.ChangeSubscriptionTier(companyID, tierName); err != nil {
+				return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+			}
+		}
+	}
+
 	err = services.UpdateCompany(companyID, updates)
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
@@ -2,9 +2,13 @@ package controllers
 
 import (
 	"chatgpt-clone/backend/middleware"
+	"chatgpt-clone/backend/models"
 	"chatgpt-clone/backend/services"
 	"chatgpt-clone/backend/utils"
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -19,7 +23,39 @@ func Register(c echo.Context) error {
 		"Public registration is not allowed. Please contact your company administrator to create an account, or register your company at /api/companies/register")
 }
 
-// Login handles user login and returns a JWT.
+// Cookie names. The refresh cookie is only sent to the auth endpoints.
+const (
+	accessTokenCookie  = "token"
+	refreshTokenCookie = "refresh_token"
+	refreshCookiePath  = "/api/auth"
+)
+
+// setAuthCookie sets a secure, HttpOnly cookie.
+func setAuthCookie(c echo.Context, name, value, path string, expires time.Time) {
+	cookie := new(http.Cookie)
+	cookie.Name = name
+	cookie.Value = value
+	cookie.Expires = expires
+	cookie.Path = path
+	cookie.HttpOnly = true
+	cookie.Secure = true
+	cookie.SameSite = http.SameSiteNoneMode
+	c.SetCookie(cookie)
+}
+
+// setAuthCookies hands the access and refresh tokens to the client.
+func setAuthCookies(c echo.Context, tokens *services.AuthTokens) {
+	setAuthCookie(c, accessTokenCookie, tokens.AccessToken, "/", tokens.AccessExpiresAt)
+	setAuthCookie(c, refreshTokenCookie, tokens.RefreshToken, refreshCookiePath, tokens.RefreshExpiresAt)
+}
+
+// clearAuthCookies "deletes" both cookies by expiring them.
+func clearAuthCookies(c echo.Context) {
+	setAuthCookie(c, accessTokenCookie, "", "/", time.Unix(0, 0))
+	setAuthCookie(c, refreshTokenCookie, "", refreshCookiePath, time.Unix(0, 0))
+}
+
+// Login handles user login and sets the access and refresh token cookies.
 func Login(c echo.Context) error {
 	var input services.LoginUserInput
 	if err := c.Bind(&input); err != nil {
@@ -30,28 +66,56 @@ func Login(c echo.Context) error {
 	}
 
 	// Use multi-tenant login
-	token, user, err := services.MultiTenantLoginUser(input, c.RealIP())
+	tokens, user, err := services.MultiTenantLoginUser(input, c.RealIP(), c.Request().UserAgent())
 	if err != nil {
+		var lockedErr *services.LoginLockedError
+		if errors.As(err, &lockedErr) {
+			c.Response().Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(time.Until(lockedErr.Until).Seconds()))))
+			return utils.ErrorResponse(c, http.StatusTooManyRequests, err.Error())
+		}
 		return utils.ErrorResponse(c, http.StatusUnauthorized, err.Error())
 	}
 
-	// Set the token in a secure, HttpOnly cookie
-	cookie := new(http.Cookie)
-	cookie.Name = "token"
-	cookie.Value = token
-	cookie.Expires = time.Now().Add(72 * time.Hour)
-	cookie.Path = "/"
-	cookie.HttpOnly = true
-	cookie.Secure = true
-	cookie.SameSite = http.SameSiteNoneMode
-	c.SetCookie(cookie)
+	setAuthCookies(c, tokens)
 
 	// Return user info without password
 	user.Password = ""
 	return utils.SuccessResponse(c, "Login successful", map[string]interface{}{
-		"user":    user,
-		"company": user.CompanyID.Hex(),
-		"role":    user.RoleName,
+		"user":       user,
+		"company":    user.CompanyID.Hex(),
+		"role":       user.RoleName,
+		"expires_at": tokens.AccessExpiresAt,
+	})
+}
+
+// RefreshToken exchanges the refresh token cookie for a new access token and
+// a new refresh token. A reused refresh token revokes the session.
+func RefreshToken(c echo.Context) error {
+	cookie, err := c.Cookie(refreshTokenCookie)
+	if err != nil || cookie.Value == "" {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Missing refresh token")
+	}
+
+	tokens, user, err := services.RefreshAccessToken(cookie.Value, c.RealIP(), c.Request().UserAgent())
+	if err != nil {
+		// Another tab refreshed with the same cookie first. Its response
+		// carries the new cookies, so leave them alone and let the client
+		// retry with what it holds now.
+		if errors.Is(err, services.ErrRefreshRaced) {
+			return utils.ErrorResponse(c, http.StatusConflict, err.Error())
+		}
+		if errors.Is(err, services.ErrSessionInvalid) || errors.Is(err, services.ErrRefreshTokenReused) {
+			clearAuthCookies(c)
+			return utils.ErrorResponse(c, http.StatusUnauthorized, err.Error())
+		}
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to refresh session")
+	}
+
+	setAuthCookies(c, tokens)
+
+	return utils.SuccessResponse(c, "Session refreshed", map[string]interface{}{
+		"role":       user.RoleName,
+		"expires_at": tokens.AccessExpiresAt,
 	})
 }
 
@@ -68,24 +132,30 @@ func GetCurrentUser(c echo.Context) error {
 		return utils.ErrorResponse(c, http.StatusNotFound, "User not found")
 	}
 
+	// Report the permissions actually in effect, not the stored copy
+	if permissions, ok := c.Request().Context().Value(middleware.PermissionsKey).([]string); ok {
+		user.Permissions = permissions
+	}
+	if roleName, ok := c.Request().Context().Value(middleware.RoleNameKey).(string); ok && roleName != "" {
+		user.RoleName = roleName
+	}
+
 	// Do not return password
 	user.Password = ""
 
 	return utils.SuccessResponse(c, "User profile fetched successfully", user)
 }
 
-// Logout is a placeholder for session/token invalidation logic.
+// Logout revokes the current session and clears the auth cookies.
 func Logout(c echo.Context) error {
-	// --- CHANGE IS HERE ---
-	// To "delete" a cookie, we set it again but with an expiration date in the past.
-	cookie := new(http.Cookie)
-	cookie.Name = "token"
-	cookie.Value = ""
-	cookie.Expires = time.Unix(0, 0) // Set to a past time
-	cookie.Path = "/"
-	cookie.HttpOnly = true
-	c.SetCookie(cookie)
-	// --- END OF CHANGE ---
+	// Revoke the server-side session so a copied token stops working too
+	if jti, ok := c.Request().Context().Value(middleware.SessionIDKey).(string); ok {
+		if err := services.RevokeSessionByJTI(jti, models.SessionRevokedLogout); err != nil {
+			c.Logger().Error("Failed to revoke session on logout:", err)
+		}
+	}
+
+	clearAuthCookies(c)
 
 	return utils.SuccessResponse(c, "Logged out successfully", nil)
 }
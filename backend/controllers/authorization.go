@@ -0,0 +1,60 @@
+package controllers
+
+import (
+	"chatgpt-clone/backend/middleware"
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/services"
+	"chatgpt-clone/backend/utils"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// currentActor builds the services.Actor for the authenticated user from the
+// values AuthMiddleware put in the request context.
+func currentActor(c echo.Context) services.Actor {
+	ctx := c.Request().Context()
+	actor := services.Actor{}
+	actor.UserID, _ = ctx.Value(middleware.UserIDKey).(primitive.ObjectID)
+	actor.CompanyID, _ = ctx.Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	actor.RoleName, _ = ctx.Value(middleware.RoleNameKey).(string)
+	actor.Permissions, _ = ctx.Value(middleware.PermissionsKey).([]string)
+	actor.IsSuperAdmin, _ = ctx.Value(middleware.IsSuperAdminKey).(bool)
+	return actor
+}
+
+// authorizationErrorResponse maps services.Authorize* errors to responses.
+func authorizationErrorResponse(c echo.Context, err error, resource string) error {
+	switch {
+	case errors.Is(err, services.ErrResourceNotFound):
+		return utils.ErrorResponse(c, http.StatusNotFound, resource+" not found")
+	case errors.Is(err, services.ErrAccessDenied):
+		return utils.ErrorResponse(c, http.StatusForbidden, "Unauthorized to access this "+resource)
+	}
+	return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to load "+resource)
+}
+
+// auditChatAccess records access to someone else's chat in the activity log.
+func auditChatAccess(c echo.Context, actor services.Actor, chat *models.Chat, basis services.AccessBasis, action string) {
+	if basis == services.AccessAsOwner {
+		return
+	}
+	services.LogActivity(
+		actor.CompanyID,
+		actor.UserID,
+		action,
+		models.ResourceChat,
+		chat.ID.Hex(),
+		"Accessed another user's chat as "+string(basis),
+		true,
+		map[string]interface{}{"chat_owner_id": chat.UserID.Hex(), "chat_company_id": chat.CompanyID.Hex(), "basis": string(basis)},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		c.Request().Method,
+		c.Path(),
+		200,
+		"",
+	)
+}
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"chatgpt-clone/backend/config"
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/services"
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// handlerFixture is a chat with one message and a department-restricted
+// document of company A, and actors inside and outside it
+type handlerFixture struct {
+	chatID, messageID, docID       primitive.ObjectID
+	owner, colleague, otherCompany services.Actor
+}
+
+func newHandlerFixture(t *testing.T) handlerFixture {
+	t.Helper()
+	setupTestDB(t)
+
+	companyA, companyB := primitive.NewObjectID(), primitive.NewObjectID()
+	now := primitive.NewDateTimeFromTime(time.Now())
+	f := handlerFixture{
+		chatID:       primitive.NewObjectID(),
+		messageID:    primitive.NewObjectID(),
+		docID:        primitive.NewObjectID(),
+		owner:        services.Actor{UserID: primitive.NewObjectID(), CompanyID: companyA, RoleName: models.RoleEmployee},
+		colleague:    services.Actor{UserID: primitive.NewObjectID(), CompanyID: companyA, RoleName: models.RoleEmployee},
+		otherCompany: services.Actor{UserID: primitive.NewObjectID(), CompanyID: companyB, RoleName: models.RoleCompanyAdmin},
+	}
+
+	mustInsert(t, "users",
+		models.User{ID: f.owner.UserID, CompanyID: companyA, Email: "owner@a.test", RoleName: models.RoleEmployee, IsActive: true, Department: "Finance"},
+		models.User{ID: f.colleague.UserID, CompanyID: companyA, Email: "colleague@a.test", RoleName: models.RoleEmployee, IsActive: true, Department: "Sales"},
+	)
+	mustInsert(t, "chats", models.Chat{ID: f.chatID, CompanyID: companyA, UserID: f.owner.UserID, Title: "Mine", CreatedAt: now, UpdatedAt: now})
+	mustInsert(t, "messages", models.Message{ID: f.messageID, ChatID: f.chatID, Role: "user", Content: "hello", Timestamp: now})
+	mustInsert(t, "knowledge_base_documents", models.KnowledgeBaseDocument{
+		ID:         f.docID,
+		CompanyID:  companyA,
+		LogicalID:  f.docID,
+		Version:    1,
+		IsCurrent:  true,
+		UploadedBy: f.owner.UserID,
+		Filename:   "budget.txt",
+		Status:     models.KBStatusSynced,
+		ACL:        &models.DocumentACL{Departments: []string{"Finance"}},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+	return f
+}
+
+func TestGetMessagesAuthorization(t *testing.T) {
+	f := newHandlerFixture(t)
+	tests := []struct {
+		name     string
+		actor    services.Actor
+		wantCode int
+	}{
+		{"owner", f.owner, http.StatusOK},
+		{"colleague", f.colleague, http.StatusForbidden},
+		{"other company", f.otherCompany, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newActorContext(http.MethodGet, tt.actor, map[string]string{"chat_id": f.chatID.Hex()})
+			if err := GetMessages(c); err != nil {
+				t.Fatalf("handler error: %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantCode, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestDeleteMessageAuthorization(t *testing.T) {
+	f := newHandlerFixture(t)
+	tests := []struct {
+		name     string
+		actor    services.Actor
+		wantCode int
+	}{
+		{"colleague", f.colleague, http.StatusForbidden},
+		{"other company", f.otherCompany, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newActorContext(http.MethodDelete, tt.actor, map[string]string{"message_id": f.messageID.Hex()})
+			if err := DeleteMessage(c); err != nil {
+				t.Fatalf("handler error: %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			count, err := config.GetCollection("messages").CountDocuments(context.Background(), bson.M{"_id": f.messageID})
+			if err != nil || count != 1 {
+				t.Fatalf("message was deleted (count %d, err %v)", count, err)
+			}
+		})
+	}
+}
+
+func TestGetKnowledgeBaseDocumentContentAuthorization(t *testing.T) {
+	f := newHandlerFixture(t)
+	tests := []struct {
+		name     string
+		actor    services.Actor
+		wantCode int
+	}{
+		{"uploader", f.owner, http.StatusOK},
+		{"colleague outside the ACL", f.colleague, http.StatusNotFound},
+		{"other company", f.otherCompany, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newActorContext(http.MethodGet, tt.actor, map[string]string{"doc_id": f.docID.Hex()})
+			if err := GetKnowledgeBaseDocumentContent(c); err != nil {
+				t.Fatalf("handler error: %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantCode, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestGetTeamChatMessagesAuthorization(t *testing.T) {
+	f := newHandlerFixture(t)
+	manager := services.Actor{UserID: primitive.NewObjectID(), CompanyID: f.owner.CompanyID, RoleName: models.RoleManager,
+		Permissions: []string{models.PermissionManageTeamChats}}
+	otherManager := manager
+	otherManager.UserID = primitive.NewObjectID()
+	mustInsert(t, "teams", models.Team{ID: primitive.NewObjectID(), CompanyID: f.owner.CompanyID, Name: "Finance",
+		ManagerIDs: []primitive.ObjectID{manager.UserID}, MemberIDs: []primitive.ObjectID{f.owner.UserID}})
+
+	tests := []struct {
+		name      string
+		actor     services.Actor
+		wantCode  int
+		wantAudit bool
+	}{
+		{"manager of the owner's team", manager, http.StatusOK, true},
+		{"manager of another team", otherManager, http.StatusForbidden, false},
+		{"other company", f.otherCompany, http.StatusNotFound, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, rec := newActorContext(http.MethodGet, tt.actor, map[string]string{"chat_id": f.chatID.Hex()})
+			if err := GetTeamChatMessages(c); err != nil {
+				t.Fatalf("handler error: %v", err)
+			}
+			if rec.Code != tt.wantCode {
+				t.Fatalf("status = %d, want %d (%s)", rec.Code, tt.wantCode, rec.Body.String())
+			}
+			audits, err := config.GetCollection("activity_logs").CountDocuments(context.Background(), bson.M{
+				"user_id": tt.actor.UserID, "action": models.ActionViewTeamChat, "resource_id": f.chatID.Hex(),
+			})
+			if err != nil || (audits == 1) != tt.wantAudit {
+				t.Fatalf("%d audit entries (err %v), want audited %v", audits, err, tt.wantAudit)
+			}
+		})
+	}
+}
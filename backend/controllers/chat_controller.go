@@ -5,6 +5,7 @@ import (
 	"chatgpt-clone/backend/models"
 	"chatgpt-clone/backend/services"
 	"chatgpt-clone/backend/utils"
+	"errors"
 	"net/http"
 	"time"
 
@@ -38,6 +39,10 @@ func CreateChat(c echo.Context) error {
 		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
 	}
 
+	if err := services.CheckChatQuota(companyID, userID); err != nil {
+		return quotaErrorResponse(c, err)
+	}
+
 	title := input.Title
 	if title == "" {
 		title = "New Chat" // A clean default title
@@ -64,31 +69,62 @@ func GetChats(c echo.Context) error {
 	return utils.SuccessResponse(c, "Chats fetched successfully", chats)
 }
 
-// CreateMessage sends a message, gets a response from Gemini, and saves both.
-// It also handles setting the chat title from the first message.
-func CreateMessage(c echo.Context) error {
-	startTime := time.Now() // Track response time
-	companyID := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+// quotaErrorResponse answers a failed quota check. Quota violations carry their
+// own status plus the limit and current usage; anything else is a lookup failure.
+func quotaErrorResponse(c echo.Context, err error) error {
+	var quotaErr *services.QuotaError
+	if errors.As(err, &quotaErr) {
+		return utils.ErrorResponseWithData(c, quotaErr.Status, quotaErr.Message, quotaErr)
+	}
+	c.Logger().Error("Quota check failed:", err)
+	return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check company quota")
+}
 
-	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+// checkBudget enforces the monthly token and request budgets before a message
+// is answered. Soft-limit warnings are returned in the X-Budget-Warning header
+// and recorded in the activity log.
+func checkBudget(c echo.Context, companyID, userID primitive.ObjectID) error {
+	status, err := services.CheckBudget(companyID, userID)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chat ID")
+		var quotaErr *services.QuotaError
+		if errors.As(err, &quotaErr) {
+			go services.LogActivity(
+				companyID,
+				userID,
+				models.ActionBudgetExceeded,
+				models.ResourceBudget,
+				"",
+				quotaErr.Message,
+				false,
+				map[string]interface{}{"code": quotaErr.Code, "limit": quotaErr.Limit, "used": quotaErr.Current},
+				c.RealIP(),
+				c.Request().UserAgent(),
+				c.Request().Method,
+				c.Path(),
+				quotaErr.Status,
+				quotaErr.Code,
+			)
+		}
+		return err
 	}
 
-	var input CreateMessageInput
-	if err := c.Bind(&input); err != nil {
-		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
-	}
-	if err := c.Validate(&input); err != nil {
-		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	if len(status.Warnings) > 0 {
+		c.Response().Header().Set("X-Budget-Warning", status.WarningHeader())
+		go services.LogBudgetWarnings(companyID, userID, status, c.RealIP(), c.Request().UserAgent(), c.Request().Method, c.Path())
 	}
+	return nil
+}
 
+// saveUserMessage filters the user's input, sets the chat title from the first
+// message and persists the user's message. It is shared by CreateMessage and
+// CreateMessageStream.
+func saveUserMessage(c echo.Context, chatID, companyID primitive.ObjectID, content string) (*models.Message, error) {
 	// Filter profanity from user input
-	filteredContent, hasProfanity := services.FilterProfanity(input.Content)
+	filteredContent, hasProfanity := services.FilterProfanity(content)
 	if hasProfanity {
 		c.Logger().Warn("Profanity detected and filtered in message")
 	}
-	input.Content = filteredContent
+	content = filteredContent
 
 	// Check if this is the first message to set the chat title.
 	messageCount, err := services.CountMessagesInChat(chatID)
@@ -97,12 +133,14 @@ func CreateMessage(c echo.Context) error {
 		// Don't block the request; sending the message is more important.
 	}
 
-	if messageCount == 0 && input.Content != "" {
+	if messageCount == 0 && content != "" {
 		const maxTitleLength = 50
-		title := input.Content
+		title := content
 		if len(title) > maxTitleLength {
 			// Safely truncate to handle multi-byte characters
-			title = string([]rune(title)[:maxTitleLength])
+			if runes := []rune(title); len(runes) > maxTitleLength {
+				title = string(runes[:maxTitleLength])
+			}
 		}
 
 		err := services.UpdateChatTitle(chatID, companyID, title)
@@ -112,53 +150,211 @@ func CreateMessage(c echo.Context) error {
 		}
 	}
 
-	// 1. Save the user's message
 	userMessage := &models.Message{
 		ID:        primitive.NewObjectID(),
 		ChatID:    chatID,
 		Role:      "user",
-		Content:   input.Content,
+		Content:   content,
 		Timestamp: primitive.NewDateTimeFromTime(time.Now()),
 	}
-	_, err = services.SaveMessage(userMessage)
+	return services.SaveMessage(userMessage)
+}
+
+// CreateMessage sends a message, gets a response from the company's LLM provider, and saves both.
+// It also handles setting the chat title from the first message.
+func CreateMessage(c echo.Context) error {
+	startTime := time.Now() // Track response time
+	userID := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	companyID := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+
+	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chat ID")
+	}
+
+	var input CreateMessageInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	// Only the owner can post to a chat
+	if _, _, err := services.AuthorizeChat(currentActor(c), chatID, services.AccessWrite); err != nil {
+		return authorizationErrorResponse(c, err, "chat")
+	}
+
+	if err := services.CheckMessageQuota(companyID, chatID); err != nil {
+		return quotaErrorResponse(c, err)
+	}
+	if err := checkBudget(c, companyID, userID); err != nil {
+		return quotaErrorResponse(c, err)
+	}
+
+	// 1. Collect prior turns before the new message is stored
+	history, err := services.GetConversationWindow(chatID, companyID)
+	if err != nil {
+		c.Logger().Error("Failed to load conversation history:", err)
+		// Answer without context rather than failing the message.
+	}
+
+	// 2. Save the user's message
+	userMessage, err := saveUserMessage(c, chatID, companyID, input.Content)
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save user message")
 	}
 
-	// 2. Call Python Enterprise Assistant backend (RAG query)
-	queryResult, err := services.QueryEnterpriseAssistant(companyID.Hex(), input.Content, 3)
+	// 3. Ask the company's LLM provider
+	reply, err := services.GenerateAssistantReply(c.Request().Context(), companyID, userID, userMessage.Content, history)
 	if err != nil {
-		c.Logger().Error("Enterprise Assistant query failed:", err)
+		c.Logger().Error("Assistant provider query failed:", err)
 		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to get response from enterprise assistant")
 	}
 
-	aiResponseContent := queryResult.Answer
-
 	// Calculate response time
 	responseTime := time.Since(startTime).Seconds()
 	if responseTime > 5.0 {
 		c.Logger().Warnf("Response time exceeded 5 seconds: %.2fs", responseTime)
 	}
 
-	// 5. Save the AI's response
+	// 4. Save the AI's response
 	aiMessage := &models.Message{
-		ID:           primitive.NewObjectID(),
-		ChatID:       chatID,
-		Role:         "assistant",
-		Content:      aiResponseContent,
-		Timestamp:    primitive.NewDateTimeFromTime(time.Now()),
-		ModelUsed:    "enterprise-assistant-rag",
-		ResponseTime: responseTime,
+		ID:               primitive.NewObjectID(),
+		ChatID:           chatID,
+		Role:             "assistant",
+		Content:          reply.Content,
+		Timestamp:        primitive.NewDateTimeFromTime(time.Now()),
+		TokenCount:       reply.TotalTokens(),
+		PromptTokens:     reply.PromptTokens,
+		CompletionTokens: reply.CompletionTokens,
+		TokensEstimated:  reply.TokensEstimated,
+		ModelUsed:        reply.ModelLabel(),
+		Provider:         reply.Provider,
+		FallbackHop:      reply.FallbackHop,
+		ResponseTime:     responseTime,
+	}
+	if err := services.RecordUsage(companyID, userID, reply); err != nil {
+		c.Logger().Error("Failed to record token usage:", err)
 	}
 	savedAIMessage, err := services.SaveMessage(aiMessage)
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save AI response")
 	}
 
-	// 6. Return the new AI message to the frontend
+	// 5. Return the new AI message to the frontend
 	return utils.SuccessResponse(c, "Message processed successfully", savedAIMessage)
 }
 
+// CreateMessageStream is the Server-Sent Events variant of CreateMessage.
+// It emits a "user_message" event once the user's message is stored, a "chunk"
+// event for every fragment of the answer, and a final "done" event carrying the
+// saved assistant message. The assistant message is only persisted once the
+// stream completes, or with the partial answer if the client disconnects.
+func CreateMessageStream(c echo.Context) error {
+	startTime := time.Now()
+	userID := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	companyID := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+
+	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chat ID")
+	}
+
+	var input CreateMessageInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	// Only the owner can post to a chat
+	if _, _, err := services.AuthorizeChat(currentActor(c), chatID, services.AccessWrite); err != nil {
+		return authorizationErrorResponse(c, err, "chat")
+	}
+
+	if err := services.CheckMessageQuota(companyID, chatID); err != nil {
+		return quotaErrorResponse(c, err)
+	}
+	if err := checkBudget(c, companyID, userID); err != nil {
+		return quotaErrorResponse(c, err)
+	}
+
+	history, err := services.GetConversationWindow(chatID, companyID)
+	if err != nil {
+		c.Logger().Error("Failed to load conversation history:", err)
+	}
+
+	userMessage, err := saveUserMessage(c, chatID, companyID, input.Content)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save user message")
+	}
+
+	// From here on the response is an event stream; errors are sent as events.
+	stream := utils.NewSSEStream(c)
+	if err := stream.Send("user_message", userMessage); err != nil {
+		return nil
+	}
+
+	ctx := c.Request().Context()
+	reply, streamErr := services.StreamAssistantReply(ctx, companyID, userID, userMessage.Content, history, func(chunk string) error {
+		return stream.Send("chunk", map[string]string{"content": chunk})
+	})
+
+	cancelled := ctx.Err() != nil
+	if streamErr != nil && !cancelled {
+		c.Logger().Error("Assistant stream failed:", streamErr)
+		// The chunks streamed before the failure were generated all the same
+		if reply != nil && reply.Content != "" {
+			if err := services.RecordUsage(companyID, userID, reply); err != nil {
+				c.Logger().Error("Failed to record token usage:", err)
+			}
+		}
+		stream.Send("error", map[string]string{"message": "Failed to get response from assistant"})
+		return nil
+	}
+	if cancelled && (reply == nil || reply.Content == "") {
+		return nil
+	}
+
+	responseTime := time.Since(startTime).Seconds()
+	aiMessage := &models.Message{
+		ID:               primitive.NewObjectID(),
+		ChatID:           chatID,
+		Role:             "assistant",
+		Content:          reply.Content,
+		Timestamp:        primitive.NewDateTimeFromTime(time.Now()),
+		TokenCount:       reply.TotalTokens(),
+		PromptTokens:     reply.PromptTokens,
+		CompletionTokens: reply.CompletionTokens,
+		TokensEstimated:  reply.TokensEstimated,
+		ModelUsed:        reply.ModelLabel(),
+		Provider:         reply.Provider,
+		FallbackHop:      reply.FallbackHop,
+		ResponseTime:     responseTime,
+	}
+	if err := services.RecordUsage(companyID, userID, reply); err != nil {
+		c.Logger().Error("Failed to record token usage:", err)
+	}
+	savedAIMessage, err := services.SaveMessage(aiMessage)
+	if err != nil {
+		c.Logger().Error("Failed to save streamed AI response:", err)
+		if !cancelled {
+			stream.Send("error", map[string]string{"message": "Failed to save AI response"})
+		}
+		return nil
+	}
+
+	if cancelled {
+		c.Logger().Warnf("Client disconnected; saved partial assistant reply for chat %s", chatID.Hex())
+		return nil
+	}
+
+	stream.Send("done", savedAIMessage)
+	return nil
+}
+
 // GetMessages retrieves all messages for a specific chat.
 func GetMessages(c echo.Context) error {
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
@@ -166,6 +362,13 @@ func GetMessages(c echo.Context) error {
 		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chat ID")
 	}
 
+	actor := currentActor(c)
+	chat, basis, err := services.AuthorizeChat(actor, chatID, services.AccessRead)
+	if err != nil {
+		return authorizationErrorResponse(c, err, "chat")
+	}
+	auditChatAccess(c, actor, chat, basis, models.ActionViewChat)
+
 	messages, err := services.GetChatMessages(chatID)
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch messages")
@@ -176,28 +379,23 @@ func GetMessages(c echo.Context) error {
 
 // GetChatByID retrieves a specific chat by its ID after verifying ownership.
 func GetChatByID(c echo.Context) error {
-	userID := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
-	companyID := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chat ID")
 	}
 
-	chat, err := services.GetChatByID(chatID, companyID)
+	actor := currentActor(c)
+	chat, basis, err := services.AuthorizeChat(actor, chatID, services.AccessRead)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusNotFound, "Chat not found")
-	}
-
-	if chat.UserID != userID {
-		return utils.ErrorResponse(c, http.StatusForbidden, "Unauthorized to access this chat")
+		return authorizationErrorResponse(c, err, "chat")
 	}
+	auditChatAccess(c, actor, chat, basis, models.ActionViewChat)
 
 	return utils.SuccessResponse(c, "Chat fetched successfully", chat)
 }
 
 // UpdateChat handles manually renaming a chat.
 func UpdateChat(c echo.Context) error {
-	userID := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
 	companyID := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
@@ -212,13 +410,9 @@ func UpdateChat(c echo.Context) error {
 		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
 	}
 
-	// Security check: Verify the chat belongs to the current user before updating.
-	chat, err := services.GetChatByID(chatID, companyID)
-	if err != nil {
-		return utils.ErrorResponse(c, http.StatusNotFound, "Chat not found")
-	}
-	if chat.UserID != userID {
-		return utils.ErrorResponse(c, http.StatusForbidden, "Unauthorized to update this chat")
+	// Security check: only the owner can rename a chat
+	if _, _, err := services.AuthorizeChat(currentActor(c), chatID, services.AccessWrite); err != nil {
+		return authorizationErrorResponse(c, err, "chat")
 	}
 
 	if err := services.UpdateChatTitle(chatID, companyID, input.Title); err != nil {
@@ -230,23 +424,20 @@ func UpdateChat(c echo.Context) error {
 
 // DeleteChat handles manually deleting a chat.
 func DeleteChat(c echo.Context) error {
-	userID := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
-	companyID := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chat ID")
 	}
 
-	// Security check: Verify the chat belongs to the current user before deleting.
-	chat, err := services.GetChatByID(chatID, companyID)
+	// Security check: the owner or an admin can delete a chat
+	actor := currentActor(c)
+	chat, basis, err := services.AuthorizeChat(actor, chatID, services.AccessDelete)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusNotFound, "Chat not found")
-	}
-	if chat.UserID != userID {
-		return utils.ErrorResponse(c, http.StatusForbidden, "Unauthorized to delete this chat")
+		return authorizationErrorResponse(c, err, "chat")
 	}
+	auditChatAccess(c, actor, chat, basis, models.ActionDeleteChat)
 
-	if err := services.DeleteChat(chatID, companyID); err != nil {
+	if err := services.DeleteChat(chatID, chat.CompanyID); err != nil {
 		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to delete chat")
 	}
 
@@ -255,21 +446,18 @@ func DeleteChat(c echo.Context) error {
 
 // CleanupChat handles the request to check and potentially delete an empty chat.
 func CleanupChat(c echo.Context) error {
-	userID := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
-	companyID := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
 	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chat ID")
 	}
 
 	// Security check: Verify ownership before cleaning up.
-	chat, err := services.GetChatByID(chatID, companyID)
-	if err != nil {
-		// If chat not found, it might have already been deleted, which is fine.
-		return utils.SuccessResponse(c, "Chat not found, assumed cleaned up", nil)
-	}
-	if chat.UserID != userID {
-		return utils.ErrorResponse(c, http.StatusForbidden, "Unauthorized to clean up this chat")
+	if _, _, err := services.AuthorizeChat(currentActor(c), chatID, services.AccessWrite); err != nil {
+		if errors.Is(err, services.ErrResourceNotFound) {
+			// If chat not found, it might have already been deleted, which is fine.
+			return utils.SuccessResponse(c, "Chat not found, assumed cleaned up", nil)
+		}
+		return authorizationErrorResponse(c, err, "chat")
 	}
 
 	if err := services.CleanupEmptyChat(chatID); err != nil {
@@ -282,14 +470,20 @@ func CleanupChat(c echo.Context) error {
 
 // DeleteMessage deletes a specific message by its ID.
 func DeleteMessage(c echo.Context) error {
-	companyID := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
-
 	messageID, err := primitive.ObjectIDFromHex(c.Param("message_id"))
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid message ID")
 	}
 
-	if err := services.DeleteMessageByID(messageID, companyID); err != nil {
+	// Security check: same rules as deleting the chat it belongs to
+	actor := currentActor(c)
+	_, chat, basis, err := services.AuthorizeMessage(actor, messageID, services.AccessDelete)
+	if err != nil {
+		return authorizationErrorResponse(c, err, "message")
+	}
+	auditChatAccess(c, actor, chat, basis, models.ActionDeleteMessage)
+
+	if err := services.DeleteMessageByID(messageID, chat.CompanyID); err != nil {
 		return utils.ErrorResponse(c, http.StatusNotFound, "Message not found or access denied")
 	}
 
@@ -5,230 +5,530 @@ import (
 	"chatgpt-clone/backend/models"
 	"chatgpt-clone/backend/services"
 	"chatgpt-clone/backend/utils"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime/multipart"
 	"net/http"
+	"strconv"
 	"strings"
-	"time"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ProcessDocumentInput struct {
 	Action string `json:"action"` // "extract"
 }
 
-type documentProcessResult struct {
-	Text string
-	Err  error
-}
+// UploadAndProcessDocument queues a document attached to a chat. An
+// ingestion worker extracts it, posts it to the chat and answers with a
+// summary; the client follows the returned job.
+func UploadAndProcessDocument(c echo.Context) error {
+	userID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user context")
+	}
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid company context")
+	}
+
+	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chat ID")
+	}
 
-func processDocumentInGoroutine(documentData []byte, mimeType string) (string, error) {
-	resultChan := make(chan documentProcessResult, 1)
+	// Only the owner can upload into a chat
+	if _, _, err := services.AuthorizeChat(currentActor(c), chatID, services.AccessWrite); err != nil {
+		return authorizationErrorResponse(c, err, "chat")
+	}
+
+	// Validate against the company's upload policy and message quota
+	upload, err := readUploadedDocument(c, companyID)
+	if err != nil {
+		return uploadedDocumentErrorResponse(c, err)
+	}
 
-	go func() {
-		processedText, processErr := services.ProcessDocument(documentData, mimeType, "extract")
-		resultChan <- documentProcessResult{Text: strings.TrimSpace(processedText), Err: processErr}
-	}()
+	// The same file is posted to a chat once
+	message, err := services.FindChatAttachmentMessage(chatID, services.ContentHash(upload.Data))
+	if err == nil {
+		return utils.SuccessResponse(c, "Document already uploaded to this chat", map[string]interface{}{
+			"duplicate": true,
+			"message":   message,
+		})
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check for duplicate documents")
+	}
 
-	select {
-	case processResult := <-resultChan:
-		return processResult.Text, processResult.Err
-	case <-time.After(60 * time.Second):
-		return "", fmt.Errorf("document processing timed out")
+	if err := services.CheckMessageQuota(companyID, chatID); err != nil {
+		return quotaErrorResponse(c, err)
 	}
+
+	job, err := services.EnqueueIngestionJob(services.IngestionJobInput{
+		CompanyID: companyID,
+		UserID:    userID,
+		Kind:      models.JobKindChatDocument,
+		Filename:  upload.Header.Filename,
+		MimeType:  upload.MimeType,
+		ChatID:    &chatID,
+		Origin:    requestOrigin(c),
+	}, upload.Data)
+	if err != nil {
+		c.Logger().Error("Failed to queue document:", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to queue document")
+	}
+
+	return utils.AcceptedResponse(c, "Document queued for processing", job)
 }
 
-// UploadAndProcessDocument handles document upload and processing
-func UploadAndProcessDocument(c echo.Context) error {
-	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+// GetKnowledgeBaseDocuments lists the KB documents of the requesting company
+// that the caller may see.
+func GetKnowledgeBaseDocuments(c echo.Context) error {
+	if _, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID); !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid company context")
+	}
+
+	tag := strings.Trim(strings.TrimSpace(c.QueryParam("tag")), "/")
+	docs, err := services.GetKnowledgeBaseDocuments(currentActor(c), tag)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chat ID")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch documents")
 	}
 
-	// Get the uploaded file
-	file, err := c.FormFile("document")
+	return utils.SuccessResponse(c, "Documents fetched successfully", docs)
+}
+
+// GetKnowledgeBaseDocumentContent returns the full extracted text of a single KB document.
+func GetKnowledgeBaseDocumentContent(c echo.Context) error {
+	if _, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID); !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid company context")
+	}
+
+	docID, err := primitive.ObjectIDFromHex(c.Param("doc_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+	}
+
+	doc, _, err := services.AuthorizeDocument(currentActor(c), docID, services.AccessRead)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusBadRequest, "No file uploaded")
+		return authorizationErrorResponse(c, err, "document")
 	}
 
-	// Validate file size (max 10MB)
-	const maxFileSize = 10 * 1024 * 1024
-	if file.Size > maxFileSize {
-		return utils.ErrorResponse(c, http.StatusBadRequest, "File size exceeds 10MB limit")
+	return utils.SuccessResponse(c, "Document content fetched", doc)
+}
+
+// DeleteKnowledgeBaseDocument removes a KB document.
+func DeleteKnowledgeBaseDocument(c echo.Context) error {
+	if _, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID); !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid company context")
 	}
 
-	// Open the file
-	src, err := file.Open()
+	docID, err := primitive.ObjectIDFromHex(c.Param("doc_id"))
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to read file")
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
 	}
-	defer src.Close()
 
-	// Read file data
-	fileData, err := io.ReadAll(src)
+	doc, _, err := services.AuthorizeDocument(currentActor(c), docID, services.AccessDelete)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to read file data")
+		return authorizationErrorResponse(c, err, "document")
 	}
 
-	// Determine MIME type
-	mimeType := file.Header.Get("Content-Type")
-	if mimeType == "" {
-		mimeType = "application/octet-stream"
+	tombstoned, err := services.DeleteKnowledgeBaseDocument(docID, doc.CompanyID)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusNotFound, "Document not found or already deleted")
 	}
 
-	extractedText, err := processDocumentInGoroutine(fileData, mimeType)
+	if tombstoned {
+		return utils.SuccessResponse(c, "Document deleted; removal from the enterprise assistant index is pending", map[string]interface{}{
+			"sync_status": models.KBStatusPendingDelete,
+		})
+	}
+	return utils.SuccessResponse(c, "Document deleted successfully", nil)
+}
+
+// ReplaceKnowledgeBaseDocument queues an upload as the new version of a KB
+// document. The previous version is kept in the history and removed from the
+// enterprise assistant index.
+func ReplaceKnowledgeBaseDocument(c echo.Context) error {
+	actor := currentActor(c)
+
+	docID, err := primitive.ObjectIDFromHex(c.Param("doc_id"))
 	if err != nil {
-		c.Logger().Error("Document processing failed:", err)
-		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to process document")
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
 	}
 
-	// Create attachment record (stores raw text internally, not shown to user)
-	attachment := models.Attachment{
-		ID:            primitive.NewObjectID(),
-		Filename:      file.Filename,
-		MimeType:      mimeType,
-		Size:          file.Size,
-		UploadedAt:    primitive.NewDateTimeFromTime(time.Now()),
-		ProcessedData: extractedText,
+	doc, _, err := services.AuthorizeDocument(actor, docID, services.AccessWrite)
+	if err != nil {
+		return authorizationErrorResponse(c, err, "document")
 	}
 
-	// Save user message with attachment
-	userMessage := &models.Message{
-		ID:          primitive.NewObjectID(),
-		ChatID:      chatID,
-		Role:        "user",
-		Content:     fmt.Sprintf("Uploaded document: %s", file.Filename),
-		Timestamp:   primitive.NewDateTimeFromTime(time.Now()),
-		Attachments: []models.Attachment{attachment},
+	upload, err := readUploadedDocument(c, doc.CompanyID)
+	if err != nil {
+		return uploadedDocumentErrorResponse(c, err)
 	}
-	_, err = services.SaveMessage(userMessage)
+
+	existing, err := duplicateKnowledgeBaseDocument(doc.CompanyID, upload.Data)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save message")
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check for duplicate documents")
+	}
+	if existing != nil && existing.LogicalID != doc.LogicalID {
+		return duplicateDocumentConflict(c, existing)
+	}
+
+	job, err := services.EnqueueIngestionJob(services.IngestionJobInput{
+		CompanyID:  doc.CompanyID,
+		UserID:     actor.UserID,
+		Kind:       models.JobKindKnowledgeBase,
+		Filename:   upload.Header.Filename,
+		MimeType:   upload.MimeType,
+		ReplacesID: &doc.ID,
+		KeepACL:    true,
+		Origin:     requestOrigin(c),
+	}, upload.Data)
+	if err != nil {
+		c.Logger().Error("Failed to queue knowledge base document:", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to queue document")
 	}
 
-	// Send extracted text to Gemini for a proper AI summary/analysis
-	geminiPrompt := fmt.Sprintf(
-		"The user uploaded a document named \"%s\". Here is the extracted content:\n\n%s\n\nPlease provide a concise summary of this document and highlight the key points.",
-		file.Filename,
-		extractedText,
-	)
+	return utils.AcceptedResponse(c, "New document version queued for processing", job)
+}
+
+// knowledgeBaseVersionErrorResponse maps the errors of a version that was not
+// created to responses
+func knowledgeBaseVersionErrorResponse(c echo.Context, err error, fallback string) error {
+	switch {
+	case errors.Is(err, services.ErrDocumentSyncInProgress), errors.Is(err, services.ErrDocumentVersionCurrent):
+		return utils.ErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrDocumentDeleted), errors.Is(err, mongo.ErrNoDocuments):
+		return utils.ErrorResponse(c, http.StatusNotFound, "document not found")
+	case errors.Is(err, services.ErrDuplicateDocument):
+		return utils.ErrorResponse(c, http.StatusConflict, err.Error())
+	}
+	return utils.ErrorResponse(c, http.StatusInternalServerError, fallback)
+}
 
-	aiResponseContent, aiErr := services.GenerateResponse(nil, geminiPrompt)
-	if aiErr != nil {
-		c.Logger().Warnf("Gemini summarization failed for document %s: %v — using fallback", file.Filename, aiErr)
-		// Fallback: acknowledge the upload without dumping raw text
-		aiResponseContent = fmt.Sprintf(
-			"I've received and processed **%s**.\n\nThe document has been extracted successfully. You can now ask me questions about its content.",
-			file.Filename,
-		)
+// parseDocumentVersion parses a version number; empty means zero
+func parseDocumentVersion(raw string) (int, bool) {
+	if raw == "" {
+		return 0, true
 	}
+	version, err := strconv.Atoi(raw)
+	return version, err == nil && version > 0
+}
 
-	aiMessage := &models.Message{
-		ID:        primitive.NewObjectID(),
-		ChatID:    chatID,
-		Role:      "assistant",
-		Content:   aiResponseContent,
-		Timestamp: primitive.NewDateTimeFromTime(time.Now()),
-		ModelUsed: "gemini",
+// GetKnowledgeBaseDocumentVersions lists the versions of a KB document,
+// newest first.
+func GetKnowledgeBaseDocumentVersions(c echo.Context) error {
+	docID, err := primitive.ObjectIDFromHex(c.Param("doc_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
 	}
-	savedAIMessage, err := services.SaveMessage(aiMessage)
+
+	doc, _, err := services.AuthorizeDocument(currentActor(c), docID, services.AccessRead)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to save AI response")
+		return authorizationErrorResponse(c, err, "document")
 	}
 
-	return utils.SuccessResponse(c, "Document processed successfully", map[string]interface{}{
-		"user_message": userMessage,
-		"ai_message":   savedAIMessage,
-		"attachment":   attachment,
-	})
+	versions, err := services.GetKnowledgeBaseVersions(doc.LogicalID, doc.CompanyID)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch document versions")
+	}
+
+	return utils.SuccessResponse(c, "Document versions fetched successfully", versions)
 }
 
-// GetKnowledgeBaseDocuments lists all KB documents for the requesting company.
-func GetKnowledgeBaseDocuments(c echo.Context) error {
-	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+// GetKnowledgeBaseDocumentVersion returns one version of a KB document with
+// its extracted text.
+func GetKnowledgeBaseDocumentVersion(c echo.Context) error {
+	docID, err := primitive.ObjectIDFromHex(c.Param("doc_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+	}
+	version, ok := parseDocumentVersion(c.Param("version"))
 	if !ok {
-		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid company context")
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid version")
 	}
 
-	docs, err := services.GetKnowledgeBaseDocuments(companyID)
+	doc, _, err := services.AuthorizeDocument(currentActor(c), docID, services.AccessRead)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch documents")
+		return authorizationErrorResponse(c, err, "document")
 	}
 
-	return utils.SuccessResponse(c, "Documents fetched successfully", docs)
+	found, err := services.GetKnowledgeBaseVersion(doc.LogicalID, doc.CompanyID, version)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return utils.ErrorResponse(c, http.StatusNotFound, "Version not found")
+	}
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch document version")
+	}
+
+	return utils.SuccessResponse(c, "Document version fetched successfully", found)
 }
 
-// GetKnowledgeBaseDocumentContent returns the full extracted text of a single KB document.
-func GetKnowledgeBaseDocumentContent(c echo.Context) error {
-	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
-	if !ok {
-		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid company context")
+// DiffKnowledgeBaseDocumentVersions diffs the extracted text of two versions
+// of a KB document. "to" defaults to the current version and "from" to the
+// version before "to".
+func DiffKnowledgeBaseDocumentVersions(c echo.Context) error {
+	docID, err := primitive.ObjectIDFromHex(c.Param("doc_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+	}
+	from, fromOK := parseDocumentVersion(c.QueryParam("from"))
+	to, toOK := parseDocumentVersion(c.QueryParam("to"))
+	if !fromOK || !toOK {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid version")
+	}
+
+	doc, _, err := services.AuthorizeDocument(currentActor(c), docID, services.AccessRead)
+	if err != nil {
+		return authorizationErrorResponse(c, err, "document")
 	}
 
+	diff, err := services.DiffKnowledgeBaseVersions(doc.LogicalID, doc.CompanyID, from, to)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return utils.ErrorResponse(c, http.StatusNotFound, "Version not found")
+	}
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to diff document versions")
+	}
+
+	return utils.SuccessResponse(c, "Document versions compared successfully", diff)
+}
+
+// RollbackKnowledgeBaseDocument restores an earlier version of a KB document
+// as its new current version.
+func RollbackKnowledgeBaseDocument(c echo.Context) error {
+	actor := currentActor(c)
+
 	docID, err := primitive.ObjectIDFromHex(c.Param("doc_id"))
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
 	}
+	version, ok := parseDocumentVersion(c.Param("version"))
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid version")
+	}
 
-	doc, err := services.GetKnowledgeBaseDocumentByID(docID, companyID)
+	doc, _, err := services.AuthorizeDocument(actor, docID, services.AccessWrite)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusNotFound, "Document not found")
-	}
+		return authorizationErrorResponse(c, err, "document")
+	}
+
+	created, uploadErr := services.RollbackKnowledgeBaseDocument(doc.LogicalID, doc.CompanyID, version, actor.UserID)
+	if created == nil {
+		return knowledgeBaseVersionErrorResponse(c, uploadErr, "Failed to roll back document")
+	}
+
+	// Log activity
+	services.LogActivity(
+		doc.CompanyID,
+		actor.UserID,
+		models.ActionRollbackDocument,
+		models.ResourceDocument,
+		created.LogicalID.Hex(),
+		fmt.Sprintf("Rolled back document %s to version %d", created.Filename, version),
+		true,
+		map[string]interface{}{"restored_from": version, "version": created.Version, "status": created.Status},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"POST",
+		c.Path(),
+		200,
+		"",
+	)
 
-	return utils.SuccessResponse(c, "Document content fetched", doc)
+	if uploadErr != nil {
+		return utils.SuccessResponse(c, "Document rolled back locally; upstream sync pending", created)
+	}
+	return utils.SuccessResponse(c, "Document rolled back successfully", created)
 }
 
-// DeleteKnowledgeBaseDocument removes a KB document.
-func DeleteKnowledgeBaseDocument(c echo.Context) error {
+// ReconcileKnowledgeBase diffs the company's documents against the
+// enterprise assistant index and repairs the differences.
+func ReconcileKnowledgeBase(c echo.Context) error {
 	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
 	if !ok {
 		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid company context")
 	}
 
+	report, err := services.ReconcileKnowledgeBase(companyID)
+	if err != nil {
+		c.Logger().Error("Knowledge base reconciliation failed:", err)
+		return utils.ErrorResponse(c, http.StatusBadGateway, "Knowledge base upstream error: "+err.Error())
+	}
+
+	return utils.SuccessResponse(c, "Knowledge base reconciled", report)
+}
+
+// ResyncKnowledgeBaseDocument retries the upstream upload of a pending_sync or
+// failed KB document immediately.
+func ResyncKnowledgeBaseDocument(c echo.Context) error {
+	actor := currentActor(c)
+
+	docID, err := primitive.ObjectIDFromHex(c.Param("doc_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
+	}
+
+	doc, _, err := services.AuthorizeDocument(actor, docID, services.AccessWrite)
+	if err != nil {
+		return authorizationErrorResponse(c, err, "document")
+	}
+
+	updated, syncErr := services.ResyncKnowledgeBaseDocument(doc.ID, doc.CompanyID)
+	switch {
+	case errors.Is(syncErr, services.ErrDocumentAlreadySynced), errors.Is(syncErr, services.ErrDocumentSyncInProgress),
+		errors.Is(syncErr, services.ErrDocumentSuperseded):
+		return utils.ErrorResponse(c, http.StatusConflict, syncErr.Error())
+	case errors.Is(syncErr, services.ErrDocumentDeleted), errors.Is(syncErr, mongo.ErrNoDocuments):
+		return utils.ErrorResponse(c, http.StatusNotFound, "document not found")
+	case updated == nil:
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to resync document")
+	}
+
+	// Log activity
+	status, errMsg := http.StatusOK, ""
+	if syncErr != nil {
+		status, errMsg = http.StatusBadGateway, syncErr.Error()
+	}
+	services.LogActivity(
+		doc.CompanyID,
+		actor.UserID,
+		models.ActionResyncDocument,
+		models.ResourceDocument,
+		doc.ID.Hex(),
+		"Resynced document: "+doc.Filename,
+		syncErr == nil,
+		map[string]interface{}{"status": updated.Status, "sync_attempts": updated.SyncAttempts},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"POST",
+		c.Path(),
+		status,
+		errMsg,
+	)
+
+	if syncErr != nil {
+		return utils.ErrorResponseWithData(c, http.StatusBadGateway, "Knowledge base upstream error: "+syncErr.Error(), updated)
+	}
+	return utils.SuccessResponse(c, "Document synced successfully", updated)
+}
+
+// UpdateKnowledgeBaseDocumentACL replaces the access list of a KB document.
+// Empty lists make it visible to the whole company again.
+func UpdateKnowledgeBaseDocumentACL(c echo.Context) error {
+	actor := currentActor(c)
+
 	docID, err := primitive.ObjectIDFromHex(c.Param("doc_id"))
 	if err != nil {
 		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid document ID")
 	}
 
-	if err := services.DeleteKnowledgeBaseDocument(docID, companyID); err != nil {
-		return utils.ErrorResponse(c, http.StatusNotFound, "Document not found or already deleted")
+	var input services.DocumentACLInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
 	}
 
-	return utils.SuccessResponse(c, "Document deleted successfully", nil)
+	doc, _, err := services.AuthorizeDocument(actor, docID, services.AccessWrite)
+	if err != nil {
+		return authorizationErrorResponse(c, err, "document")
+	}
+
+	acl, err := services.BuildDocumentACL(doc.CompanyID, input)
+	if err != nil {
+		return documentACLErrorResponse(c, err)
+	}
+
+	updated, err := services.SetKnowledgeBaseDocumentACL(doc.ID, doc.CompanyID, acl)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to update document access")
+	}
+
+	// Log activity
+	services.LogActivity(
+		doc.CompanyID,
+		actor.UserID,
+		models.ActionSetDocumentACL,
+		models.ResourceDocument,
+		doc.ID.Hex(),
+		"Updated access list of document: "+doc.Filename,
+		true,
+		map[string]interface{}{"acl": acl},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"PUT",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "Document access updated successfully", updated)
 }
 
-// UploadKnowledgeBaseDocument handles KB upload in a dedicated module (not chat).
-func UploadKnowledgeBaseDocument(c echo.Context) error {
-	userID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
-	if !ok {
-		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user context")
+// documentACLFromForm reads the optional "acl" form field of a KB upload, a
+// JSON services.DocumentACLInput.
+func documentACLFromForm(c echo.Context, companyID primitive.ObjectID) (*models.DocumentACL, error) {
+	raw := c.FormValue("acl")
+	if raw == "" {
+		return nil, nil
 	}
-	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
-	if !ok {
-		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid company context")
+	var input services.DocumentACLInput
+	if err := json.Unmarshal([]byte(raw), &input); err != nil {
+		return nil, fmt.Errorf("%w: malformed acl field", services.ErrInvalidDocumentACL)
+	}
+	return services.BuildDocumentACL(companyID, input)
+}
+
+// documentACLErrorResponse maps access list validation errors to responses
+func documentACLErrorResponse(c echo.Context, err error) error {
+	if errors.Is(err, services.ErrInvalidDocumentACL) {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
 	}
+	return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to validate document access list")
+}
+
+// uploadedDocument is the "document" form file of an upload and its content
+type uploadedDocument struct {
+	Header   *multipart.FileHeader
+	MimeType string
+	Data     []byte
+}
 
+// uploadedDocumentError is a readUploadedDocument failure and its response
+type uploadedDocumentError struct {
+	Status  int
+	Message string
+}
+
+func (e *uploadedDocumentError) Error() string { return e.Message }
+
+// readUploadedDocument reads the "document" form file after checking it
+// against the company's upload policy.
+func readUploadedDocument(c echo.Context, companyID primitive.ObjectID) (*uploadedDocument, error) {
 	file, err := c.FormFile("document")
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusBadRequest, "No file uploaded")
+		return nil, &uploadedDocumentError{http.StatusBadRequest, "No file uploaded"}
 	}
 
-	const maxFileSize = 10 * 1024 * 1024
-	if file.Size > maxFileSize {
-		return utils.ErrorResponse(c, http.StatusBadRequest, "File size exceeds 10MB limit")
+	if err := services.CheckDocumentUpload(companyID, file.Size); err != nil {
+		return nil, err
 	}
 
 	src, err := file.Open()
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to read file")
+		return nil, &uploadedDocumentError{http.StatusInternalServerError, "Failed to read file"}
 	}
 	defer src.Close()
 
 	fileData, err := io.ReadAll(src)
 	if err != nil {
-		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to read file data")
+		return nil, &uploadedDocumentError{http.StatusInternalServerError, "Failed to read file data"}
+	}
+	if len(fileData) == 0 {
+		return nil, &uploadedDocumentError{http.StatusBadRequest, "Uploaded file is empty"}
 	}
 
 	mimeType := file.Header.Get("Content-Type")
@@ -236,95 +536,210 @@ func UploadKnowledgeBaseDocument(c echo.Context) error {
 		mimeType = "application/octet-stream"
 	}
 
-	prompt := "extract"
+	return &uploadedDocument{Header: file, MimeType: mimeType, Data: fileData}, nil
+}
+
+// uploadedDocumentErrorResponse maps readUploadedDocument errors to responses
+func uploadedDocumentErrorResponse(c echo.Context, err error) error {
+	var uploadErr *uploadedDocumentError
+	if errors.As(err, &uploadErr) {
+		return utils.ErrorResponse(c, uploadErr.Status, uploadErr.Message)
+	}
+	return quotaErrorResponse(c, err)
+}
+
+// knowledgeBaseUploadTarget returns the document named by the optional
+// "replaces" form field of a KB upload, or nil. Uploads without it still
+// become a new version of the current document with the same filename, which
+// the ingestion worker looks up when it runs.
+func knowledgeBaseUploadTarget(c echo.Context, companyID primitive.ObjectID) (*models.KnowledgeBaseDocument, error) {
+	raw := c.FormValue("replaces")
+	if raw == "" {
+		return nil, nil
+	}
+	docID, err := primitive.ObjectIDFromHex(raw)
+	if err != nil {
+		return nil, &uploadedDocumentError{http.StatusBadRequest, "Invalid replaces document ID"}
+	}
+	doc, err := services.GetKnowledgeBaseDocumentByID(docID, companyID)
+	if err != nil {
+		return nil, &uploadedDocumentError{http.StatusNotFound, "Replaced document not found"}
+	}
+	return doc, nil
+}
+
+// duplicateKnowledgeBaseDocument returns the current KB document uploaded
+// with the same content, or nil
+func duplicateKnowledgeBaseDocument(companyID primitive.ObjectID, data []byte) (*models.KnowledgeBaseDocument, error) {
+	existing, err := services.FindKnowledgeBaseDocumentByHash(companyID, services.ContentHash(data))
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	return existing, err
+}
+
+// duplicateDocumentConflict rejects an upload that would make a document
+// identical to another current one
+func duplicateDocumentConflict(c echo.Context, existing *models.KnowledgeBaseDocument) error {
+	return utils.ErrorResponseWithData(c, http.StatusConflict,
+		fmt.Sprintf("The file is identical to the document %s", existing.Filename), existing)
+}
+
+// UploadKnowledgeBaseDocument queues a KB upload (a dedicated module, not
+// chat). An ingestion worker extracts it and indexes it upstream; uploading a
+// file over an existing document adds a new version. Files identical to a
+// current document return that document instead of a job.
+func UploadKnowledgeBaseDocument(c echo.Context) error {
+	userID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user context")
+	}
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid company context")
+	}
 
-	textContent, extractErr := processDocumentInGoroutine(fileData, mimeType)
-	if extractErr != nil {
-		c.Logger().Error("Failed to extract text from document:", extractErr)
-		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to extract text from document")
+	acl, err := documentACLFromForm(c, companyID)
+	if err != nil {
+		return documentACLErrorResponse(c, err)
 	}
 
-	if textContent == "" {
-		return utils.ErrorResponse(c, http.StatusBadRequest, "Document content is empty after extraction")
+	upload, err := readUploadedDocument(c, companyID)
+	if err != nil {
+		return uploadedDocumentErrorResponse(c, err)
 	}
 
-	pythonResp, err := services.UploadDocumentToEnterpriseAssistant(
-		companyID.Hex(),
-		userID.Hex(),
-		file.Filename,
-		textContent,
-	)
+	target, err := knowledgeBaseUploadTarget(c, companyID)
 	if err != nil {
-		c.Logger().Error("Knowledge base upload to Python backend failed:", err)
-		localDoc, saveErr := services.SaveKnowledgeBaseDocument(
-			companyID,
-			userID,
-			file.Filename,
-			mimeType,
-			prompt,
-			textContent,
-			"pending_sync",
-			err.Error(),
-			"",
-			0,
-		)
-		if saveErr != nil {
-			c.Logger().Error("Failed to persist pending knowledge base document:", saveErr)
-			return utils.ErrorResponse(c, http.StatusBadGateway, "Knowledge base upstream error: "+err.Error())
-		}
+		return uploadedDocumentErrorResponse(c, err)
+	}
 
-		attachment := models.Attachment{
-			ID:            primitive.NewObjectID(),
-			Filename:      file.Filename,
-			MimeType:      mimeType,
-			Size:          file.Size,
-			UploadedAt:    primitive.NewDateTimeFromTime(time.Now()),
-			ProcessedData: "Stored locally as pending sync",
+	// Identical content is not extracted and indexed again: the existing
+	// document is returned unless "on_duplicate" asks to save the upload as
+	// its new version, e.g. under a new filename
+	existing, err := duplicateKnowledgeBaseDocument(companyID, upload.Data)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to check for duplicate documents")
+	}
+	if existing != nil {
+		switch {
+		case target != nil && target.LogicalID != existing.LogicalID:
+			return duplicateDocumentConflict(c, existing)
+		case target == nil && c.FormValue("on_duplicate") != "new_version":
+			return utils.SuccessResponse(c, "Document already in the knowledge base", map[string]interface{}{
+				"duplicate": true,
+				"document":  existing,
+			})
 		}
+		target = existing
+	}
+
+	var replaces *primitive.ObjectID
+	if target != nil {
+		replaces = &target.ID
+	}
+	job, err := services.EnqueueIngestionJob(services.IngestionJobInput{
+		CompanyID:  companyID,
+		UserID:     userID,
+		Kind:       models.JobKindKnowledgeBase,
+		Filename:   upload.Header.Filename,
+		MimeType:   upload.MimeType,
+		ReplacesID: replaces,
+		ACL:        acl,
+		KeepACL:    c.FormValue("acl") == "", // New versions keep the access list unless one is given
+		Origin:     requestOrigin(c),
+	}, upload.Data)
+	if err != nil {
+		c.Logger().Error("Failed to queue knowledge base document:", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to queue document")
+	}
 
-		return utils.SuccessResponse(c, "Knowledge base saved locally; upstream sync pending", map[string]interface{}{
-			"company_id":       companyID,
-			"uploaded_by":      userID,
-			"action":           prompt,
-			"attachment":       attachment,
-			"sync_status":      "pending_sync",
-			"local_document":   localDoc,
-			"upstream_message": err.Error(),
-		})
+	return utils.AcceptedResponse(c, "Knowledge base document queued for processing", job)
+}
+
+// ImportKnowledgeBaseArchive queues an uploaded ZIP archive for import into
+// the knowledge base and returns the import's ID; GetKnowledgeBaseImport
+// reports what happened to every file. Folder paths become tags; the optional
+// "acl" form field applies to every document.
+func ImportKnowledgeBaseArchive(c echo.Context) error {
+	actor := currentActor(c)
+
+	acl, err := documentACLFromForm(c, actor.CompanyID)
+	if err != nil {
+		return documentACLErrorResponse(c, err)
+	}
+
+	file, err := c.FormFile("archive")
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "No archive uploaded")
+	}
+	if maxSize := services.ImportMaxArchiveSize(); file.Size > maxSize {
+		return utils.ErrorResponse(c, http.StatusRequestEntityTooLarge, fmt.Sprintf("Archive exceeds the %d MB limit", maxSize>>20))
+	}
+	src, err := file.Open()
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to read archive")
+	}
+	defer src.Close()
+	archive, err := io.ReadAll(src)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to read archive data")
 	}
 
-	_, saveErr := services.SaveKnowledgeBaseDocument(
-		companyID,
-		userID,
-		file.Filename,
-		mimeType,
-		prompt,
-		textContent,
-		"synced",
+	report, err := services.ImportKnowledgeBaseArchive(services.KnowledgeBaseImportInput{
+		CompanyID: actor.CompanyID,
+		UserID:    actor.UserID,
+		Filename:  file.Filename,
+		ACL:       acl,
+		Origin:    requestOrigin(c),
+	}, archive)
+	if errors.Is(err, services.ErrInvalidImportArchive) {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+	var quotaErr *services.QuotaError
+	if errors.As(err, &quotaErr) {
+		return quotaErrorResponse(c, err)
+	}
+	if err != nil {
+		c.Logger().Error("Failed to queue knowledge base import:", err)
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to queue import")
+	}
+
+	// Log activity
+	services.LogActivity(
+		actor.CompanyID,
+		actor.UserID,
+		models.ActionImportDocuments,
+		models.ResourceDocument,
+		report.ImportID.Hex(),
+		fmt.Sprintf("Queued archive %s for import", file.Filename),
+		true,
+		map[string]interface{}{"archive": file.Filename, "job_id": report.JobID.Hex()},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"POST",
+		c.Path(),
+		http.StatusAccepted,
 		"",
-		pythonResp.DocumentID,
-		pythonResp.ChunksCreated,
 	)
-	if saveErr != nil {
-		c.Logger().Warn("Knowledge base synced upstream but failed local save:", saveErr)
-	}
-
-	attachment := models.Attachment{
-		ID:            primitive.NewObjectID(),
-		Filename:      file.Filename,
-		MimeType:      mimeType,
-		Size:          file.Size,
-		UploadedAt:    primitive.NewDateTimeFromTime(time.Now()),
-		ProcessedData: "Indexed in enterprise knowledge base",
-	}
-
-	return utils.SuccessResponse(c, "Knowledge base document uploaded successfully", map[string]interface{}{
-		"company_id":     companyID,
-		"uploaded_by":    userID,
-		"action":         prompt,
-		"attachment":     attachment,
-		"document_id":    pythonResp.DocumentID,
-		"chunks_created": pythonResp.ChunksCreated,
-		"summary":        pythonResp.Summary,
-	})
+
+	return utils.AcceptedResponse(c, "Knowledge base import queued for processing", report)
+}
+
+// GetKnowledgeBaseImport reports the progress of a bulk import's documents.
+func GetKnowledgeBaseImport(c echo.Context) error {
+	importID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid import ID")
+	}
+
+	report, err := services.GetKnowledgeBaseImport(importID, currentActor(c).CompanyID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return utils.ErrorResponse(c, http.StatusNotFound, "Import not found")
+	}
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to fetch import")
+	}
+
+	return utils.SuccessResponse(c, "Import fetched successfully", report)
 }
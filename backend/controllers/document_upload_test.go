@@ -0,0 +1,78 @@
+package controllers
+
+import (
+	"bytes"
+	"chatgpt-clone/backend/config"
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/services"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestUploadDocumentToChatDuplicate checks that uploading a file a chat
+// already carries returns the existing message instead of queueing it again,
+// and that the same file in another user's chat is never handed back.
+func TestUploadDocumentToChatDuplicate(t *testing.T) {
+	f := newHandlerFixture(t)
+	mustInsert(t, "companies", models.Company{ID: f.owner.CompanyID, Name: "Acme", Domain: "acme", IsActive: true,
+		Settings: models.CompanySettings{EnableDocumentUpload: true}})
+
+	content := []byte("Travel expenses are reimbursed within 30 days.")
+	hash := services.ContentHash(content)
+	now := primitive.NewDateTimeFromTime(time.Now())
+	colleagueChatID, uploadID := primitive.NewObjectID(), primitive.NewObjectID()
+	mustInsert(t, "chats", models.Chat{ID: colleagueChatID, CompanyID: f.colleague.CompanyID, UserID: f.colleague.UserID, Title: "Theirs", CreatedAt: now, UpdatedAt: now})
+	mustInsert(t, "messages",
+		models.Message{ID: primitive.NewObjectID(), ChatID: colleagueChatID, Role: "user", Content: "policy.txt", Timestamp: now,
+			Attachments: []models.Attachment{{ID: primitive.NewObjectID(), Filename: "policy.txt", ContentHash: hash}}},
+		models.Message{ID: uploadID, ChatID: f.chatID, Role: "user", Content: "policy.txt", Timestamp: now,
+			Attachments: []models.Attachment{{ID: primitive.NewObjectID(), Filename: "policy.txt", ContentHash: hash, ProcessedData: "Travel expenses..."}}},
+	)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("document", "policy-copy.txt")
+	if err != nil {
+		t.Fatalf("create form file: %v", err)
+	}
+	part.Write(content)
+	form.Close()
+	req := httptest.NewRequest(http.MethodPost, "/", &body)
+	req.Header.Set(echo.HeaderContentType, form.FormDataContentType())
+	rec := httptest.NewRecorder()
+	c := newActorRequestContext(req, rec, f.owner, map[string]string{"chat_id": f.chatID.Hex()})
+
+	if err := UploadAndProcessDocument(c); err != nil {
+		t.Fatalf("handler error: %v", err)
+	}
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d (%s)", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var resp struct {
+		Data struct {
+			Duplicate bool           `json:"duplicate"`
+			Message   models.Message `json:"message"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+	if !resp.Data.Duplicate || resp.Data.Message.ID != uploadID {
+		t.Fatalf("response = %+v, want the chat's existing message %s", resp.Data, uploadID.Hex())
+	}
+
+	jobs, err := config.GetCollection("ingestion_jobs").CountDocuments(context.Background(), bson.M{})
+	if err != nil || jobs != 0 {
+		t.Fatalf("%d ingestion jobs queued (err %v), want none", jobs, err)
+	}
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/services"
+	"chatgpt-clone/backend/utils"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Job event stream timing
+const (
+	jobEventsPollInterval = time.Second
+	jobEventsKeepAlive    = 15 * time.Second
+)
+
+// requestOrigin records the request queuing a job, for the activity log
+func requestOrigin(c echo.Context) models.RequestOrigin {
+	return models.RequestOrigin{
+		IPAddress: c.RealIP(),
+		UserAgent: c.Request().UserAgent(),
+		Method:    c.Request().Method,
+		Path:      c.Path(),
+	}
+}
+
+// GetJob returns the state of an ingestion job.
+func GetJob(c echo.Context) error {
+	jobID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid job ID")
+	}
+
+	job, _, err := services.AuthorizeJob(currentActor(c), jobID)
+	if err != nil {
+		return authorizationErrorResponse(c, err, "job")
+	}
+
+	return utils.SuccessResponse(c, "Job fetched successfully", job)
+}
+
+// StreamJobEvents streams an ingestion job's progress as Server-Sent Events:
+// "progress" whenever it changes, then "done" or "failed" once it finishes.
+// Every event carries the whole job.
+func StreamJobEvents(c echo.Context) error {
+	jobID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid job ID")
+	}
+
+	job, _, err := services.AuthorizeJob(currentActor(c), jobID)
+	if err != nil {
+		return authorizationErrorResponse(c, err, "job")
+	}
+
+	// From here on the response is an event stream
+	stream := utils.NewSSEStream(c)
+	ctx := c.Request().Context()
+	poll := time.NewTicker(jobEventsPollInterval)
+	defer poll.Stop()
+	keepAlive := time.NewTicker(jobEventsKeepAlive)
+	defer keepAlive.Stop()
+
+	var lastSent primitive.DateTime
+	for {
+		if job.UpdatedAt != lastSent {
+			event := "progress"
+			switch job.Status {
+			case models.JobStatusSucceeded:
+				event = "done"
+			case models.JobStatusFailed:
+				event = "failed"
+			}
+			if err := stream.Send(event, job); err != nil || job.Finished() {
+				return nil
+			}
+			lastSent = job.UpdatedAt
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-keepAlive.C:
+			if err := stream.KeepAlive(); err != nil {
+				return nil
+			}
+		case <-poll.C:
+			updated, err := services.GetIngestionJob(jobID)
+			if err != nil {
+				// Lookup failures are retried on the next tick
+				continue
+			}
+			job = updated
+		}
+	}
+}
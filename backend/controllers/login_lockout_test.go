@@ -0,0 +1,82 @@
+package controllers
+
+import (
+	"chatgpt-clone/backend/config"
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/utils"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestLoginIPLockoutIgnoresForwardedFor checks that rotating
+// X-Forwarded-For neither dodges the IP lockout nor locks out the forged
+// address.
+func TestLoginIPLockoutIgnoresForwardedFor(t *testing.T) {
+	setupTestDB(t)
+	t.Setenv("LOGIN_IP_MAX_FAILURES", "3")
+	t.Setenv("LOGIN_MAX_FAILURES", "100")
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	mustInsert(t, "companies", models.Company{
+		ID:                 primitive.NewObjectID(),
+		Name:               "Acme",
+		Domain:             "acme",
+		SubscriptionTier:   "basic",
+		SubscriptionStatus: "active",
+		IsActive:           true,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	})
+
+	e := echo.New()
+	e.Validator = utils.NewValidator()
+	extractor, err := config.NewIPExtractor("")
+	if err != nil {
+		t.Fatalf("NewIPExtractor: %v", err)
+	}
+	e.IPExtractor = extractor
+	e.POST("/api/auth/login", Login)
+
+	const attackerIP, victimIP = "203.0.113.7", "198.51.100.9"
+	login := func(attempt int) int {
+		body := fmt.Sprintf(`{"email":"user%d@acme.test","password":"wrong","company_domain":"acme"}`, attempt)
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		req.RemoteAddr = attackerIP + ":5000"
+		req.Header.Set(echo.HeaderXForwardedFor, fmt.Sprintf("%s, 192.0.2.%d", victimIP, attempt))
+		req.Header.Set(echo.HeaderXRealIP, victimIP)
+		rec := httptest.NewRecorder()
+		e.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	for attempt := 1; attempt <= 3; attempt++ {
+		if code := login(attempt); code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: status = %d, want %d", attempt, code, http.StatusUnauthorized)
+		}
+	}
+	if code := login(4); code != http.StatusTooManyRequests {
+		t.Fatalf("attempt with a fresh forged header: status = %d, want %d", code, http.StatusTooManyRequests)
+	}
+
+	lockouts := config.GetCollection("login_lockouts")
+	ctx := context.Background()
+	if n, _ := lockouts.CountDocuments(ctx, bson.M{"subject": models.LockoutSubjectIP, "ip_address": attackerIP}); n != 1 {
+		t.Fatalf("connection address lockouts = %d, want 1", n)
+	}
+	if n, _ := lockouts.CountDocuments(ctx, bson.M{"subject": models.LockoutSubjectIP, "ip_address": bson.M{"$ne": attackerIP}}); n != 0 {
+		t.Fatalf("forged addresses were locked out: %d", n)
+	}
+	if n, _ := config.GetCollection("activity_logs").CountDocuments(ctx, bson.M{"action": models.ActionFailedLogin, "ip_address": victimIP}); n != 0 {
+		t.Fatalf("failed logins counted against the forged address: %d", n)
+	}
+}
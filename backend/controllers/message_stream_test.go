@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"bytes"
+	"chatgpt-clone/backend/config"
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/services"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// streamFixture is a chat of a company answered along the given fallback
+// chain
+type streamFixture struct {
+	chatID primitive.ObjectID
+	owner  services.Actor
+}
+
+func newStreamFixture(t *testing.T, chain []string) streamFixture {
+	t.Helper()
+	setupTestDB(t)
+
+	companyID := primitive.NewObjectID()
+	now := primitive.NewDateTimeFromTime(time.Now())
+	f := streamFixture{
+		chatID: primitive.NewObjectID(),
+		owner:  services.Actor{UserID: primitive.NewObjectID(), CompanyID: companyID, RoleName: models.RoleEmployee},
+	}
+	mustInsert(t, "companies", models.Company{
+		ID:                 companyID,
+		Name:               "Acme",
+		Domain:             "acme-" + companyID.Hex(),
+		SubscriptionTier:   models.TierBasic,
+		SubscriptionStatus: "active",
+		IsActive:           true,
+		Settings:           models.CompanySettings{LLMFallbackChain: chain},
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	})
+	mustInsert(t, "users", models.User{ID: f.owner.UserID, CompanyID: companyID, Email: "owner@acme.test", RoleName: models.RoleEmployee, IsActive: true})
+	mustInsert(t, "chats", models.Chat{ID: f.chatID, CompanyID: companyID, UserID: f.owner.UserID, Title: "Refunds", CreatedAt: now, UpdatedAt: now})
+	return f
+}
+
+// streamRecorder records the handler's events and reports when the given
+// number of chunk events has been written
+type streamRecorder struct {
+	*httptest.ResponseRecorder
+	mu      sync.Mutex
+	chunks  int
+	notify  int
+	reached chan struct{}
+}
+
+func (r *streamRecorder) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if bytes.HasPrefix(p, []byte("event: chunk\n")) {
+		r.chunks++
+		if r.chunks == r.notify {
+			close(r.reached)
+		}
+	}
+	return r.ResponseRecorder.Write(p)
+}
+
+// events splits the recorded body into (event, data) pairs
+func (r *streamRecorder) events() [][2]string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var events [][2]string
+	for _, block := range strings.Split(strings.TrimSpace(r.Body.String()), "\n\n") {
+		var event, data string
+		for _, line := range strings.Split(block, "\n") {
+			if name, ok := strings.CutPrefix(line, "event: "); ok {
+				event = name
+			} else if payload, ok := strings.CutPrefix(line, "data: "); ok {
+				data = payload
+			}
+		}
+		events = append(events, [2]string{event, data})
+	}
+	return events
+}
+
+func eventNames(events [][2]string) string {
+	var names []string
+	for _, e := range events {
+		names = append(names, e[0])
+	}
+	return strings.Join(names, ",")
+}
+
+func TestCreateMessageStream(t *testing.T) {
+	const answer = "Refunds are processed within 14 days."
+	const canned = "I'm sorry, the assistant service is temporarily unavailable. Your message has been saved — please try again in a few minutes, or contact your IT helpdesk if the problem persists."
+	tests := []struct {
+		name string
+		// upstream answers the enterprise assistant's stream request; cancel
+		// ends the client's request once two chunks reached it
+		upstream   func(t *testing.T, w http.ResponseWriter, r *http.Request, twoChunks <-chan struct{}, cancel func())
+		chain      []string // Default: the enterprise assistant only
+		wantEvents string
+		wantSaved  string // Content of the saved assistant message, if any
+		wantBilled string // Streamed content usage is recorded for, if any
+	}{
+		{
+			name: "upstream error event",
+			upstream: func(t *testing.T, w http.ResponseWriter, r *http.Request, twoChunks <-chan struct{}, cancel func()) {
+				writeUpstreamChunks(w, "Refunds are")
+				fmt.Fprint(w, "event: error\ndata: {\"detail\":\"llm timeout\"}\n\n")
+			},
+			wantEvents: "user_message,chunk,chunk,error",
+			wantBilled: "Refunds are",
+		},
+		{
+			name: "complete stream",
+			upstream: func(t *testing.T, w http.ResponseWriter, r *http.Request, twoChunks <-chan struct{}, cancel func()) {
+				writeUpstreamChunks(w, answer)
+				fmt.Fprint(w, "event: done\ndata: {\"chunks_used\":2,\"llm_used\":true}\n\n")
+			},
+			wantEvents: "user_message,chunk,chunk,chunk,chunk,chunk,chunk,done",
+			wantSaved:  answer,
+			wantBilled: answer,
+		},
+		{
+			name: "upstream disconnects mid-stream",
+			upstream: func(t *testing.T, w http.ResponseWriter, r *http.Request, twoChunks <-chan struct{}, cancel func()) {
+				writeUpstreamChunks(w, "Refunds are")
+				conn, _, err := w.(http.Hijacker).Hijack()
+				if err != nil {
+					t.Errorf("hijack: %v", err)
+					return
+				}
+				conn.Close()
+			},
+			wantEvents: "user_message,chunk,chunk,error",
+			wantBilled: "Refunds are",
+		},
+		{
+			name: "client disconnects mid-stream",
+			upstream: func(t *testing.T, w http.ResponseWriter, r *http.Request, twoChunks <-chan struct{}, cancel func()) {
+				writeUpstreamChunks(w, "Refunds are")
+				<-twoChunks
+				cancel()
+				<-r.Context().Done()
+			},
+			wantEvents: "user_message,chunk,chunk",
+			wantSaved:  "Refunds are",
+			wantBilled: "Refunds are",
+		},
+		{
+			name: "canned reply while the assistant is down",
+			upstream: func(t *testing.T, w http.ResponseWriter, r *http.Request, twoChunks <-chan struct{}, cancel func()) {
+				http.Error(w, "index unavailable", http.StatusServiceUnavailable)
+			},
+			chain:      []string{services.ProviderEnterpriseAssistant, services.ProviderUnavailable},
+			wantEvents: "user_message," + strings.Repeat("chunk,", len(strings.Fields(canned))) + "done",
+			wantSaved:  canned, // Not billed
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chain := tt.chain
+			if chain == nil {
+				chain = []string{services.ProviderEnterpriseAssistant}
+			}
+			f := newStreamFixture(t, chain)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			rec := &streamRecorder{ResponseRecorder: httptest.NewRecorder(), notify: 2, reached: make(chan struct{})}
+			upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/event-stream")
+				tt.upstream(t, w, r, rec.reached, cancel)
+			}))
+			defer upstream.Close()
+			t.Setenv("ENTERPRISE_ASSISTANT_URL", upstream.URL)
+			services.InitEnterpriseAssistantClient()
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"content":"How long do refunds take?"}`)).WithContext(ctx)
+			req.Header.Set("Content-Type", "application/json")
+			c := newActorRequestContext(req, rec, f.owner, map[string]string{"chat_id": f.chatID.Hex()})
+			if err := CreateMessageStream(c); err != nil {
+				t.Fatalf("handler error: %v", err)
+			}
+
+			events := rec.events()
+			if got := eventNames(events); got != tt.wantEvents {
+				t.Fatalf("events = %s, want %s\n%s", got, tt.wantEvents, rec.Body.String())
+			}
+
+			var usage []models.UsageDaily
+			cursor, err := config.GetCollection("usage_daily").Find(context.Background(), bson.M{"company_id": f.owner.CompanyID, "scope": models.UsageScopeCompany})
+			if err != nil || cursor.All(context.Background(), &usage) != nil {
+				t.Fatalf("load usage: %v", err)
+			}
+			if tt.wantBilled == "" {
+				if len(usage) != 0 {
+					t.Fatalf("usage recorded: %+v", usage[0])
+				}
+			} else if len(usage) != 1 || usage[0].Requests != 1 || usage[0].CompletionTokens != int64(services.EstimateTokens(tt.wantBilled)) {
+				t.Fatalf("usage = %+v, want one request billing %q", usage, tt.wantBilled)
+			}
+
+			var saved []models.Message
+			cursor, err = config.GetCollection("messages").Find(context.Background(), bson.M{"chat_id": f.chatID, "role": "assistant"})
+			if err != nil || cursor.All(context.Background(), &saved) != nil {
+				t.Fatalf("load messages: %v", err)
+			}
+			if tt.wantSaved == "" {
+				if len(saved) != 0 {
+					t.Fatalf("assistant message saved for a failed stream: %q", saved[0].Content)
+				}
+				return
+			}
+			if len(saved) != 1 || saved[0].Content != tt.wantSaved {
+				t.Fatalf("saved assistant messages = %+v, want one with %q", saved, tt.wantSaved)
+			}
+
+			last := events[len(events)-1]
+			if last[0] == "done" {
+				var done models.Message
+				if err := json.Unmarshal([]byte(last[1]), &done); err != nil {
+					t.Fatalf("decode done event: %v", err)
+				}
+				if done.ID != saved[0].ID || done.Content != saved[0].Content || done.ResponseTime <= 0 || done.Provider != chain[len(chain)-1] {
+					t.Fatalf("done event carries %+v", done)
+				}
+			}
+		})
+	}
+}
+
+// writeUpstreamChunks streams answer one word per chunk event, as
+// scripts/fake_enterprise_assistant does
+func writeUpstreamChunks(w http.ResponseWriter, answer string) {
+	for _, word := range strings.SplitAfter(answer, " ") {
+		payload, _ := json.Marshal(map[string]string{"delta": word})
+		fmt.Fprintf(w, "event: chunk\ndata: %s\n\n", payload)
+		w.(http.Flusher).Flush()
+	}
+}
@@ -0,0 +1,91 @@
+package controllers
+
+import (
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/services"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// TestRefreshTokenConcurrentRotation checks that when two tabs refresh with
+// the same cookie at once, the losing response leaves the cookies alone
+// instead of expiring the ones the winner just set.
+func TestRefreshTokenConcurrentRotation(t *testing.T) {
+	setupTestDB(t)
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	company := models.Company{
+		ID:                 primitive.NewObjectID(),
+		Name:               "Acme",
+		Domain:             "acme",
+		SubscriptionTier:   "basic",
+		SubscriptionStatus: "active",
+		IsActive:           true,
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	user := models.User{
+		ID:        primitive.NewObjectID(),
+		CompanyID: company.ID,
+		Email:     "user@acme.test",
+		RoleName:  models.RoleEmployee,
+		IsActive:  true,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	mustInsert(t, "companies", company)
+	mustInsert(t, "users", user)
+
+	_, refreshToken, err := services.CreateSession(&user, "198.51.100.9", "test", 0)
+	if err != nil {
+		t.Fatalf("CreateSession: %v", err)
+	}
+
+	e := echo.New()
+	e.POST("/api/auth/refresh", RefreshToken)
+
+	const tabs = 2
+	recs := make([]*httptest.ResponseRecorder, tabs)
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := range recs {
+		recs[i] = httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/api/auth/refresh", nil)
+		req.AddCookie(&http.Cookie{Name: refreshTokenCookie, Value: refreshToken})
+		wg.Add(1)
+		go func(rec *httptest.ResponseRecorder) {
+			defer wg.Done()
+			<-start
+			e.ServeHTTP(rec, req)
+		}(recs[i])
+	}
+	close(start)
+	wg.Wait()
+
+	var won, raced int
+	for _, rec := range recs {
+		switch rec.Code {
+		case http.StatusOK:
+			won++
+			if len(rec.Result().Cookies()) != 2 {
+				t.Fatalf("winner set %d cookies, want 2", len(rec.Result().Cookies()))
+			}
+		case http.StatusConflict:
+			raced++
+			if cookies := rec.Header().Values("Set-Cookie"); len(cookies) != 0 {
+				t.Fatalf("loser sent Set-Cookie %q", cookies)
+			}
+		default:
+			t.Fatalf("status = %d (%s), want %d or %d", rec.Code, rec.Body.String(), http.StatusOK, http.StatusConflict)
+		}
+	}
+	if won != 1 || raced != 1 {
+		t.Fatalf("%d refreshes won and %d raced, want 1 and 1", won, raced)
+	}
+}
@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"chatgpt-clone/backend/middleware"
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/services"
+	"chatgpt-clone/backend/utils"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// teamErrorResponse maps team service errors to HTTP responses
+func teamErrorResponse(c echo.Context, err error, fallback string) error {
+	switch {
+	case errors.Is(err, services.ErrTeamPermission):
+		return utils.ErrorResponse(c, http.StatusForbidden, "Insufficient permissions")
+	case errors.Is(err, services.ErrNotTeamManager), errors.Is(err, services.ErrNotTeamMember), errors.Is(err, mongo.ErrNoDocuments):
+		return utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, services.ErrTeamNameInUse):
+		return utils.ErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, services.ErrInvalidTeamUser):
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+	return utils.ErrorResponse(c, http.StatusInternalServerError, fallback)
+}
+
+// optionalObjectIDParam parses an optional ObjectID query parameter
+func optionalObjectIDParam(c echo.Context, name string) (*primitive.ObjectID, error) {
+	value := c.QueryParam(name)
+	if value == "" {
+		return nil, nil
+	}
+	id, err := primitive.ObjectIDFromHex(value)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+// --- Admin: team management ---
+
+// GetTeams lists the company's teams
+func GetTeams(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	teams, err := services.GetTeamsByCompany(companyID)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve teams")
+	}
+
+	return utils.SuccessResponse(c, "Teams retrieved successfully", teams)
+}
+
+// CreateTeam creates a team with its managers and members
+func CreateTeam(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+
+	var input services.TeamInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	team, err := services.CreateTeam(companyID, adminID, input)
+	if err != nil {
+		return teamErrorResponse(c, err, "Failed to create team")
+	}
+
+	// Log activity
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionCreateTeam,
+		models.ResourceTeam,
+		team.ID.Hex(),
+		"Created team: "+team.Name,
+		true,
+		map[string]interface{}{"managers": len(team.ManagerIDs), "members": len(team.MemberIDs)},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"POST",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "Team created successfully", team)
+}
+
+// UpdateTeam changes a team's details, managers or members
+func UpdateTeam(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+
+	teamID, err := primitive.ObjectIDFromHex(c.Param("team_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid team ID")
+	}
+
+	var input services.UpdateTeamInput
+	if err := c.Bind(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid request body")
+	}
+	if err := c.Validate(&input); err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
+	}
+
+	team, err := services.UpdateTeam(teamID, companyID, input)
+	if err != nil {
+		return teamErrorResponse(c, err, "Failed to update team")
+	}
+
+	// Log activity
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionUpdateTeam,
+		models.ResourceTeam,
+		team.ID.Hex(),
+		"Updated team: "+team.Name,
+		true,
+		map[string]interface{}{"managers": len(team.ManagerIDs), "members": len(team.MemberIDs)},
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"PUT",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "Team updated successfully", team)
+}
+
+// DeleteTeam deletes a team
+func DeleteTeam(c echo.Context) error {
+	companyID, ok := c.Request().Context().Value(middleware.CompanyIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Company context missing")
+	}
+
+	adminID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "User context missing")
+	}
+
+	teamID, err := primitive.ObjectIDFromHex(c.Param("team_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid team ID")
+	}
+
+	if err := services.DeleteTeam(teamID, companyID); err != nil {
+		return teamErrorResponse(c, err, "Failed to delete team")
+	}
+
+	// Log activity
+	services.LogActivity(
+		companyID,
+		adminID,
+		models.ActionDeleteTeam,
+		models.ResourceTeam,
+		teamID.Hex(),
+		"Deleted team",
+		true,
+		nil,
+		c.RealIP(),
+		c.Request().UserAgent(),
+		"DELETE",
+		c.Path(),
+		200,
+		"",
+	)
+
+	return utils.SuccessResponse(c, "Team deleted successfully", nil)
+}
+
+// --- Manager: team scope ---
+
+// GetMyTeams lists the teams the caller manages
+func GetMyTeams(c echo.Context) error {
+	userID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user ID in token")
+	}
+
+	teams, err := services.GetManagedTeams(userID)
+	if err != nil {
+		return teamErrorResponse(c, err, "Failed to retrieve teams")
+	}
+
+	return utils.SuccessResponse(c, "Teams retrieved successfully", teams)
+}
+
+// GetTeamMembers lists the members of the caller's teams (?team_id= for one)
+func GetTeamMembers(c echo.Context) error {
+	userID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user ID in token")
+	}
+
+	teamID, err := optionalObjectIDParam(c, "team_id")
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid team ID")
+	}
+
+	members, err := services.GetTeamMembers(userID, teamID)
+	if err != nil {
+		return teamErrorResponse(c, err, "Failed to retrieve team members")
+	}
+
+	return utils.SuccessResponse(c, "Team members retrieved successfully", members)
+}
+
+// GetTeamActivityLogs returns the activity of the caller's team members
+func GetTeamActivityLogs(c echo.Context) error {
+	userID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user ID in token")
+	}
+
+	page, _ := strconv.Atoi(c.QueryParam("page"))
+	if page < 1 {
+		page = 1
+	}
+
+	limit, _ := strconv.Atoi(c.QueryParam("limit"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	teamID, err := optionalObjectIDParam(c, "team_id")
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid team ID")
+	}
+	memberID, err := optionalObjectIDParam(c, "user_id")
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	logs, total, err := services.GetTeamActivityLogs(userID, teamID, memberID, page, limit, c.QueryParam("action"))
+	if err != nil {
+		return teamErrorResponse(c, err, "Failed to retrieve team activity")
+	}
+
+	return utils.SuccessResponse(c, "Team activity retrieved successfully", map[string]interface{}{
+		"logs":        logs,
+		"total":       total,
+		"page":        page,
+		"limit":       limit,
+		"total_pages": (total + int64(limit) - 1) / int64(limit),
+	})
+}
+
+// GetTeamChats lists the chats of the caller's team members
+func GetTeamChats(c echo.Context) error {
+	userID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user ID in token")
+	}
+
+	teamID, err := optionalObjectIDParam(c, "team_id")
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid team ID")
+	}
+	memberID, err := optionalObjectIDParam(c, "user_id")
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid user ID")
+	}
+
+	chats, err := services.GetTeamChats(userID, teamID, memberID)
+	if err != nil {
+		return teamErrorResponse(c, err, "Failed to retrieve team chats")
+	}
+
+	return utils.SuccessResponse(c, "Team chats retrieved successfully", chats)
+}
+
+// GetTeamChatMessages returns a team member's chat. Access is checked and
+// audited like any other chat read.
+func GetTeamChatMessages(c echo.Context) error {
+	chatID, err := primitive.ObjectIDFromHex(c.Param("chat_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid chat ID")
+	}
+
+	actor := currentActor(c)
+	chat, basis, err := services.AuthorizeChat(actor, chatID, services.AccessRead)
+	if err != nil {
+		return authorizationErrorResponse(c, err, "chat")
+	}
+	auditChatAccess(c, actor, chat, basis, models.ActionViewTeamChat)
+
+	messages, err := services.GetChatMessages(chatID)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve chat")
+	}
+
+	return utils.SuccessResponse(c, "Team chat retrieved successfully", map[string]interface{}{
+		"chat":     chat,
+		"messages": messages,
+	})
+}
@@ -2,6 +2,7 @@ package controllers
 
 import (
 	"chatgpt-clone/backend/middleware"
+	"chatgpt-clone/backend/models"
 	"chatgpt-clone/backend/services"
 	"chatgpt-clone/backend/utils"
 	"net/http"
@@ -49,9 +50,66 @@ func ChangePassword(c echo.Context) error {
 		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
 	}
 
-	if err := services.ChangeUserPassword(userID, input); err != nil {
+	// Keep the current session; every other session is revoked
+	currentJTI, _ := c.Request().Context().Value(middleware.SessionIDKey).(string)
+	if err := services.ChangeUserPassword(userID, input, currentJTI); err != nil {
 		return utils.ErrorResponse(c, http.StatusBadRequest, err.Error())
 	}
 
 	return utils.SuccessResponse(c, "Password changed successfully", nil)
 }
+
+// GetMySessions lists the authenticated user's active sessions.
+func GetMySessions(c echo.Context) error {
+	userID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user ID in token")
+	}
+	currentJTI, _ := c.Request().Context().Value(middleware.SessionIDKey).(string)
+
+	sessions, err := services.GetUserSessions(userID)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to retrieve sessions")
+	}
+	for i := range sessions {
+		sessions[i].Current = sessions[i].JTI == currentJTI
+	}
+
+	return utils.SuccessResponse(c, "Sessions retrieved successfully", sessions)
+}
+
+// RevokeMySession signs out one of the authenticated user's sessions.
+func RevokeMySession(c echo.Context) error {
+	userID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user ID in token")
+	}
+
+	sessionID, err := primitive.ObjectIDFromHex(c.Param("session_id"))
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusBadRequest, "Invalid session ID")
+	}
+
+	if err := services.RevokeUserSession(sessionID, userID, models.SessionRevokedByUser); err != nil {
+		return utils.ErrorResponse(c, http.StatusNotFound, err.Error())
+	}
+
+	return utils.SuccessResponse(c, "Session revoked successfully", nil)
+}
+
+// RevokeMyOtherSessions signs out every session of the authenticated user
+// except the current one.
+func RevokeMyOtherSessions(c echo.Context) error {
+	userID, ok := c.Request().Context().Value(middleware.UserIDKey).(primitive.ObjectID)
+	if !ok {
+		return utils.ErrorResponse(c, http.StatusUnauthorized, "Invalid user ID in token")
+	}
+	currentJTI, _ := c.Request().Context().Value(middleware.SessionIDKey).(string)
+
+	revoked, err := services.RevokeUserSessions(userID, models.SessionRevokedByUser, currentJTI)
+	if err != nil {
+		return utils.ErrorResponse(c, http.StatusInternalServerError, "Failed to revoke sessions")
+	}
+
+	return utils.SuccessResponse(c, "Other sessions revoked successfully", map[string]interface{}{"revoked": revoked})
+}
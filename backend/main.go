@@ -32,6 +32,13 @@ func main() {
 	// Register custom validator
 	e.Validator = utils.NewValidator()
 
+	// Client IP used by rate limits and login lockouts
+	ipExtractor, err := config.IPExtractor()
+	if err != nil {
+		log.Fatal(err)
+	}
+	e.IPExtractor = ipExtractor
+
 	// CORS Configuration
 	allowedOrigin := os.Getenv("FRONTEND_URL")
 	if allowedOrigin == "" {
@@ -45,6 +52,7 @@ func main() {
 		AllowOrigins:     []string{allowedOrigin},
 		AllowHeaders:     []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept, echo.HeaderAuthorization},
 		AllowMethods:     []string{echo.GET, echo.HEAD, echo.PUT, echo.PATCH, echo.POST, echo.DELETE},
+		ExposeHeaders:    []string{"X-Budget-Warning", "Retry-After", "X-RateLimit-Limit", "X-RateLimit-Remaining", "X-RateLimit-Reset"},
 		AllowCredentials: true,
 	}))
 
@@ -3,11 +3,13 @@ package middleware
 import (
 	"chatgpt-clone/backend/services"
 	"context"
+	"errors"
 	"net/http"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
 // A private key for our context to avoid collisions.
@@ -25,6 +27,7 @@ const (
 	RoleNameKey      contextKey = "roleName"
 	PermissionsKey   contextKey = "permissions"
 	IsSuperAdminKey  contextKey = "isSuperAdmin"
+	SessionIDKey     contextKey = "sessionID" // The token's jti
 )
 
 // AuthMiddleware is the JWT authentication middleware that reads from a cookie.
@@ -50,6 +53,10 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		})
 
 		if err != nil {
+			// Access tokens are short-lived; the client should call /api/auth/refresh
+			if errors.Is(err, jwt.ErrTokenExpired) {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Token expired"})
+			}
 			return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid token"})
 		}
 
@@ -65,8 +72,19 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 				return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Invalid user ID in token"})
 			}
 
+			// The token must belong to a live server-side session
+			jti, _ := claims["jti"].(string)
+			if jti == "" {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Session expired, please log in again"})
+			}
+			session, err := services.ValidateSession(jti)
+			if err != nil || session.UserID != userID {
+				return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Session expired, please log in again"})
+			}
+
 			// Start with user ID in context
 			ctx := context.WithValue(c.Request().Context(), UserIDKey, userID)
+			ctx = context.WithValue(ctx, SessionIDKey, jti)
 			ctx = context.WithValue(ctx, UserIDStrKey, userIDStr)
 			if userEmail, ok := claims["user_email"].(string); ok && userEmail != "" {
 				ctx = context.WithValue(ctx, UserEmailKey, userEmail)
@@ -84,35 +102,19 @@ func AuthMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 				ctx = context.WithValue(ctx, CompanyDomainKey, companyDomain)
 			}
 
-			// Extract role information
-			if roleIDStr, ok := claims["role_id"].(string); ok && roleIDStr != "" {
-				roleID, err := primitive.ObjectIDFromHex(roleIDStr)
-				if err == nil {
-					ctx = context.WithValue(ctx, RoleIDKey, roleID)
-				}
-			}
-
-			if roleName, ok := claims["role_name"].(string); ok {
-				ctx = context.WithValue(ctx, RoleNameKey, roleName)
-			}
-
-			// Extract permissions array
-			if permsInterface, ok := claims["permissions"]; ok {
-				if permsArray, ok := permsInterface.([]interface{}); ok {
-					permissions := make([]string, 0, len(permsArray))
-					for _, p := range permsArray {
-						if pStr, ok := p.(string); ok {
-							permissions = append(permissions, pStr)
-						}
-					}
-					ctx = context.WithValue(ctx, PermissionsKey, permissions)
+			// Resolve role and permissions from the user's current role rather
+			// than trusting the token, so role changes apply immediately
+			access, err := services.ResolveAccess(userID)
+			if err != nil {
+				if errors.Is(err, services.ErrUserInactive) || errors.Is(err, mongo.ErrNoDocuments) {
+					return c.JSON(http.StatusUnauthorized, map[string]string{"message": "Session expired, please log in again"})
 				}
+				return c.JSON(http.StatusInternalServerError, map[string]string{"message": "Failed to resolve permissions"})
 			}
-
-			// Extract super admin flag
-			if isSuperAdmin, ok := claims["is_super_admin"].(bool); ok {
-				ctx = context.WithValue(ctx, IsSuperAdminKey, isSuperAdmin)
-			}
+			ctx = context.WithValue(ctx, RoleIDKey, access.RoleID)
+			ctx = context.WithValue(ctx, RoleNameKey, access.RoleName)
+			ctx = context.WithValue(ctx, PermissionsKey, access.Permissions)
+			ctx = context.WithValue(ctx, IsSuperAdminKey, access.IsSuperAdmin)
 
 			c.SetRequest(c.Request().WithContext(ctx))
 
@@ -0,0 +1,118 @@
+package middleware
+
+import (
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/services"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RateLimit applies the token-bucket limits of a route group. Each scope
+// (services.RateLimitScopeIP, ...User, ...Company) is checked against its own
+// bucket; the request is rejected if any bucket is empty. User and company
+// scopes need AuthMiddleware to have run and are skipped otherwise.
+//
+// X-RateLimit-Limit/Remaining/Reset describe the most constrained bucket, and
+// a rejected request gets Retry-After plus an activity log entry.
+func RateLimit(group string, scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			userID, _ := c.Request().Context().Value(UserIDKey).(primitive.ObjectID)
+			companyID, _ := c.Request().Context().Value(CompanyIDKey).(primitive.ObjectID)
+
+			var tightest *services.RateLimitResult
+			for _, scope := range scopes {
+				var id string
+				switch scope {
+				case services.RateLimitScopeIP:
+					id = c.RealIP()
+				case services.RateLimitScopeUser:
+					if userID.IsZero() {
+						continue
+					}
+					id = userID.Hex()
+				case services.RateLimitScopeCompany:
+					if companyID.IsZero() {
+						continue
+					}
+					id = companyID.Hex()
+				}
+
+				rate, ok := services.RateLimitFor(group, scope, companyID)
+				if !ok {
+					continue
+				}
+
+				result, err := services.TakeRateLimit(c.Request().Context(), group, scope, id, rate)
+				if err != nil {
+					// Fail open: a broken store must not take the API down.
+					log.Printf("Rate limiter error (%s/%s): %v", group, scope, err)
+					continue
+				}
+
+				if !result.Allowed {
+					setRateLimitHeaders(c, result)
+					retryAfter := int(math.Ceil(result.RetryAfter.Seconds()))
+					if retryAfter < 1 {
+						retryAfter = 1
+					}
+					c.Response().Header().Set("Retry-After", strconv.Itoa(retryAfter))
+					logRateLimited(c, userID, companyID, group, scope, result)
+					return echo.NewHTTPError(http.StatusTooManyRequests, fmt.Sprintf("Too many requests; try again in %d seconds", retryAfter))
+				}
+
+				if tightest == nil || result.Remaining < tightest.Remaining {
+					r := result
+					tightest = &r
+				}
+			}
+
+			if tightest != nil {
+				setRateLimitHeaders(c, *tightest)
+			}
+			return next(c)
+		}
+	}
+}
+
+func setRateLimitHeaders(c echo.Context, result services.RateLimitResult) {
+	h := c.Response().Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(result.Limit))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds()))))
+}
+
+func logRateLimited(c echo.Context, userID, companyID primitive.ObjectID, group, scope string, result services.RateLimitResult) {
+	ip := c.RealIP()
+	userAgent := c.Request().UserAgent()
+	method := c.Request().Method
+	path := c.Path()
+
+	go services.LogActivity(
+		companyID,
+		userID,
+		models.ActionRateLimited,
+		models.ResourceRateLimit,
+		group+":"+scope,
+		fmt.Sprintf("Rate limit exceeded for %s (%s)", group, scope),
+		false,
+		map[string]interface{}{
+			"group":       group,
+			"scope":       scope,
+			"limit":       result.Limit,
+			"retry_after": result.RetryAfter.Seconds(),
+		},
+		ip,
+		userAgent,
+		method,
+		path,
+		http.StatusTooManyRequests,
+		"rate limit exceeded",
+	)
+}
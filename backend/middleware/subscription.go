@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/services"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RequireActiveSubscription blocks requests from companies whose subscription
+// is suspended or cancelled. Super admins are never blocked.
+func RequireActiveSubscription() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			if isSuperAdmin, ok := c.Request().Context().Value(IsSuperAdminKey).(bool); ok && isSuperAdmin {
+				return next(c)
+			}
+
+			companyID, ok := c.Request().Context().Value(CompanyIDKey).(primitive.ObjectID)
+			if !ok {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Company context missing")
+			}
+
+			company, err := services.GetCompanyByID(companyID)
+			if err != nil {
+				return echo.NewHTTPError(http.StatusUnauthorized, "Company not found")
+			}
+
+			switch company.SubscriptionStatus {
+			case models.SubscriptionSuspended:
+				return echo.NewHTTPError(http.StatusPaymentRequired, "Company subscription is suspended; an administrator must update billing")
+			case models.SubscriptionCancelled:
+				return echo.NewHTTPError(http.StatusForbidden, "Company subscription has been cancelled")
+			}
+
+			return next(c)
+		}
+	}
+}
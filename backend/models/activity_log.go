@@ -42,24 +42,50 @@ const (
 	ActionDeactivateUser   = "deactivate_user"
 	ActionActivateUser     = "activate_user"
 	ActionAssignRole       = "assign_role"
+	ActionCreateRole       = "create_role"
+	ActionUpdateRole       = "update_role"
+	ActionDeleteRole       = "delete_role"
 	ActionCreateChat       = "create_chat"
 	ActionDeleteChat       = "delete_chat"
+	ActionViewChat         = "view_chat"
+	ActionDeleteMessage    = "delete_message"
 	ActionSendMessage      = "send_message"
 	ActionUploadDocument   = "upload_document"
+	ActionSetDocumentACL   = "set_document_acl"
+	ActionResyncDocument   = "resync_document"
+	ActionReplaceDocument  = "replace_document"
+	ActionRollbackDocument = "rollback_document"
+	ActionImportDocuments  = "import_documents"
 	ActionUpdateSettings   = "update_settings"
 	ActionViewActivityLogs = "view_activity_logs"
 	ActionViewAnalytics    = "view_analytics"
 	ActionCreateCompany    = "create_company"
 	ActionUpdateCompany    = "update_company"
+	ActionBudgetSoftLimit  = "budget_soft_limit"
+	ActionBudgetExceeded   = "budget_exceeded"
+	ActionGrantOverride    = "grant_budget_override"
+	ActionRevokeOverride   = "revoke_budget_override"
+	ActionRateLimited      = "rate_limited"
+	ActionAccountLocked    = "account_locked"
+	ActionAccountUnlocked  = "account_unlocked"
+	ActionRevokeSessions   = "revoke_sessions"
+	ActionRefreshReuse     = "refresh_token_reuse"
+	ActionCreateTeam       = "create_team"
+	ActionUpdateTeam       = "update_team"
+	ActionDeleteTeam       = "delete_team"
+	ActionViewTeamChat     = "view_team_chat"
 )
 
 // Resource type constants
 const (
-	ResourceUser     = "user"
-	ResourceCompany  = "company"
-	ResourceRole     = "role"
-	ResourceChat     = "chat"
-	ResourceMessage  = "message"
-	ResourceDocument = "document"
-	ResourceSettings = "settings"
+	ResourceUser      = "user"
+	ResourceCompany   = "company"
+	ResourceRole      = "role"
+	ResourceTeam      = "team"
+	ResourceChat      = "chat"
+	ResourceMessage   = "message"
+	ResourceDocument  = "document"
+	ResourceSettings  = "settings"
+	ResourceBudget    = "budget"
+	ResourceRateLimit = "rate_limit"
 )
@@ -0,0 +1,19 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// BudgetOverride temporarily raises a monthly budget for a company or one of
+// its users. Extra allowances are added on top of the configured budget while
+// the override has not expired.
+type BudgetOverride struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID     primitive.ObjectID `bson:"company_id" json:"company_id"`
+	UserID        primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"` // Empty = applies to the company budget
+	ExtraTokens   int64              `bson:"extra_tokens,omitempty" json:"extra_tokens,omitempty"`
+	ExtraRequests int64              `bson:"extra_requests,omitempty" json:"extra_requests,omitempty"`
+	Unlimited     bool               `bson:"unlimited,omitempty" json:"unlimited,omitempty"` // Lift the hard limit entirely
+	Reason        string             `bson:"reason" json:"reason"`
+	ExpiresAt     primitive.DateTime `bson:"expires_at" json:"expires_at"`
+	CreatedBy     primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt     primitive.DateTime `bson:"created_at" json:"created_at"`
+}
@@ -3,11 +3,22 @@ package models
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Chat struct {
-	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	CompanyID  primitive.ObjectID `bson:"company_id" json:"company_id"` // Tenant isolation
-	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
-	Title      string             `bson:"title" json:"title"`
-	CreatedAt  primitive.DateTime `bson:"created_at" json:"created_at"`
-	UpdatedAt  primitive.DateTime `bson:"updated_at" json:"updated_at"`
-	IsArchived bool               `bson:"is_archived" json:"is_archived"`
+	ID             primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID      primitive.ObjectID  `bson:"company_id" json:"company_id"` // Tenant isolation
+	UserID         primitive.ObjectID  `bson:"user_id" json:"user_id"`
+	Title          string              `bson:"title" json:"title"`
+	CreatedAt      primitive.DateTime  `bson:"created_at" json:"created_at"`
+	UpdatedAt      primitive.DateTime  `bson:"updated_at" json:"updated_at"`
+	IsArchived     bool                `bson:"is_archived" json:"is_archived"`
+	HistorySummary *ChatHistorySummary `bson:"history_summary,omitempty" json:"-"` // Rolling summary of messages that no longer fit the context window
+}
+
+// ChatHistorySummary condenses the first Through messages of a chat, the last
+// of which is LastMessageID. A summary whose last message no longer sits at
+// that position (e.g. after a deletion) is stale and ignored.
+type ChatHistorySummary struct {
+	Text          string             `bson:"text"`
+	Through       int                `bson:"through"`
+	LastMessageID primitive.ObjectID `bson:"last_message_id"`
+	UpdatedAt     primitive.DateTime `bson:"updated_at"`
 }
@@ -15,6 +15,7 @@ type Company struct {
 	SubscriptionTier   string `bson:"subscription_tier" json:"subscription_tier"`     // "free", "basic", "premium", "enterprise"
 	SubscriptionStatus string `bson:"subscription_status" json:"subscription_status"` // "active", "suspended", "cancelled"
 	MaxUsers           int    `bson:"max_users" json:"max_users"`
+	ActiveUsers        int    `bson:"active_users" json:"active_users"` // Seats taken, kept by ReserveSeat and ReleaseSeat
 
 	// Settings
 	Settings CompanySettings `bson:"settings" json:"settings"`
@@ -36,4 +37,79 @@ type CompanySettings struct {
 	MaxMessagesPerChat       int      `bson:"max_messages_per_chat" json:"max_messages_per_chat"`
 	EnableDocumentUpload     bool     `bson:"enable_document_upload" json:"enable_document_upload"`
 	MaxDocumentSize          int64    `bson:"max_document_size" json:"max_document_size"` // in bytes
+
+	// LLM routing
+	LLMProvider string `bson:"llm_provider,omitempty" json:"llm_provider,omitempty"` // "enterprise_assistant", "gemini", "openai", "echo"; empty = platform default
+	LLMModel    string `bson:"llm_model,omitempty" json:"llm_model,omitempty"`       // Provider model override, e.g. "gemini-2.5-pro"
+	// Ordered hops tried when the previous one fails, as "provider" or
+	// "provider:model", e.g. ["enterprise_assistant", "gemini", "unavailable"].
+	// Empty = LLMProvider followed by the platform default chain.
+	LLMFallbackChain []string `bson:"llm_fallback_chain,omitempty" json:"llm_fallback_chain,omitempty"`
+
+	// Monthly budgets (calendar month, UTC). Zero = unlimited.
+	MonthlyTokenBudget       int64            `bson:"monthly_token_budget,omitempty" json:"monthly_token_budget,omitempty"`               // Whole company
+	MonthlyRequestBudget     int64            `bson:"monthly_request_budget,omitempty" json:"monthly_request_budget,omitempty"`           // Whole company
+	UserMonthlyTokenBudget   int64            `bson:"user_monthly_token_budget,omitempty" json:"user_monthly_token_budget,omitempty"`     // Each user
+	UserMonthlyRequestBudget int64            `bson:"user_monthly_request_budget,omitempty" json:"user_monthly_request_budget,omitempty"` // Each user
+	RoleMonthlyTokenBudgets  map[string]int64 `bson:"role_monthly_token_budgets,omitempty" json:"role_monthly_token_budgets,omitempty"`   // Role name -> per-user tokens, replaces UserMonthlyTokenBudget
+	BudgetSoftLimitPercent   int              `bson:"budget_soft_limit_percent,omitempty" json:"budget_soft_limit_percent,omitempty"`     // Warn at this share of a budget; 0 = 80
+}
+
+// Subscription tiers
+const (
+	TierFree       = "free"
+	TierBasic      = "basic"
+	TierPremium    = "premium"
+	TierEnterprise = "enterprise"
+)
+
+// Subscription statuses
+const (
+	SubscriptionActive    = "active"
+	SubscriptionSuspended = "suspended" // Billing problem: only admins may log in, chat is blocked
+	SubscriptionCancelled = "cancelled" // No logins
+)
+
+// TierLimits holds the seat count and quota settings that come with a
+// subscription tier. Zero means unlimited.
+type TierLimits struct {
+	MaxUsers           int
+	MaxChatsPerUser    int
+	MaxMessagesPerChat int
+	MaxDocumentSize    int64 // in bytes
+}
+
+// GetTierLimits returns the default limits for a subscription tier. Unknown
+// tiers get the free tier limits and ok=false.
+func GetTierLimits(tier string) (limits TierLimits, ok bool) {
+	switch tier {
+	case TierFree:
+		return TierLimits{MaxUsers: 10, MaxChatsPerUser: 100, MaxMessagesPerChat: 1000, MaxDocumentSize: 10 * 1024 * 1024}, true
+	case TierBasic:
+		return TierLimits{MaxUsers: 50, MaxChatsPerUser: 500, MaxMessagesPerChat: 2000, MaxDocumentSize: 25 * 1024 * 1024}, true
+	case TierPremium:
+		return TierLimits{MaxUsers: 250, MaxChatsPerUser: 2000, MaxMessagesPerChat: 5000, MaxDocumentSize: 50 * 1024 * 1024}, true
+	case TierEnterprise:
+		return TierLimits{MaxUsers: 0, MaxChatsPerUser: 0, MaxMessagesPerChat: 0, MaxDocumentSize: 100 * 1024 * 1024}, true
+	default:
+		limits, _ = GetTierLimits(TierFree)
+		return limits, false
+	}
+}
+
+// ApplyTo copies the tier's quota limits into settings, leaving the rest of
+// the company's preferences untouched.
+func (l TierLimits) ApplyTo(settings *CompanySettings) {
+	settings.MaxChatsPerUser = l.MaxChatsPerUser
+	settings.MaxMessagesPerChat = l.MaxMessagesPerChat
+	settings.MaxDocumentSize = l.MaxDocumentSize
+}
+
+// IsValidSubscriptionStatus reports whether status is a known subscription status.
+func IsValidSubscriptionStatus(status string) bool {
+	switch status {
+	case SubscriptionActive, SubscriptionSuspended, SubscriptionCancelled:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,105 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Ingestion job kinds
+const (
+	JobKindChatDocument        = "chat_document"         // File attached to a chat: extract, summarise, post messages
+	JobKindKnowledgeBase       = "knowledge_base"        // KB upload or new version: extract, index upstream, save
+	JobKindKnowledgeBaseImport = "knowledge_base_import" // ZIP archive: queue a knowledge_base job per document
+)
+
+// Ingestion job states
+const (
+	JobStatusQueued    = "queued"
+	JobStatusRunning   = "running"
+	JobStatusSucceeded = "succeeded"
+	JobStatusFailed    = "failed"
+)
+
+// Ingestion job stages, in order
+const (
+	JobStageQueued      = "queued"
+	JobStageExtracting  = "extracting"
+	JobStageUploading   = "uploading"
+	JobStageSummarizing = "summarizing"
+	JobStageSaving      = "saving"
+	JobStageDone        = "done"
+)
+
+// IngestionJob is an uploaded document waiting for, or going through, text
+// extraction and indexing by the ingestion workers. The file is kept in
+// GridFS until the job finishes, so queued and interrupted jobs survive
+// restarts.
+type IngestionJob struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID primitive.ObjectID `bson:"company_id" json:"company_id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Kind      string             `bson:"kind" json:"kind"`
+	Status    string             `bson:"status" json:"status"`
+	Stage     string             `bson:"stage" json:"stage"`
+	Progress  int                `bson:"progress" json:"progress"` // Percent
+	Error     string             `bson:"error,omitempty" json:"error,omitempty"`
+
+	Filename    string             `bson:"filename" json:"filename"`
+	MimeType    string             `bson:"mime_type" json:"mime_type"`
+	Size        int64              `bson:"size" json:"size"`
+	ContentHash string             `bson:"content_hash" json:"content_hash"` // SHA-256 of the file
+	FileID      primitive.ObjectID `bson:"file_id" json:"-"`                 // GridFS file, deleted when the job finishes
+
+	// Kind specific parameters
+	ChatID     *primitive.ObjectID `bson:"chat_id,omitempty" json:"chat_id,omitempty"`
+	ReplacesID *primitive.ObjectID `bson:"replaces_id,omitempty" json:"replaces_id,omitempty"` // KB document to add a version to
+	ACL        *DocumentACL        `bson:"acl,omitempty" json:"acl,omitempty"`
+	KeepACL    bool                `bson:"keep_acl,omitempty" json:"keep_acl,omitempty"` // New versions inherit the current access list
+	Tags       []string            `bson:"tags,omitempty" json:"tags,omitempty"`
+	BatchID    *primitive.ObjectID `bson:"batch_id,omitempty" json:"batch_id,omitempty"` // Bulk import the job belongs to
+
+	// Checkpoints, so that a job resumed after a restart skips finished steps
+	ExtractedText string             `bson:"extracted_text,omitempty" json:"-"`
+	Result        IngestionJobResult `bson:"result" json:"result"`
+
+	Attempts      int                 `bson:"attempts" json:"attempts"`
+	RunAfter      *primitive.DateTime `bson:"run_after,omitempty" json:"run_after,omitempty"`
+	LeaseUntil    *primitive.DateTime `bson:"lease_until,omitempty" json:"-"`
+	RequestOrigin RequestOrigin       `bson:"request_origin" json:"-"`
+	CreatedAt     primitive.DateTime  `bson:"created_at" json:"created_at"`
+	UpdatedAt     primitive.DateTime  `bson:"updated_at" json:"updated_at"`
+	StartedAt     *primitive.DateTime `bson:"started_at,omitempty" json:"started_at,omitempty"`
+	FinishedAt    *primitive.DateTime `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+// IngestionJobResult is what a job produced; fields fill in as steps finish
+type IngestionJobResult struct {
+	UserMessageID *primitive.ObjectID `bson:"user_message_id,omitempty" json:"user_message_id,omitempty"`
+	AIMessageID   *primitive.ObjectID `bson:"ai_message_id,omitempty" json:"ai_message_id,omitempty"`
+	DocumentID    *primitive.ObjectID `bson:"document_id,omitempty" json:"document_id,omitempty"` // KB document version created
+	Version       int                 `bson:"version,omitempty" json:"version,omitempty"`
+	SyncStatus    string              `bson:"sync_status,omitempty" json:"sync_status,omitempty"`
+	UpstreamError string              `bson:"upstream_error,omitempty" json:"upstream_error,omitempty"`
+	ChunksCreated int                 `bson:"chunks_created,omitempty" json:"chunks_created,omitempty"`
+	Summary       string              `bson:"summary,omitempty" json:"summary,omitempty"`
+	Skipped       string              `bson:"skipped,omitempty" json:"skipped,omitempty"`               // Why nothing was stored, e.g. unchanged or duplicate content
+	ImportEntries []ImportEntry       `bson:"import_entries,omitempty" json:"import_entries,omitempty"` // Archive entries an import did not queue
+}
+
+// ImportEntry is an archive entry a bulk import skipped or rejected
+type ImportEntry struct {
+	Path        string `bson:"path" json:"path"`
+	Status      string `bson:"status" json:"status"`
+	Reason      string `bson:"reason,omitempty" json:"reason,omitempty"`
+	DuplicateOf string `bson:"duplicate_of,omitempty" json:"duplicate_of,omitempty"`
+}
+
+// RequestOrigin is the request that queued a job, for the activity log
+type RequestOrigin struct {
+	IPAddress string `bson:"ip_address,omitempty"`
+	UserAgent string `bson:"user_agent,omitempty"`
+	Method    string `bson:"method,omitempty"`
+	Path      string `bson:"path,omitempty"`
+}
+
+// Finished reports whether the job reached a final state
+func (j *IngestionJob) Finished() bool {
+	return j.Status == JobStatusSucceeded || j.Status == JobStatusFailed
+}
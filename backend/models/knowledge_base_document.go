@@ -2,18 +2,58 @@ package models
 
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
+// Knowledge base document sync states
+const (
+	KBStatusSynced        = "synced"
+	KBStatusPendingSync   = "pending_sync"   // Upstream upload failed; queued for the sync worker
+	KBStatusFailed        = "failed"         // A retry failed; retried with backoff until the attempt cap
+	KBStatusPendingDelete = "pending_delete" // Tombstone: deleted locally, upstream delete still being retried
+	KBStatusSuperseded    = "superseded"     // An older version; kept for history, not indexed upstream
+)
+
+// KnowledgeBaseDocument is one version of a knowledge base document. All
+// versions share a LogicalID; only the current one is listed and indexed.
 type KnowledgeBaseDocument struct {
-	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
-	CompanyID     primitive.ObjectID `bson:"company_id" json:"company_id"`
-	UploadedBy    primitive.ObjectID `bson:"uploaded_by" json:"uploaded_by"`
-	Filename      string             `bson:"filename" json:"filename"`
-	MimeType      string             `bson:"mime_type" json:"mime_type"`
-	Action        string             `bson:"action" json:"action"`
-	ExtractedText string             `bson:"extracted_text" json:"extracted_text"`
-	Status        string             `bson:"status" json:"status"` // synced | pending_sync | failed
-	UpstreamError string             `bson:"upstream_error,omitempty" json:"upstream_error,omitempty"`
-	DocumentID    string             `bson:"document_id,omitempty" json:"document_id,omitempty"`
-	ChunksCreated int                `bson:"chunks_created,omitempty" json:"chunks_created,omitempty"`
-	CreatedAt     primitive.DateTime `bson:"created_at" json:"created_at"`
-	UpdatedAt     primitive.DateTime `bson:"updated_at" json:"updated_at"`
+	ID            primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID     primitive.ObjectID  `bson:"company_id" json:"company_id"`
+	LogicalID     primitive.ObjectID  `bson:"logical_id" json:"logical_id"`
+	Version       int                 `bson:"version" json:"version"`
+	IsCurrent     bool                `bson:"is_current" json:"is_current"`
+	RestoredFrom  int                 `bson:"restored_from,omitempty" json:"restored_from,omitempty"` // Version a rollback copied
+	UploadedBy    primitive.ObjectID  `bson:"uploaded_by" json:"uploaded_by"`
+	Filename      string              `bson:"filename" json:"filename"`
+	MimeType      string              `bson:"mime_type" json:"mime_type"`
+	ContentHash   string              `bson:"content_hash,omitempty" json:"content_hash,omitempty"` // SHA-256 of the uploaded file; unique among current documents
+	Action        string              `bson:"action" json:"action"`
+	ExtractedText string              `bson:"extracted_text" json:"extracted_text"`
+	Status        string              `bson:"status" json:"status"` // synced | pending_sync | failed | pending_delete | superseded
+	UpstreamError string              `bson:"upstream_error,omitempty" json:"upstream_error,omitempty"`
+	SyncAttempts  int                 `bson:"sync_attempts,omitempty" json:"sync_attempts,omitempty"`
+	NextSyncAt    *primitive.DateTime `bson:"next_sync_at,omitempty" json:"next_sync_at,omitempty"` // Unset once synced or out of attempts
+	LastSyncAt    *primitive.DateTime `bson:"last_sync_at,omitempty" json:"last_sync_at,omitempty"`
+	SyncingUntil  *primitive.DateTime `bson:"syncing_until,omitempty" json:"-"` // Lease held while an upstream call is in flight
+	DocumentID    string              `bson:"document_id,omitempty" json:"document_id,omitempty"`
+	ChunksCreated int                 `bson:"chunks_created,omitempty" json:"chunks_created,omitempty"`
+	// Upstream copies superseded by a replace, deleted by the sync worker
+	StaleDocumentIDs []string            `bson:"stale_document_ids,omitempty" json:"stale_document_ids,omitempty"`
+	PurgeAttempts    int                 `bson:"purge_attempts,omitempty" json:"purge_attempts,omitempty"`
+	NextPurgeAt      *primitive.DateTime `bson:"next_purge_at,omitempty" json:"next_purge_at,omitempty"`
+	ACL              *DocumentACL        `bson:"acl,omitempty" json:"acl,omitempty"`   // Nil means visible to the whole company
+	Tags             []string            `bson:"tags,omitempty" json:"tags,omitempty"` // Folder paths of bulk imports, e.g. "HR", "HR/Leave"
+	CreatedAt        primitive.DateTime  `bson:"created_at" json:"created_at"`
+	UpdatedAt        primitive.DateTime  `bson:"updated_at" json:"updated_at"`
+}
+
+// DocumentACL restricts a knowledge base document to the users it lists by
+// role name, department or ID. A user matching any entry may read the
+// document, and only their questions are answered from it.
+type DocumentACL struct {
+	Roles       []string             `bson:"roles,omitempty" json:"roles,omitempty"`
+	Departments []string             `bson:"departments,omitempty" json:"departments,omitempty"`
+	UserIDs     []primitive.ObjectID `bson:"user_ids,omitempty" json:"user_ids,omitempty"`
+}
+
+// IsEmpty reports whether the ACL lists nobody, i.e. does not restrict access
+func (a *DocumentACL) IsEmpty() bool {
+	return a == nil || len(a.Roles) == 0 && len(a.Departments) == 0 && len(a.UserIDs) == 0
 }
@@ -0,0 +1,24 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Lockout subjects
+const (
+	LockoutSubjectAccount = "account" // A (company, email) pair
+	LockoutSubjectIP      = "ip"      // A client IP across all companies
+)
+
+// LoginLockout tracks the lockout state of one account or IP. Failures
+// themselves are counted from failed_login entries in activity_logs since
+// ResetAt.
+type LoginLockout struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	Subject     string             `bson:"subject" json:"subject"`                           // "account" or "ip"
+	CompanyID   primitive.ObjectID `bson:"company_id,omitempty" json:"company_id,omitempty"` // Account lockouts only
+	Email       string             `bson:"email,omitempty" json:"email,omitempty"`           // Account lockouts only
+	IPAddress   string             `bson:"ip_address,omitempty" json:"ip_address,omitempty"` // IP lockouts only
+	LockCount   int                `bson:"lock_count" json:"lock_count"`                     // Consecutive locks; drives the progressive duration
+	LockedUntil primitive.DateTime `bson:"locked_until,omitempty" json:"locked_until,omitempty"`
+	ResetAt     primitive.DateTime `bson:"reset_at,omitempty" json:"reset_at,omitempty"` // Failures before this are ignored
+	UpdatedAt   primitive.DateTime `bson:"updated_at" json:"updated_at"`
+}
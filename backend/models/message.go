@@ -8,10 +8,17 @@ type Message struct {
 	Role         string             `bson:"role" json:"role"` // "user" or "assistant"
 	Content      string             `bson:"content" json:"content"`
 	Timestamp    primitive.DateTime `bson:"timestamp" json:"timestamp"`
-	TokenCount   int                `bson:"token_count,omitempty" json:"token_count,omitempty"`
+	TokenCount   int                `bson:"token_count,omitempty" json:"token_count,omitempty"` // Prompt + completion for assistant messages
 	ModelUsed    string             `bson:"model_used,omitempty" json:"model_used,omitempty"`
 	ResponseTime float64            `bson:"response_time,omitempty" json:"response_time,omitempty"` // in seconds
+	Provider     string             `bson:"provider,omitempty" json:"provider,omitempty"`           // LLM provider that answered
+	FallbackHop  int                `bson:"fallback_hop,omitempty" json:"fallback_hop,omitempty"`   // Position in the fallback chain (0 = primary)
 	Attachments  []Attachment       `bson:"attachments,omitempty" json:"attachments,omitempty"`
+
+	// Token accounting (assistant messages)
+	PromptTokens     int  `bson:"prompt_tokens,omitempty" json:"prompt_tokens,omitempty"`
+	CompletionTokens int  `bson:"completion_tokens,omitempty" json:"completion_tokens,omitempty"`
+	TokensEstimated  bool `bson:"tokens_estimated,omitempty" json:"tokens_estimated,omitempty"` // Counts estimated locally, not reported by the provider
 }
 
 type Attachment struct {
@@ -19,6 +26,7 @@ type Attachment struct {
 	Filename      string             `bson:"filename" json:"filename"`
 	MimeType      string             `bson:"mime_type" json:"mime_type"`
 	Size          int64              `bson:"size" json:"size"`
+	ContentHash   string             `bson:"content_hash,omitempty" json:"content_hash,omitempty"` // SHA-256 of the uploaded file
 	URL           string             `bson:"url,omitempty" json:"url,omitempty"`
 	UploadedAt    primitive.DateTime `bson:"uploaded_at" json:"uploaded_at"`
 	ProcessedData string             `bson:"processed_data,omitempty" json:"processed_data,omitempty"` // Summary or extracted text
@@ -53,6 +53,80 @@ const (
 	RoleEmployee     = "employee"
 )
 
+// Permission groups used by the catalogue
+const (
+	PermissionGroupPlatform = "platform"
+	PermissionGroupUsers    = "users"
+	PermissionGroupRoles    = "roles"
+	PermissionGroupCompany  = "company"
+	PermissionGroupTeam     = "team"
+	PermissionGroupChat     = "chat"
+	PermissionGroupProfile  = "profile"
+)
+
+// PermissionInfo describes a permission in the catalogue
+type PermissionInfo struct {
+	Key          string   `json:"key"`
+	Description  string   `json:"description"`
+	Group        string   `json:"group"`
+	GrantableBy  []string `json:"grantable_by"`  // Role names allowed to grant it
+	PlatformOnly bool     `json:"platform_only"` // Only super admins can grant it
+}
+
+var (
+	grantableBySuperAdmin   = []string{RoleSuperAdmin}
+	grantableByCompanyAdmin = []string{RoleSuperAdmin, RoleCompanyAdmin}
+)
+
+// PermissionCatalogue lists every permission the application checks, in
+// display order
+var PermissionCatalogue = []PermissionInfo{
+	{PermissionManageCompanies, "Create, update and deactivate any company", PermissionGroupPlatform, grantableBySuperAdmin, true},
+	{PermissionViewAllCompanies, "View every company on the platform", PermissionGroupPlatform, grantableBySuperAdmin, true},
+	{PermissionManageUsers, "Create, update, deactivate and unlock users", PermissionGroupUsers, grantableByCompanyAdmin, false},
+	{PermissionViewUsers, "View the company's users", PermissionGroupUsers, grantableByCompanyAdmin, false},
+	{PermissionManageRoles, "Create, edit and delete roles and their permissions", PermissionGroupRoles, grantableByCompanyAdmin, false},
+	{PermissionViewRoles, "View roles and the permission catalogue", PermissionGroupRoles, grantableByCompanyAdmin, false},
+	{PermissionManageCompanySettings, "Change company settings, budgets and sessions", PermissionGroupCompany, grantableByCompanyAdmin, false},
+	{PermissionViewActivityLogs, "View the company's activity logs", PermissionGroupCompany, grantableByCompanyAdmin, false},
+	{PermissionViewAnalytics, "View usage statistics and token reports", PermissionGroupCompany, grantableByCompanyAdmin, false},
+	{PermissionViewTeamUsers, "View members of the teams they manage", PermissionGroupTeam, grantableByCompanyAdmin, false},
+	{PermissionViewTeamActivity, "View activity of the teams they manage", PermissionGroupTeam, grantableByCompanyAdmin, false},
+	{PermissionManageTeamChats, "View and manage chats of the teams they manage", PermissionGroupTeam, grantableByCompanyAdmin, false},
+	{PermissionCreateChat, "Start new chats", PermissionGroupChat, grantableByCompanyAdmin, false},
+	{PermissionViewOwnChats, "View their own chats", PermissionGroupChat, grantableByCompanyAdmin, false},
+	{PermissionManageOwnChats, "Rename and delete their own chats", PermissionGroupChat, grantableByCompanyAdmin, false},
+	{PermissionSendMessages, "Send messages to the assistant", PermissionGroupChat, grantableByCompanyAdmin, false},
+	{PermissionUploadDocuments, "Upload documents to chats and the knowledge base", PermissionGroupChat, grantableByCompanyAdmin, false},
+	{PermissionViewOwnProfile, "View their own profile", PermissionGroupProfile, grantableByCompanyAdmin, false},
+	{PermissionEditOwnProfile, "Edit their own profile and password", PermissionGroupProfile, grantableByCompanyAdmin, false},
+}
+
+// GetPermissionInfo looks up a permission in the catalogue
+func GetPermissionInfo(permission string) (PermissionInfo, bool) {
+	for _, info := range PermissionCatalogue {
+		if info.Key == permission {
+			return info, true
+		}
+	}
+	return PermissionInfo{}, false
+}
+
+// IsKnownPermission checks if a permission string is in the catalogue
+func IsKnownPermission(permission string) bool {
+	_, ok := GetPermissionInfo(permission)
+	return ok
+}
+
+// IsSystemRoleName checks if a role name is reserved for the seeded roles
+func IsSystemRoleName(name string) bool {
+	switch name {
+	case RoleSuperAdmin, RoleCompanyAdmin, RoleManager, RoleEmployee:
+		return true
+	}
+	return false
+}
+
 // GetDefaultPermissions returns default permissions for each role
 func GetDefaultPermissions(roleName string) []string {
 	switch roleName {
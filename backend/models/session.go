@@ -0,0 +1,41 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Session revocation reasons
+const (
+	SessionRevokedLogout          = "logout"
+	SessionRevokedByUser          = "revoked_by_user"
+	SessionRevokedByAdmin         = "revoked_by_admin"
+	SessionRevokedPasswordChanged = "password_changed"
+	SessionRevokedUserDeactivated = "user_deactivated"
+	SessionRevokedCompanyDisabled = "company_deactivated"
+	SessionRevokedRefreshReused   = "refresh_token_reused"
+	SessionRevokedIdleTimeout     = "idle_timeout"
+)
+
+// Session is a server-side record of a login. Short-lived access tokens carry
+// JTI in their "jti" claim and are only accepted while the session is
+// unrevoked and unexpired. The refresh token cookie is rotated on every use;
+// only its hash is stored, along with recently rotated hashes so that a
+// replayed refresh token can be detected.
+type Session struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	JTI         string             `bson:"jti" json:"-"`
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	CompanyID   primitive.ObjectID `bson:"company_id" json:"company_id"`
+	IPAddress   string             `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	UserAgent   string             `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	CreatedAt   primitive.DateTime `bson:"created_at" json:"created_at"`
+	LastSeenAt  primitive.DateTime `bson:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt   primitive.DateTime `bson:"expires_at" json:"expires_at"`
+	IdleTimeout int                `bson:"idle_timeout,omitempty" json:"idle_timeout,omitempty"` // In minutes, from CompanySettings.SessionTimeout; 0 = none
+
+	RefreshTokenHash      string             `bson:"refresh_token_hash" json:"-"`
+	PreviousRefreshHashes []string           `bson:"previous_refresh_hashes,omitempty" json:"-"`
+	RefreshedAt           primitive.DateTime `bson:"refreshed_at,omitempty" json:"refreshed_at,omitempty"`
+
+	RevokedAt     *primitive.DateTime `bson:"revoked_at,omitempty" json:"revoked_at,omitempty"`
+	RevokedReason string              `bson:"revoked_reason,omitempty" json:"revoked_reason,omitempty"`
+	Current       bool                `bson:"-" json:"current,omitempty"` // Set when listing: the caller's own session
+}
@@ -0,0 +1,18 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Team groups users under one or more managers. Managers with the team
+// permissions (view:team_users, view:team_activity, manage:team_chats) can
+// see their members' profiles, activity and chats.
+type Team struct {
+	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID   primitive.ObjectID   `bson:"company_id" json:"company_id"` // Tenant isolation
+	Name        string               `bson:"name" json:"name"`
+	Description string               `bson:"description,omitempty" json:"description,omitempty"`
+	ManagerIDs  []primitive.ObjectID `bson:"manager_ids" json:"manager_ids"`
+	MemberIDs   []primitive.ObjectID `bson:"member_ids" json:"member_ids"`
+	CreatedBy   primitive.ObjectID   `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt   primitive.DateTime   `bson:"created_at" json:"created_at"`
+	UpdatedAt   primitive.DateTime   `bson:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// Usage rollup scopes
+const (
+	UsageScopeUser    = "user"
+	UsageScopeCompany = "company"
+)
+
+// UsageDateLayout is the format of UsageDaily.Date (UTC calendar day).
+const UsageDateLayout = "2006-01-02"
+
+// UsageDaily is a per-day LLM token rollup for one user or a whole company.
+// Documents are upserted with $inc as messages are answered.
+type UsageDaily struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID  primitive.ObjectID `bson:"company_id" json:"company_id"`
+	UserID     primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"` // Empty for company scope
+	Scope      string             `bson:"scope" json:"scope"`                         // "user" or "company"
+	Date       string             `bson:"date" json:"date"`                           // "2006-01-02", UTC
+	Department string             `bson:"department,omitempty" json:"department,omitempty"`
+
+	PromptTokens      int64            `bson:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens  int64            `bson:"completion_tokens" json:"completion_tokens"`
+	TotalTokens       int64            `bson:"total_tokens" json:"total_tokens"`
+	Requests          int64            `bson:"requests" json:"requests"`
+	EstimatedRequests int64            `bson:"estimated_requests" json:"estimated_requests"`   // Requests whose counts were estimated locally
+	Providers         map[string]int64 `bson:"providers,omitempty" json:"providers,omitempty"` // Total tokens per provider
+
+	UpdatedAt primitive.DateTime `bson:"updated_at" json:"updated_at"`
+}
@@ -13,7 +13,7 @@ type User struct {
 	// Role and permissions
 	RoleID      primitive.ObjectID `bson:"role_id" json:"role_id"`
 	RoleName    string             `bson:"role_name" json:"role_name"`                         // Denormalized for quick access
-	Permissions []string           `bson:"permissions,omitempty" json:"permissions,omitempty"` // Cached permissions
+	Permissions []string           `bson:"permissions,omitempty" json:"permissions,omitempty"` // Denormalized copy for display; authorization uses the role (services.ResolveAccess)
 
 	// User status
 	IsActive      bool `bson:"is_active" json:"is_active"`
@@ -4,6 +4,7 @@ import (
 	"chatgpt-clone/backend/controllers"
 	"chatgpt-clone/backend/middleware"
 	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/services"
 
 	"github.com/labstack/echo/v4"
 )
@@ -15,7 +16,7 @@ func SetupRoutes(e *echo.Echo) {
 
 	// Public routes - No authentication required
 	// Company registration (public)
-	api.POST("/companies/register", controllers.RegisterCompany)
+	api.POST("/companies/register", controllers.RegisterCompany, middleware.RateLimit(services.RateLimitGroupAuth, services.RateLimitScopeIP))
 
 	// Authentication routes (no auth required)
 	auth := api.Group("/auth")
@@ -23,33 +24,60 @@ func SetupRoutes(e *echo.Echo) {
 		// Note: Public user registration is disabled in multi-tenant B2B system
 		// Users must be created by company admins or during company registration
 		auth.POST("/register", controllers.Register) // Returns forbidden error with instructions
-		auth.POST("/login", controllers.Login)
+		auth.POST("/login", controllers.Login, middleware.RateLimit(services.RateLimitGroupAuth, services.RateLimitScopeIP))
+		auth.POST("/refresh", controllers.RefreshToken, middleware.RateLimit(services.RateLimitGroupRefresh, services.RateLimitScopeIP))
 	}
 
 	// Authenticated routes - Base authentication required
 	authRequired := api.Group("")
 	authRequired.Use(middleware.AuthMiddleware)   // Apply JWT authentication middleware
 	authRequired.Use(middleware.ActivityLogger()) // Log all activities
+	authRequired.Use(middleware.RateLimit(services.RateLimitGroupAPI, services.RateLimitScopeUser))
 	{
 		// User routes
 		authRequired.GET("/auth/me", controllers.GetCurrentUser)
 		authRequired.PUT("/auth/me", controllers.UpdateUserProfile)
 		authRequired.POST("/auth/change-password", controllers.ChangePassword)
 		authRequired.POST("/auth/logout", controllers.Logout)
+		authRequired.GET("/auth/sessions", controllers.GetMySessions)
+		authRequired.DELETE("/auth/sessions", controllers.RevokeMyOtherSessions)
+		authRequired.DELETE("/auth/sessions/:session_id", controllers.RevokeMySession)
+
+		// Team scope for managers (also enforced in the team service)
+		team := authRequired.Group("/team")
+		{
+			team.GET("/teams", controllers.GetMyTeams, middleware.RequirePermission(models.PermissionViewTeamUsers))
+			team.GET("/members", controllers.GetTeamMembers, middleware.RequirePermission(models.PermissionViewTeamUsers))
+			team.GET("/activity", controllers.GetTeamActivityLogs, middleware.RequirePermission(models.PermissionViewTeamActivity))
+			team.GET("/chats", controllers.GetTeamChats, middleware.RequirePermission(models.PermissionManageTeamChats))
+			team.GET("/chats/:chat_id/messages", controllers.GetTeamChatMessages, middleware.RequirePermission(models.PermissionManageTeamChats))
+		}
 
 		// Knowledge Base routes (separate module, not tied to chat)
 		knowledgeBase := authRequired.Group("/knowledge-base")
 		{
-			// List & view — any user with upload:documents permission
+			// List, view, versions & diffs — users with upload:documents, subject to each document's ACL
 			knowledgeBase.GET("/documents", controllers.GetKnowledgeBaseDocuments, middleware.RequirePermission(models.PermissionUploadDocuments))
 			knowledgeBase.GET("/documents/:doc_id", controllers.GetKnowledgeBaseDocumentContent, middleware.RequirePermission(models.PermissionUploadDocuments))
-			// Upload & delete — company admin only
+			knowledgeBase.GET("/documents/:doc_id/versions", controllers.GetKnowledgeBaseDocumentVersions, middleware.RequirePermission(models.PermissionUploadDocuments))
+			knowledgeBase.GET("/documents/:doc_id/versions/:version", controllers.GetKnowledgeBaseDocumentVersion, middleware.RequirePermission(models.PermissionUploadDocuments))
+			knowledgeBase.GET("/documents/:doc_id/diff", controllers.DiffKnowledgeBaseDocumentVersions, middleware.RequirePermission(models.PermissionUploadDocuments))
+			// Upload, import, replace, delete, access lists, sync & rollback — company admin only
 			knowledgeBase.POST("/documents", controllers.UploadKnowledgeBaseDocument, middleware.RequireCompanyAdmin())
+			knowledgeBase.PUT("/documents/:doc_id", controllers.ReplaceKnowledgeBaseDocument, middleware.RequireCompanyAdmin())
 			knowledgeBase.DELETE("/documents/:doc_id", controllers.DeleteKnowledgeBaseDocument, middleware.RequireCompanyAdmin())
+			knowledgeBase.PUT("/documents/:doc_id/acl", controllers.UpdateKnowledgeBaseDocumentACL, middleware.RequireCompanyAdmin())
+			knowledgeBase.POST("/documents/:doc_id/resync", controllers.ResyncKnowledgeBaseDocument, middleware.RequireCompanyAdmin())
+			knowledgeBase.POST("/documents/:doc_id/versions/:version/rollback", controllers.RollbackKnowledgeBaseDocument, middleware.RequireCompanyAdmin())
+			knowledgeBase.POST("/import", controllers.ImportKnowledgeBaseArchive, middleware.RequireCompanyAdmin())
+			knowledgeBase.GET("/imports/:id", controllers.GetKnowledgeBaseImport, middleware.RequireCompanyAdmin())
+			knowledgeBase.POST("/reconcile", controllers.ReconcileKnowledgeBase, middleware.RequireCompanyAdmin())
 		}
 
 		// Chat Management routes
+		chatRateLimit := middleware.RateLimit(services.RateLimitGroupChat, services.RateLimitScopeUser, services.RateLimitScopeCompany)
 		chats := authRequired.Group("/chats")
+		chats.Use(middleware.RequireActiveSubscription()) // Suspended companies cannot chat
 		{
 			chats.POST("", controllers.CreateChat)
 			chats.GET("", controllers.GetChats)
@@ -58,23 +86,33 @@ func SetupRoutes(e *echo.Echo) {
 			chats.DELETE("/:chat_id", controllers.DeleteChat)
 			chats.POST("/:chat_id/cleanup", controllers.CleanupChat)
 			// Document upload for a specific chat
-			chats.POST("/:chat_id/documents", controllers.UploadAndProcessDocument)
+			chats.POST("/:chat_id/documents", controllers.UploadAndProcessDocument, chatRateLimit)
 			// Message routes (nested under chats)
-			chats.POST("/:chat_id/messages", controllers.CreateMessage)
+			chats.POST("/:chat_id/messages", controllers.CreateMessage, chatRateLimit)
+			chats.POST("/:chat_id/messages/stream", controllers.CreateMessageStream, chatRateLimit) // Server-Sent Events
 			chats.GET("/:chat_id/messages", controllers.GetMessages)
 		}
 
 		// Direct Message routes
 		messages := authRequired.Group("/messages")
+		messages.Use(middleware.RequireActiveSubscription())
 		{
 			messages.DELETE("/:message_id", controllers.DeleteMessage)
 		}
+
+		// Document ingestion jobs — the uploader, company admins and super admins
+		jobs := authRequired.Group("/jobs")
+		{
+			jobs.GET("/:id", controllers.GetJob)
+			jobs.GET("/:id/events", controllers.StreamJobEvents) // Server-Sent Events
+		}
 	}
 
 	// Admin Panel Routes - Requires authentication + specific permissions
 	admin := api.Group("/admin")
 	admin.Use(middleware.AuthMiddleware)
 	admin.Use(middleware.ActivityLogger())
+	admin.Use(middleware.RateLimit(services.RateLimitGroupAPI, services.RateLimitScopeUser))
 	{
 		// User Management
 		users := admin.Group("/users")
@@ -84,23 +122,54 @@ func SetupRoutes(e *echo.Echo) {
 			users.PUT("/:user_id", controllers.UpdateUser, middleware.RequirePermission(models.PermissionManageUsers))
 			users.DELETE("/:user_id", controllers.DeactivateUser, middleware.RequirePermission(models.PermissionManageUsers))
 			users.GET("/stats", controllers.GetUserStats, middleware.RequirePermission(models.PermissionViewAnalytics))
+			users.GET("/locked", controllers.GetLockedUsers, middleware.RequirePermission(models.PermissionViewUsers))
+			users.POST("/:user_id/unlock", controllers.UnlockUser, middleware.RequirePermission(models.PermissionManageUsers))
+			users.DELETE("/:user_id/sessions", controllers.RevokeUserSessions, middleware.RequirePermission(models.PermissionManageUsers))
+		}
+
+		// Team Management
+		teams := admin.Group("/teams")
+		{
+			teams.GET("", controllers.GetTeams, middleware.RequirePermission(models.PermissionViewUsers))
+			teams.POST("", controllers.CreateTeam, middleware.RequirePermission(models.PermissionManageUsers))
+			teams.PUT("/:team_id", controllers.UpdateTeam, middleware.RequirePermission(models.PermissionManageUsers))
+			teams.DELETE("/:team_id", controllers.DeleteTeam, middleware.RequirePermission(models.PermissionManageUsers))
 		}
 
+		// Permission catalogue
+		admin.GET("/permissions", controllers.GetPermissionCatalogue, middleware.RequirePermission(models.PermissionViewRoles))
+
 		// Role Management
 		roles := admin.Group("/roles")
 		{
 			roles.GET("", controllers.GetRoles, middleware.RequirePermission(models.PermissionViewRoles))
+			roles.POST("", controllers.CreateRole, middleware.RequirePermission(models.PermissionManageRoles))
+			roles.GET("/:role_id", controllers.GetRole, middleware.RequirePermission(models.PermissionViewRoles))
+			roles.PUT("/:role_id", controllers.UpdateRole, middleware.RequirePermission(models.PermissionManageRoles))
+			roles.DELETE("/:role_id", controllers.DeleteRole, middleware.RequirePermission(models.PermissionManageRoles))
 			roles.PUT("/:role_id/permissions", controllers.UpdateRolePermissions, middleware.RequirePermission(models.PermissionManageRoles))
 		}
 
 		// Activity Logs & Monitoring
 		admin.GET("/activity-logs", controllers.GetActivityLogs, middleware.RequirePermission(models.PermissionViewActivityLogs))
 		admin.GET("/analytics", controllers.GetCompanyAnalytics, middleware.RequirePermission(models.PermissionViewAnalytics))
+		admin.GET("/usage", controllers.GetUsage, middleware.RequirePermission(models.PermissionViewAnalytics))
 
 		// Company Settings
 		admin.GET("/settings", controllers.GetCompanySettings, middleware.RequirePermission(models.PermissionManageCompanySettings))
 		admin.PUT("/settings", controllers.UpdateCompanySettings, middleware.RequirePermission(models.PermissionManageCompanySettings))
 
+		// Sign out every user of the company
+		admin.DELETE("/sessions", controllers.RevokeCompanySessions, middleware.RequirePermission(models.PermissionManageCompanySettings))
+
+		// Budget overrides (temporary increases to monthly budgets)
+		budgetOverrides := admin.Group("/budget-overrides")
+		{
+			budgetOverrides.GET("", controllers.GetBudgetOverrides, middleware.RequirePermission(models.PermissionManageCompanySettings))
+			budgetOverrides.POST("", controllers.CreateBudgetOverride, middleware.RequirePermission(models.PermissionManageCompanySettings))
+			budgetOverrides.DELETE("/:override_id", controllers.DeleteBudgetOverride, middleware.RequirePermission(models.PermissionManageCompanySettings))
+		}
+
 		// Super Admin Company Management
 		companies := admin.Group("/companies")
 		companies.Use(middleware.RequireSuperAdmin()) // Only super admins
@@ -110,6 +179,7 @@ func SetupRoutes(e *echo.Echo) {
 			companies.GET("/:company_id", controllers.GetCompanyByID)
 			companies.PUT("/:company_id", controllers.UpdateCompanyBySuperAdmin)
 			companies.DELETE("/:company_id", controllers.DeactivateCompany)
+			companies.DELETE("/:company_id/sessions", controllers.RevokeCompanySessions)
 		}
 	}
 }
@@ -43,6 +43,7 @@ func main() {
 		"subscription_tier":   "enterprise",
 		"subscription_status": "active",
 		"max_users":           999999,
+		"active_users":        1, // The super admin created below
 		"settings": bson.M{
 			"allow_user_registration":    true,
 			"require_email_verification": false,
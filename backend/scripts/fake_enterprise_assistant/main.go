@@ -0,0 +1,238 @@
+// Command fake_enterprise_assistant is a local stand-in for the Python
+// Enterprise Assistant backend. It answers deterministically so the Go API can
+// be exercised (including SSE streaming) without the RAG stack running.
+//
+//	go run ./scripts/fake_enterprise_assistant -addr :8000
+//	ENTERPRISE_ASSISTANT_URL=http://localhost:8000 go run .
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type queryRequest struct {
+	CompanyID      string `json:"company_id"`
+	Message        string `json:"message"`
+	TopK           int    `json:"top_k"`
+	HistorySummary string `json:"history_summary"`
+	History        []struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"history"`
+	Filter *struct {
+		UserID             string   `json:"user_id"`
+		ExcludeDocumentIDs []string `json:"exclude_document_ids"`
+	} `json:"filter"`
+}
+
+type documentRequest struct {
+	CompanyID string `json:"company_id"`
+	UserID    string `json:"user_id"`
+	Filename  string `json:"filename"`
+	Text      string `json:"text"`
+}
+
+type storedDocument struct {
+	DocumentID string `json:"document_id"`
+	CompanyID  string `json:"company_id"`
+	Filename   string `json:"filename"`
+	Chunks     int    `json:"chunks"`
+}
+
+type server struct {
+	mu        sync.Mutex
+	documents map[string]storedDocument
+	nextID    int
+	delay     time.Duration
+}
+
+func main() {
+	addr := flag.String("addr", ":8000", "listen address")
+	delay := flag.Duration("chunk-delay", 50*time.Millisecond, "delay between streamed chunks")
+	flag.Parse()
+
+	s := &server{documents: map[string]storedDocument{}, delay: *delay}
+
+	log.Printf("Fake enterprise assistant listening on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s.routes()))
+}
+
+func (s *server) routes() *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/query", s.handleQuery)
+	mux.HandleFunc("/api/v1/query/stream", s.handleQueryStream)
+	mux.HandleFunc("/api/v1/documents", s.handleDocuments)
+	mux.HandleFunc("/api/v1/documents/", s.handleDocument)
+	return mux
+}
+
+func (s *server) answerFor(req queryRequest) string {
+	return fmt.Sprintf("Echo from fake enterprise assistant for company %s (%d prior turns, %d documents searchable): %s",
+		req.CompanyID, len(req.History), s.searchableDocuments(req), req.Message)
+}
+
+// searchableDocuments counts the company's documents the request's filter
+// leaves available for retrieval
+func (s *server) searchableDocuments(req queryRequest) int {
+	excluded := map[string]bool{}
+	if req.Filter != nil {
+		for _, id := range req.Filter.ExcludeDocumentIDs {
+			excluded[id] = true
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count := 0
+	for id, doc := range s.documents {
+		if doc.CompanyID == req.CompanyID && !excluded[id] {
+			count++
+		}
+	}
+	return count
+}
+
+func (s *server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req queryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"answer":                s.answerFor(req),
+		"chunks_used":           0,
+		"llm_used":              false,
+		"llm_error":             nil,
+		"used_document_context": false,
+		"best_similarity":       nil,
+	})
+}
+
+func (s *server) handleQueryStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req queryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	for _, word := range strings.SplitAfter(s.answerFor(req), " ") {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(s.delay):
+		}
+		payload, _ := json.Marshal(map[string]string{"delta": word})
+		fmt.Fprintf(w, "event: chunk\ndata: %s\n\n", payload)
+		flusher.Flush()
+	}
+
+	summary, _ := json.Marshal(map[string]interface{}{
+		"chunks_used":           0,
+		"llm_used":              false,
+		"used_document_context": false,
+	})
+	fmt.Fprintf(w, "event: done\ndata: %s\n\n", summary)
+	flusher.Flush()
+}
+
+func (s *server) handleDocuments(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var req documentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		s.mu.Lock()
+		s.nextID++
+		doc := storedDocument{
+			DocumentID: fmt.Sprintf("fake-doc-%d", s.nextID),
+			CompanyID:  req.CompanyID,
+			Filename:   req.Filename,
+			Chunks:     len(req.Text)/1000 + 1,
+		}
+		s.documents[doc.DocumentID] = doc
+		s.mu.Unlock()
+
+		writeJSON(w, http.StatusCreated, map[string]interface{}{
+			"document_id":    doc.DocumentID,
+			"chunks_created": doc.Chunks,
+			"summary":        nil,
+		})
+	case http.MethodGet:
+		companyID := r.URL.Query().Get("company_id")
+
+		s.mu.Lock()
+		docs := []storedDocument{}
+		for _, doc := range s.documents {
+			if companyID == "" || doc.CompanyID == companyID {
+				docs = append(docs, doc)
+			}
+		}
+		s.mu.Unlock()
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{"documents": docs})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *server) handleDocument(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/documents/")
+	companyID := r.URL.Query().Get("company_id")
+
+	s.mu.Lock()
+	doc, ok := s.documents[id]
+	if ok && (companyID == "" || doc.CompanyID == companyID) {
+		delete(s.documents, id)
+	} else {
+		ok = false
+	}
+	s.mu.Unlock()
+
+	if !ok {
+		http.Error(w, "document not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
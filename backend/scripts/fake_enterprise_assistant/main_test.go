@@ -0,0 +1,51 @@
+package main
+
+import (
+	"chatgpt-clone/backend/services"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// TestFakeAgainstClient runs the backend's enterprise assistant client against
+// the fake, so the two keep agreeing on the wire format.
+func TestFakeAgainstClient(t *testing.T) {
+	s := &server{documents: map[string]storedDocument{}}
+	upstream := httptest.NewServer(s.routes())
+	defer upstream.Close()
+	t.Setenv("ENTERPRISE_ASSISTANT_URL", upstream.URL)
+	t.Setenv("ENTERPRISE_ASSISTANT_DOCUMENTS_URL", "")
+	services.InitEnterpriseAssistantClient()
+
+	if _, err := services.UploadDocumentToEnterpriseAssistant("c1", "u1", "policy.txt", "Refunds take 14 days."); err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+
+	history := services.ConversationWindow{Turns: []services.ConversationTurn{{Role: "user", Content: "Hi"}}}
+	var chunks []string
+	result, err := services.StreamEnterpriseAssistant(context.Background(), "c1", "How long do refunds take?", history, 3, nil, func(chunk string) error {
+		chunks = append(chunks, chunk)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("stream: %v", err)
+	}
+
+	want := "Echo from fake enterprise assistant for company c1 (1 prior turns, 1 documents searchable): How long do refunds take?"
+	if result.Answer != want {
+		t.Fatalf("answer = %q, want %q", result.Answer, want)
+	}
+	if len(chunks) != len(strings.Fields(want)) {
+		t.Fatalf("got %d chunks, want one per word", len(chunks))
+	}
+
+	filter := &services.RetrievalFilter{UserID: "u2", ExcludeDocumentIDs: []string{"fake-doc-1"}}
+	reply, err := services.QueryEnterpriseAssistant("c1", "Anything?", services.ConversationWindow{}, 3, filter)
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+	if !strings.Contains(reply.Answer, "0 documents searchable") {
+		t.Fatalf("excluded document was searchable: %q", reply.Answer)
+	}
+}
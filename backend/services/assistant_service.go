@@ -0,0 +1,110 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// assistantRequest builds the completion request for a chat message, applying
+// the company's model override and the asking user's retrieval filter.
+func assistantRequest(companyID primitive.ObjectID, content string, history ConversationWindow, model string, access *RetrievalFilter) CompletionRequest {
+	return CompletionRequest{
+		CompanyID: companyID.Hex(),
+		Prompt:    content,
+		History:   history,
+		Model:     model,
+		TopK:      3,
+		Access:    access,
+	}
+}
+
+// GenerateAssistantReply answers userID's message through the company's
+// fallback chain, sending the conversation window as context. Retrieval is
+// limited to the knowledge base documents the user may read. The response
+// records which provider and chain hop produced the answer.
+func GenerateAssistantReply(ctx context.Context, companyID, userID primitive.ObjectID, content string, history ConversationWindow) (*CompletionResponse, error) {
+	access, err := RetrievalFilterFor(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve document access: %w", err)
+	}
+
+	response, err := routeCompletion(ctx, companyID, func(hop routeHop) (*CompletionResponse, bool, error) {
+		response, err := hop.provider.Generate(ctx, assistantRequest(companyID, content, history, hop.model, access))
+		return response, false, err
+	})
+	estimateUsage(response, assistantRequest(companyID, content, history, "", access))
+	return response, err
+}
+
+// StreamAssistantReply is the streaming form of GenerateAssistantReply,
+// invoking onChunk for each fragment. A hop that fails before sending anything
+// falls through to the next one. The returned response always holds whatever
+// content was received, even when an error or cancellation cut the stream
+// short, so callers can persist partial answers.
+func StreamAssistantReply(ctx context.Context, companyID, userID primitive.ObjectID, content string, history ConversationWindow, onChunk func(string) error) (*CompletionResponse, error) {
+	access, err := RetrievalFilterFor(userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve document access: %w", err)
+	}
+
+	response, err := routeCompletion(ctx, companyID, func(hop routeHop) (*CompletionResponse, bool, error) {
+		var received strings.Builder
+		response, err := hop.provider.Stream(ctx, assistantRequest(companyID, content, history, hop.model, access), func(chunk string) error {
+			received.WriteString(chunk)
+			return onChunk(chunk)
+		})
+		if response == nil {
+			response = &CompletionResponse{Provider: hop.provider.Name(), Model: hop.model}
+		}
+		if err != nil {
+			response.Content = received.String()
+		}
+		return response, received.Len() > 0, err
+	})
+	estimateUsage(response, assistantRequest(companyID, content, history, "", access))
+	return response, err
+}
+
+// SummarizeDocument asks a general-purpose model for a short summary of an
+// uploaded document's extracted text.
+func SummarizeDocument(ctx context.Context, companyID primitive.ObjectID, filename, extractedText string) (*CompletionResponse, error) {
+	company, _ := GetCompanyByID(companyID)
+	provider := SummaryProviderForCompany(company)
+
+	prompt := fmt.Sprintf(
+		"The user uploaded a document named \"%s\". Here is the extracted content:\n\n%s\n\nPlease provide a concise summary of this document and highlight the key points.",
+		filename,
+		extractedText,
+	)
+	req := CompletionRequest{CompanyID: companyID.Hex(), Prompt: prompt}
+	response, err := provider.Generate(ctx, req)
+	estimateUsage(response, req)
+	return response, err
+}
+
+// estimateUsage fills in token counts the provider did not report, estimating
+// the prompt from the system prompt, conversation window and new message.
+func estimateUsage(response *CompletionResponse, req CompletionRequest) {
+	if response == nil {
+		return
+	}
+	if response.PromptTokens == 0 {
+		systemPrompt := req.SystemPrompt
+		if systemPrompt == "" {
+			systemPrompt = SystemPrompt
+		}
+		prompt := EstimateTokens(systemPrompt) + EstimateTokens(req.History.Summary) + EstimateTokens(req.Prompt)
+		for _, turn := range req.History.Turns {
+			prompt += EstimateTokens(turn.Content)
+		}
+		response.PromptTokens = prompt
+		response.TokensEstimated = true
+	}
+	if response.CompletionTokens == 0 && response.Content != "" {
+		response.CompletionTokens = EstimateTokens(response.Content)
+		response.TokensEstimated = true
+	}
+}
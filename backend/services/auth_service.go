@@ -37,18 +37,60 @@ type LoginUserInput struct {
 	CompanyDomain string `json:"company_domain" validate:"required"` // Company identifier
 }
 
-// MultiTenantLoginUser verifies user credentials for multi-tenant and returns a JWT token
-func MultiTenantLoginUser(input LoginUserInput, ipAddress string) (string, *models.User, error) {
+// AuthTokens are handed to the client as cookies after login or refresh.
+type AuthTokens struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+// issueTokens signs a short-lived access token for a session. The token only
+// identifies the user, company and session; role and permissions are resolved
+// on every request (see ResolveAccess).
+func issueTokens(user *models.User, companyDomain string, session *models.Session, refreshToken string) (*AuthTokens, error) {
+	expiresAt := time.Now().Add(AccessTokenTTL)
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"jti":            session.JTI,
+		"user_id":        user.ID.Hex(),
+		"user_email":     user.Email,
+		"company_id":     user.CompanyID.Hex(),
+		"company_domain": companyDomain,
+		"email":          user.Email,
+		"exp":            expiresAt.Unix(),
+	})
+
+	tokenString, err := token.SignedString(JwtSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AuthTokens{
+		AccessToken:      tokenString,
+		AccessExpiresAt:  expiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: session.ExpiresAt.Time(),
+	}, nil
+}
+
+// MultiTenantLoginUser verifies user credentials for multi-tenant and returns
+// an access token and refresh token for a new server-side session.
+func MultiTenantLoginUser(input LoginUserInput, ipAddress, userAgent string) (*AuthTokens, *models.User, error) {
 	ctx := context.Background()
 
 	// Get company by domain
 	company, err := GetCompanyByDomain(input.CompanyDomain)
 	if err != nil {
-		return "", nil, errors.New("invalid company or credentials")
+		return nil, nil, errors.New("invalid company or credentials")
 	}
 
 	if !company.IsActive {
-		return "", nil, errors.New("company account is suspended")
+		return nil, nil, errors.New("company account is suspended")
+	}
+
+	// Refuse early while the account or IP is locked out
+	if err := CheckLoginLockout(company.ID, input.Email, ipAddress); err != nil {
+		return nil, nil, err
 	}
 
 	// Find user by email and company
@@ -75,12 +117,23 @@ func MultiTenantLoginUser(input LoginUserInput, ipAddress string) (string, *mode
 			401,
 			"Invalid credentials",
 		)
-		return "", nil, errors.New("invalid email or password")
+		RecordLoginFailure(company.ID, primitive.NilObjectID, input.Email, ipAddress)
+		return nil, nil, errors.New("invalid email or password")
 	}
 
 	// Check if user is active
 	if !user.IsActive {
-		return "", nil, errors.New("user account is deactivated")
+		return nil, nil, errors.New("user account is deactivated")
+	}
+
+	// A suspended subscription only lets admins in, to sort out billing
+	switch company.SubscriptionStatus {
+	case models.SubscriptionCancelled:
+		return nil, nil, errors.New("company subscription has been cancelled")
+	case models.SubscriptionSuspended:
+		if user.RoleName != models.RoleCompanyAdmin && !user.IsSuperAdmin {
+			return nil, nil, errors.New("company subscription is suspended; please contact your administrator")
+		}
 	}
 
 	// Verify password
@@ -103,9 +156,12 @@ func MultiTenantLoginUser(input LoginUserInput, ipAddress string) (string, *mode
 			401,
 			"Invalid password",
 		)
-		return "", nil, errors.New("invalid email or password")
+		RecordLoginFailure(company.ID, user.ID, input.Email, ipAddress)
+		return nil, nil, errors.New("invalid email or password")
 	}
 
+	ResetLoginFailures(company.ID, input.Email)
+
 	// Update last login
 	userCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
 		"$set": bson.M{
@@ -114,23 +170,15 @@ func MultiTenantLoginUser(input LoginUserInput, ipAddress string) (string, *mode
 		},
 	})
 
-	// Generate JWT with company and role information
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"user_id":        user.ID.Hex(),
-		"user_email":     user.Email,
-		"company_id":     user.CompanyID.Hex(),
-		"company_domain": company.Domain,
-		"email":          user.Email,
-		"role_id":        user.RoleID.Hex(),
-		"role_name":      user.RoleName,
-		"permissions":    user.Permissions,
-		"is_super_admin": user.IsSuperAdmin,
-		"exp":            time.Now().Add(time.Hour * 72).Unix(),
-	})
+	// Record the session the tokens belong to
+	session, refreshToken, err := CreateSession(&user, ipAddress, userAgent, company.Settings.SessionTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
 
-	tokenString, err := token.SignedString(JwtSecret)
+	tokens, err := issueTokens(&user, company.Domain, session, refreshToken)
 	if err != nil {
-		return "", nil, err
+		return nil, nil, err
 	}
 
 	// Log successful login
@@ -151,7 +199,42 @@ func MultiTenantLoginUser(input LoginUserInput, ipAddress string) (string, *mode
 		"",
 	)
 
-	return tokenString, &user, nil
+	return tokens, &user, nil
+}
+
+// RefreshAccessToken rotates a refresh token and issues a new access token
+// with the user's current role and permissions.
+func RefreshAccessToken(refreshToken, ipAddress, userAgent string) (*AuthTokens, *models.User, error) {
+	sessionID, _, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var current models.Session
+	if err := sessionCollection.FindOne(context.Background(), bson.M{"_id": sessionID}).Decode(&current); err != nil {
+		return nil, nil, ErrSessionInvalid
+	}
+
+	user, err := GetUserByID(current.UserID)
+	if err != nil || !user.IsActive {
+		return nil, nil, ErrSessionInvalid
+	}
+
+	company, err := GetCompanyByID(user.CompanyID)
+	if err != nil || !company.IsActive || company.SubscriptionStatus == models.SubscriptionCancelled {
+		return nil, nil, ErrSessionInvalid
+	}
+
+	session, newRefreshToken, err := RotateRefreshToken(refreshToken, ipAddress, userAgent, company.Settings.SessionTimeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tokens, err := issueTokens(user, company.Domain, session, newRefreshToken)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tokens, user, nil
 }
 
 // Legacy LoginUser for backward compatibility - will be deprecated
@@ -224,8 +307,9 @@ func UpdateUserProfile(userID primitive.ObjectID, input UpdateProfileInput) (*mo
 	return GetUserByID(userID)
 }
 
-// ChangeUserPassword verifies the current password and sets a new one.
-func ChangeUserPassword(userID primitive.ObjectID, input ChangePasswordInput) error {
+// ChangeUserPassword verifies the current password and sets a new one. All of
+// the user's other sessions are revoked; the session with currentJTI stays.
+func ChangeUserPassword(userID primitive.ObjectID, input ChangePasswordInput, currentJTI string) error {
 	ctx := context.Background()
 
 	var user models.User
@@ -248,5 +332,10 @@ func ChangeUserPassword(userID primitive.ObjectID, input ChangePasswordInput) er
 			"updated_at": primitive.NewDateTimeFromTime(time.Now()),
 		},
 	})
+	if err != nil {
+		return err
+	}
+
+	_, err = RevokeUserSessions(userID, models.SessionRevokedPasswordChanged, currentJTI)
 	return err
 }
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Actions checked by the Authorize* functions
+const (
+	AccessRead   = "read"
+	AccessWrite  = "write" // Send messages, upload, rename
+	AccessDelete = "delete"
+)
+
+// AccessBasis says why access was granted. Anything other than AccessAsOwner
+// is access to someone else's data and should be audited.
+type AccessBasis string
+
+const (
+	AccessAsOwner       AccessBasis = "owner"
+	AccessAsTeamManager AccessBasis = "team_manager"
+	AccessAsAdmin       AccessBasis = "company_admin"
+	AccessAsSuperAdmin  AccessBasis = "super_admin"
+	AccessAsMember      AccessBasis = "company_member" // Shared company resources
+)
+
+// Authorization errors. Resources of another company are reported as not
+// found so that their existence does not leak.
+var (
+	ErrResourceNotFound = errors.New("resource not found")
+	ErrAccessDenied     = errors.New("access denied")
+)
+
+// Actor is the authenticated user a request acts as.
+type Actor struct {
+	UserID       primitive.ObjectID
+	CompanyID    primitive.ObjectID
+	RoleName     string
+	Permissions  []string
+	IsSuperAdmin bool
+}
+
+func (a Actor) hasPermission(permission string) bool {
+	for _, p := range a.Permissions {
+		if p == permission {
+			return true
+		}
+	}
+	return false
+}
+
+func (a Actor) isCompanyAdmin() bool {
+	return a.RoleName == models.RoleCompanyAdmin
+}
+
+// managesUser reports whether manager manages a team that userID belongs to.
+func managesUser(companyID, managerID, userID primitive.ObjectID) bool {
+	count, err := teamCollection.CountDocuments(context.Background(), bson.M{
+		"company_id":  companyID,
+		"manager_ids": managerID,
+		"member_ids":  userID,
+	})
+	return err == nil && count > 0
+}
+
+// AuthorizeChat loads a chat and checks that actor may perform action on it:
+//
+//   - read:   the owner, a manager of the owner's team (manage:team_chats),
+//     a company admin, or a super admin
+//   - write:  the owner only
+//   - delete: the owner, a company admin, or a super admin
+func AuthorizeChat(actor Actor, chatID primitive.ObjectID, action string) (*models.Chat, AccessBasis, error) {
+	var chat models.Chat
+	if err := chatCollection.FindOne(context.Background(), bson.M{"_id": chatID}).Decode(&chat); err != nil {
+		return nil, "", ErrResourceNotFound
+	}
+
+	if chat.CompanyID != actor.CompanyID && !actor.IsSuperAdmin {
+		return nil, "", ErrResourceNotFound
+	}
+	if chat.UserID == actor.UserID {
+		return &chat, AccessAsOwner, nil
+	}
+
+	switch action {
+	case AccessRead:
+		if actor.IsSuperAdmin {
+			return &chat, AccessAsSuperAdmin, nil
+		}
+		if actor.isCompanyAdmin() {
+			return &chat, AccessAsAdmin, nil
+		}
+		if actor.hasPermission(models.PermissionManageTeamChats) && managesUser(chat.CompanyID, actor.UserID, chat.UserID) {
+			return &chat, AccessAsTeamManager, nil
+		}
+	case AccessDelete:
+		if actor.IsSuperAdmin {
+			return &chat, AccessAsSuperAdmin, nil
+		}
+		if actor.isCompanyAdmin() {
+			return &chat, AccessAsAdmin, nil
+		}
+	}
+	return nil, "", ErrAccessDenied
+}
+
+// AuthorizeMessage loads a message and checks action against its chat with
+// the same rules as AuthorizeChat.
+func AuthorizeMessage(actor Actor, messageID primitive.ObjectID, action string) (*models.Message, *models.Chat, AccessBasis, error) {
+	var message models.Message
+	if err := messageCollection.FindOne(context.Background(), bson.M{"_id": messageID}).Decode(&message); err != nil {
+		return nil, nil, "", ErrResourceNotFound
+	}
+
+	chat, basis, err := AuthorizeChat(actor, message.ChatID, action)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	return &message, chat, basis, nil
+}
+
+// AuthorizeDocument loads a knowledge base document and checks that actor
+// may perform action on it:
+//
+//   - read:          a member of the document's company its ACL admits (see
+//     documentReader.canRead), a company admin, or a super admin
+//   - write, delete: a company admin or a super admin
+//
+// Documents the ACL hides are reported as not found.
+func AuthorizeDocument(actor Actor, docID primitive.ObjectID, action string) (*models.KnowledgeBaseDocument, AccessBasis, error) {
+	var doc models.KnowledgeBaseDocument
+	if err := knowledgeBaseCollection.FindOne(context.Background(), bson.M{
+		"_id":    docID,
+		"status": bson.M{"$ne": models.KBStatusPendingDelete},
+	}).Decode(&doc); err != nil {
+		return nil, "", ErrResourceNotFound
+	}
+
+	if doc.CompanyID != actor.CompanyID {
+		if actor.IsSuperAdmin {
+			return &doc, AccessAsSuperAdmin, nil
+		}
+		return nil, "", ErrResourceNotFound
+	}
+
+	switch {
+	case actor.IsSuperAdmin:
+		return &doc, AccessAsSuperAdmin, nil
+	case actor.isCompanyAdmin():
+		return &doc, AccessAsAdmin, nil
+	case action == AccessRead:
+		reader, err := documentReaderFor(actor)
+		if err != nil {
+			return nil, "", err
+		}
+		if !reader.canRead(&doc) {
+			return nil, "", ErrResourceNotFound
+		}
+		return &doc, AccessAsMember, nil
+	}
+	return nil, "", ErrAccessDenied
+}
+
+// AuthorizeJob loads an ingestion job. The user who queued it, a company
+// admin of its company, or a super admin may follow it; anyone else is told it
+// does not exist.
+func AuthorizeJob(actor Actor, jobID primitive.ObjectID) (*models.IngestionJob, AccessBasis, error) {
+	job, err := GetIngestionJob(jobID)
+	if err != nil {
+		return nil, "", ErrResourceNotFound
+	}
+
+	switch {
+	case job.UserID == actor.UserID:
+		return job, AccessAsOwner, nil
+	case actor.IsSuperAdmin:
+		return job, AccessAsSuperAdmin, nil
+	case job.CompanyID == actor.CompanyID && actor.isCompanyAdmin():
+		return job, AccessAsAdmin, nil
+	}
+	return nil, "", ErrResourceNotFound
+}
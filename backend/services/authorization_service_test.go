@@ -0,0 +1,276 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"errors"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// authFixture is one chat, message, job and two documents of company A, and
+// actors of companies A and B
+type authFixture struct {
+	chatID, messageID, jobID  primitive.ObjectID
+	publicDocID, financeDocID primitive.ObjectID
+	pendingDeleteDocID        primitive.ObjectID
+
+	owner, colleague, financeColleague Actor
+	manager, managerNoPermission       Actor
+	admin, otherCompanyAdmin           Actor
+	superAdmin                         Actor
+}
+
+func newAuthFixture(t *testing.T) authFixture {
+	t.Helper()
+	setupTestDB(t)
+
+	companyA, companyB := primitive.NewObjectID(), primitive.NewObjectID()
+	now := primitive.NewDateTimeFromTime(time.Now())
+	employee := func(companyID primitive.ObjectID) Actor {
+		return Actor{
+			UserID:      primitive.NewObjectID(),
+			CompanyID:   companyID,
+			RoleName:    models.RoleEmployee,
+			Permissions: models.GetDefaultPermissions(models.RoleEmployee),
+		}
+	}
+
+	f := authFixture{
+		chatID:             primitive.NewObjectID(),
+		messageID:          primitive.NewObjectID(),
+		jobID:              primitive.NewObjectID(),
+		publicDocID:        primitive.NewObjectID(),
+		financeDocID:       primitive.NewObjectID(),
+		pendingDeleteDocID: primitive.NewObjectID(),
+		owner:              employee(companyA),
+		colleague:          employee(companyA),
+		financeColleague:   employee(companyA),
+	}
+	f.manager = Actor{
+		UserID:      primitive.NewObjectID(),
+		CompanyID:   companyA,
+		RoleName:    models.RoleManager,
+		Permissions: []string{models.PermissionManageTeamChats},
+	}
+	f.managerNoPermission = f.manager
+	f.managerNoPermission.Permissions = []string{}
+	f.admin = Actor{UserID: primitive.NewObjectID(), CompanyID: companyA, RoleName: models.RoleCompanyAdmin}
+	f.otherCompanyAdmin = Actor{UserID: primitive.NewObjectID(), CompanyID: companyB, RoleName: models.RoleCompanyAdmin}
+	f.superAdmin = Actor{UserID: primitive.NewObjectID(), CompanyID: companyB, RoleName: models.RoleSuperAdmin, IsSuperAdmin: true}
+
+	mustInsert(t, userCollection,
+		models.User{ID: f.owner.UserID, CompanyID: companyA, Email: "owner@a.test", RoleName: models.RoleEmployee, IsActive: true},
+		models.User{ID: f.colleague.UserID, CompanyID: companyA, Email: "colleague@a.test", RoleName: models.RoleEmployee, IsActive: true},
+		models.User{ID: f.financeColleague.UserID, CompanyID: companyA, Email: "finance@a.test", RoleName: models.RoleEmployee, IsActive: true, Department: "Finance"},
+	)
+	mustInsert(t, teamCollection, models.Team{
+		ID:         primitive.NewObjectID(),
+		CompanyID:  companyA,
+		Name:       "Support",
+		ManagerIDs: []primitive.ObjectID{f.manager.UserID},
+		MemberIDs:  []primitive.ObjectID{f.owner.UserID},
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	})
+	mustInsert(t, chatCollection, models.Chat{ID: f.chatID, CompanyID: companyA, UserID: f.owner.UserID, Title: "Mine", CreatedAt: now, UpdatedAt: now})
+	mustInsert(t, messageCollection, models.Message{ID: f.messageID, ChatID: f.chatID, Role: "user", Content: "hello", Timestamp: now})
+	mustInsert(t, ingestionJobCollection, models.IngestionJob{
+		ID:        f.jobID,
+		CompanyID: companyA,
+		UserID:    f.owner.UserID,
+		Kind:      models.JobKindKnowledgeBase,
+		Status:    models.JobStatusQueued,
+	})
+
+	document := func(id primitive.ObjectID, status string, acl *models.DocumentACL) models.KnowledgeBaseDocument {
+		return models.KnowledgeBaseDocument{
+			ID:         id,
+			CompanyID:  companyA,
+			LogicalID:  id,
+			Version:    1,
+			IsCurrent:  true,
+			UploadedBy: f.owner.UserID,
+			Filename:   id.Hex() + ".txt",
+			Status:     status,
+			ACL:        acl,
+			CreatedAt:  now,
+			UpdatedAt:  now,
+		}
+	}
+	mustInsert(t, knowledgeBaseCollection,
+		document(f.publicDocID, models.KBStatusSynced, nil),
+		document(f.financeDocID, models.KBStatusSynced, &models.DocumentACL{Departments: []string{"Finance"}}),
+		document(f.pendingDeleteDocID, models.KBStatusPendingDelete, nil),
+	)
+	return f
+}
+
+// checkAccess compares the outcome of an Authorize* call with the expected
+// basis, or with the expected error when wantErr is set
+func checkAccess(t *testing.T, basis AccessBasis, err error, wantBasis AccessBasis, wantErr error) {
+	t.Helper()
+	if wantErr != nil {
+		if !errors.Is(err, wantErr) {
+			t.Fatalf("err = %v, want %v", err, wantErr)
+		}
+		return
+	}
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if basis != wantBasis {
+		t.Fatalf("basis = %q, want %q", basis, wantBasis)
+	}
+}
+
+func TestAuthorizeChat(t *testing.T) {
+	f := newAuthFixture(t)
+	tests := []struct {
+		name      string
+		actor     Actor
+		action    string
+		wantBasis AccessBasis
+		wantErr   error
+	}{
+		{"owner reads", f.owner, AccessRead, AccessAsOwner, nil},
+		{"owner writes", f.owner, AccessWrite, AccessAsOwner, nil},
+		{"owner deletes", f.owner, AccessDelete, AccessAsOwner, nil},
+		{"colleague reads", f.colleague, AccessRead, "", ErrAccessDenied},
+		{"colleague deletes", f.colleague, AccessDelete, "", ErrAccessDenied},
+		{"team manager reads", f.manager, AccessRead, AccessAsTeamManager, nil},
+		{"team manager writes", f.manager, AccessWrite, "", ErrAccessDenied},
+		{"team manager deletes", f.manager, AccessDelete, "", ErrAccessDenied},
+		{"team manager without manage:team_chats reads", f.managerNoPermission, AccessRead, "", ErrAccessDenied},
+		{"company admin reads", f.admin, AccessRead, AccessAsAdmin, nil},
+		{"company admin writes", f.admin, AccessWrite, "", ErrAccessDenied},
+		{"company admin deletes", f.admin, AccessDelete, AccessAsAdmin, nil},
+		{"other company admin reads", f.otherCompanyAdmin, AccessRead, "", ErrResourceNotFound},
+		{"other company admin deletes", f.otherCompanyAdmin, AccessDelete, "", ErrResourceNotFound},
+		{"super admin reads", f.superAdmin, AccessRead, AccessAsSuperAdmin, nil},
+		{"super admin writes", f.superAdmin, AccessWrite, "", ErrAccessDenied},
+		{"super admin deletes", f.superAdmin, AccessDelete, AccessAsSuperAdmin, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chat, basis, err := AuthorizeChat(tt.actor, f.chatID, tt.action)
+			checkAccess(t, basis, err, tt.wantBasis, tt.wantErr)
+			if tt.wantErr == nil && chat.ID != f.chatID {
+				t.Fatalf("chat = %s, want %s", chat.ID.Hex(), f.chatID.Hex())
+			}
+		})
+	}
+
+	t.Run("missing chat", func(t *testing.T) {
+		_, _, err := AuthorizeChat(f.superAdmin, primitive.NewObjectID(), AccessRead)
+		checkAccess(t, "", err, "", ErrResourceNotFound)
+	})
+}
+
+func TestAuthorizeMessage(t *testing.T) {
+	f := newAuthFixture(t)
+	tests := []struct {
+		name      string
+		actor     Actor
+		action    string
+		wantBasis AccessBasis
+		wantErr   error
+	}{
+		{"owner reads", f.owner, AccessRead, AccessAsOwner, nil},
+		{"owner deletes", f.owner, AccessDelete, AccessAsOwner, nil},
+		{"colleague reads", f.colleague, AccessRead, "", ErrAccessDenied},
+		{"colleague deletes", f.colleague, AccessDelete, "", ErrAccessDenied},
+		{"team manager reads", f.manager, AccessRead, AccessAsTeamManager, nil},
+		{"team manager deletes", f.manager, AccessDelete, "", ErrAccessDenied},
+		{"team manager without manage:team_chats reads", f.managerNoPermission, AccessRead, "", ErrAccessDenied},
+		{"company admin deletes", f.admin, AccessDelete, AccessAsAdmin, nil},
+		{"other company admin reads", f.otherCompanyAdmin, AccessRead, "", ErrResourceNotFound},
+		{"other company admin deletes", f.otherCompanyAdmin, AccessDelete, "", ErrResourceNotFound},
+		{"super admin deletes", f.superAdmin, AccessDelete, AccessAsSuperAdmin, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			message, chat, basis, err := AuthorizeMessage(tt.actor, f.messageID, tt.action)
+			checkAccess(t, basis, err, tt.wantBasis, tt.wantErr)
+			if tt.wantErr == nil && (message.ID != f.messageID || chat.ID != f.chatID) {
+				t.Fatalf("got message %s in chat %s", message.ID.Hex(), chat.ID.Hex())
+			}
+		})
+	}
+
+	t.Run("missing message", func(t *testing.T) {
+		_, _, _, err := AuthorizeMessage(f.owner, primitive.NewObjectID(), AccessRead)
+		checkAccess(t, "", err, "", ErrResourceNotFound)
+	})
+}
+
+func TestAuthorizeDocument(t *testing.T) {
+	f := newAuthFixture(t)
+	tests := []struct {
+		name      string
+		actor     Actor
+		docID     primitive.ObjectID
+		action    string
+		wantBasis AccessBasis
+		wantErr   error
+	}{
+		{"colleague reads public document", f.colleague, f.publicDocID, AccessRead, AccessAsMember, nil},
+		{"colleague writes public document", f.colleague, f.publicDocID, AccessWrite, "", ErrAccessDenied},
+		{"colleague deletes public document", f.colleague, f.publicDocID, AccessDelete, "", ErrAccessDenied},
+		{"colleague reads restricted document", f.colleague, f.financeDocID, AccessRead, "", ErrResourceNotFound},
+		{"department member reads restricted document", f.financeColleague, f.financeDocID, AccessRead, AccessAsMember, nil},
+		{"uploader reads restricted document", f.owner, f.financeDocID, AccessRead, AccessAsMember, nil},
+		{"uploader deletes own document", f.owner, f.financeDocID, AccessDelete, "", ErrAccessDenied},
+		{"team manager reads restricted document", f.manager, f.financeDocID, AccessRead, "", ErrResourceNotFound},
+		{"company admin reads restricted document", f.admin, f.financeDocID, AccessRead, AccessAsAdmin, nil},
+		{"company admin deletes restricted document", f.admin, f.financeDocID, AccessDelete, AccessAsAdmin, nil},
+		{"other company admin reads public document", f.otherCompanyAdmin, f.publicDocID, AccessRead, "", ErrResourceNotFound},
+		{"other company admin deletes public document", f.otherCompanyAdmin, f.publicDocID, AccessDelete, "", ErrResourceNotFound},
+		{"super admin reads restricted document", f.superAdmin, f.financeDocID, AccessRead, AccessAsSuperAdmin, nil},
+		{"super admin deletes restricted document", f.superAdmin, f.financeDocID, AccessDelete, AccessAsSuperAdmin, nil},
+		{"pending delete document", f.admin, f.pendingDeleteDocID, AccessRead, "", ErrResourceNotFound},
+		{"missing document", f.superAdmin, primitive.NewObjectID(), AccessRead, "", ErrResourceNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, basis, err := AuthorizeDocument(tt.actor, tt.docID, tt.action)
+			checkAccess(t, basis, err, tt.wantBasis, tt.wantErr)
+			if tt.wantErr == nil && doc.ID != tt.docID {
+				t.Fatalf("document = %s, want %s", doc.ID.Hex(), tt.docID.Hex())
+			}
+		})
+	}
+}
+
+func TestAuthorizeJob(t *testing.T) {
+	f := newAuthFixture(t)
+	tests := []struct {
+		name      string
+		actor     Actor
+		wantBasis AccessBasis
+		wantErr   error
+	}{
+		{"owner", f.owner, AccessAsOwner, nil},
+		{"colleague", f.colleague, "", ErrResourceNotFound},
+		{"team manager", f.manager, "", ErrResourceNotFound},
+		{"team manager without manage:team_chats", f.managerNoPermission, "", ErrResourceNotFound},
+		{"company admin", f.admin, AccessAsAdmin, nil},
+		{"other company admin", f.otherCompanyAdmin, "", ErrResourceNotFound},
+		{"super admin", f.superAdmin, AccessAsSuperAdmin, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			job, basis, err := AuthorizeJob(tt.actor, f.jobID)
+			checkAccess(t, basis, err, tt.wantBasis, tt.wantErr)
+			if tt.wantErr == nil && job.ID != f.jobID {
+				t.Fatalf("job = %s, want %s", job.ID.Hex(), f.jobID.Hex())
+			}
+		})
+	}
+
+	t.Run("missing job", func(t *testing.T) {
+		_, _, err := AuthorizeJob(f.superAdmin, primitive.NewObjectID())
+		checkAccess(t, "", err, "", ErrResourceNotFound)
+	})
+}
@@ -0,0 +1,364 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultBudgetSoftLimitPercent applies when BudgetSoftLimitPercent is unset.
+const defaultBudgetSoftLimitPercent = 80
+
+// Budget error codes returned to clients.
+const (
+	QuotaCodeTokenBudget   = "token_budget_exceeded"
+	QuotaCodeRequestBudget = "request_budget_exceeded"
+)
+
+// Budget metrics
+const (
+	BudgetMetricTokens   = "tokens"
+	BudgetMetricRequests = "requests"
+)
+
+// BudgetUsage is the month-to-date consumption of one budget.
+type BudgetUsage struct {
+	Scope   string `json:"scope"`  // "company" or "user"
+	Metric  string `json:"metric"` // "tokens" or "requests"
+	Limit   int64  `json:"limit"`
+	Used    int64  `json:"used"`
+	Percent int    `json:"percent"`
+}
+
+// BudgetStatus lists the budgets that apply to a user this month and which of
+// them are past the soft limit.
+type BudgetStatus struct {
+	Month    string        `json:"month"` // "2006-01"
+	Budgets  []BudgetUsage `json:"budgets"`
+	Warnings []BudgetUsage `json:"warnings"`
+}
+
+// WarningHeader renders the soft-limit warnings for the X-Budget-Warning
+// response header, e.g. "user tokens 85% (85000/100000)".
+func (s *BudgetStatus) WarningHeader() string {
+	parts := make([]string, 0, len(s.Warnings))
+	for _, w := range s.Warnings {
+		parts = append(parts, fmt.Sprintf("%s %s %d%% (%d/%d)", w.Scope, w.Metric, w.Percent, w.Used, w.Limit))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// BudgetOverrideInput defines input for granting a temporary budget override
+type BudgetOverrideInput struct {
+	UserID         string `json:"user_id,omitempty"` // Empty = company budget
+	ExtraTokens    int64  `json:"extra_tokens" validate:"min=0"`
+	ExtraRequests  int64  `json:"extra_requests" validate:"min=0"`
+	Unlimited      bool   `json:"unlimited"`
+	Reason         string `json:"reason" validate:"required,min=3"`
+	ExpiresInHours int    `json:"expires_in_hours" validate:"required,min=1,max=2160"` // Up to 90 days
+}
+
+// currentBudgetMonth returns the current UTC month and its first and last
+// usage dates.
+func currentBudgetMonth() (month, from, to string) {
+	now := time.Now().UTC()
+	start := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	end := start.AddDate(0, 1, -1)
+	return start.Format("2006-01"), start.Format(models.UsageDateLayout), end.Format(models.UsageDateLayout)
+}
+
+// sumUsage totals usage_daily documents matching filter.
+func sumUsage(ctx context.Context, filter bson.M) (UsageTotals, error) {
+	var totals UsageTotals
+	cursor, err := usageDailyCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: filter}},
+		{{Key: "$group", Value: bson.M{
+			"_id":                nil,
+			"prompt_tokens":      bson.M{"$sum": "$prompt_tokens"},
+			"completion_tokens":  bson.M{"$sum": "$completion_tokens"},
+			"total_tokens":       bson.M{"$sum": "$total_tokens"},
+			"requests":           bson.M{"$sum": "$requests"},
+			"estimated_requests": bson.M{"$sum": "$estimated_requests"},
+		}}},
+	})
+	if err != nil {
+		return totals, err
+	}
+	defer cursor.Close(ctx)
+
+	if cursor.Next(ctx) {
+		err = cursor.Decode(&totals)
+	}
+	return totals, err
+}
+
+// activeOverrides sums the unexpired overrides for the company budget
+// (userID zero) or for one user's budget.
+func activeOverrides(ctx context.Context, companyID, userID primitive.ObjectID) (extraTokens, extraRequests int64, unlimited bool, err error) {
+	filter := bson.M{
+		"company_id": companyID,
+		"expires_at": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())},
+	}
+	if userID.IsZero() {
+		filter["user_id"] = bson.M{"$exists": false}
+	} else {
+		filter["user_id"] = userID
+	}
+
+	cursor, err := budgetOverrideCollection.Find(ctx, filter)
+	if err != nil {
+		return 0, 0, false, err
+	}
+	var overrides []models.BudgetOverride
+	if err := cursor.All(ctx, &overrides); err != nil {
+		return 0, 0, false, err
+	}
+
+	for _, o := range overrides {
+		extraTokens += o.ExtraTokens
+		extraRequests += o.ExtraRequests
+		unlimited = unlimited || o.Unlimited
+	}
+	return extraTokens, extraRequests, unlimited, nil
+}
+
+// CheckBudget evaluates the company and per-user monthly budgets before a
+// message is sent. A *QuotaError (429) is returned once a hard limit is
+// reached; budgets past the soft limit are reported in the status' Warnings.
+func CheckBudget(companyID, userID primitive.ObjectID) (*BudgetStatus, error) {
+	ctx := context.Background()
+
+	company, err := GetCompanyByID(companyID)
+	if err != nil {
+		return nil, err
+	}
+	settings := company.Settings
+
+	month, from, to := currentBudgetMonth()
+	status := &BudgetStatus{Month: month, Budgets: []BudgetUsage{}, Warnings: []BudgetUsage{}}
+
+	softPercent := settings.BudgetSoftLimitPercent
+	if softPercent <= 0 || softPercent > 100 {
+		softPercent = defaultBudgetSoftLimitPercent
+	}
+
+	userTokenBudget := settings.UserMonthlyTokenBudget
+	if user, err := GetUserByID(userID); err == nil {
+		if roleBudget, ok := settings.RoleMonthlyTokenBudgets[user.RoleName]; ok {
+			userTokenBudget = roleBudget
+		}
+	}
+
+	scopes := []struct {
+		scope          string
+		ownerID        primitive.ObjectID
+		filter         bson.M
+		tokenBudget    int64
+		requestBudget  int64
+		exceededPrefix string
+	}{
+		{
+			scope:          models.UsageScopeCompany,
+			filter:         bson.M{"company_id": companyID, "scope": models.UsageScopeCompany, "date": bson.M{"$gte": from, "$lte": to}},
+			tokenBudget:    settings.MonthlyTokenBudget,
+			requestBudget:  settings.MonthlyRequestBudget,
+			exceededPrefix: "Your company has used its monthly",
+		},
+		{
+			scope:          models.UsageScopeUser,
+			ownerID:        userID,
+			filter:         bson.M{"company_id": companyID, "scope": models.UsageScopeUser, "user_id": userID, "date": bson.M{"$gte": from, "$lte": to}},
+			tokenBudget:    userTokenBudget,
+			requestBudget:  settings.UserMonthlyRequestBudget,
+			exceededPrefix: "You have used your monthly",
+		},
+	}
+
+	for _, sc := range scopes {
+		if sc.tokenBudget <= 0 && sc.requestBudget <= 0 {
+			continue
+		}
+
+		used, err := sumUsage(ctx, sc.filter)
+		if err != nil {
+			return nil, err
+		}
+		extraTokens, extraRequests, unlimited, err := activeOverrides(ctx, companyID, sc.ownerID)
+		if err != nil {
+			return nil, err
+		}
+
+		checks := []struct {
+			metric string
+			code   string
+			limit  int64
+			used   int64
+		}{
+			{BudgetMetricTokens, QuotaCodeTokenBudget, sc.tokenBudget, used.TotalTokens},
+			{BudgetMetricRequests, QuotaCodeRequestBudget, sc.requestBudget, used.Requests},
+		}
+		for _, check := range checks {
+			if check.limit <= 0 {
+				continue
+			}
+			limit := check.limit
+			if check.metric == BudgetMetricTokens {
+				limit += extraTokens
+			} else {
+				limit += extraRequests
+			}
+
+			usage := BudgetUsage{
+				Scope:   sc.scope,
+				Metric:  check.metric,
+				Limit:   limit,
+				Used:    check.used,
+				Percent: int(check.used * 100 / limit),
+			}
+			status.Budgets = append(status.Budgets, usage)
+
+			if check.used >= limit && !unlimited {
+				return status, &QuotaError{
+					Status:  http.StatusTooManyRequests,
+					Code:    check.code,
+					Message: fmt.Sprintf("%s %s budget (%d of %d). Ask an administrator for an override or wait until next month.", sc.exceededPrefix, check.metric, check.used, limit),
+					Limit:   limit,
+					Current: check.used,
+				}
+			}
+			if usage.Percent >= softPercent {
+				status.Warnings = append(status.Warnings, usage)
+			}
+		}
+	}
+
+	return status, nil
+}
+
+// LogBudgetWarnings writes a soft-limit activity log entry for each warning,
+// at most once per budget per month.
+func LogBudgetWarnings(companyID, userID primitive.ObjectID, status *BudgetStatus, ipAddress, userAgent, method, endpoint string) {
+	if status == nil {
+		return
+	}
+	ctx := context.Background()
+	_, from, _ := currentBudgetMonth()
+	monthStart, _ := time.Parse(models.UsageDateLayout, from)
+
+	for _, w := range status.Warnings {
+		resourceID := companyID.Hex() + ":" + w.Metric
+		if w.Scope == models.UsageScopeUser {
+			resourceID = userID.Hex() + ":" + w.Metric
+		}
+
+		count, err := activityLogCollection.CountDocuments(ctx, bson.M{
+			"company_id":  companyID,
+			"action":      models.ActionBudgetSoftLimit,
+			"resource_id": resourceID,
+			"timestamp":   bson.M{"$gte": primitive.NewDateTimeFromTime(monthStart)},
+		}, options.Count().SetLimit(1))
+		if err != nil || count > 0 {
+			continue
+		}
+
+		LogActivity(
+			companyID,
+			userID,
+			models.ActionBudgetSoftLimit,
+			models.ResourceBudget,
+			resourceID,
+			fmt.Sprintf("Monthly %s %s budget at %d%% (%d of %d)", w.Scope, w.Metric, w.Percent, w.Used, w.Limit),
+			true,
+			map[string]interface{}{"scope": w.Scope, "metric": w.Metric, "limit": w.Limit, "used": w.Used, "month": status.Month},
+			ipAddress,
+			userAgent,
+			method,
+			endpoint,
+			200,
+			"",
+		)
+	}
+}
+
+// CreateBudgetOverride grants a temporary budget increase.
+func CreateBudgetOverride(companyID, createdBy primitive.ObjectID, input BudgetOverrideInput) (*models.BudgetOverride, error) {
+	if input.ExtraTokens == 0 && input.ExtraRequests == 0 && !input.Unlimited {
+		return nil, errors.New("override must add tokens, requests or be unlimited")
+	}
+
+	now := time.Now()
+	override := models.BudgetOverride{
+		ID:            primitive.NewObjectID(),
+		CompanyID:     companyID,
+		ExtraTokens:   input.ExtraTokens,
+		ExtraRequests: input.ExtraRequests,
+		Unlimited:     input.Unlimited,
+		Reason:        input.Reason,
+		ExpiresAt:     primitive.NewDateTimeFromTime(now.Add(time.Duration(input.ExpiresInHours) * time.Hour)),
+		CreatedBy:     createdBy,
+		CreatedAt:     primitive.NewDateTimeFromTime(now),
+	}
+
+	if input.UserID != "" {
+		userID, err := primitive.ObjectIDFromHex(input.UserID)
+		if err != nil {
+			return nil, errors.New("invalid user ID")
+		}
+		user, err := GetUserByID(userID)
+		if err != nil || user.CompanyID != companyID {
+			return nil, errors.New("user not found")
+		}
+		override.UserID = userID
+	}
+
+	if _, err := budgetOverrideCollection.InsertOne(context.Background(), override); err != nil {
+		return nil, err
+	}
+	return &override, nil
+}
+
+// GetBudgetOverrides lists a company's overrides, newest first. Expired ones
+// are included only when includeExpired is set.
+func GetBudgetOverrides(companyID primitive.ObjectID, includeExpired bool) ([]models.BudgetOverride, error) {
+	ctx := context.Background()
+
+	filter := bson.M{"company_id": companyID}
+	if !includeExpired {
+		filter["expires_at"] = bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())}
+	}
+
+	cursor, err := budgetOverrideCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	overrides := []models.BudgetOverride{}
+	if err := cursor.All(ctx, &overrides); err != nil {
+		return nil, err
+	}
+	return overrides, nil
+}
+
+// DeleteBudgetOverride revokes an override.
+func DeleteBudgetOverride(overrideID, companyID primitive.ObjectID) error {
+	result, err := budgetOverrideCollection.DeleteOne(context.Background(), bson.M{
+		"_id":        overrideID,
+		"company_id": companyID,
+	})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return errors.New("budget override not found")
+	}
+	return nil
+}
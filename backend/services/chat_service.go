@@ -77,6 +77,25 @@ func GetChatMessages(chatID primitive.ObjectID) ([]models.Message, error) {
 	return messages, nil
 }
 
+// GetConversationWindow loads a chat's messages and returns the token-budgeted
+// window of prior turns to send along with the next user message. The chat's
+// rolling summary of older turns is refreshed in the background as they pile up.
+func GetConversationWindow(chatID, companyID primitive.ObjectID) (ConversationWindow, error) {
+	chat, err := GetChatByID(chatID, companyID)
+	if err != nil {
+		return ConversationWindow{}, err
+	}
+	messages, err := GetChatMessages(chatID)
+	if err != nil {
+		return ConversationWindow{}, err
+	}
+
+	budget := HistoryTokenBudget()
+	window, overflowed := BuildConversationWindow(messages, budget, chat.HistorySummary)
+	scheduleHistorySummaryRefresh(chat, messages[:overflowed], budget/summaryBudgetShare)
+	return window, nil
+}
+
 // --- ADD THIS NEW FUNCTION ---
 // CountMessagesInChat counts the number of messages in a given chat.
 func CountMessagesInChat(chatID primitive.ObjectID) (int64, error) {
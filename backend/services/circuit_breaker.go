@@ -0,0 +1,163 @@
+package services
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Circuit breaker states.
+const (
+	CircuitClosed   = "closed"    // Requests flow normally
+	CircuitOpen     = "open"      // Upstream considered down; requests are skipped
+	CircuitHalfOpen = "half_open" // Cooldown elapsed; one trial request is allowed
+)
+
+const (
+	circuitFailureThreshold = 3
+	circuitCooldown         = 30 * time.Second
+	// A trial that neither succeeds nor fails within this time (e.g. its
+	// goroutine panicked) no longer holds the breaker half-open
+	circuitTrialTimeout = 2 * time.Minute
+)
+
+// CircuitBreaker tracks consecutive failures of one upstream.
+type CircuitBreaker struct {
+	mu               sync.Mutex
+	name             string
+	state            string
+	consecutiveFails int
+	openedAt         time.Time
+	trialStartedAt   time.Time
+	lastError        string
+}
+
+// CircuitStatus is a point-in-time view of a breaker, for admin display.
+type CircuitStatus struct {
+	Upstream         string     `json:"upstream"`
+	State            string     `json:"state"`
+	ConsecutiveFails int        `json:"consecutive_fails"`
+	OpenedAt         *time.Time `json:"opened_at,omitempty"`
+	LastError        string     `json:"last_error,omitempty"`
+}
+
+var (
+	circuitBreakersMu sync.Mutex
+	circuitBreakers   = map[string]*CircuitBreaker{}
+)
+
+// circuitBreakerFor returns the shared breaker for an upstream, creating it on first use.
+func circuitBreakerFor(upstream string) *CircuitBreaker {
+	circuitBreakersMu.Lock()
+	defer circuitBreakersMu.Unlock()
+
+	cb, ok := circuitBreakers[upstream]
+	if !ok {
+		cb = &CircuitBreaker{name: upstream, state: CircuitClosed}
+		circuitBreakers[upstream] = cb
+	}
+	return cb
+}
+
+// Allow reports whether a request may be sent. An open breaker moves to
+// half-open once the cooldown has elapsed and lets a single trial through.
+// Callers that get true must report the outcome with RecordSuccess,
+// RecordFailure or Abandon.
+func (cb *CircuitBreaker) Allow() bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < circuitCooldown {
+			return false
+		}
+		cb.state = CircuitHalfOpen
+		cb.trialStartedAt = time.Now()
+		return true
+	case CircuitHalfOpen:
+		// A trial request is already in flight, unless it was lost
+		if time.Since(cb.trialStartedAt) < circuitTrialTimeout {
+			return false
+		}
+		cb.trialStartedAt = time.Now()
+		return true
+	default:
+		return true
+	}
+}
+
+// Abandon reports a request that ended without saying anything about the
+// upstream, e.g. because the client disconnected. An abandoned half-open
+// trial puts the breaker back to open with a fresh cooldown; otherwise
+// nothing changes.
+func (cb *CircuitBreaker) Abandon() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitHalfOpen {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+// RecordSuccess closes the breaker.
+func (cb *CircuitBreaker) RecordSuccess() {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.state = CircuitClosed
+	cb.consecutiveFails = 0
+	cb.lastError = ""
+}
+
+// RecordFailure counts a failure and opens the breaker once the threshold is
+// reached, or immediately if the half-open trial failed.
+func (cb *CircuitBreaker) RecordFailure(err error) {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	cb.consecutiveFails++
+	if err != nil {
+		cb.lastError = err.Error()
+	}
+	if cb.state == CircuitHalfOpen || cb.consecutiveFails >= circuitFailureThreshold {
+		cb.state = CircuitOpen
+		cb.openedAt = time.Now()
+	}
+}
+
+// Status returns a snapshot of the breaker.
+func (cb *CircuitBreaker) Status() CircuitStatus {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	status := CircuitStatus{
+		Upstream:         cb.name,
+		State:            cb.state,
+		ConsecutiveFails: cb.consecutiveFails,
+		LastError:        cb.lastError,
+	}
+	if cb.state != CircuitClosed {
+		openedAt := cb.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// CircuitStatuses lists the state of every upstream seen so far.
+func CircuitStatuses() []CircuitStatus {
+	circuitBreakersMu.Lock()
+	breakers := make([]*CircuitBreaker, 0, len(circuitBreakers))
+	for _, cb := range circuitBreakers {
+		breakers = append(breakers, cb)
+	}
+	circuitBreakersMu.Unlock()
+
+	statuses := make([]CircuitStatus, 0, len(breakers))
+	for _, cb := range breakers {
+		statuses = append(statuses, cb.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Upstream < statuses[j].Upstream })
+	return statuses
+}
@@ -0,0 +1,101 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// openBreaker returns a breaker tripped by consecutive failures whose
+// cooldown has already elapsed
+func openBreaker(t *testing.T) *CircuitBreaker {
+	t.Helper()
+	cb := &CircuitBreaker{name: "test", state: CircuitClosed}
+	for i := 0; i < circuitFailureThreshold; i++ {
+		if !cb.Allow() {
+			t.Fatalf("closed breaker refused request %d", i)
+		}
+		cb.RecordFailure(errors.New("upstream down"))
+	}
+	if cb.Allow() {
+		t.Fatal("open breaker allowed a request during the cooldown")
+	}
+	cb.openedAt = time.Now().Add(-circuitCooldown)
+	return cb
+}
+
+func TestCircuitBreakerHalfOpenTrial(t *testing.T) {
+	cb := openBreaker(t)
+	if !cb.Allow() {
+		t.Fatal("breaker refused the trial after the cooldown")
+	}
+	if cb.Allow() {
+		t.Fatal("breaker allowed a second request while the trial is in flight")
+	}
+
+	cb.RecordSuccess()
+	if got := cb.Status().State; got != CircuitClosed {
+		t.Fatalf("state after successful trial = %s, want %s", got, CircuitClosed)
+	}
+}
+
+func TestCircuitBreakerFailedTrialReopens(t *testing.T) {
+	cb := openBreaker(t)
+	cb.Allow()
+	cb.RecordFailure(errors.New("still down"))
+	if got := cb.Status().State; got != CircuitOpen {
+		t.Fatalf("state after failed trial = %s, want %s", got, CircuitOpen)
+	}
+	if cb.Allow() {
+		t.Fatal("breaker allowed a request right after the failed trial")
+	}
+}
+
+func TestCircuitBreakerAbandonedTrial(t *testing.T) {
+	cb := openBreaker(t)
+	if !cb.Allow() {
+		t.Fatal("breaker refused the trial after the cooldown")
+	}
+
+	cb.Abandon()
+	if got := cb.Status().State; got != CircuitOpen {
+		t.Fatalf("state after abandoned trial = %s, want %s", got, CircuitOpen)
+	}
+	if cb.Allow() {
+		t.Fatal("breaker allowed a request before the fresh cooldown elapsed")
+	}
+
+	cb.openedAt = time.Now().Add(-circuitCooldown)
+	if !cb.Allow() {
+		t.Fatal("breaker refused a new trial after the fresh cooldown")
+	}
+}
+
+func TestCircuitBreakerAbandonLeavesOtherStates(t *testing.T) {
+	cb := &CircuitBreaker{name: "test", state: CircuitClosed}
+	cb.RecordFailure(errors.New("blip"))
+	cb.Abandon()
+	status := cb.Status()
+	if status.State != CircuitClosed || status.ConsecutiveFails != 1 {
+		t.Fatalf("abandon changed a closed breaker: %+v", status)
+	}
+
+	cb = openBreaker(t)
+	openedAt := cb.openedAt
+	cb.Abandon()
+	if cb.state != CircuitOpen || !cb.openedAt.Equal(openedAt) {
+		t.Fatal("abandon restarted the cooldown of an open breaker")
+	}
+}
+
+func TestCircuitBreakerLostTrialTimesOut(t *testing.T) {
+	cb := openBreaker(t)
+	cb.Allow()
+	cb.trialStartedAt = time.Now().Add(-circuitTrialTimeout)
+	if !cb.Allow() {
+		t.Fatal("breaker stayed half-open after the trial timed out")
+	}
+	if cb.Allow() {
+		t.Fatal("breaker allowed a second request while the new trial is in flight")
+	}
+}
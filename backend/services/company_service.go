@@ -47,7 +47,8 @@ func CreateCompany(input CompanyRegistrationInput) (*models.Company, *models.Use
 		return nil, nil, errors.New("company email already exists")
 	}
 
-	// Create company with default settings
+	// Create company with default settings for the free tier
+	limits, _ := models.GetTierLimits(models.TierFree)
 	company := models.Company{
 		ID:                 primitive.NewObjectID(),
 		Name:               input.CompanyName,
@@ -55,24 +56,23 @@ func CreateCompany(input CompanyRegistrationInput) (*models.Company, *models.Use
 		Email:              input.Email,
 		Phone:              input.Phone,
 		Address:            input.Address,
-		SubscriptionTier:   "free",
-		SubscriptionStatus: "active",
-		MaxUsers:           10, // Free tier limit
+		SubscriptionTier:   models.TierFree,
+		SubscriptionStatus: models.SubscriptionActive,
+		MaxUsers:           limits.MaxUsers,
 		Settings: models.CompanySettings{
 			AllowUserRegistration:    false, // Only admins can add users by default
 			RequireEmailVerification: false,
 			SessionTimeout:           60, // 60 minutes
 			AllowedDomains:           []string{},
-			MaxChatsPerUser:          100,
-			MaxMessagesPerChat:       1000,
 			EnableDocumentUpload:     true,
-			MaxDocumentSize:          10 * 1024 * 1024, // 10MB
 		},
 		IsActive:  true,
 		CreatedAt: primitive.NewDateTimeFromTime(time.Now()),
 		UpdatedAt: primitive.NewDateTimeFromTime(time.Now()),
 	}
 
+	limits.ApplyTo(&company.Settings)
+
 	_, err = companyCollection.InsertOne(ctx, company)
 	if err != nil {
 		return nil, nil, err
@@ -153,6 +153,37 @@ func UpdateCompany(companyID primitive.ObjectID, updates bson.M) error {
 	return err
 }
 
+// ChangeSubscriptionTier moves a company to another tier and resets its seat
+// count and quota settings to that tier's defaults.
+func ChangeSubscriptionTier(companyID primitive.ObjectID, tier string) error {
+	limits, ok := models.GetTierLimits(tier)
+	if !ok {
+		return errors.New("invalid subscription tier")
+	}
+
+	company, err := GetCompanyByID(companyID)
+	if err != nil {
+		return err
+	}
+
+	settings := company.Settings
+	limits.ApplyTo(&settings)
+
+	_, err = companyCollection.UpdateOne(
+		context.Background(),
+		bson.M{"_id": companyID},
+		bson.M{
+			"$set": bson.M{
+				"subscription_tier": tier,
+				"max_users":         limits.MaxUsers,
+				"settings":          settings,
+				"updated_at":        primitive.NewDateTimeFromTime(time.Now()),
+			},
+		},
+	)
+	return err
+}
+
 // ListCompanies retrieves all companies (for super admin)
 func ListCompanies(page, limit int) ([]models.Company, int64, error) {
 	ctx := context.Background()
@@ -236,7 +267,7 @@ func GetAllCompanies(page, limit int, search string) ([]models.Company, int, err
 	return companies, int(total), nil
 }
 
-// DeactivateCompany deactivates a company (super admin only)
+// DeactivateCompany deactivates a company and revokes all of its sessions (super admin only)
 func DeactivateCompany(companyID primitive.ObjectID) error {
 	_, err := companyCollection.UpdateOne(
 		context.Background(),
@@ -248,5 +279,10 @@ func DeactivateCompany(companyID primitive.ObjectID) error {
 			},
 		},
 	)
+	if err != nil {
+		return err
+	}
+
+	_, err = RevokeCompanySessions(companyID, models.SessionRevokedCompanyDisabled, "")
 	return err
 }
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/generative-ai-go/genai"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// defaultHistoryTokenBudget bounds how much prior conversation is sent upstream
+	// with each message. Override with CHAT_HISTORY_TOKEN_BUDGET.
+	defaultHistoryTokenBudget = 2000
+	// maxHistoryTurns caps the verbatim window regardless of the token budget.
+	maxHistoryTurns = 20
+	// summaryBudgetShare is the fraction of the budget reserved for the summary
+	// of turns that no longer fit verbatim.
+	summaryBudgetShare = 4
+	// historySummaryRefreshTurns is how many overflowed messages the rolling
+	// summary may lag behind before a model refreshes it.
+	historySummaryRefreshTurns = 6
+	historySummaryTimeout      = 30 * time.Second
+)
+
+const historySummarySystemPrompt = "You condense conversations into short factual summaries for later reference."
+
+// ConversationTurn is one prior message sent as context to the assistant.
+type ConversationTurn struct {
+	Role    string `json:"role"` // "user" or "assistant"
+	Content string `json:"content"`
+}
+
+// ConversationWindow is the bounded slice of chat history sent with a new
+// message: the most recent turns verbatim plus a summary of everything older.
+type ConversationWindow struct {
+	Summary string             `json:"summary,omitempty"`
+	Turns   []ConversationTurn `json:"turns,omitempty"`
+}
+
+// EstimateTokens approximates the token count of text (~4 characters per token).
+func EstimateTokens(text string) int {
+	if text == "" {
+		return 0
+	}
+	return (len([]rune(text)) + 3) / 4
+}
+
+// HistoryTokenBudget returns the configured token budget for conversation history.
+func HistoryTokenBudget() int {
+	if v, err := strconv.Atoi(os.Getenv("CHAT_HISTORY_TOKEN_BUDGET")); err == nil && v > 0 {
+		return v
+	}
+	return defaultHistoryTokenBudget
+}
+
+// BuildConversationWindow selects the newest messages that fit in tokenBudget
+// (oldest first in the result). Messages that overflow the window are condensed
+// into Summary, which is itself limited to a quarter of the budget: stored, the
+// chat's rolling summary, covers the oldest of them and the rest are condensed
+// extractively, so building a window never calls a model. It also returns how
+// many leading messages overflowed.
+func BuildConversationWindow(messages []models.Message, tokenBudget int, stored *models.ChatHistorySummary) (ConversationWindow, int) {
+	var window ConversationWindow
+	if len(messages) == 0 || tokenBudget <= 0 {
+		return window, 0
+	}
+
+	turnBudget := tokenBudget - tokenBudget/summaryBudgetShare
+	used := 0
+	cut := len(messages)
+	for i := len(messages) - 1; i >= 0; i-- {
+		content := strings.TrimSpace(messages[i].Content)
+		if content == "" {
+			cut = i
+			continue
+		}
+		cost := EstimateTokens(content)
+		if used+cost > turnBudget || len(messages)-i > maxHistoryTurns {
+			break
+		}
+		used += cost
+		cut = i
+	}
+
+	for _, msg := range messages[cut:] {
+		content := strings.TrimSpace(msg.Content)
+		if content == "" {
+			continue
+		}
+		window.Turns = append(window.Turns, ConversationTurn{Role: msg.Role, Content: content})
+	}
+
+	if cut > 0 {
+		window.Summary = summarizeTurns(messages[:cut], validHistorySummary(messages[:cut], stored), tokenBudget/summaryBudgetShare)
+	}
+
+	return window, cut
+}
+
+// validHistorySummary returns stored if it still describes a prefix of the
+// overflowed messages, nil otherwise.
+func validHistorySummary(overflow []models.Message, stored *models.ChatHistorySummary) *models.ChatHistorySummary {
+	if stored == nil || stored.Text == "" || stored.Through <= 0 || stored.Through > len(overflow) {
+		return nil
+	}
+	if overflow[stored.Through-1].ID != stored.LastMessageID {
+		return nil
+	}
+	return stored
+}
+
+// summarizeTurns condenses overflowed messages into at most budget tokens: the
+// stored summary, if any, followed by the first sentence of the most recent
+// messages it does not cover yet.
+func summarizeTurns(messages []models.Message, stored *models.ChatHistorySummary, budget int) string {
+	if budget <= 0 {
+		return ""
+	}
+
+	var parts []string
+	if stored != nil {
+		text := truncateToTokens(stored.Text, budget)
+		parts = append(parts, text)
+		budget -= EstimateTokens(text)
+		messages = messages[stored.Through:]
+	}
+
+	// Extractive: walk backwards so the most recent context survives.
+	var lines []string
+	used := 0
+	for i := len(messages) - 1; i >= 0; i-- {
+		content := firstSentence(strings.TrimSpace(messages[i].Content))
+		if content == "" {
+			continue
+		}
+		line := messages[i].Role + ": " + content
+		cost := EstimateTokens(line)
+		if used+cost > budget {
+			break
+		}
+		used += cost
+		lines = append([]string{line}, lines...)
+	}
+	if len(lines) > 0 {
+		parts = append(parts, strings.Join(lines, "\n"))
+	}
+	return strings.Join(parts, "\n")
+}
+
+// historySummaryHop is the model that condenses a company's older chat
+// history: the first hop of its route. Companies answered by the enterprise
+// assistant get none, so their chats are never sent to another model and keep
+// the extractive summary.
+func historySummaryHop(company *models.Company) (routeHop, bool) {
+	hop := routeForCompany(company)[0]
+	switch hop.provider.Name() {
+	case ProviderEnterpriseAssistant, ProviderUnavailable:
+		return routeHop{}, false
+	}
+	return hop, true
+}
+
+// historySummaryRefreshes tracks the chats whose summary is being refreshed
+var historySummaryRefreshes = struct {
+	sync.Mutex
+	running map[primitive.ObjectID]bool
+}{running: map[primitive.ObjectID]bool{}}
+
+// scheduleHistorySummaryRefresh folds overflowed messages into the chat's
+// rolling summary in the background once historySummaryRefreshTurns of them
+// are not covered by it yet.
+func scheduleHistorySummaryRefresh(chat *models.Chat, overflow []models.Message, budget int) {
+	stored := validHistorySummary(overflow, chat.HistorySummary)
+	covered := 0
+	if stored != nil {
+		covered = stored.Through
+	}
+	if len(overflow)-covered < historySummaryRefreshTurns || budget <= 0 {
+		return
+	}
+
+	company, _ := GetCompanyByID(chat.CompanyID)
+	hop, ok := historySummaryHop(company)
+	if !ok {
+		return
+	}
+
+	historySummaryRefreshes.Lock()
+	defer historySummaryRefreshes.Unlock()
+	if historySummaryRefreshes.running[chat.ID] {
+		return
+	}
+	historySummaryRefreshes.running[chat.ID] = true
+
+	go func() {
+		defer func() {
+			historySummaryRefreshes.Lock()
+			delete(historySummaryRefreshes.running, chat.ID)
+			historySummaryRefreshes.Unlock()
+		}()
+		if err := refreshHistorySummary(chat, hop, overflow, stored, budget); err != nil {
+			log.Printf("Warning: failed to refresh history summary of chat %s: %v", chat.ID.Hex(), err)
+		}
+	}()
+}
+
+// refreshHistorySummary asks hop to fold the messages stored does not cover
+// into it and saves the result on the chat. The call is billed to the chat's
+// owner like any other completion.
+func refreshHistorySummary(chat *models.Chat, hop routeHop, overflow []models.Message, stored *models.ChatHistorySummary, budget int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), historySummaryTimeout)
+	defer cancel()
+
+	previous, pending := "", overflow
+	if stored != nil {
+		previous, pending = stored.Text, overflow[stored.Through:]
+	}
+	var transcript strings.Builder
+	for _, msg := range pending {
+		if content := strings.TrimSpace(msg.Content); content != "" {
+			fmt.Fprintf(&transcript, "%s: %s\n", msg.Role, content)
+		}
+	}
+	if previous == "" && transcript.Len() == 0 {
+		return nil
+	}
+
+	// Leave room in the budget for the messages that overflow until the next refresh
+	limit := budget * 3 / 4
+	prompt := fmt.Sprintf(
+		"Summarise the following earlier part of a conversation in at most %d words. Keep names, numbers and the questions the user asked.\n\n",
+		limit*3/4,
+	)
+	if previous != "" {
+		prompt += "Summary of the conversation before this part:\n" + previous + "\n\n"
+	}
+	prompt += transcript.String()
+
+	req := CompletionRequest{
+		CompanyID:    chat.CompanyID.Hex(),
+		Prompt:       prompt,
+		SystemPrompt: historySummarySystemPrompt,
+		Model:        hop.model,
+	}
+	response, err := hop.provider.Generate(ctx, req)
+	estimateUsage(response, req)
+	if err != nil {
+		return err
+	}
+	if err := RecordUsage(chat.CompanyID, chat.UserID, response); err != nil {
+		log.Printf("Warning: failed to record history summary usage for chat %s: %v", chat.ID.Hex(), err)
+	}
+
+	text := truncateToTokens(strings.TrimSpace(response.Content), limit)
+	if text == "" {
+		return errors.New("empty summary response")
+	}
+	summary := models.ChatHistorySummary{
+		Text:          text,
+		Through:       len(overflow),
+		LastMessageID: overflow[len(overflow)-1].ID,
+		UpdatedAt:     primitive.NewDateTimeFromTime(time.Now()),
+	}
+	_, err = chatCollection.UpdateOne(ctx, bson.M{"_id": chat.ID}, bson.M{"$set": bson.M{"history_summary": summary}})
+	return err
+}
+
+// ToGeminiHistory converts the window into Gemini chat history. The summary,
+// if any, is replayed as an initial user/model exchange.
+func (w ConversationWindow) ToGeminiHistory() []*genai.Content {
+	history := make([]*genai.Content, 0, len(w.Turns)+2)
+	if w.Summary != "" {
+		history = append(history,
+			&genai.Content{Role: "user", Parts: []genai.Part{genai.Text("Summary of our earlier conversation:\n" + w.Summary)}},
+			&genai.Content{Role: "model", Parts: []genai.Part{genai.Text("Understood.")}},
+		)
+	}
+	for _, turn := range w.Turns {
+		role := "user"
+		if turn.Role == "assistant" {
+			role = "model"
+		}
+		history = append(history, &genai.Content{Role: role, Parts: []genai.Part{genai.Text(turn.Content)}})
+	}
+	return history
+}
+
+func firstSentence(text string) string {
+	if idx := strings.IndexAny(text, ".?!\n"); idx >= 0 {
+		text = text[:idx+1]
+	}
+	return truncateToTokens(text, 60)
+}
+
+func truncateToTokens(text string, tokens int) string {
+	runes := []rune(text)
+	if maxRunes := tokens * 4; len(runes) > maxRunes {
+		return strings.TrimSpace(string(runes[:maxRunes])) + "…"
+	}
+	return text
+}
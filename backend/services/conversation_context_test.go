@@ -0,0 +1,155 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// testConversation alternates user and assistant messages of 26 tokens
+func testConversation(chatID primitive.ObjectID, n int) []models.Message {
+	messages := make([]models.Message, n)
+	start := time.Now().Add(-time.Hour)
+	for i := range messages {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		messages[i] = models.Message{
+			ID:        primitive.NewObjectID(),
+			ChatID:    chatID,
+			Role:      role,
+			Content:   fmt.Sprintf("Message %d. %s", i, strings.Repeat("x", 90)),
+			Timestamp: primitive.NewDateTimeFromTime(start.Add(time.Duration(i) * time.Second)),
+		}
+	}
+	return messages
+}
+
+// useEchoProvider registers the echo provider for the rest of the test
+func useEchoProvider(t *testing.T) {
+	t.Helper()
+	RegisterProvider(&echoProvider{})
+	t.Cleanup(func() {
+		providersMu.Lock()
+		delete(providers, ProviderEcho)
+		providersMu.Unlock()
+	})
+}
+
+func TestBuildConversationWindowSummary(t *testing.T) {
+	messages := testConversation(primitive.NewObjectID(), 30)
+	const budget = 400 // 300 tokens of turns, 100 of summary
+
+	window, cut := BuildConversationWindow(messages, budget, nil)
+	if cut != 19 || len(window.Turns) != 11 || window.Turns[0].Content != messages[19].Content {
+		t.Fatalf("cut %d with %d turns, want 19 and 11", cut, len(window.Turns))
+	}
+	if !strings.HasPrefix(window.Summary, "user: Message 0.\n") || !strings.HasSuffix(window.Summary, "\nuser: Message 18.") {
+		t.Fatalf("extractive summary = %q, want the overflowed messages", window.Summary)
+	}
+
+	stored := &models.ChatHistorySummary{Text: "They discussed refunds.", Through: 10, LastMessageID: messages[9].ID}
+	window, _ = BuildConversationWindow(messages, budget, stored)
+	if !strings.HasPrefix(window.Summary, "They discussed refunds.\nuser: Message 10.\n") || strings.Contains(window.Summary, "Message 9.") ||
+		!strings.HasSuffix(window.Summary, "\nuser: Message 18.") {
+		t.Fatalf("summary = %q, want the stored one followed by the messages after it", window.Summary)
+	}
+
+	// A message inside the covered range was deleted
+	stale := append(append([]models.Message{}, messages[:3]...), messages[4:]...)
+	window, _ = BuildConversationWindow(stale, budget, stored)
+	if strings.Contains(window.Summary, "They discussed refunds.") {
+		t.Fatalf("stale summary used: %q", window.Summary)
+	}
+
+	// The budget grew so that some covered messages are verbatim again
+	window, cut = BuildConversationWindow(messages[:25], 4000, stored)
+	if cut != 5 || strings.Contains(window.Summary, "They discussed refunds.") {
+		t.Fatalf("cut %d with summary %q, want 5 without the stored summary", cut, window.Summary)
+	}
+}
+
+func TestHistorySummaryHop(t *testing.T) {
+	RegisterProvider(&enterpriseAssistantProvider{})
+	useEchoProvider(t)
+	t.Setenv("LLM_PROVIDER", "")
+	t.Setenv("CHAT_BACKEND", "")
+
+	tests := []struct {
+		name    string
+		company *models.Company
+		want    string
+	}{
+		{"platform default is the enterprise assistant", nil, ""},
+		{"enterprise assistant chain", &models.Company{Settings: models.CompanySettings{LLMFallbackChain: []string{ProviderEnterpriseAssistant, ProviderEcho}}}, ""},
+		{"configured provider", &models.Company{Settings: models.CompanySettings{LLMProvider: ProviderEcho}}, ProviderEcho},
+		{"chain starting with a model", &models.Company{Settings: models.CompanySettings{LLMFallbackChain: []string{ProviderEcho + ":echo-2", ProviderEnterpriseAssistant}}}, ProviderEcho},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hop, ok := historySummaryHop(tt.company)
+			if tt.want == "" {
+				if ok {
+					t.Fatalf("got hop %s, want none", hop.provider.Name())
+				}
+				return
+			}
+			if !ok || hop.provider.Name() != tt.want {
+				t.Fatalf("got %v (%v), want %s", hop, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetConversationWindowRefreshesSummary(t *testing.T) {
+	setupTestDB(t)
+	useEchoProvider(t)
+	t.Setenv("CHAT_HISTORY_TOKEN_BUDGET", "400")
+
+	companyID, userID, chatID := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	mustInsert(t, companyCollection, models.Company{ID: companyID, Name: "Acme", Domain: "acme", IsActive: true,
+		Settings: models.CompanySettings{LLMProvider: ProviderEcho}})
+	mustInsert(t, chatCollection, models.Chat{ID: chatID, CompanyID: companyID, UserID: userID, Title: "Refunds"})
+	messages := testConversation(chatID, 30)
+	for _, msg := range messages {
+		mustInsert(t, messageCollection, msg)
+	}
+
+	if _, err := GetConversationWindow(chatID, companyID); err != nil {
+		t.Fatalf("GetConversationWindow: %v", err)
+	}
+
+	var chat *models.Chat
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var err error
+		if chat, err = GetChatByID(chatID, companyID); err != nil {
+			t.Fatalf("load chat: %v", err)
+		}
+		if chat.HistorySummary != nil || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	summary := chat.HistorySummary
+	if summary == nil || summary.Through != 19 || summary.LastMessageID != messages[18].ID || !strings.HasPrefix(summary.Text, "Echo: Summarise") {
+		t.Fatalf("stored summary = %+v, want one covering the 19 overflowed messages", summary)
+	}
+
+	window, err := GetConversationWindow(chatID, companyID)
+	if err != nil || !strings.HasPrefix(window.Summary, summary.Text) {
+		t.Fatalf("summary = %q, err %v; want the stored one", window.Summary, err)
+	}
+
+	var usage []models.UsageDaily
+	cursor, err := usageDailyCollection.Find(context.Background(), map[string]interface{}{"company_id": companyID})
+	if err != nil || cursor.All(context.Background(), &usage) != nil || len(usage) == 0 {
+		t.Fatalf("summary usage not recorded: %v", err)
+	}
+}
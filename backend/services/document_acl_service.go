@@ -0,0 +1,232 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ErrInvalidDocumentACL is returned for access lists naming unknown roles or
+// users outside the company
+var ErrInvalidDocumentACL = errors.New("invalid document access list")
+
+// DocumentACLInput is the access list of a knowledge base document as sent by
+// clients. Empty lists everywhere make the document company-wide.
+type DocumentACLInput struct {
+	Roles       []string `json:"roles"`
+	Departments []string `json:"departments"`
+	UserIDs     []string `json:"user_ids"`
+}
+
+// RetrievalFilter limits RAG retrieval to the documents the asking user may
+// read. Restricted documents outside the user's reach, and deleted or
+// replaced copies not yet removed upstream, are listed by their upstream
+// document ID, so changes apply to the next question without re-indexing.
+type RetrievalFilter struct {
+	UserID             string   `json:"user_id"`
+	ExcludeDocumentIDs []string `json:"exclude_document_ids"`
+}
+
+// documentReader is who a knowledge base document's ACL is checked against
+type documentReader struct {
+	UserID       primitive.ObjectID
+	RoleName     string
+	Department   string
+	Unrestricted bool // Company admins and super admins see every document
+}
+
+func documentReaderFor(actor Actor) (documentReader, error) {
+	reader := documentReader{
+		UserID:       actor.UserID,
+		RoleName:     actor.RoleName,
+		Unrestricted: actor.IsSuperAdmin || actor.isCompanyAdmin(),
+	}
+	if reader.Unrestricted {
+		return reader, nil
+	}
+
+	var user models.User
+	err := userCollection.FindOne(context.Background(),
+		bson.M{"_id": actor.UserID},
+		options.FindOne().SetProjection(bson.M{"department": 1}),
+	).Decode(&user)
+	if err != nil {
+		return reader, err
+	}
+	reader.Department = user.Department
+	return reader, nil
+}
+
+// canRead reports whether the reader may see doc. Uploaders always see their
+// own documents.
+func (r documentReader) canRead(doc *models.KnowledgeBaseDocument) bool {
+	if r.Unrestricted || doc.ACL.IsEmpty() || doc.UploadedBy == r.UserID {
+		return true
+	}
+	return slices.Contains(doc.ACL.Roles, r.RoleName) ||
+		(r.Department != "" && slices.Contains(doc.ACL.Departments, r.Department)) ||
+		slices.Contains(doc.ACL.UserIDs, r.UserID)
+}
+
+// visibleFilter matches the documents canRead allows
+func (r documentReader) visibleFilter() bson.M {
+	if r.Unrestricted {
+		return bson.M{}
+	}
+	or := []bson.M{
+		{"acl": nil},
+		{"uploaded_by": r.UserID},
+		{"acl.roles": r.RoleName},
+		{"acl.user_ids": r.UserID},
+	}
+	if r.Department != "" {
+		or = append(or, bson.M{"acl.departments": r.Department})
+	}
+	return bson.M{"$or": or}
+}
+
+// BuildDocumentACL validates an access list against the company's roles and
+// users. It returns nil when the list does not restrict access.
+func BuildDocumentACL(companyID primitive.ObjectID, input DocumentACLInput) (*models.DocumentACL, error) {
+	acl := &models.DocumentACL{
+		Roles:       trimmedUnique(input.Roles),
+		Departments: trimmedUnique(input.Departments),
+	}
+
+	if len(acl.Roles) > 0 {
+		count, err := roleCollection.CountDocuments(context.Background(), bson.M{
+			"company_id": companyID,
+			"name":       bson.M{"$in": acl.Roles},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if count != int64(len(acl.Roles)) {
+			return nil, fmt.Errorf("%w: unknown role", ErrInvalidDocumentACL)
+		}
+	}
+
+	userIDs, err := companyUserIDs(companyID, input.UserIDs)
+	if err != nil {
+		if errors.Is(err, ErrInvalidTeamUser) {
+			return nil, fmt.Errorf("%w: users must belong to the company", ErrInvalidDocumentACL)
+		}
+		return nil, err
+	}
+	if len(userIDs) > 0 {
+		acl.UserIDs = userIDs
+	}
+
+	if acl.IsEmpty() {
+		return nil, nil
+	}
+	return acl, nil
+}
+
+func trimmedUnique(values []string) []string {
+	var result []string
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value != "" && !slices.Contains(result, value) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+// SetKnowledgeBaseDocumentACL replaces the access list of a document and all
+// its versions; nil makes it company-wide again
+func SetKnowledgeBaseDocumentACL(docID, companyID primitive.ObjectID, acl *models.DocumentACL) (*models.KnowledgeBaseDocument, error) {
+	doc, err := GetKnowledgeBaseDocumentByID(docID, companyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := setVersionsACL(doc.LogicalID, companyID, acl); err != nil {
+		return nil, err
+	}
+	return GetKnowledgeBaseDocumentByID(docID, companyID)
+}
+
+// RetrievalFilterFor builds the retrieval filter for questions asked by
+// userID. Errors must fail the query rather than drop the filter.
+func RetrievalFilterFor(userID primitive.ObjectID) (*RetrievalFilter, error) {
+	access, err := ResolveAccess(userID)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := documentReaderFor(Actor{
+		UserID:       userID,
+		CompanyID:    access.CompanyID,
+		RoleName:     access.RoleName,
+		IsSuperAdmin: access.IsSuperAdmin,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	filter := &RetrievalFilter{UserID: userID.Hex(), ExcludeDocumentIDs: []string{}}
+
+	// Deleted and replaced copies may linger upstream until the worker
+	// removes them; nobody is answered from those
+	removed, err := removedUpstreamCopies(access.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	filter.ExcludeDocumentIDs = append(filter.ExcludeDocumentIDs, removed...)
+	if reader.Unrestricted {
+		return filter, nil
+	}
+
+	ids, err := knowledgeBaseCollection.Distinct(context.Background(), "document_id", bson.M{
+		"company_id":  access.CompanyID,
+		"status":      bson.M{"$ne": models.KBStatusPendingDelete},
+		"acl":         bson.M{"$ne": nil},
+		"document_id": bson.M{"$nin": bson.A{"", nil}},
+		"$nor":        bson.A{reader.visibleFilter()},
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range ids {
+		if s, ok := id.(string); ok {
+			filter.ExcludeDocumentIDs = append(filter.ExcludeDocumentIDs, s)
+		}
+	}
+	return filter, nil
+}
+
+// removedUpstreamCopies lists a company's upstream document IDs that are
+// tombstoned or superseded but not yet deleted upstream
+func removedUpstreamCopies(companyID primitive.ObjectID) ([]string, error) {
+	ctx := context.Background()
+	cursor, err := knowledgeBaseCollection.Find(ctx,
+		bson.M{
+			"company_id": companyID,
+			"$or": bson.A{
+				bson.M{"status": models.KBStatusPendingDelete},
+				bson.M{"stale_document_ids.0": bson.M{"$exists": true}},
+			},
+		},
+		options.Find().SetProjection(bson.M{"status": 1, "document_id": 1, "stale_document_ids": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	var docs []models.KnowledgeBaseDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for i := range docs {
+		ids = append(ids, upstreamCopies(&docs[i])...)
+	}
+	return ids, nil
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// kbContentHashIndex is the unique index keeping one current knowledge base
+// document per content and company
+const kbContentHashIndex = "current_content_hash"
+
+// ErrDuplicateDocument is returned when a document would become the second
+// current knowledge base document with the same content
+var ErrDuplicateDocument = errors.New("an identical document is already in the knowledge base")
+
+// ContentHash returns the hex SHA-256 of an uploaded file
+func ContentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// FindKnowledgeBaseDocumentByHash returns the company's current document
+// uploaded with the given content, if any. Documents stored before content
+// hashing have no hash and never match.
+func FindKnowledgeBaseDocumentByHash(companyID primitive.ObjectID, hash string) (*models.KnowledgeBaseDocument, error) {
+	if hash == "" {
+		return nil, mongo.ErrNoDocuments
+	}
+	var doc models.KnowledgeBaseDocument
+	err := knowledgeBaseCollection.FindOne(context.Background(), bson.M{
+		"company_id":   companyID,
+		"is_current":   true,
+		"content_hash": hash,
+	}).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// FindChatAttachmentMessage returns the message of a chat that already
+// carries an upload with the given content, if any. Unlike knowledge base
+// documents, attachments are deliberately deduplicated per chat, not per
+// company: chats are private to their owner, so a colleague's earlier upload
+// of the same file must neither block the upload nor be handed back. The
+// extracted text is still reused company-wide (see reusableExtractedText).
+func FindChatAttachmentMessage(chatID primitive.ObjectID, hash string) (*models.Message, error) {
+	var message models.Message
+	err := messageCollection.FindOne(context.Background(), bson.M{
+		"chat_id":                  chatID,
+		"attachments.content_hash": hash,
+	}, options.FindOne().SetProjection(bson.M{"attachments.processed_data": 0})).Decode(&message)
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// reusableExtractedText returns text already extracted from a file with the
+// job's content: the current knowledge base document with it, or an earlier
+// job of the company. Empty means the file has to be extracted.
+func reusableExtractedText(job *models.IngestionJob) string {
+	if job.ContentHash == "" {
+		return ""
+	}
+	if doc, err := FindKnowledgeBaseDocumentByHash(job.CompanyID, job.ContentHash); err == nil {
+		return doc.ExtractedText
+	}
+
+	var earlier models.IngestionJob
+	err := ingestionJobCollection.FindOne(context.Background(), bson.M{
+		"company_id":     job.CompanyID,
+		"content_hash":   job.ContentHash,
+		"_id":            bson.M{"$ne": job.ID},
+		"extracted_text": bson.M{"$nin": bson.A{nil, ""}},
+	}, options.FindOne().SetProjection(bson.M{"extracted_text": 1})).Decode(&earlier)
+	if err != nil {
+		return ""
+	}
+	return earlier.ExtractedText
+}
+
+// duplicateDocumentError turns violations of the content hash index into
+// ErrDuplicateDocument
+func duplicateDocumentError(err error) error {
+	if mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), kbContentHashIndex) {
+		return ErrDuplicateDocument
+	}
+	return err
+}
@@ -8,6 +8,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"os/exec"
 	"regexp"
@@ -21,18 +22,29 @@ var (
 	multiWhitespacePattern = regexp.MustCompile(`\s+`)
 )
 
+// defaultExtractionTimeout bounds the extractors ExtractDocumentText runs
+const defaultExtractionTimeout = 30 * time.Second
+
 func ExtractDocumentText(documentData []byte, mimeType string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultExtractionTimeout)
+	defer cancel()
+	return ExtractDocumentTextContext(ctx, documentData, mimeType)
+}
+
+// ExtractDocumentTextContext is ExtractDocumentText with the extractors
+// bounded by ctx instead of the default timeout, for large documents.
+func ExtractDocumentTextContext(ctx context.Context, documentData []byte, mimeType string) (string, error) {
 	normalizedMIME := strings.ToLower(strings.TrimSpace(strings.Split(mimeType, ";")[0]))
 
 	switch {
 	case isPlainTextMIME(normalizedMIME):
 		return normalizeExtractedText(string(documentData))
 	case isPDFMIME(normalizedMIME, documentData):
-		return extractPDFText(documentData)
+		return extractPDFText(ctx, documentData)
 	case isDocxMIME(normalizedMIME, documentData):
 		return extractDocxText(documentData)
 	case isDocMIME(normalizedMIME, documentData):
-		return extractDocText(documentData)
+		return extractDocText(ctx, documentData)
 	case isRTFMIME(normalizedMIME, documentData):
 		return extractRTFText(documentData)
 	case isODTMIME(normalizedMIME, documentData):
@@ -88,8 +100,36 @@ func isODTMIME(mimeType string, payload []byte) bool {
 	return bytes.HasPrefix(payload, []byte("PK")) && zipHasEntry(payload, "content.xml")
 }
 
+// openZip opens an in-memory ZIP archive
+func openZip(data []byte) (*zip.Reader, error) {
+	return zip.NewReader(bytes.NewReader(data), int64(len(data)))
+}
+
+// readZipEntry reads one archive entry. A positive limit rejects entries that
+// inflate beyond it, whatever their header claims.
+func readZipEntry(file *zip.File, limit int64) ([]byte, error) {
+	rc, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", file.Name, err)
+	}
+	defer rc.Close()
+
+	var reader io.Reader = rc
+	if limit > 0 {
+		reader = io.LimitReader(rc, limit+1)
+	}
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", file.Name, limit)
+	}
+	return data, nil
+}
+
 func zipHasEntry(documentData []byte, filename string) bool {
-	reader, err := zip.NewReader(bytes.NewReader(documentData), int64(len(documentData)))
+	reader, err := openZip(documentData)
 	if err != nil {
 		return false
 	}
@@ -103,10 +143,42 @@ func zipHasEntry(documentData []byte, filename string) bool {
 	return false
 }
 
-func extractPDFText(documentData []byte) (string, error) {
+// extractPDFText extracts a PDF's text page by page, each page prefixed with
+// its number. PDF_EXTRACTOR picks the extractor: "native" always uses the
+// built-in parser, "pdftotext" requires poppler's tool, and "auto" (the
+// default) uses the tool when it is installed and falls back to the parser
+// when it is missing or fails.
+func extractPDFText(ctx context.Context, documentData []byte) (string, error) {
+	var (
+		pages []string
+		err   error
+	)
+	switch strings.ToLower(strings.TrimSpace(os.Getenv("PDF_EXTRACTOR"))) {
+	case "native":
+		pages, err = extractPDFPages(ctx, documentData)
+	case "pdftotext":
+		pages, err = extractPDFPagesWithTool(ctx, documentData)
+	default:
+		if _, lookErr := exec.LookPath("pdftotext"); lookErr == nil {
+			if pages, err = extractPDFPagesWithTool(ctx, documentData); err == nil || ctx.Err() != nil {
+				break
+			}
+			log.Printf("pdftotext failed, using the built-in pdf extractor: %v", err)
+		}
+		pages, err = extractPDFPages(ctx, documentData)
+	}
+	if err != nil {
+		return "", err
+	}
+	return joinPDFPages(pages)
+}
+
+// extractPDFPagesWithTool runs pdftotext, which ends every page with a form
+// feed
+func extractPDFPagesWithTool(ctx context.Context, documentData []byte) ([]string, error) {
 	tempDir, err := os.MkdirTemp("", "doc-pdf-*")
 	if err != nil {
-		return "", fmt.Errorf("failed to create temp directory for pdf extraction: %w", err)
+		return nil, fmt.Errorf("failed to create temp directory for pdf extraction: %w", err)
 	}
 	defer os.RemoveAll(tempDir)
 
@@ -114,26 +186,44 @@ func extractPDFText(documentData []byte) (string, error) {
 	outFile := tempDir + "/output.txt"
 
 	if err := os.WriteFile(inFile, documentData, 0600); err != nil {
-		return "", fmt.Errorf("failed to write temp pdf file: %w", err)
+		return nil, fmt.Errorf("failed to write temp pdf file: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
 	cmd := exec.CommandContext(ctx, "pdftotext", "-layout", inFile, outFile)
 	if output, err := cmd.CombinedOutput(); err != nil {
 		if errors.Is(err, exec.ErrNotFound) {
-			return "", errors.New("pdf extraction tool not found: install pdftotext (poppler-utils)")
+			return nil, errors.New("pdf extraction tool not found: install pdftotext (poppler-utils) or set PDF_EXTRACTOR=native")
 		}
-		return "", fmt.Errorf("pdftotext failed: %v (%s)", err, strings.TrimSpace(string(output)))
+		return nil, fmt.Errorf("pdftotext failed: %v (%s)", err, strings.TrimSpace(string(output)))
 	}
 
 	textBytes, err := os.ReadFile(outFile)
 	if err != nil {
-		return "", fmt.Errorf("failed to read extracted pdf text: %w", err)
+		return nil, fmt.Errorf("failed to read extracted pdf text: %w", err)
+	}
+
+	pages := strings.Split(string(textBytes), "\f")
+	if len(pages) > 1 && strings.TrimSpace(pages[len(pages)-1]) == "" {
+		pages = pages[:len(pages)-1]
 	}
+	return pages, nil
+}
 
-	return normalizeExtractedText(string(textBytes))
+// joinPDFPages joins page texts as "[Page N] ..." paragraphs, leaving out
+// pages without text but keeping the numbering of the rest
+func joinPDFPages(pages []string) (string, error) {
+	var parts []string
+	for i, page := range pages {
+		text := strings.TrimSpace(multiWhitespacePattern.ReplaceAllString(page, " "))
+		if text == "" {
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("[Page %d] %s", i+1, text))
+	}
+	if len(parts) == 0 {
+		return "", errors.New("pdf has no extractable text (it may be scanned images)")
+	}
+	return strings.Join(parts, "\n\n"), nil
 }
 
 func extractDocxText(documentData []byte) (string, error) {
@@ -153,27 +243,15 @@ func extractODTText(documentData []byte) (string, error) {
 }
 
 func readZipXMLFile(documentData []byte, filename string) ([]byte, error) {
-	reader, err := zip.NewReader(bytes.NewReader(documentData), int64(len(documentData)))
+	reader, err := openZip(documentData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open zip document: %w", err)
 	}
 
 	for _, file := range reader.File {
-		if !strings.EqualFold(file.Name, filename) {
-			continue
-		}
-
-		rc, openErr := file.Open()
-		if openErr != nil {
-			return nil, fmt.Errorf("failed to open %s: %w", filename, openErr)
-		}
-		defer rc.Close()
-
-		xmlData, readErr := io.ReadAll(rc)
-		if readErr != nil {
-			return nil, fmt.Errorf("failed to read %s: %w", filename, readErr)
+		if strings.EqualFold(file.Name, filename) {
+			return readZipEntry(file, 0)
 		}
-		return xmlData, nil
 	}
 
 	return nil, fmt.Errorf("missing %s in document archive", filename)
@@ -207,7 +285,7 @@ func extractXMLCharData(xmlData []byte) (string, error) {
 	return normalizeExtractedText(strings.Join(parts, " "))
 }
 
-func extractDocText(documentData []byte) (string, error) {
+func extractDocText(ctx context.Context, documentData []byte) (string, error) {
 	tempFile, err := os.CreateTemp("", "doc-*.doc")
 	if err != nil {
 		return "", fmt.Errorf("failed to create temp doc file: %w", err)
@@ -219,9 +297,6 @@ func extractDocText(documentData []byte) (string, error) {
 		return "", fmt.Errorf("failed to write temp doc file: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
-
 	antiwordCmd := exec.CommandContext(ctx, "antiword", tempFile.Name())
 	antiwordOutput, antiwordErr := antiwordCmd.CombinedOutput()
 	if antiwordErr == nil {
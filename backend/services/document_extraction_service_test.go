@@ -0,0 +1,97 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestJoinPDFPages(t *testing.T) {
+	tests := []struct {
+		name    string
+		pages   []string
+		want    string
+		wantErr bool
+	}{
+		{"one page", []string{"Hello world"}, "[Page 1] Hello world", false},
+		{"collapses whitespace", []string{"  Hello \n\n world\t!  "}, "[Page 1] Hello world !", false},
+		{"keeps numbering across empty pages", []string{"First", "", " \n\f ", "Fourth\npage"}, "[Page 1] First\n\n[Page 4] Fourth page", false},
+		{"no text", []string{"", "  \n"}, "", true},
+		{"no pages", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := joinPDFPages(tt.pages)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// installFakePDFToText puts a pdftotext on PATH that runs script, or no
+// pdftotext at all when script is empty
+func installFakePDFToText(t *testing.T, script string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake pdftotext is a shell script")
+	}
+	dir := t.TempDir()
+	if script != "" {
+		if err := os.WriteFile(filepath.Join(dir, "pdftotext"), []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Setenv("PATH", dir)
+}
+
+func TestExtractPDFTextExtractors(t *testing.T) {
+	const (
+		working = `printf 'From the tool\f\f' > "$3"`
+		failing = `echo "Syntax Error: broken file" >&2; exit 1`
+	)
+	pdf := buildTestPDF(testPDFPages(testPDFFirstPage, testPDFSecondPage), "", nil)
+	native := "[Page 1] Hello world Next line\n\n[Page 2] Second page"
+
+	tests := []struct {
+		name      string
+		extractor string
+		script    string
+		want      string
+		wantErr   string
+	}{
+		{"auto prefers the tool", "", working, "[Page 1] From the tool", ""},
+		{"auto without the tool", "auto", "", native, ""},
+		{"auto falls back when the tool fails", "", failing, native, ""},
+		{"native ignores the tool", "native", working, native, ""},
+		{"pdftotext", "pdftotext", working, "[Page 1] From the tool", ""},
+		{"pdftotext fails", "pdftotext", failing, "", "Syntax Error"},
+		{"pdftotext missing", "pdftotext", "", "", "not found"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFakePDFToText(t, tt.script)
+			t.Setenv("PDF_EXTRACTOR", tt.extractor)
+
+			got, err := extractPDFText(context.Background(), pdf)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("extractPDFText: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,20 +2,26 @@ package services
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
 )
 
 type enterpriseAssistantQueryRequest struct {
-	CompanyID string `json:"company_id"`
-	Message   string `json:"message"`
-	TopK      int    `json:"top_k"`
+	CompanyID      string             `json:"company_id"`
+	Message        string             `json:"message"`
+	TopK           int                `json:"top_k"`
+	History        []ConversationTurn `json:"history,omitempty"`         // Prior turns, oldest first
+	HistorySummary string             `json:"history_summary,omitempty"` // Summary of turns older than History
+	Filter         *RetrievalFilter   `json:"filter,omitempty"`          // Document ACL restrictions of the asking user
 }
 
 type EnterpriseAssistantQueryResponse struct {
@@ -35,15 +41,15 @@ type enterpriseAssistantDocumentRequest struct {
 }
 
 type EnterpriseAssistantDocumentResponse struct {
-	DocumentID   string  `json:"document_id"`
-	ChunksCreated int    `json:"chunks_created"`
-	Summary      *string `json:"summary"`
+	DocumentID    string  `json:"document_id"`
+	ChunksCreated int     `json:"chunks_created"`
+	Summary       *string `json:"summary"`
 }
 
 var (
-	enterpriseAssistantBaseURL string
+	enterpriseAssistantBaseURL      string
 	enterpriseAssistantDocumentsURL string
-	enterpriseAssistantClient  *http.Client
+	enterpriseAssistantClient       *http.Client
 )
 
 func InitEnterpriseAssistantClient() {
@@ -72,27 +78,37 @@ func InitEnterpriseAssistantClient() {
 	}
 }
 
-func QueryEnterpriseAssistant(companyID, message string, topK int) (*EnterpriseAssistantQueryResponse, error) {
+// QueryEnterpriseAssistant runs a RAG query for message, sending the bounded
+// conversation window so follow-up questions keep their context and filter
+// so that only documents the asking user may read are retrieved.
+func QueryEnterpriseAssistant(companyID, message string, history ConversationWindow, topK int, filter *RetrievalFilter) (*EnterpriseAssistantQueryResponse, error) {
+	return queryEnterpriseAssistant(context.Background(), enterpriseAssistantQueryRequest{
+		CompanyID:      companyID,
+		Message:        message,
+		TopK:           topK,
+		History:        history.Turns,
+		HistorySummary: history.Summary,
+		Filter:         filter,
+	})
+}
+
+func queryEnterpriseAssistant(ctx context.Context, payload enterpriseAssistantQueryRequest) (*EnterpriseAssistantQueryResponse, error) {
 	if enterpriseAssistantClient == nil {
 		InitEnterpriseAssistantClient()
 	}
 
-	payload := enterpriseAssistantQueryRequest{
-		CompanyID: companyID,
-		Message:   message,
-		TopK:      topK,
-	}
-
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal query payload: %w", err)
 	}
 
-	resp, err := enterpriseAssistantClient.Post(
-		enterpriseAssistantBaseURL+"/api/v1/query",
-		"application/json",
-		bytes.NewBuffer(body),
-	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, enterpriseAssistantBaseURL+"/api/v1/query", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build enterprise assistant query request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := enterpriseAssistantClient.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to call enterprise assistant query API: %w", err)
 	}
@@ -115,7 +131,104 @@ func QueryEnterpriseAssistant(companyID, message string, topK int) (*EnterpriseA
 	return &result, nil
 }
 
+// StreamEnterpriseAssistant runs a RAG query against the streaming endpoint
+// (/api/v1/query/stream) and calls onChunk for every answer fragment. Backends
+// that predate the streaming endpoint answer 404/405, in which case the regular
+// query API is used and the whole answer is delivered as a single chunk.
+func StreamEnterpriseAssistant(ctx context.Context, companyID, message string, history ConversationWindow, topK int, filter *RetrievalFilter, onChunk func(string) error) (*EnterpriseAssistantQueryResponse, error) {
+	if enterpriseAssistantClient == nil {
+		InitEnterpriseAssistantClient()
+	}
+
+	payload := enterpriseAssistantQueryRequest{
+		CompanyID:      companyID,
+		Message:        message,
+		TopK:           topK,
+		History:        history.Turns,
+		HistorySummary: history.Summary,
+		Filter:         filter,
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal query payload: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, enterpriseAssistantBaseURL+"/api/v1/query/stream", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build enterprise assistant stream request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := enterpriseAssistantClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call enterprise assistant stream API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusMethodNotAllowed {
+		result, err := queryEnterpriseAssistant(ctx, payload)
+		if err != nil {
+			return nil, err
+		}
+		if err := onChunk(result.Answer); err != nil {
+			return nil, err
+		}
+		return result, nil
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("enterprise assistant stream API returned %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var answer strings.Builder
+	var result EnterpriseAssistantQueryResponse
+	done := false
+	err = readSSE(resp.Body, func(event, data string) error {
+		switch event {
+		case "chunk", "":
+			var chunk struct {
+				Delta string `json:"delta"`
+			}
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return fmt.Errorf("failed to parse enterprise assistant stream chunk: %w", err)
+			}
+			if chunk.Delta == "" {
+				return nil
+			}
+			answer.WriteString(chunk.Delta)
+			return onChunk(chunk.Delta)
+		case "done":
+			if err := json.Unmarshal([]byte(data), &result); err != nil {
+				return fmt.Errorf("failed to parse enterprise assistant stream summary: %w", err)
+			}
+			done = true
+			return errSSEDone
+		case "error":
+			return fmt.Errorf("enterprise assistant stream error: %s", data)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !done {
+		// The upstream went away between events
+		return nil, errors.New("enterprise assistant stream ended before the done event")
+	}
+
+	// The done event carries metadata; the answer is whatever was streamed.
+	result.Answer = answer.String()
+	return &result, nil
+}
+
 func UploadDocumentToEnterpriseAssistant(companyID, userID, filename, text string) (*EnterpriseAssistantDocumentResponse, error) {
+	return uploadDocumentToEnterpriseAssistant(context.Background(), companyID, userID, filename, text)
+}
+
+func uploadDocumentToEnterpriseAssistant(ctx context.Context, companyID, userID, filename, text string) (*EnterpriseAssistantDocumentResponse, error) {
 	if enterpriseAssistantClient == nil {
 		InitEnterpriseAssistantClient()
 	}
@@ -126,18 +239,20 @@ func UploadDocumentToEnterpriseAssistant(companyID, userID, filename, text strin
 		Filename:  filename,
 		Text:      text,
 	}
-//print payload for debugging
+	//print payload for debugging
 	fmt.Printf("Uploading document to Enterprise Assistant: %+v\n", payload)
 	body, err := json.Marshal(payload)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal document payload: %w", err)
 	}
 
-	resp, err := enterpriseAssistantClient.Post(
-		enterpriseAssistantDocumentsURL+"/api/v1/documents",
-		"application/json",
-		bytes.NewBuffer(body),
-	)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, enterpriseAssistantDocumentsURL+"/api/v1/documents", bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build enterprise assistant document request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := enterpriseAssistantClient.Do(req)
 	if err != nil {
 		fmt.Printf("Error calling Enterprise Assistant document API: %v\n", err)
 		return nil, fmt.Errorf("failed to call enterprise assistant document API: %w", err)
@@ -167,3 +282,72 @@ func UploadDocumentToEnterpriseAssistant(companyID, userID, filename, text strin
 
 	return &result, nil
 }
+
+// EnterpriseAssistantDocument is an entry of the upstream document list
+type EnterpriseAssistantDocument struct {
+	DocumentID string `json:"document_id"`
+	CompanyID  string `json:"company_id"`
+	Filename   string `json:"filename"`
+}
+
+// deleteEnterpriseAssistantDocument removes a document and its chunks from
+// the upstream index. A document that is already gone counts as deleted.
+func deleteEnterpriseAssistantDocument(ctx context.Context, companyID, documentID string) error {
+	if enterpriseAssistantClient == nil {
+		InitEnterpriseAssistantClient()
+	}
+
+	endpoint := enterpriseAssistantDocumentsURL + "/api/v1/documents/" + url.PathEscape(documentID) + "?company_id=" + url.QueryEscape(companyID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("failed to build enterprise assistant delete request: %w", err)
+	}
+
+	resp, err := enterpriseAssistantClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call enterprise assistant document API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent, http.StatusNotFound:
+		return nil
+	}
+	respBody, _ := io.ReadAll(resp.Body)
+	return fmt.Errorf("enterprise assistant document delete returned %d: %s", resp.StatusCode, string(respBody))
+}
+
+// listEnterpriseAssistantDocuments returns the documents indexed upstream for
+// a company
+func listEnterpriseAssistantDocuments(ctx context.Context, companyID string) ([]EnterpriseAssistantDocument, error) {
+	if enterpriseAssistantClient == nil {
+		InitEnterpriseAssistantClient()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, enterpriseAssistantDocumentsURL+"/api/v1/documents?company_id="+url.QueryEscape(companyID), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build enterprise assistant list request: %w", err)
+	}
+
+	resp, err := enterpriseAssistantClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call enterprise assistant document API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read enterprise assistant document list: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("enterprise assistant document list returned %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Documents []EnterpriseAssistantDocument `json:"documents"`
+	}
+	if err := json.Unmarshal(respBody, &result); err != nil {
+		return nil, fmt.Errorf("failed to parse enterprise assistant document list: %w", err)
+	}
+	return result.Documents, nil
+}
@@ -0,0 +1,179 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useEnterpriseAssistant points the client at handler for the rest of the test
+func useEnterpriseAssistant(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	t.Setenv("ENTERPRISE_ASSISTANT_URL", server.URL)
+	t.Setenv("ENTERPRISE_ASSISTANT_DOCUMENTS_URL", "")
+	InitEnterpriseAssistantClient()
+	t.Cleanup(func() { enterpriseAssistantClient = nil }) // Re-read the environment on next use
+}
+
+// writeFakeAssistantChunks writes answer the way scripts/fake_enterprise_assistant
+// streams it: one chunk event per word
+func writeFakeAssistantChunks(w http.ResponseWriter, answer string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, word := range strings.SplitAfter(answer, " ") {
+		payload, _ := json.Marshal(map[string]string{"delta": word})
+		fmt.Fprintf(w, "event: chunk\ndata: %s\n\n", payload)
+		w.(http.Flusher).Flush()
+	}
+}
+
+func writeFakeAssistantDone(w http.ResponseWriter) {
+	fmt.Fprint(w, "event: done\ndata: {\"chunks_used\":2,\"llm_used\":true,\"used_document_context\":true}\n\n")
+	w.(http.Flusher).Flush()
+}
+
+// dropConnection closes the connection without ending the chunked body
+func dropConnection(t *testing.T, w http.ResponseWriter) {
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		t.Errorf("hijack: %v", err)
+		return
+	}
+	conn.Close()
+}
+
+func TestStreamEnterpriseAssistant(t *testing.T) {
+	const answer = "Refunds are processed within 14 days."
+	tests := []struct {
+		name       string
+		handler    func(t *testing.T, w http.ResponseWriter, r *http.Request)
+		wantChunks []string
+		wantErr    string
+	}{
+		{
+			name: "complete stream",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				writeFakeAssistantChunks(w, answer)
+				fmt.Fprint(w, ": keep-alive\n\n")
+				writeFakeAssistantDone(w)
+			},
+			wantChunks: strings.SplitAfter(answer, " "),
+		},
+		{
+			name: "upstream error event",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				writeFakeAssistantChunks(w, "Refunds are")
+				fmt.Fprint(w, "event: error\ndata: {\"detail\":\"llm timeout\"}\n\n")
+			},
+			wantChunks: []string{"Refunds ", "are"},
+			wantErr:    "llm timeout",
+		},
+		{
+			name: "mid-stream disconnect",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				writeFakeAssistantChunks(w, "Refunds are")
+				dropConnection(t, w)
+			},
+			wantChunks: []string{"Refunds ", "are"},
+			wantErr:    "unexpected EOF",
+		},
+		{
+			name: "stream ends without done",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				writeFakeAssistantChunks(w, "Refunds are")
+			},
+			wantChunks: []string{"Refunds ", "are"},
+			wantErr:    "before the done event",
+		},
+		{
+			name: "malformed chunk",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				fmt.Fprint(w, "event: chunk\ndata: {not json\n\n")
+			},
+			wantErr: "failed to parse enterprise assistant stream chunk",
+		},
+		{
+			name: "upstream failure status",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				http.Error(w, "index unavailable", http.StatusServiceUnavailable)
+			},
+			wantErr: "returned 503: index unavailable",
+		},
+		{
+			name: "backend without the streaming endpoint",
+			handler: func(t *testing.T, w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/api/v1/query" {
+					http.NotFound(w, r)
+					return
+				}
+				json.NewEncoder(w).Encode(map[string]interface{}{"answer": answer, "chunks_used": 2})
+			},
+			wantChunks: []string{answer},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var request enterpriseAssistantQueryRequest
+			useEnterpriseAssistant(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/api/v1/query/stream" {
+					json.NewDecoder(r.Body).Decode(&request)
+				}
+				tt.handler(t, w, r)
+			})
+
+			history := ConversationWindow{
+				Turns:   []ConversationTurn{{Role: "user", Content: "Hi"}, {Role: "assistant", Content: "Hello"}},
+				Summary: "Earlier: greetings",
+			}
+			filter := &RetrievalFilter{UserID: "u1", ExcludeDocumentIDs: []string{"doc-9"}}
+			var chunks []string
+			result, err := StreamEnterpriseAssistant(context.Background(), "c1", "How long do refunds take?", history, 3, filter, func(chunk string) error {
+				chunks = append(chunks, chunk)
+				return nil
+			})
+
+			if strings.Join(chunks, "|") != strings.Join(tt.wantChunks, "|") {
+				t.Errorf("chunks = %q, want %q", chunks, tt.wantChunks)
+			}
+			if request.CompanyID != "c1" || len(request.History) != 2 || request.HistorySummary != history.Summary ||
+				request.Filter == nil || request.Filter.ExcludeDocumentIDs[0] != "doc-9" {
+				t.Errorf("upstream received %+v", request)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("StreamEnterpriseAssistant: %v", err)
+			}
+			if result.Answer != answer || result.ChunksUsed != 2 {
+				t.Fatalf("result = %+v", result)
+			}
+		})
+	}
+}
+
+func TestStreamEnterpriseAssistantStopsOnChunkError(t *testing.T) {
+	useEnterpriseAssistant(t, func(w http.ResponseWriter, r *http.Request) {
+		writeFakeAssistantChunks(w, "one two three")
+		writeFakeAssistantDone(w)
+	})
+
+	clientGone := errors.New("client gone")
+	calls := 0
+	_, err := StreamEnterpriseAssistant(context.Background(), "c1", "count", ConversationWindow{}, 3, nil, func(chunk string) error {
+		calls++
+		return clientGone
+	})
+	if !errors.Is(err, clientGone) || calls != 1 {
+		t.Fatalf("err = %v after %d chunks, want %v after 1", err, calls, clientGone)
+	}
+}
@@ -49,15 +49,24 @@ func InitGemini() {
 	}
 
 	geminiClient = client
-	geminiModel = client.GenerativeModel("gemini-2.5-flash")
+	geminiModel = newGeminiModel(defaultGeminiModel)
+}
+
+// defaultGeminiModel is used unless a company configures CompanySettings.LLMModel.
+const defaultGeminiModel = "gemini-2.5-flash"
+
+// newGeminiModel returns a model handle with the enterprise system prompt and
+// safety settings applied.
+func newGeminiModel(name string) *genai.GenerativeModel {
+	model := geminiClient.GenerativeModel(name)
 
 	// Set system instruction
-	geminiModel.SystemInstruction = &genai.Content{
+	model.SystemInstruction = &genai.Content{
 		Parts: []genai.Part{genai.Text(SystemPrompt)},
 	}
 
 	// Configure safety settings for enterprise use
-	geminiModel.SafetySettings = []*genai.SafetySetting{
+	model.SafetySettings = []*genai.SafetySetting{
 		{
 			Category:  genai.HarmCategoryHarassment,
 			Threshold: genai.HarmBlockMediumAndAbove,
@@ -75,6 +84,8 @@ func InitGemini() {
 			Threshold: genai.HarmBlockMediumAndAbove,
 		},
 	}
+
+	return model
 }
 
 // GenerateResponse sends the chat history to the Gemini API and returns the AI's response.
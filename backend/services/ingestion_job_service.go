@@ -0,0 +1,364 @@
+package services
+
+import (
+	"bytes"
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Ingestion worker defaults. INGESTION_WORKERS sets the pool size (0 disables
+// the workers), INGESTION_JOB_TIMEOUT_SECONDS the time one attempt may take
+// and INGESTION_MAX_ATTEMPTS how often an interrupted job is retried.
+const (
+	defaultIngestionWorkers     = 2
+	defaultIngestionJobTimeout  = 15 * time.Minute
+	defaultIngestionMaxAttempts = 3
+	ingestionLease              = 2 * time.Minute // Renewed while the job runs
+	ingestionHeartbeat          = 30 * time.Second
+	ingestionPollInterval       = 5 * time.Second
+	ingestionRetryDelay         = 30 * time.Second
+	ingestionFilesBucket        = "ingestion_files"
+)
+
+// errIngestionRetry marks a step that failed for a passing reason; the job is
+// queued again instead of failing
+var errIngestionRetry = errors.New("temporary ingestion failure")
+
+var (
+	ingestionFiles *gridfs.Bucket
+	ingestionWake  = make(chan struct{}, 1)
+)
+
+// IngestionJobInput describes an upload to queue
+type IngestionJobInput struct {
+	CompanyID  primitive.ObjectID
+	UserID     primitive.ObjectID
+	Kind       string
+	Filename   string
+	MimeType   string
+	ChatID     *primitive.ObjectID
+	ReplacesID *primitive.ObjectID
+	ACL        *models.DocumentACL
+	KeepACL    bool
+	Tags       []string
+	BatchID    *primitive.ObjectID
+	Origin     models.RequestOrigin
+}
+
+func initIngestionFiles() {
+	bucket, err := gridfs.NewBucket(ingestionJobCollection.Database(), options.GridFSBucket().SetName(ingestionFilesBucket))
+	if err != nil {
+		log.Printf("Warning: Failed to open ingestion file bucket: %v", err)
+		return
+	}
+	ingestionFiles = bucket
+}
+
+func ingestionMaxAttempts() int {
+	return envInt("INGESTION_MAX_ATTEMPTS", defaultIngestionMaxAttempts)
+}
+
+func ingestionJobTimeout() time.Duration {
+	return time.Duration(envInt("INGESTION_JOB_TIMEOUT_SECONDS", int(defaultIngestionJobTimeout/time.Second))) * time.Second
+}
+
+// EnqueueIngestionJob stores the uploaded file and queues a job to process it
+func EnqueueIngestionJob(input IngestionJobInput, data []byte) (*models.IngestionJob, error) {
+	if ingestionFiles == nil {
+		return nil, errors.New("ingestion file storage unavailable")
+	}
+
+	fileID := primitive.NewObjectID()
+	if err := ingestionFiles.UploadFromStreamWithID(fileID, input.Filename, bytes.NewReader(data)); err != nil {
+		return nil, fmt.Errorf("failed to store uploaded file: %w", err)
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	job := models.IngestionJob{
+		ID:            primitive.NewObjectID(),
+		CompanyID:     input.CompanyID,
+		UserID:        input.UserID,
+		Kind:          input.Kind,
+		Status:        models.JobStatusQueued,
+		Stage:         models.JobStageQueued,
+		Filename:      input.Filename,
+		MimeType:      input.MimeType,
+		Size:          int64(len(data)),
+		ContentHash:   ContentHash(data),
+		FileID:        fileID,
+		ChatID:        input.ChatID,
+		ReplacesID:    input.ReplacesID,
+		ACL:           input.ACL,
+		KeepACL:       input.KeepACL,
+		Tags:          input.Tags,
+		BatchID:       input.BatchID,
+		RequestOrigin: input.Origin,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if _, err := ingestionJobCollection.InsertOne(context.Background(), job); err != nil {
+		deleteIngestionFile(fileID)
+		return nil, err
+	}
+
+	select {
+	case ingestionWake <- struct{}{}:
+	default:
+	}
+	return &job, nil
+}
+
+// GetIngestionJob fetches a job by ID
+func GetIngestionJob(jobID primitive.ObjectID) (*models.IngestionJob, error) {
+	var job models.IngestionJob
+	if err := ingestionJobCollection.FindOne(context.Background(), bson.M{"_id": jobID}).Decode(&job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// startIngestionWorkers starts the worker pool. Jobs left queued or running
+// by a previous process are picked up again once their lease expires.
+func startIngestionWorkers() {
+	workers := envInt("INGESTION_WORKERS", defaultIngestionWorkers)
+	if workers <= 0 {
+		log.Println("Ingestion workers disabled")
+		return
+	}
+	for i := 0; i < workers; i++ {
+		go runIngestionWorker()
+	}
+}
+
+func runIngestionWorker() {
+	ticker := time.NewTicker(ingestionPollInterval)
+	defer ticker.Stop()
+	for {
+		failAbandonedIngestionJobs()
+		for {
+			job, err := claimIngestionJob()
+			if err != nil {
+				if !errors.Is(err, mongo.ErrNoDocuments) {
+					log.Printf("Warning: Failed to claim ingestion job: %v", err)
+				}
+				break
+			}
+			processIngestionJob(job)
+		}
+		select {
+		case <-ingestionWake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// claimIngestionJob leases the oldest queued job, or a running one whose
+// worker stopped renewing its lease
+func claimIngestionJob() (*models.IngestionJob, error) {
+	now := time.Now()
+	nowDT := primitive.NewDateTimeFromTime(now)
+	var job models.IngestionJob
+	err := ingestionJobCollection.FindOneAndUpdate(context.Background(),
+		bson.M{
+			"$or": bson.A{
+				bson.M{"status": models.JobStatusQueued, "run_after": bson.M{"$not": bson.M{"$gt": nowDT}}},
+				bson.M{"status": models.JobStatusRunning, "lease_until": bson.M{"$lt": nowDT}},
+			},
+			"attempts": bson.M{"$lt": ingestionMaxAttempts()},
+		},
+		bson.M{
+			"$set": bson.M{
+				"status":      models.JobStatusRunning,
+				"lease_until": primitive.NewDateTimeFromTime(now.Add(ingestionLease)),
+				"started_at":  nowDT,
+				"updated_at":  nowDT,
+			},
+			"$unset": bson.M{"run_after": ""},
+			"$inc":   bson.M{"attempts": 1},
+		},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "created_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&job)
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// failAbandonedIngestionJobs fails the jobs whose worker stopped on their
+// last attempt, e.g. because every attempt crashed the process
+func failAbandonedIngestionJobs() {
+	ctx := context.Background()
+	cursor, err := ingestionJobCollection.Find(ctx, bson.M{
+		"status":      models.JobStatusRunning,
+		"lease_until": bson.M{"$lt": primitive.NewDateTimeFromTime(time.Now())},
+		"attempts":    bson.M{"$gte": ingestionMaxAttempts()},
+	})
+	if err != nil {
+		return
+	}
+	var jobs []models.IngestionJob
+	if err := cursor.All(ctx, &jobs); err != nil {
+		return
+	}
+	for i := range jobs {
+		finishIngestionJob(&jobs[i], fmt.Errorf("processing stopped after %d attempts", jobs[i].Attempts))
+	}
+}
+
+// processIngestionJob runs one attempt of a leased job and records the outcome
+func processIngestionJob(job *models.IngestionJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), ingestionJobTimeout())
+	defer cancel()
+	stop := keepIngestionLease(job, cancel)
+	defer stop()
+
+	var err error
+	switch job.Kind {
+	case models.JobKindChatDocument:
+		err = runChatDocumentJob(ctx, job)
+	case models.JobKindKnowledgeBase:
+		err = runKnowledgeBaseJob(ctx, job)
+	case models.JobKindKnowledgeBaseImport:
+		err = runKnowledgeBaseImportJob(ctx, job)
+	default:
+		err = fmt.Errorf("unknown job kind %q", job.Kind)
+	}
+
+	if errors.Is(err, errIngestionRetry) && job.Attempts < ingestionMaxAttempts() {
+		requeueIngestionJob(job, err)
+		return
+	}
+	if err != nil {
+		log.Printf("Ingestion job %s failed: %v", job.ID.Hex(), err)
+	}
+	finishIngestionJob(job, err)
+}
+
+// keepIngestionLease renews the job's lease until stop is called, and
+// cancels the attempt if another worker took the job over
+func keepIngestionLease(job *models.IngestionJob, cancel context.CancelFunc) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(ingestionHeartbeat)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				result, err := ingestionJobCollection.UpdateOne(context.Background(),
+					attemptFilter(job),
+					bson.M{"$set": bson.M{"lease_until": primitive.NewDateTimeFromTime(time.Now().Add(ingestionLease))}},
+				)
+				if err == nil && result.MatchedCount == 0 {
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// attemptFilter matches the job only while this attempt still owns it, so a
+// worker whose lease was taken over cannot overwrite the new attempt
+func attemptFilter(job *models.IngestionJob) bson.M {
+	return bson.M{"_id": job.ID, "status": models.JobStatusRunning, "attempts": job.Attempts}
+}
+
+// updateIngestionJob records progress of a running job; set may carry
+// checkpoint fields
+func updateIngestionJob(job *models.IngestionJob, stage string, progress int, set bson.M) {
+	if set == nil {
+		set = bson.M{}
+	}
+	set["stage"] = stage
+	set["progress"] = progress
+	set["updated_at"] = primitive.NewDateTimeFromTime(time.Now())
+	job.Stage, job.Progress = stage, progress
+
+	_, err := ingestionJobCollection.UpdateOne(context.Background(), attemptFilter(job), bson.M{"$set": set})
+	if err != nil {
+		log.Printf("Warning: Failed to record progress of ingestion job %s: %v", job.ID.Hex(), err)
+	}
+}
+
+func requeueIngestionJob(job *models.IngestionJob, cause error) {
+	now := time.Now()
+	_, err := ingestionJobCollection.UpdateOne(context.Background(),
+		attemptFilter(job),
+		bson.M{
+			"$set": bson.M{
+				"status":     models.JobStatusQueued,
+				"error":      cause.Error(),
+				"run_after":  primitive.NewDateTimeFromTime(now.Add(ingestionRetryDelay)),
+				"updated_at": primitive.NewDateTimeFromTime(now),
+			},
+			"$unset": bson.M{"lease_until": ""},
+		},
+	)
+	if err != nil {
+		log.Printf("Warning: Failed to requeue ingestion job %s: %v", job.ID.Hex(), err)
+	}
+}
+
+// finishIngestionJob marks a job succeeded (nil jobErr) or failed and drops
+// its file and checkpointed text
+func finishIngestionJob(job *models.IngestionJob, jobErr error) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	set := bson.M{"finished_at": now, "updated_at": now}
+	unset := bson.M{"lease_until": "", "run_after": "", "extracted_text": ""}
+	if jobErr == nil {
+		set["status"] = models.JobStatusSucceeded
+		set["stage"] = models.JobStageDone
+		set["progress"] = 100
+		unset["error"] = ""
+	} else {
+		set["status"] = models.JobStatusFailed
+		set["error"] = jobErr.Error()
+	}
+
+	result, err := ingestionJobCollection.UpdateOne(context.Background(),
+		attemptFilter(job),
+		bson.M{"$set": set, "$unset": unset},
+	)
+	if err != nil {
+		log.Printf("Warning: Failed to finish ingestion job %s: %v", job.ID.Hex(), err)
+		return
+	}
+	if result.MatchedCount > 0 {
+		deleteIngestionFile(job.FileID)
+	}
+}
+
+func readIngestionFile(fileID primitive.ObjectID) ([]byte, error) {
+	if ingestionFiles == nil {
+		return nil, errors.New("ingestion file storage unavailable")
+	}
+	var buf bytes.Buffer
+	if _, err := ingestionFiles.DownloadToStream(fileID, &buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func deleteIngestionFile(fileID primitive.ObjectID) {
+	if ingestionFiles == nil || fileID.IsZero() {
+		return
+	}
+	if err := ingestionFiles.Delete(fileID); err != nil && !errors.Is(err, gridfs.ErrFileNotFound) {
+		log.Printf("Warning: Failed to delete ingestion file %s: %v", fileID.Hex(), err)
+	}
+}
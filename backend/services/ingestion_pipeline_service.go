@@ -0,0 +1,325 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Progress reported when each stage starts
+const (
+	progressExtracting  = 10
+	progressUploading   = 40
+	progressSummarizing = 60
+	progressSaving      = 90
+)
+
+// ingestionText returns the job's extracted text, extracting it on the first
+// attempt that gets this far unless a file with the same content was
+// extracted before
+func ingestionText(ctx context.Context, job *models.IngestionJob) (string, error) {
+	if job.ExtractedText != "" {
+		return job.ExtractedText, nil
+	}
+	updateIngestionJob(job, models.JobStageExtracting, progressExtracting, nil)
+
+	if text := reusableExtractedText(job); text != "" {
+		job.ExtractedText = text
+		updateIngestionJob(job, models.JobStageExtracting, progressExtracting, bson.M{"extracted_text": text})
+		return text, nil
+	}
+
+	data, err := readIngestionFile(job.FileID)
+	if err != nil {
+		return "", fmt.Errorf("failed to read uploaded file: %w", err)
+	}
+	text, err := ExtractDocumentTextContext(ctx, data, job.MimeType)
+	if ctx.Err() != nil {
+		return "", errors.New("document processing timed out")
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to extract text from document: %w", err)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return "", errors.New("document content is empty after extraction")
+	}
+
+	job.ExtractedText = text
+	updateIngestionJob(job, models.JobStageExtracting, progressExtracting, bson.M{"extracted_text": text})
+	return text, nil
+}
+
+// runChatDocumentJob extracts a file attached to a chat, posts it as a user
+// message and answers with a summary
+func runChatDocumentJob(ctx context.Context, job *models.IngestionJob) error {
+	if job.ChatID == nil {
+		return errors.New("chat document job without chat")
+	}
+	text, err := ingestionText(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	if job.Result.UserMessageID == nil {
+		updateIngestionJob(job, models.JobStageSaving, progressUploading, nil)
+		userMessage := &models.Message{
+			ID:        primitive.NewObjectID(),
+			ChatID:    *job.ChatID,
+			Role:      "user",
+			Content:   fmt.Sprintf("Uploaded document: %s", job.Filename),
+			Timestamp: primitive.NewDateTimeFromTime(time.Now()),
+			// The raw text is kept for context, not shown to the user
+			Attachments: []models.Attachment{{
+				ID:            primitive.NewObjectID(),
+				Filename:      job.Filename,
+				MimeType:      job.MimeType,
+				Size:          job.Size,
+				ContentHash:   job.ContentHash,
+				UploadedAt:    job.CreatedAt,
+				ProcessedData: text,
+			}},
+		}
+		if _, err := SaveMessage(userMessage); err != nil {
+			return fmt.Errorf("%w: failed to save message: %v", errIngestionRetry, err)
+		}
+		job.Result.UserMessageID = &userMessage.ID
+		updateIngestionJob(job, models.JobStageSaving, progressUploading, bson.M{"result.user_message_id": userMessage.ID})
+	}
+
+	if job.Result.AIMessageID == nil {
+		updateIngestionJob(job, models.JobStageSummarizing, progressSummarizing, nil)
+		aiMessage := &models.Message{
+			ID:        primitive.NewObjectID(),
+			ChatID:    *job.ChatID,
+			Role:      "assistant",
+			Timestamp: primitive.NewDateTimeFromTime(time.Now()),
+		}
+		summary, aiErr := SummarizeDocument(ctx, job.CompanyID, job.Filename, text)
+		if aiErr != nil {
+			log.Printf("Document summarization failed for %s: %v — using fallback", job.Filename, aiErr)
+			// Fallback: acknowledge the upload without dumping raw text
+			aiMessage.Content = fmt.Sprintf(
+				"I've received and processed **%s**.\n\nThe document has been extracted successfully. You can now ask me questions about its content.",
+				job.Filename,
+			)
+		} else {
+			aiMessage.Content = summary.Content
+			aiMessage.ModelUsed = summary.ModelLabel()
+			aiMessage.PromptTokens, aiMessage.CompletionTokens = summary.PromptTokens, summary.CompletionTokens
+			aiMessage.TokenCount = summary.PromptTokens + summary.CompletionTokens
+			aiMessage.TokensEstimated = summary.TokensEstimated
+			if err := RecordUsage(job.CompanyID, job.UserID, summary); err != nil {
+				log.Printf("Failed to record token usage: %v", err)
+			}
+		}
+
+		updateIngestionJob(job, models.JobStageSaving, progressSaving, nil)
+		if _, err := SaveMessage(aiMessage); err != nil {
+			return fmt.Errorf("%w: failed to save AI response: %v", errIngestionRetry, err)
+		}
+		job.Result.AIMessageID = &aiMessage.ID
+		updateIngestionJob(job, models.JobStageSaving, progressSaving, bson.M{"result.ai_message_id": aiMessage.ID})
+	}
+	return nil
+}
+
+// runKnowledgeBaseJob extracts a KB upload and indexes it upstream, as a new
+// document or as a new version of the one it replaces
+func runKnowledgeBaseJob(ctx context.Context, job *models.IngestionJob) error {
+	if job.Result.DocumentID != nil {
+		return nil
+	}
+	// A new upload identical to a current document is not indexed again
+	if job.ReplacesID == nil {
+		if handled, err := skipDuplicateKnowledgeBaseJob(job); handled || err != nil {
+			return err
+		}
+	}
+	text, err := ingestionText(ctx, job)
+	if err != nil {
+		return err
+	}
+	updateIngestionJob(job, models.JobStageUploading, progressUploading, nil)
+
+	// Uploads over an existing document become its new version
+	target, err := knowledgeBaseJobTarget(job)
+	if err != nil {
+		return err
+	}
+	if target != nil {
+		return addKnowledgeBaseJobVersion(job, target, text)
+	}
+
+	result := models.IngestionJobResult{SyncStatus: models.KBStatusSynced}
+	upstream, uploadErr := uploadDocumentToEnterpriseAssistant(ctx, job.CompanyID.Hex(), job.UserID.Hex(), job.Filename, text)
+	if uploadErr != nil {
+		log.Printf("Knowledge base upload to Python backend failed: %v", uploadErr)
+		result.SyncStatus = models.KBStatusPendingSync
+		result.UpstreamError = uploadErr.Error()
+		upstream = &EnterpriseAssistantDocumentResponse{}
+	} else {
+		result.ChunksCreated = upstream.ChunksCreated
+		if upstream.Summary != nil {
+			result.Summary = *upstream.Summary
+		}
+	}
+
+	updateIngestionJob(job, models.JobStageSaving, progressSaving, nil)
+	doc, err := SaveKnowledgeBaseDocument(
+		job.CompanyID,
+		job.UserID,
+		job.Filename,
+		job.MimeType,
+		job.ContentHash,
+		"extract",
+		text,
+		result.SyncStatus,
+		result.UpstreamError,
+		upstream.DocumentID,
+		upstream.ChunksCreated,
+		job.ACL,
+		job.Tags,
+	)
+	if err != nil {
+		if uploadErr == nil {
+			discardUpload(job.CompanyID, upstream.DocumentID)
+		}
+		if errors.Is(err, ErrDuplicateDocument) {
+			// An identical upload was saved while this one was indexed
+			if handled, err := skipDuplicateKnowledgeBaseJob(job); handled || err != nil {
+				return err
+			}
+		}
+		return fmt.Errorf("%w: failed to save document: %v", errIngestionRetry, err)
+	}
+	result.DocumentID, result.Version = &doc.ID, doc.Version
+	saveIngestionResult(job, result)
+	return nil
+}
+
+// knowledgeBaseJobTarget returns the document a KB job adds a version to: the
+// one it names, else the current document with the same filename
+func knowledgeBaseJobTarget(job *models.IngestionJob) (*models.KnowledgeBaseDocument, error) {
+	if job.ReplacesID != nil {
+		doc, err := GetKnowledgeBaseDocumentByID(*job.ReplacesID, job.CompanyID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("the document to replace was deleted")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errIngestionRetry, err)
+		}
+		return doc, nil
+	}
+
+	doc, err := FindCurrentKnowledgeBaseDocumentByFilename(job.CompanyID, job.Filename)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errIngestionRetry, err)
+	}
+	return doc, nil
+}
+
+// skipDuplicateKnowledgeBaseJob finishes a job whose file is already the
+// current version of a document, reporting whether it did
+func skipDuplicateKnowledgeBaseJob(job *models.IngestionJob) (bool, error) {
+	existing, err := FindKnowledgeBaseDocumentByHash(job.CompanyID, job.ContentHash)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", errIngestionRetry, err)
+	}
+
+	skipped := "duplicate"
+	if existing.Filename == job.Filename {
+		skipped = "unchanged"
+	}
+	saveIngestionResult(job, models.IngestionJobResult{
+		DocumentID: &existing.ID,
+		Version:    existing.Version,
+		SyncStatus: existing.Status,
+		Skipped:    skipped,
+	})
+	return true, nil
+}
+
+func addKnowledgeBaseJobVersion(job *models.IngestionJob, target *models.KnowledgeBaseDocument, text string) error {
+	// Re-uploading the same content, e.g. a bulk import run twice, adds no version
+	current, err := currentKnowledgeBaseVersion(target.LogicalID, target.CompanyID)
+	if err == nil && job.KeepACL && current.Filename == job.Filename && current.ExtractedText == text &&
+		(job.Tags == nil || slices.Equal(job.Tags, current.Tags)) {
+		saveIngestionResult(job, models.IngestionJobResult{
+			DocumentID: &current.ID,
+			Version:    current.Version,
+			SyncStatus: current.Status,
+			Skipped:    "unchanged",
+		})
+		return nil
+	}
+
+	created, uploadErr := CreateKnowledgeBaseVersion(target.ID, target.CompanyID, KnowledgeBaseVersionInput{
+		UploadedBy:  job.UserID,
+		Filename:    job.Filename,
+		MimeType:    job.MimeType,
+		ContentHash: job.ContentHash,
+		Text:        text,
+		ACL:         job.ACL,
+		KeepACL:     job.KeepACL,
+		Tags:        job.Tags,
+	})
+	if created == nil {
+		switch {
+		case errors.Is(uploadErr, ErrDocumentSyncInProgress):
+			return fmt.Errorf("%w: %v", errIngestionRetry, uploadErr)
+		case errors.Is(uploadErr, ErrDocumentDeleted), errors.Is(uploadErr, mongo.ErrNoDocuments):
+			return errors.New("the document to replace was deleted")
+		case errors.Is(uploadErr, ErrDuplicateDocument):
+			return uploadErr
+		}
+		return fmt.Errorf("failed to add document version: %w", uploadErr)
+	}
+
+	origin := job.RequestOrigin
+	LogActivity(
+		created.CompanyID,
+		job.UserID,
+		models.ActionReplaceDocument,
+		models.ResourceDocument,
+		created.LogicalID.Hex(),
+		fmt.Sprintf("Uploaded version %d of document: %s", created.Version, target.Filename),
+		true,
+		map[string]interface{}{"filename": created.Filename, "version": created.Version, "status": created.Status, "job_id": job.ID.Hex()},
+		origin.IPAddress,
+		origin.UserAgent,
+		origin.Method,
+		origin.Path,
+		200,
+		"",
+	)
+
+	saveIngestionResult(job, models.IngestionJobResult{
+		DocumentID:    &created.ID,
+		Version:       created.Version,
+		SyncStatus:    created.Status,
+		UpstreamError: created.UpstreamError,
+		ChunksCreated: created.ChunksCreated,
+	})
+	return nil
+}
+
+func saveIngestionResult(job *models.IngestionJob, result models.IngestionJobResult) {
+	job.Result = result
+	updateIngestionJob(job, models.JobStageSaving, progressSaving, bson.M{"result": result})
+}
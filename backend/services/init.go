@@ -13,25 +13,32 @@ import (
 // Package-level variables to hold collection instances.
 // They are declared but not initialized here.
 var (
-	userCollection          *mongo.Collection
-	chatCollection          *mongo.Collection
-	messageCollection       *mongo.Collection
-	companyCollection       *mongo.Collection
-	roleCollection          *mongo.Collection
-	activityLogCollection   *mongo.Collection
-	knowledgeBaseCollection *mongo.Collection
+	userCollection           *mongo.Collection
+	chatCollection           *mongo.Collection
+	messageCollection        *mongo.Collection
+	companyCollection        *mongo.Collection
+	roleCollection           *mongo.Collection
+	activityLogCollection    *mongo.Collection
+	knowledgeBaseCollection  *mongo.Collection
+	usageDailyCollection     *mongo.Collection
+	budgetOverrideCollection *mongo.Collection
+	loginLockoutCollection   *mongo.Collection
+	sessionCollection        *mongo.Collection
+	teamCollection           *mongo.Collection
+	ingestionJobCollection   *mongo.Collection
 )
 
 // Init initializes all the service-level variables, like database collections.
 // This function should be called from main.go after the database is connected.
 func Init() {
-	userCollection = config.GetCollection("users")
-	chatCollection = config.GetCollection("chats")
-	messageCollection = config.GetCollection("messages")
-	companyCollection = config.GetCollection("companies")
-	roleCollection = config.GetCollection("roles")
-	activityLogCollection = config.GetCollection("activity_logs")
-	knowledgeBaseCollection = config.GetCollection("knowledge_base_documents")
+	InitCollections()
+
+	// Give documents stored before versioning a version (before the
+	// version indexes are created)
+	migrateKnowledgeBaseVersions()
+
+	// Count the seats of companies stored before seats were counted
+	migrateCompanySeats()
 
 	// Create database indexes for performance and constraints
 	createIndexes()
@@ -41,6 +48,37 @@ func Init() {
 
 	// Initialize Enterprise Assistant Python backend client
 	InitEnterpriseAssistantClient()
+
+	// Register LLM providers (must run after the clients above)
+	InitProviders()
+
+	// Select the rate limiter's bucket store
+	initRateLimiter()
+
+	// Retry knowledge base uploads the enterprise assistant did not accept
+	startKnowledgeBaseSyncWorker()
+
+	// Process queued document uploads, including jobs interrupted by a restart
+	initIngestionFiles()
+	startIngestionWorkers()
+}
+
+// InitCollections binds the collection variables to the connected database.
+// Init calls it; tests call it alone against a test database.
+func InitCollections() {
+	userCollection = config.GetCollection("users")
+	chatCollection = config.GetCollection("chats")
+	messageCollection = config.GetCollection("messages")
+	companyCollection = config.GetCollection("companies")
+	roleCollection = config.GetCollection("roles")
+	activityLogCollection = config.GetCollection("activity_logs")
+	knowledgeBaseCollection = config.GetCollection("knowledge_base_documents")
+	usageDailyCollection = config.GetCollection("usage_daily")
+	budgetOverrideCollection = config.GetCollection("budget_overrides")
+	loginLockoutCollection = config.GetCollection("login_lockouts")
+	sessionCollection = config.GetCollection("sessions")
+	teamCollection = config.GetCollection("teams")
+	ingestionJobCollection = config.GetCollection("ingestion_jobs")
 }
 
 // createIndexes creates necessary database indexes
@@ -97,6 +135,17 @@ func createIndexes() {
 		log.Printf("Warning: Failed to create chat indexes: %v", err)
 	}
 
+	// Messages collection indexes
+	messageIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "chat_id", Value: 1}, {Key: "attachments.content_hash", Value: 1}}, // Duplicate uploads, per chat (see FindChatAttachmentMessage)
+		},
+	}
+	_, err = messageCollection.Indexes().CreateMany(ctx, messageIndexes)
+	if err != nil {
+		log.Printf("Warning: Failed to create message indexes: %v", err)
+	}
+
 	// Roles collection indexes
 	roleIndexes := []mongo.IndexModel{
 		{
@@ -137,11 +186,135 @@ func createIndexes() {
 		{
 			Keys: bson.D{{Key: "status", Value: 1}},
 		},
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "next_sync_at", Value: 1}}, // Sync worker queue
+		},
+		{
+			Keys:    bson.D{{Key: "next_purge_at", Value: 1}}, // Upstream delete queue
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.D{{Key: "logical_id", Value: 1}, {Key: "version", Value: 1}}, // Version history
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "is_current", Value: 1}, {Key: "filename", Value: 1}}, // Re-upload lookup
+		},
+		{
+			Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "tags", Value: 1}}, // Folder filter of bulk imports
+		},
+		{
+			// One current document per content; older and deleted versions may repeat it
+			Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "content_hash", Value: 1}},
+			Options: options.Index().SetName(kbContentHashIndex).SetUnique(true).SetPartialFilterExpression(bson.M{
+				"is_current":   true,
+				"content_hash": bson.M{"$exists": true},
+			}),
+		},
 	}
 	_, err = knowledgeBaseCollection.Indexes().CreateMany(ctx, knowledgeBaseIndexes)
 	if err != nil {
 		log.Printf("Warning: Failed to create knowledge base indexes: %v", err)
 	}
 
+	// Usage rollup indexes (one document per scope, user and day)
+	usageIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "company_id", Value: 1}, {Key: "scope", Value: 1}, {Key: "date", Value: 1}, {Key: "user_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	}
+	_, err = usageDailyCollection.Indexes().CreateMany(ctx, usageIndexes)
+	if err != nil {
+		log.Printf("Warning: Failed to create usage indexes: %v", err)
+	}
+
+	// Budget overrides indexes
+	budgetOverrideIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "expires_at", Value: -1}},
+		},
+	}
+	_, err = budgetOverrideCollection.Indexes().CreateMany(ctx, budgetOverrideIndexes)
+	if err != nil {
+		log.Printf("Warning: Failed to create budget override indexes: %v", err)
+	}
+
+	// Login lockout indexes
+	loginLockoutIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "subject", Value: 1}, {Key: "company_id", Value: 1}, {Key: "email", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "subject", Value: 1}, {Key: "ip_address", Value: 1}},
+		},
+	}
+	_, err = loginLockoutCollection.Indexes().CreateMany(ctx, loginLockoutIndexes)
+	if err != nil {
+		log.Printf("Warning: Failed to create login lockout indexes: %v", err)
+	}
+
+	// Sessions collection indexes
+	sessionIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "jti", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "user_id", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "company_id", Value: 1}},
+		},
+		{
+			Keys:    bson.D{{Key: "expires_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60), // Keep a week of history
+		},
+	}
+	_, err = sessionCollection.Indexes().CreateMany(ctx, sessionIndexes)
+	if err != nil {
+		log.Printf("Warning: Failed to create session indexes: %v", err)
+	}
+
+	// Teams collection indexes
+	teamIndexes := []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "company_id", Value: 1}, {Key: "name", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys: bson.D{{Key: "manager_ids", Value: 1}},
+		},
+		{
+			Keys: bson.D{{Key: "member_ids", Value: 1}},
+		},
+	}
+	_, err = teamCollection.Indexes().CreateMany(ctx, teamIndexes)
+	if err != nil {
+		log.Printf("Warning: Failed to create team indexes: %v", err)
+	}
+
+	// Ingestion jobs collection indexes
+	ingestionJobIndexes := []mongo.IndexModel{
+		{
+			Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}, // Worker queue
+		},
+		{
+			Keys:    bson.D{{Key: "finished_at", Value: 1}},
+			Options: options.Index().SetExpireAfterSeconds(7 * 24 * 60 * 60), // Keep a week of finished jobs
+		},
+		{
+			Keys:    bson.D{{Key: "batch_id", Value: 1}}, // Bulk import reports
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "content_hash", Value: 1}}, // Extracted text reuse
+		},
+	}
+	_, err = ingestionJobCollection.Indexes().CreateMany(ctx, ingestionJobIndexes)
+	if err != nil {
+		log.Printf("Warning: Failed to create ingestion job indexes: %v", err)
+	}
+
 	log.Println("Database indexes created successfully")
 }
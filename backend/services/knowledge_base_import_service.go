@@ -0,0 +1,404 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Bulk import limits. KB_IMPORT_MAX_ARCHIVE_MB caps the uploaded archive,
+// KB_IMPORT_MAX_FILES the documents in it and KB_IMPORT_MAX_EXTRACTED_MB
+// their total size once inflated.
+const (
+	defaultImportMaxArchiveMB   = 200
+	defaultImportMaxFiles       = 1000
+	defaultImportMaxExtractedMB = 2048
+)
+
+// Per-file outcomes of a bulk import
+const (
+	ImportFileQueued   = "queued"
+	ImportFileSkipped  = "skipped"
+	ImportFileRejected = "rejected"
+)
+
+// ErrInvalidImportArchive is returned for uploads that are not a readable ZIP
+// archive or exceed the import limits
+var ErrInvalidImportArchive = errors.New("invalid import archive")
+
+// importMimeTypes maps the extensions a bulk import accepts to the MIME type
+// the extractor expects
+var importMimeTypes = map[string]string{
+	".pdf":  "application/pdf",
+	".doc":  "application/msword",
+	".docx": "application/vnd.openxmlformats-officedocument.wordprocessingml.document",
+	".odt":  "application/vnd.oasis.opendocument.text",
+	".rtf":  "application/rtf",
+	".txt":  "text/plain",
+	".md":   "text/markdown",
+	".csv":  "text/csv",
+	".json": "application/json",
+}
+
+// KnowledgeBaseImportFile is the outcome of one archive entry
+type KnowledgeBaseImportFile struct {
+	Path        string              `json:"path"`
+	Status      string              `json:"status"`
+	Reason      string              `json:"reason,omitempty"`
+	Tags        []string            `json:"tags,omitempty"`
+	JobID       *primitive.ObjectID `json:"job_id,omitempty"`
+	JobStatus   string              `json:"job_status,omitempty"` // Set by GetKnowledgeBaseImport
+	DocumentID  *primitive.ObjectID `json:"document_id,omitempty"`
+	DuplicateOf string              `json:"duplicate_of,omitempty"` // Identical file in the archive or the knowledge base
+}
+
+// KnowledgeBaseImportReport is the per-file report of a bulk import
+type KnowledgeBaseImportReport struct {
+	ImportID primitive.ObjectID        `json:"import_id"`
+	JobID    *primitive.ObjectID       `json:"job_id,omitempty"` // Job expanding the archive
+	Status   string                    `json:"status"`           // Of that job; files are listed once it succeeded
+	Error    string                    `json:"error,omitempty"`
+	Files    []KnowledgeBaseImportFile `json:"files"`
+	Queued   int                       `json:"queued"`
+	Skipped  int                       `json:"skipped"`
+	Rejected int                       `json:"rejected"`
+	// Progress of the queued documents' jobs
+	Succeeded int `json:"succeeded,omitempty"`
+	Failed    int `json:"failed,omitempty"`
+	Pending   int `json:"pending,omitempty"`
+}
+
+// KnowledgeBaseImportInput describes who imports an archive
+type KnowledgeBaseImportInput struct {
+	CompanyID primitive.ObjectID
+	UserID    primitive.ObjectID
+	Filename  string              // Of the archive
+	ACL       *models.DocumentACL // Applied to every imported document
+	Origin    models.RequestOrigin
+}
+
+// ImportMaxArchiveSize is the largest archive a bulk import accepts, in bytes
+func ImportMaxArchiveSize() int64 {
+	return int64(envInt("KB_IMPORT_MAX_ARCHIVE_MB", defaultImportMaxArchiveMB)) << 20
+}
+
+func (r *KnowledgeBaseImportReport) add(file KnowledgeBaseImportFile) {
+	switch file.Status {
+	case ImportFileQueued:
+		r.Queued++
+	case ImportFileSkipped:
+		r.Skipped++
+	default:
+		r.Rejected++
+	}
+	r.Files = append(r.Files, file)
+}
+
+// ImportKnowledgeBaseArchive checks that archive is a ZIP within the import
+// limits and queues an ingestion job to expand it, returning the import's ID
+// straight away. The archive's documents are read by the job; see
+// runKnowledgeBaseImportJob.
+func ImportKnowledgeBaseArchive(input KnowledgeBaseImportInput, archive []byte) (*KnowledgeBaseImportReport, error) {
+	if err := CheckDocumentUpload(input.CompanyID, 0); err != nil {
+		return nil, err
+	}
+
+	// Only the central directory is read here
+	reader, err := openZip(archive)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a ZIP archive", ErrInvalidImportArchive)
+	}
+	maxFiles := envInt("KB_IMPORT_MAX_FILES", defaultImportMaxFiles)
+	documents := 0
+	for _, file := range reader.File {
+		if !file.FileInfo().IsDir() {
+			documents++
+		}
+	}
+	if documents == 0 {
+		return nil, fmt.Errorf("%w: the archive is empty", ErrInvalidImportArchive)
+	}
+	if documents > maxFiles {
+		return nil, fmt.Errorf("%w: the archive holds %d files, the limit is %d", ErrInvalidImportArchive, documents, maxFiles)
+	}
+
+	importID := primitive.NewObjectID()
+	job, err := EnqueueIngestionJob(IngestionJobInput{
+		CompanyID: input.CompanyID,
+		UserID:    input.UserID,
+		Kind:      models.JobKindKnowledgeBaseImport,
+		Filename:  input.Filename,
+		MimeType:  "application/zip",
+		ACL:       input.ACL,
+		BatchID:   &importID,
+		Origin:    input.Origin,
+	}, archive)
+	if err != nil {
+		return nil, err
+	}
+	return &KnowledgeBaseImportReport{ImportID: importID, JobID: &job.ID, Status: job.Status, Files: []KnowledgeBaseImportFile{}}, nil
+}
+
+// runKnowledgeBaseImportJob fans an imported ZIP archive out into one
+// knowledge base ingestion job per document. Folder paths are kept in the
+// filename and as tags, so "HR/Leave/policy.pdf" is tagged "HR" and
+// "HR/Leave". Identical files are imported once and files already in the
+// knowledge base are skipped; files matching a current document by path
+// become its new version. Entries that were not queued are kept in the job's
+// result for GetKnowledgeBaseImport. A retried attempt reuses the document
+// jobs queued by the previous one.
+func runKnowledgeBaseImportJob(ctx context.Context, job *models.IngestionJob) error {
+	if job.BatchID == nil {
+		return errors.New("import job without import ID")
+	}
+	updateIngestionJob(job, models.JobStageExtracting, progressExtracting, nil)
+
+	archive, err := readIngestionFile(job.FileID)
+	if err != nil {
+		return fmt.Errorf("%w: failed to read archive: %v", errIngestionRetry, err)
+	}
+	reader, err := openZip(archive)
+	if err != nil {
+		return errors.New("not a ZIP archive")
+	}
+	queued, err := importDocumentJobs(*job.BatchID, job.CompanyID)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errIngestionRetry, err)
+	}
+
+	maxExtracted := int64(envInt("KB_IMPORT_MAX_EXTRACTED_MB", defaultImportMaxExtractedMB)) << 20
+	seen := make(map[string]string) // Content hash to path
+	for _, previous := range queued {
+		seen[previous.ContentHash] = previous.Filename
+	}
+	paths := make(map[string]bool)
+	entries := []models.ImportEntry{}
+	var extracted int64
+	for i, file := range reader.File {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%w: %v", errIngestionRetry, ctx.Err())
+		}
+		if i%50 == 0 {
+			updateIngestionJob(job, models.JobStageExtracting, progressExtracting+(progressSaving-progressExtracting)*i/len(reader.File), nil)
+		}
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		entry := models.ImportEntry{Path: file.Name, Status: ImportFileRejected}
+
+		name, ok := importPath(file.Name)
+		switch {
+		case !ok:
+			entry.Reason = "invalid path"
+			entries = append(entries, entry)
+			continue
+		case isImportSystemFile(name):
+			entry.Status, entry.Reason = ImportFileSkipped, "system file"
+			entries = append(entries, entry)
+			continue
+		case paths[strings.ToLower(name)]:
+			entry.Status, entry.Reason = ImportFileSkipped, "duplicate path"
+			entries = append(entries, entry)
+			continue
+		}
+		entry.Path = name
+		paths[strings.ToLower(name)] = true
+
+		size := int64(file.UncompressedSize64)
+		if previous, ok := queued[name]; ok {
+			extracted += previous.Size
+			continue
+		}
+
+		mimeType, ok := importMimeTypes[strings.ToLower(path.Ext(name))]
+		if !ok {
+			entry.Reason = "unsupported file type"
+			entries = append(entries, entry)
+			continue
+		}
+		if err := CheckDocumentUpload(job.CompanyID, size); err != nil {
+			entry.Reason = "failed to check upload policy"
+			var quotaErr *QuotaError
+			if errors.As(err, &quotaErr) {
+				entry.Reason = quotaErr.Message
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		if extracted+size > maxExtracted {
+			entry.Reason = "import size limit reached"
+			entries = append(entries, entry)
+			continue
+		}
+
+		// The claimed size was checked above; entries inflating past it are corrupt
+		data, err := readZipEntry(file, max(size, 1))
+		if err != nil {
+			entry.Reason = "unreadable archive entry"
+			entries = append(entries, entry)
+			continue
+		}
+		if len(data) == 0 {
+			entry.Reason = "file is empty"
+			entries = append(entries, entry)
+			continue
+		}
+		extracted += int64(len(data))
+
+		hash := ContentHash(data)
+		if first, ok := seen[hash]; ok {
+			entry.Status, entry.Reason, entry.DuplicateOf = ImportFileSkipped, "duplicate content", first
+			entries = append(entries, entry)
+			continue
+		}
+		seen[hash] = name
+		if existing, err := FindKnowledgeBaseDocumentByHash(job.CompanyID, hash); err == nil {
+			entry.Status, entry.Reason = ImportFileSkipped, "unchanged"
+			if existing.Filename != name {
+				entry.Reason, entry.DuplicateOf = "already in the knowledge base", existing.Filename
+			}
+			entries = append(entries, entry)
+			continue
+		}
+
+		if _, err := EnqueueIngestionJob(IngestionJobInput{
+			CompanyID: job.CompanyID,
+			UserID:    job.UserID,
+			Kind:      models.JobKindKnowledgeBase,
+			Filename:  name,
+			MimeType:  mimeType,
+			ACL:       job.ACL,
+			KeepACL:   job.ACL == nil,
+			Tags:      importTags(name),
+			BatchID:   job.BatchID,
+			Origin:    job.RequestOrigin,
+		}, data); err != nil {
+			entry.Reason = "failed to queue file"
+			entries = append(entries, entry)
+		}
+	}
+
+	saveIngestionResult(job, models.IngestionJobResult{ImportEntries: entries})
+	return nil
+}
+
+// importDocumentJobs returns the document jobs an import queued so far, by
+// filename
+func importDocumentJobs(importID, companyID primitive.ObjectID) (map[string]models.IngestionJob, error) {
+	cursor, err := ingestionJobCollection.Find(context.Background(),
+		bson.M{"batch_id": importID, "company_id": companyID, "kind": models.JobKindKnowledgeBase},
+		options.Find().SetProjection(bson.M{"filename": 1, "content_hash": 1, "size": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var jobs []models.IngestionJob
+	if err := cursor.All(context.Background(), &jobs); err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.IngestionJob, len(jobs))
+	for _, job := range jobs {
+		byName[job.Filename] = job
+	}
+	return byName, nil
+}
+
+// GetKnowledgeBaseImport reports a bulk import: the entries its archive job
+// skipped or rejected and the progress of the jobs it queued.
+func GetKnowledgeBaseImport(importID, companyID primitive.ObjectID) (*KnowledgeBaseImportReport, error) {
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetProjection(bson.M{"extracted_text": 0})
+	cursor, err := ingestionJobCollection.Find(context.Background(), bson.M{"batch_id": importID, "company_id": companyID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.Background())
+
+	var jobs []models.IngestionJob
+	if err := cursor.All(context.Background(), &jobs); err != nil {
+		return nil, err
+	}
+	if len(jobs) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	report := &KnowledgeBaseImportReport{ImportID: importID, Files: []KnowledgeBaseImportFile{}}
+	for _, job := range jobs {
+		if job.Kind == models.JobKindKnowledgeBaseImport {
+			report.JobID, report.Status, report.Error = &job.ID, job.Status, job.Error
+			for _, entry := range job.Result.ImportEntries {
+				report.add(KnowledgeBaseImportFile{Path: entry.Path, Status: entry.Status, Reason: entry.Reason, DuplicateOf: entry.DuplicateOf})
+			}
+			continue
+		}
+
+		entry := KnowledgeBaseImportFile{
+			Path:       job.Filename,
+			Status:     ImportFileQueued,
+			Tags:       job.Tags,
+			JobID:      &job.ID,
+			JobStatus:  job.Status,
+			Reason:     job.Error,
+			DocumentID: job.Result.DocumentID,
+		}
+		switch {
+		case job.Status == models.JobStatusSucceeded && job.Result.Skipped != "":
+			entry.Status, entry.Reason = ImportFileSkipped, job.Result.Skipped
+			report.Succeeded++
+		case job.Status == models.JobStatusSucceeded:
+			report.Succeeded++
+		case job.Status == models.JobStatusFailed:
+			report.Failed++
+		default:
+			report.Pending++
+		}
+		report.add(entry)
+	}
+	return report, nil
+}
+
+// importPath cleans an archive entry name into a relative slash separated
+// path, rejecting absolute paths and paths leaving the archive
+func importPath(name string) (string, bool) {
+	name = path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if name == "." || strings.HasPrefix(name, "/") || name == ".." || strings.HasPrefix(name, "../") ||
+		strings.Contains(name, ":") {
+		return "", false
+	}
+	return name, true
+}
+
+// isImportSystemFile reports files that archivers and editors leave behind:
+// macOS resource forks, hidden files, Office lock files and thumbnail caches
+func isImportSystemFile(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if part == "__MACOSX" || strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	base := path.Base(name)
+	return strings.HasPrefix(base, "~$") || strings.EqualFold(base, "Thumbs.db") || strings.EqualFold(base, "desktop.ini")
+}
+
+// importTags returns the folders a file sits in, each as its full path
+func importTags(name string) []string {
+	dir := path.Dir(name)
+	if dir == "." {
+		return nil
+	}
+	var tags []string
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		tags = append(tags, strings.Join(parts[:i+1], "/"))
+	}
+	return tags
+}
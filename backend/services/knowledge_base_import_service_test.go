@@ -0,0 +1,109 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// buildTestZip writes (name, content) pairs into a ZIP archive, in order
+func buildTestZip(t *testing.T, files ...[2]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, file := range files {
+		name, content := file[0], file[1]
+		f, err := w.Create(name)
+		if err != nil {
+			t.Fatalf("create %s: %v", name, err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close zip: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestImportKnowledgeBaseArchive(t *testing.T) {
+	setupTestDB(t)
+	initIngestionFiles()
+
+	companyID := primitive.NewObjectID()
+	mustInsert(t, companyCollection, models.Company{ID: companyID, Name: "Acme", Domain: "acme", IsActive: true,
+		Settings: models.CompanySettings{EnableDocumentUpload: true}})
+	input := KnowledgeBaseImportInput{CompanyID: companyID, UserID: primitive.NewObjectID(), Filename: "kb.zip"}
+
+	if _, err := ImportKnowledgeBaseArchive(input, []byte("not a zip")); !errors.Is(err, ErrInvalidImportArchive) {
+		t.Fatalf("err = %v, want ErrInvalidImportArchive", err)
+	}
+
+	archive := buildTestZip(t,
+		[2]string{"HR/Leave/policy.txt", "Employees get 25 days of leave."},
+		[2]string{"HR/copy.txt", "Employees get 25 days of leave."},
+		[2]string{"__MACOSX/._policy", "resource fork"},
+		[2]string{"tool.exe", "MZ"},
+		[2]string{"empty.txt", ""},
+	)
+	queued, err := ImportKnowledgeBaseArchive(input, archive)
+	if err != nil {
+		t.Fatalf("ImportKnowledgeBaseArchive: %v", err)
+	}
+	if queued.JobID == nil || queued.Status != models.JobStatusQueued || len(queued.Files) != 0 {
+		t.Fatalf("import answered %+v, want only the queued archive job", queued)
+	}
+
+	// Nothing is read from the archive until its job runs
+	report, err := GetKnowledgeBaseImport(queued.ImportID, companyID)
+	if err != nil || report.Status != models.JobStatusQueued || len(report.Files) != 0 {
+		t.Fatalf("report before the job ran = %+v, err %v", report, err)
+	}
+
+	job, err := claimIngestionJob()
+	if err != nil || job.ID != *queued.JobID {
+		t.Fatalf("claimed %v, err %v; want the archive job", job, err)
+	}
+	// A retried attempt must not queue the documents again
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := runKnowledgeBaseImportJob(context.Background(), job); err != nil {
+			t.Fatalf("attempt %d: %v", attempt, err)
+		}
+	}
+	finishIngestionJob(job, nil)
+
+	report, err = GetKnowledgeBaseImport(queued.ImportID, companyID)
+	if err != nil {
+		t.Fatalf("GetKnowledgeBaseImport: %v", err)
+	}
+	if report.Status != models.JobStatusSucceeded || report.Queued != 1 || report.Skipped != 2 || report.Rejected != 2 || report.Pending != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	byPath := map[string]KnowledgeBaseImportFile{}
+	for _, file := range report.Files {
+		byPath[file.Path] = file
+	}
+	if f := byPath["HR/Leave/policy.txt"]; f.Status != ImportFileQueued || len(f.Tags) != 2 || f.Tags[1] != "HR/Leave" {
+		t.Fatalf("policy.txt = %+v", f)
+	}
+	if f := byPath["HR/copy.txt"]; f.Status != ImportFileSkipped || f.DuplicateOf != "HR/Leave/policy.txt" {
+		t.Fatalf("copy.txt = %+v", f)
+	}
+	if f := byPath["tool.exe"]; f.Status != ImportFileRejected || f.Reason != "unsupported file type" {
+		t.Fatalf("tool.exe = %+v", f)
+	}
+
+	documents, err := ingestionJobCollection.CountDocuments(context.Background(), bson.M{"batch_id": queued.ImportID, "kind": models.JobKindKnowledgeBase})
+	if err != nil || documents != 1 {
+		t.Fatalf("%d document jobs, err %v; want 1", documents, err)
+	}
+
+	if _, err := GetKnowledgeBaseImport(primitive.NewObjectID(), companyID); err == nil {
+		t.Fatal("unknown import found")
+	}
+}
@@ -10,10 +10,22 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-// GetKnowledgeBaseDocuments returns all KB documents for a company, sorted newest first.
-func GetKnowledgeBaseDocuments(companyID primitive.ObjectID) ([]models.KnowledgeBaseDocument, error) {
+// GetKnowledgeBaseDocuments returns the current versions of the KB documents
+// of the actor's company that their ACLs let the actor see, sorted newest
+// first. A non-empty tag keeps only the documents carrying it.
+func GetKnowledgeBaseDocuments(actor Actor, tag string) ([]models.KnowledgeBaseDocument, error) {
+	reader, err := documentReaderFor(actor)
+	if err != nil {
+		return nil, err
+	}
+
 	var docs []models.KnowledgeBaseDocument
-	filter := bson.M{"company_id": companyID}
+	filter := reader.visibleFilter()
+	filter["company_id"] = actor.CompanyID
+	filter["is_current"] = true
+	if tag != "" {
+		filter["tags"] = tag
+	}
 	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
 
 	cursor, err := knowledgeBaseCollection.Find(context.Background(), filter, opts)
@@ -31,12 +43,14 @@ func GetKnowledgeBaseDocuments(companyID primitive.ObjectID) ([]models.Knowledge
 	return docs, nil
 }
 
-// GetKnowledgeBaseDocumentByID fetches a single KB document with company ownership check.
+// GetKnowledgeBaseDocumentByID fetches a single KB document with company
+// ownership check. Tombstoned documents are not found.
 func GetKnowledgeBaseDocumentByID(docID, companyID primitive.ObjectID) (*models.KnowledgeBaseDocument, error) {
 	var doc models.KnowledgeBaseDocument
 	err := knowledgeBaseCollection.FindOne(context.Background(), bson.M{
 		"_id":        docID,
 		"company_id": companyID,
+		"status":     bson.M{"$ne": models.KBStatusPendingDelete},
 	}).Decode(&doc)
 	if err != nil {
 		return nil, err
@@ -44,47 +58,56 @@ func GetKnowledgeBaseDocumentByID(docID, companyID primitive.ObjectID) (*models.
 	return &doc, nil
 }
 
-// DeleteKnowledgeBaseDocument removes a KB document (company-scoped).
-func DeleteKnowledgeBaseDocument(docID, companyID primitive.ObjectID) error {
-	_, err := knowledgeBaseCollection.DeleteOne(context.Background(), bson.M{
-		"_id":        docID,
-		"company_id": companyID,
-	})
-	return err
-}
-
 func SaveKnowledgeBaseDocument(
 	companyID primitive.ObjectID,
 	uploadedBy primitive.ObjectID,
 	filename string,
 	mimeType string,
+	contentHash string,
 	action string,
 	extractedText string,
 	status string,
 	upstreamError string,
 	documentID string,
 	chunksCreated int,
+	acl *models.DocumentACL,
+	tags []string,
 ) (*models.KnowledgeBaseDocument, error) {
 	now := primitive.NewDateTimeFromTime(time.Now())
+	id := primitive.NewObjectID()
 	doc := models.KnowledgeBaseDocument{
-		ID:            primitive.NewObjectID(),
+		ID:            id,
 		CompanyID:     companyID,
+		LogicalID:     id,
+		Version:       1,
+		IsCurrent:     true,
 		UploadedBy:    uploadedBy,
 		Filename:      filename,
 		MimeType:      mimeType,
+		ContentHash:   contentHash,
 		Action:        action,
 		ExtractedText: extractedText,
 		Status:        status,
 		UpstreamError: upstreamError,
 		DocumentID:    documentID,
 		ChunksCreated: chunksCreated,
+		ACL:           acl,
+		Tags:          tags,
 		CreatedAt:     now,
 		UpdatedAt:     now,
 	}
 
+	// A failed upload counts as the first attempt; the sync worker retries it
+	if status == models.KBStatusPendingSync {
+		nextSync := primitive.NewDateTimeFromTime(time.Now().Add(kbSyncBackoff(1)))
+		doc.SyncAttempts = 1
+		doc.LastSyncAt = &now
+		doc.NextSyncAt = &nextSync
+	}
+
 	_, err := knowledgeBaseCollection.InsertOne(context.Background(), doc)
 	if err != nil {
-		return nil, err
+		return nil, duplicateDocumentError(err)
 	}
 
 	return &doc, nil
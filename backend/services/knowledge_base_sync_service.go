@@ -0,0 +1,236 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Knowledge base sync worker defaults; the interval and attempt cap can be
+// overridden with KB_SYNC_INTERVAL_SECONDS (0 disables the worker) and
+// KB_SYNC_MAX_ATTEMPTS.
+const (
+	defaultKBSyncInterval    = 30 * time.Second
+	defaultKBSyncMaxAttempts = 8
+	kbSyncBaseBackoff        = time.Minute
+	kbSyncMaxBackoff         = 6 * time.Hour
+	kbSyncUploadTimeout      = 5 * time.Minute
+	kbSyncLease              = 10 * time.Minute // Must outlast kbSyncUploadTimeout
+	kbSyncBatchSize          = 20               // Documents per worker tick
+)
+
+// Manual resync errors
+var (
+	ErrDocumentAlreadySynced  = errors.New("document is already synced")
+	ErrDocumentSyncInProgress = errors.New("document sync already in progress")
+	ErrDocumentDeleted        = errors.New("document was deleted during sync")
+)
+
+func kbSyncMaxAttempts() int {
+	return envInt("KB_SYNC_MAX_ATTEMPTS", defaultKBSyncMaxAttempts)
+}
+
+// kbSyncBackoff returns the delay before the next attempt after attempts
+// failed ones: one minute, doubling up to six hours.
+func kbSyncBackoff(attempts int) time.Duration {
+	delay := kbSyncBaseBackoff
+	for i := 1; i < attempts && delay < kbSyncMaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, kbSyncMaxBackoff)
+}
+
+// startKnowledgeBaseSyncWorker starts the background loop that uploads
+// pending_sync and failed documents to the enterprise assistant, deletes
+// tombstoned and replaced upstream copies, and periodically reconciles the
+// local and upstream document lists.
+func startKnowledgeBaseSyncWorker() {
+	interval := time.Duration(envInt("KB_SYNC_INTERVAL_SECONDS", int(defaultKBSyncInterval/time.Second))) * time.Second
+	if interval <= 0 {
+		log.Println("Knowledge base sync worker disabled")
+		return
+	}
+	reconcileInterval := time.Duration(envInt("KB_RECONCILE_INTERVAL_MINUTES", int(defaultKBReconcileInterval/time.Minute))) * time.Minute
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		lastReconcile := time.Now()
+		for range ticker.C {
+			runKnowledgeBaseSync()
+			runKnowledgeBasePurge()
+			if reconcileInterval > 0 && time.Since(lastReconcile) >= reconcileInterval {
+				reconcileAllKnowledgeBases()
+				lastReconcile = time.Now()
+			}
+		}
+	}()
+}
+
+// runKnowledgeBasePurge deletes the upstream copies that are due, up to one
+// batch
+func runKnowledgeBasePurge() {
+	for i := 0; i < kbSyncBatchSize; i++ {
+		doc, err := claimDuePurge()
+		if err != nil {
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				log.Printf("Warning: Failed to claim knowledge base document for upstream delete: %v", err)
+			}
+			return
+		}
+		if err := purgeKnowledgeBaseDocument(doc); err != nil {
+			log.Printf("Knowledge base document %s upstream delete attempt %d failed: %v", doc.ID.Hex(), doc.PurgeAttempts+1, err)
+		}
+	}
+}
+
+// runKnowledgeBaseSync syncs the documents that are due, up to one batch
+func runKnowledgeBaseSync() {
+	for i := 0; i < kbSyncBatchSize; i++ {
+		doc, err := claimDueDocument()
+		if err != nil {
+			if !errors.Is(err, mongo.ErrNoDocuments) {
+				log.Printf("Warning: Failed to claim knowledge base document for sync: %v", err)
+			}
+			return
+		}
+		if _, err := syncClaimedDocument(doc); err != nil {
+			log.Printf("Knowledge base document %s sync attempt %d failed: %v", doc.ID.Hex(), doc.SyncAttempts+1, err)
+		}
+	}
+}
+
+// claimDueDocument leases the next unsynced document whose backoff has
+// elapsed, so that concurrent workers and manual resyncs skip it.
+func claimDueDocument() (*models.KnowledgeBaseDocument, error) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	filter := bson.M{
+		"status":        bson.M{"$in": bson.A{models.KBStatusPendingSync, models.KBStatusFailed}},
+		"sync_attempts": bson.M{"$not": bson.M{"$gte": kbSyncMaxAttempts()}},
+		"next_sync_at":  bson.M{"$not": bson.M{"$gt": now}},
+		"syncing_until": bson.M{"$not": bson.M{"$gt": now}},
+	}
+	return leaseDocument(filter, bson.M{})
+}
+
+func leaseDocument(filter, set bson.M) (*models.KnowledgeBaseDocument, error) {
+	set["syncing_until"] = primitive.NewDateTimeFromTime(time.Now().Add(kbSyncLease))
+
+	var doc models.KnowledgeBaseDocument
+	err := knowledgeBaseCollection.FindOneAndUpdate(context.Background(),
+		filter,
+		bson.M{"$set": set},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "next_sync_at", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// syncClaimedDocument uploads a leased document and records the outcome. A
+// failure schedules the next attempt, or gives up once the cap is reached.
+// It returns the updated document and the upload error, if any.
+func syncClaimedDocument(doc *models.KnowledgeBaseDocument) (*models.KnowledgeBaseDocument, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), kbSyncUploadTimeout)
+	defer cancel()
+	result, syncErr := uploadDocumentToEnterpriseAssistant(ctx, doc.CompanyID.Hex(), doc.UploadedBy.Hex(), doc.Filename, doc.ExtractedText)
+
+	now := time.Now()
+	attempts := doc.SyncAttempts + 1
+	set := bson.M{
+		"sync_attempts": attempts,
+		"last_sync_at":  primitive.NewDateTimeFromTime(now),
+		"updated_at":    primitive.NewDateTimeFromTime(now),
+	}
+	unset := bson.M{"syncing_until": ""}
+
+	if syncErr == nil {
+		set["status"] = models.KBStatusSynced
+		set["document_id"] = result.DocumentID
+		set["chunks_created"] = result.ChunksCreated
+		unset["upstream_error"] = ""
+		unset["next_sync_at"] = ""
+	} else {
+		set["status"] = models.KBStatusFailed
+		set["upstream_error"] = syncErr.Error()
+		if attempts < kbSyncMaxAttempts() {
+			set["next_sync_at"] = primitive.NewDateTimeFromTime(now.Add(kbSyncBackoff(attempts)))
+		} else {
+			unset["next_sync_at"] = ""
+			log.Printf("Knowledge base document %s gave up syncing after %d attempts", doc.ID.Hex(), attempts)
+		}
+	}
+
+	var updated models.KnowledgeBaseDocument
+	err := knowledgeBaseCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": doc.ID, "status": bson.M{"$ne": models.KBStatusPendingDelete}},
+		bson.M{"$set": set, "$unset": unset},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Deleted while uploading: the new upstream copy must go too
+		return nil, discardUploadOfDeletedDocument(doc, result, syncErr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &updated, syncErr
+}
+
+// discardUploadOfDeletedDocument handles an upload that finished after its
+// document was deleted. A tombstone gets the new copy queued for deletion;
+// without a row the copy is deleted right away (or left to reconciliation).
+func discardUploadOfDeletedDocument(doc *models.KnowledgeBaseDocument, result *EnterpriseAssistantDocumentResponse, syncErr error) error {
+	update := bson.M{"$unset": bson.M{"syncing_until": ""}}
+	if syncErr == nil {
+		update["$addToSet"] = bson.M{"stale_document_ids": result.DocumentID}
+	}
+	res, err := knowledgeBaseCollection.UpdateOne(context.Background(), bson.M{"_id": doc.ID}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 && syncErr == nil {
+		discardUpload(doc.CompanyID, result.DocumentID)
+	}
+	return ErrDocumentDeleted
+}
+
+// ResyncKnowledgeBaseDocument uploads an unsynced document immediately,
+// resetting its attempt count so the worker retries it again if this attempt
+// fails too. It returns the updated document and the upload error, if any.
+func ResyncKnowledgeBaseDocument(docID, companyID primitive.ObjectID) (*models.KnowledgeBaseDocument, error) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	doc, err := leaseDocument(bson.M{
+		"_id":           docID,
+		"company_id":    companyID,
+		"status":        bson.M{"$nin": bson.A{models.KBStatusSynced, models.KBStatusSuperseded, models.KBStatusPendingDelete}},
+		"syncing_until": bson.M{"$not": bson.M{"$gt": now}},
+	}, bson.M{"sync_attempts": 0})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		existing, findErr := GetKnowledgeBaseDocumentByID(docID, companyID)
+		if findErr != nil {
+			return nil, findErr
+		}
+		if existing.Status == models.KBStatusSynced {
+			return existing, ErrDocumentAlreadySynced
+		}
+		if existing.Status == models.KBStatusSuperseded {
+			return existing, ErrDocumentSuperseded
+		}
+		return existing, ErrDocumentSyncInProgress
+	}
+	if err != nil {
+		return nil, err
+	}
+	return syncClaimedDocument(doc)
+}
@@ -0,0 +1,311 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Upstream delete and reconciliation settings. KB_RECONCILE_INTERVAL_MINUTES
+// overrides the reconciliation interval (0 disables the scheduled run).
+const (
+	kbUpstreamCallTimeout      = time.Minute
+	defaultKBReconcileInterval = time.Hour
+	kbOrphanGracePeriod        = 10 * time.Minute // Covers uploads whose local row is not saved yet
+	kbReconcileMissingUpstream = "missing from enterprise assistant index"
+	kbPurgeFailedMessagePrefix = "upstream delete failed: "
+)
+
+// kbOrphans remembers when each upstream document without a local row was
+// first seen, so that reconciliation only deletes it after the grace period.
+var kbOrphans = struct {
+	sync.Mutex
+	firstSeen map[string]time.Time
+}{firstSeen: map[string]time.Time{}}
+
+// KnowledgeBaseReconcileReport describes one reconciliation of a company's
+// local documents against the upstream index
+type KnowledgeBaseReconcileReport struct {
+	CompanyID         string   `json:"company_id"`
+	UpstreamDocuments int      `json:"upstream_documents"`
+	LocalDocuments    int      `json:"local_documents"`
+	OrphansDeleted    []string `json:"orphans_deleted"`  // Upstream documents without a local row, deleted
+	OrphansDeferred   []string `json:"orphans_deferred"` // Orphans still within the grace period
+	Requeued          []string `json:"requeued"`         // Local documents missing upstream, queued for upload
+	Errors            []string `json:"errors,omitempty"`
+}
+
+// upstreamCopies lists the upstream document IDs that must be deleted for doc
+func upstreamCopies(doc *models.KnowledgeBaseDocument) []string {
+	ids := slices.Clone(doc.StaleDocumentIDs)
+	if doc.Status == models.KBStatusPendingDelete && doc.DocumentID != "" && !slices.Contains(ids, doc.DocumentID) {
+		ids = append(ids, doc.DocumentID)
+	}
+	return ids
+}
+
+// DeleteKnowledgeBaseDocument deletes a KB document, with all its versions,
+// together with its chunks in the enterprise assistant index. Versions whose
+// upstream delete fails are left as tombstones (pending_delete), hidden from
+// users and retrieval, and the sync worker retries the delete. It reports
+// whether any tombstone was left behind.
+func DeleteKnowledgeBaseDocument(docID, companyID primitive.ObjectID) (bool, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	doc, err := GetKnowledgeBaseDocumentByID(docID, companyID)
+	if err != nil {
+		return false, err
+	}
+
+	// Tombstone first so the document disappears even if the process dies;
+	// the worker picks it up only if the deletes below do not finish it
+	_, err = knowledgeBaseCollection.UpdateMany(ctx,
+		bson.M{"logical_id": doc.LogicalID, "company_id": companyID, "status": bson.M{"$ne": models.KBStatusPendingDelete}},
+		bson.M{
+			"$set": bson.M{
+				"status":        models.KBStatusPendingDelete,
+				"is_current":    false,
+				"next_purge_at": primitive.NewDateTimeFromTime(now.Add(kbSyncBackoff(1))),
+				"updated_at":    primitive.NewDateTimeFromTime(now),
+			},
+			"$unset": bson.M{"next_sync_at": ""},
+		},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	cursor, err := knowledgeBaseCollection.Find(ctx, bson.M{"logical_id": doc.LogicalID, "status": models.KBStatusPendingDelete})
+	if err != nil {
+		return true, nil
+	}
+	var versions []models.KnowledgeBaseDocument
+	if err := cursor.All(ctx, &versions); err != nil {
+		return true, nil
+	}
+
+	tombstoned := false
+	for i := range versions {
+		version := &versions[i]
+		// A running upload adds its result to the stale copies once it finishes
+		if version.SyncingUntil != nil && version.SyncingUntil.Time().After(time.Now()) {
+			tombstoned = true
+			continue
+		}
+		if err := purgeKnowledgeBaseDocument(version); err != nil {
+			log.Printf("Knowledge base document %s tombstoned: %v", version.ID.Hex(), err)
+			tombstoned = true
+		}
+	}
+	return tombstoned, nil
+}
+
+// purgeKnowledgeBaseDocument deletes doc's stale upstream copies and, for a
+// tombstone, its current copy and then the local row. Failures are recorded
+// on the document and retried with backoff.
+func purgeKnowledgeBaseDocument(doc *models.KnowledgeBaseDocument) error {
+	ctx, cancel := context.WithTimeout(context.Background(), kbUpstreamCallTimeout)
+	defer cancel()
+
+	var deleted []string
+	var purgeErr error
+	for _, id := range upstreamCopies(doc) {
+		if err := deleteEnterpriseAssistantDocument(ctx, doc.CompanyID.Hex(), id); err != nil {
+			purgeErr = err
+			continue
+		}
+		deleted = append(deleted, id)
+	}
+
+	if purgeErr == nil && doc.Status == models.KBStatusPendingDelete {
+		_, err := knowledgeBaseCollection.DeleteOne(context.Background(), bson.M{"_id": doc.ID, "status": models.KBStatusPendingDelete})
+		return err
+	}
+
+	now := time.Now()
+	set := bson.M{"updated_at": primitive.NewDateTimeFromTime(now)}
+	unset := bson.M{"syncing_until": ""}
+	if purgeErr != nil {
+		attempts := doc.PurgeAttempts + 1
+		set["purge_attempts"] = attempts
+		set["next_purge_at"] = primitive.NewDateTimeFromTime(now.Add(kbSyncBackoff(attempts)))
+		set["upstream_error"] = kbPurgeFailedMessagePrefix + purgeErr.Error()
+	} else {
+		unset["purge_attempts"] = ""
+		unset["next_purge_at"] = ""
+	}
+	update := bson.M{"$set": set, "$unset": unset}
+	if len(deleted) > 0 {
+		update["$pull"] = bson.M{"stale_document_ids": bson.M{"$in": deleted}}
+	}
+
+	if _, err := knowledgeBaseCollection.UpdateOne(context.Background(), bson.M{"_id": doc.ID}, update); err != nil {
+		return err
+	}
+	return purgeErr
+}
+
+// claimDuePurge leases the next document with upstream copies to delete
+func claimDuePurge() (*models.KnowledgeBaseDocument, error) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	filter := bson.M{
+		"$or": bson.A{
+			bson.M{"status": models.KBStatusPendingDelete},
+			bson.M{"stale_document_ids.0": bson.M{"$exists": true}},
+		},
+		"next_purge_at": bson.M{"$not": bson.M{"$gt": now}},
+		"syncing_until": bson.M{"$not": bson.M{"$gt": now}},
+	}
+	return leaseDocument(filter, bson.M{})
+}
+
+// ReconcileKnowledgeBase diffs a company's local documents against the
+// upstream index. Upstream documents without a local row are deleted once
+// they have been orphaned for the grace period; synced local documents
+// missing upstream are queued for the sync worker to upload again.
+func ReconcileKnowledgeBase(companyID primitive.ObjectID) (*KnowledgeBaseReconcileReport, error) {
+	report := &KnowledgeBaseReconcileReport{
+		CompanyID:       companyID.Hex(),
+		OrphansDeleted:  []string{},
+		OrphansDeferred: []string{},
+		Requeued:        []string{},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kbUpstreamCallTimeout)
+	defer cancel()
+
+	// List upstream first: anything synced after this is newer than the list
+	listedAt := time.Now()
+	upstream, err := listEnterpriseAssistantDocuments(ctx, companyID.Hex())
+	if err != nil {
+		return nil, err
+	}
+	report.UpstreamDocuments = len(upstream)
+
+	var local []models.KnowledgeBaseDocument
+	cursor, err := knowledgeBaseCollection.Find(ctx,
+		bson.M{"company_id": companyID},
+		options.Find().SetProjection(bson.M{"document_id": 1, "stale_document_ids": 1, "status": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &local); err != nil {
+		return nil, err
+	}
+	report.LocalDocuments = len(local)
+
+	known := map[string]bool{}
+	for _, doc := range local {
+		if doc.DocumentID != "" {
+			known[doc.DocumentID] = true
+		}
+		for _, id := range doc.StaleDocumentIDs {
+			known[id] = true
+		}
+	}
+
+	indexed := map[string]bool{}
+	for _, doc := range upstream {
+		indexed[doc.DocumentID] = true
+		if known[doc.DocumentID] {
+			continue
+		}
+		if !orphanGraceElapsed(doc.DocumentID, listedAt) {
+			report.OrphansDeferred = append(report.OrphansDeferred, doc.DocumentID)
+			continue
+		}
+		if err := deleteEnterpriseAssistantDocument(ctx, companyID.Hex(), doc.DocumentID); err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("delete orphan %s: %v", doc.DocumentID, err))
+			continue
+		}
+		forgetOrphan(doc.DocumentID)
+		report.OrphansDeleted = append(report.OrphansDeleted, doc.DocumentID)
+	}
+
+	for _, doc := range local {
+		if doc.Status != models.KBStatusSynced || doc.DocumentID == "" || indexed[doc.DocumentID] {
+			continue
+		}
+		now := primitive.NewDateTimeFromTime(time.Now())
+		result, err := knowledgeBaseCollection.UpdateOne(ctx,
+			bson.M{
+				"_id":         doc.ID,
+				"status":      models.KBStatusSynced,
+				"document_id": doc.DocumentID,
+				"updated_at":  bson.M{"$lt": primitive.NewDateTimeFromTime(listedAt)},
+			},
+			bson.M{
+				"$set": bson.M{
+					"status":         models.KBStatusPendingSync,
+					"upstream_error": kbReconcileMissingUpstream,
+					"sync_attempts":  0,
+					"next_sync_at":   now,
+					"updated_at":     now,
+				},
+				"$unset": bson.M{"document_id": "", "chunks_created": ""},
+			},
+		)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("requeue %s: %v", doc.ID.Hex(), err))
+			continue
+		}
+		if result.ModifiedCount > 0 {
+			report.Requeued = append(report.Requeued, doc.ID.Hex())
+		}
+	}
+
+	return report, nil
+}
+
+// orphanGraceElapsed records the first sighting of an orphan and reports
+// whether it was seen at least kbOrphanGracePeriod before now
+func orphanGraceElapsed(documentID string, now time.Time) bool {
+	kbOrphans.Lock()
+	defer kbOrphans.Unlock()
+	firstSeen, ok := kbOrphans.firstSeen[documentID]
+	if !ok {
+		kbOrphans.firstSeen[documentID] = now
+		return false
+	}
+	return now.Sub(firstSeen) >= kbOrphanGracePeriod
+}
+
+func forgetOrphan(documentID string) {
+	kbOrphans.Lock()
+	delete(kbOrphans.firstSeen, documentID)
+	kbOrphans.Unlock()
+}
+
+// reconcileAllKnowledgeBases reconciles every company's knowledge base
+func reconcileAllKnowledgeBases() {
+	ids, err := companyCollection.Distinct(context.Background(), "_id", bson.M{})
+	if err != nil {
+		log.Printf("Warning: Failed to list companies for knowledge base reconciliation: %v", err)
+		return
+	}
+	for _, id := range ids {
+		companyID, ok := id.(primitive.ObjectID)
+		if !ok {
+			continue
+		}
+		report, err := ReconcileKnowledgeBase(companyID)
+		if err != nil {
+			log.Printf("Warning: Knowledge base reconciliation failed for company %s: %v", companyID.Hex(), err)
+			continue
+		}
+		if len(report.OrphansDeleted) > 0 || len(report.Requeued) > 0 || len(report.Errors) > 0 {
+			log.Printf("Knowledge base reconciliation for company %s: %d orphans deleted, %d requeued, %d errors",
+				companyID.Hex(), len(report.OrphansDeleted), len(report.Requeued), len(report.Errors))
+		}
+	}
+}
@@ -0,0 +1,409 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"chatgpt-clone/backend/utils"
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// kbDiffContext is the number of unchanged lines shown around each change
+const kbDiffContext = 3
+
+// Version errors
+var (
+	ErrDocumentSuperseded     = errors.New("document version is superseded")
+	ErrDocumentVersionCurrent = errors.New("version is already the current version")
+)
+
+// KnowledgeBaseVersionInput is the content of a new document version
+type KnowledgeBaseVersionInput struct {
+	UploadedBy   primitive.ObjectID
+	Filename     string
+	MimeType     string
+	ContentHash  string
+	Text         string
+	ACL          *models.DocumentACL
+	KeepACL      bool     // Inherit the current version's access list instead of ACL
+	Tags         []string // Nil inherits the current version's tags
+	RestoredFrom int      // Set by rollbacks
+}
+
+// KnowledgeBaseVersionDiff is the line diff between two versions' extracted text
+type KnowledgeBaseVersionDiff struct {
+	LogicalID primitive.ObjectID `json:"logical_id"`
+	From      int                `json:"from"`
+	To        int                `json:"to"`
+	Added     int                `json:"added"`
+	Removed   int                `json:"removed"`
+	Hunks     []utils.DiffHunk   `json:"hunks"`
+}
+
+// migrateKnowledgeBaseVersions turns documents stored before versioning into
+// the first version of their own logical document. It must run before the
+// version indexes are created.
+func migrateKnowledgeBaseVersions() {
+	result, err := knowledgeBaseCollection.UpdateMany(context.Background(),
+		bson.M{"logical_id": bson.M{"$exists": false}},
+		bson.A{bson.M{"$set": bson.M{
+			"logical_id": "$_id",
+			"version":    1,
+			"is_current": bson.M{"$ne": bson.A{"$status", models.KBStatusPendingDelete}},
+		}}},
+	)
+	if err != nil {
+		log.Printf("Warning: Failed to migrate knowledge base documents to versions: %v", err)
+		return
+	}
+	if result.ModifiedCount > 0 {
+		log.Printf("Migrated %d knowledge base documents to versions", result.ModifiedCount)
+	}
+}
+
+// FindCurrentKnowledgeBaseDocumentByFilename returns the current version of
+// the company's document with the given filename, if any
+func FindCurrentKnowledgeBaseDocumentByFilename(companyID primitive.ObjectID, filename string) (*models.KnowledgeBaseDocument, error) {
+	var doc models.KnowledgeBaseDocument
+	err := knowledgeBaseCollection.FindOne(context.Background(),
+		bson.M{"company_id": companyID, "is_current": true, "filename": filename},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// CreateKnowledgeBaseVersion adds a new current version to the logical
+// document docID belongs to. The new text is uploaded as a fresh upstream
+// document; the previous version is kept for history as superseded and its
+// upstream copy is deleted so outdated text is no longer retrieved. If the
+// upload fails the new version waits for the sync worker like a failed
+// upload. It returns the new version and the upload error, if any.
+func CreateKnowledgeBaseVersion(docID, companyID primitive.ObjectID, input KnowledgeBaseVersionInput) (*models.KnowledgeBaseDocument, error) {
+	target, err := GetKnowledgeBaseDocumentByID(docID, companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Lease the current version so syncs, resyncs and other new versions
+	// wait for this one
+	now := time.Now()
+	current, err := leaseDocument(bson.M{
+		"logical_id":    target.LogicalID,
+		"company_id":    companyID,
+		"is_current":    true,
+		"status":        bson.M{"$ne": models.KBStatusPendingDelete},
+		"syncing_until": bson.M{"$not": bson.M{"$gt": primitive.NewDateTimeFromTime(now)}},
+	}, bson.M{})
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		count, countErr := knowledgeBaseCollection.CountDocuments(context.Background(), bson.M{
+			"logical_id": target.LogicalID,
+			"is_current": true,
+			"status":     bson.M{"$ne": models.KBStatusPendingDelete},
+		})
+		if countErr == nil && count > 0 {
+			return nil, ErrDocumentSyncInProgress
+		}
+		return nil, mongo.ErrNoDocuments
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	latest, err := latestKnowledgeBaseVersion(current.LogicalID)
+	if err != nil {
+		releaseDocumentLease(current.ID)
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), kbSyncUploadTimeout)
+	defer cancel()
+	result, uploadErr := uploadDocumentToEnterpriseAssistant(ctx, companyID.Hex(), input.UploadedBy.Hex(), input.Filename, input.Text)
+
+	acl := input.ACL
+	if input.KeepACL {
+		acl = current.ACL
+	}
+	tags := input.Tags
+	if tags == nil {
+		tags = current.Tags
+	}
+	// Only one current version may carry a hash: one equal to the current
+	// version's is set once that is retired
+	contentHash, deferHash := input.ContentHash, input.ContentHash != "" && input.ContentHash == current.ContentHash
+	if deferHash {
+		contentHash = ""
+	}
+	created := primitive.NewDateTimeFromTime(time.Now())
+	doc := models.KnowledgeBaseDocument{
+		ID:            primitive.NewObjectID(),
+		CompanyID:     companyID,
+		LogicalID:     current.LogicalID,
+		Version:       latest + 1,
+		IsCurrent:     true,
+		RestoredFrom:  input.RestoredFrom,
+		UploadedBy:    input.UploadedBy,
+		Filename:      input.Filename,
+		MimeType:      input.MimeType,
+		ContentHash:   contentHash,
+		Action:        current.Action,
+		ExtractedText: input.Text,
+		ACL:           acl,
+		Tags:          tags,
+		SyncAttempts:  1,
+		LastSyncAt:    &created,
+		CreatedAt:     created,
+		UpdatedAt:     created,
+	}
+	if uploadErr == nil {
+		doc.Status = models.KBStatusSynced
+		doc.DocumentID = result.DocumentID
+		doc.ChunksCreated = result.ChunksCreated
+	} else {
+		nextSync := primitive.NewDateTimeFromTime(created.Time().Add(kbSyncBackoff(1)))
+		doc.Status = models.KBStatusPendingSync
+		doc.UpstreamError = uploadErr.Error()
+		doc.NextSyncAt = &nextSync
+	}
+
+	if _, err := knowledgeBaseCollection.InsertOne(context.Background(), doc); err != nil {
+		releaseDocumentLease(current.ID)
+		if uploadErr == nil {
+			discardUpload(companyID, result.DocumentID)
+		}
+		return nil, duplicateDocumentError(err)
+	}
+
+	// Access lists are shared by all versions
+	if !input.KeepACL {
+		if err := setVersionsACL(current.LogicalID, companyID, acl); err != nil {
+			log.Printf("Warning: Failed to apply access list to versions of %s: %v", current.LogicalID.Hex(), err)
+		}
+	}
+
+	retired, err := retireKnowledgeBaseVersion(current)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// Deleted while uploading: the new version goes with the rest
+		releaseDocumentLease(current.ID)
+		if _, tombErr := DeleteKnowledgeBaseDocument(doc.ID, companyID); tombErr != nil {
+			log.Printf("Warning: Failed to delete version %s of deleted document: %v", doc.ID.Hex(), tombErr)
+		}
+		return nil, ErrDocumentDeleted
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if deferHash {
+		_, err := knowledgeBaseCollection.UpdateOne(context.Background(), bson.M{"_id": doc.ID}, bson.M{"$set": bson.M{"content_hash": input.ContentHash}})
+		if err != nil {
+			log.Printf("Warning: Failed to set content hash of knowledge base document %s: %v", doc.ID.Hex(), err)
+		} else {
+			doc.ContentHash = input.ContentHash
+		}
+	}
+
+	if len(retired.StaleDocumentIDs) > 0 {
+		if err := purgeKnowledgeBaseDocument(retired); err != nil {
+			log.Printf("Knowledge base document %s: old upstream copy left for the sync worker: %v", retired.ID.Hex(), err)
+		}
+	}
+	return &doc, uploadErr
+}
+
+// retireKnowledgeBaseVersion marks a leased current version superseded and
+// queues its upstream copy for deletion, releasing the lease
+func retireKnowledgeBaseVersion(doc *models.KnowledgeBaseDocument) (*models.KnowledgeBaseDocument, error) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	update := bson.M{
+		"$set": bson.M{
+			"status":        models.KBStatusSuperseded,
+			"is_current":    false,
+			"next_purge_at": now,
+			"updated_at":    now,
+		},
+		"$unset": bson.M{
+			"document_id":    "",
+			"chunks_created": "",
+			"upstream_error": "",
+			"sync_attempts":  "",
+			"next_sync_at":   "",
+			"syncing_until":  "",
+		},
+	}
+	if doc.DocumentID != "" {
+		update["$addToSet"] = bson.M{"stale_document_ids": doc.DocumentID}
+	}
+
+	var retired models.KnowledgeBaseDocument
+	err := knowledgeBaseCollection.FindOneAndUpdate(context.Background(),
+		bson.M{"_id": doc.ID, "status": bson.M{"$ne": models.KBStatusPendingDelete}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&retired)
+	if err != nil {
+		return nil, err
+	}
+	return &retired, nil
+}
+
+func releaseDocumentLease(docID primitive.ObjectID) {
+	_, err := knowledgeBaseCollection.UpdateOne(context.Background(),
+		bson.M{"_id": docID},
+		bson.M{"$unset": bson.M{"syncing_until": ""}},
+	)
+	if err != nil {
+		log.Printf("Warning: Failed to release lease on knowledge base document %s: %v", docID.Hex(), err)
+	}
+}
+
+// discardUpload deletes an upstream copy no local row refers to, leaving it to
+// reconciliation if that fails
+func discardUpload(companyID primitive.ObjectID, documentID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), kbUpstreamCallTimeout)
+	defer cancel()
+	if err := deleteEnterpriseAssistantDocument(ctx, companyID.Hex(), documentID); err != nil {
+		log.Printf("Warning: Orphaned upstream document %s left for reconciliation: %v", documentID, err)
+	}
+}
+
+func latestKnowledgeBaseVersion(logicalID primitive.ObjectID) (int, error) {
+	var doc models.KnowledgeBaseDocument
+	err := knowledgeBaseCollection.FindOne(context.Background(),
+		bson.M{"logical_id": logicalID},
+		options.FindOne().
+			SetSort(bson.D{{Key: "version", Value: -1}}).
+			SetProjection(bson.M{"version": 1}),
+	).Decode(&doc)
+	if err != nil {
+		return 0, err
+	}
+	return doc.Version, nil
+}
+
+// setVersionsACL replaces the access list of every version of a document
+func setVersionsACL(logicalID, companyID primitive.ObjectID, acl *models.DocumentACL) error {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	update := bson.M{"$set": bson.M{"acl": acl, "updated_at": now}}
+	if acl == nil {
+		update = bson.M{"$set": bson.M{"updated_at": now}, "$unset": bson.M{"acl": ""}}
+	}
+	_, err := knowledgeBaseCollection.UpdateMany(context.Background(),
+		bson.M{"logical_id": logicalID, "company_id": companyID, "status": bson.M{"$ne": models.KBStatusPendingDelete}},
+		update,
+	)
+	return err
+}
+
+// GetKnowledgeBaseVersions lists the versions of a logical document, newest
+// first, without their extracted text
+func GetKnowledgeBaseVersions(logicalID, companyID primitive.ObjectID) ([]models.KnowledgeBaseDocument, error) {
+	ctx := context.Background()
+	cursor, err := knowledgeBaseCollection.Find(ctx,
+		bson.M{"logical_id": logicalID, "company_id": companyID, "status": bson.M{"$ne": models.KBStatusPendingDelete}},
+		options.Find().
+			SetSort(bson.D{{Key: "version", Value: -1}}).
+			SetProjection(bson.M{"extracted_text": 0}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	versions := []models.KnowledgeBaseDocument{}
+	if err := cursor.All(ctx, &versions); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// GetKnowledgeBaseVersion fetches one version of a logical document
+func GetKnowledgeBaseVersion(logicalID, companyID primitive.ObjectID, version int) (*models.KnowledgeBaseDocument, error) {
+	var doc models.KnowledgeBaseDocument
+	err := knowledgeBaseCollection.FindOne(context.Background(), bson.M{
+		"logical_id": logicalID,
+		"company_id": companyID,
+		"version":    version,
+		"status":     bson.M{"$ne": models.KBStatusPendingDelete},
+	}).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// DiffKnowledgeBaseVersions diffs the extracted text of two versions. A zero
+// to means the current version and a zero from the version before to.
+func DiffKnowledgeBaseVersions(logicalID, companyID primitive.ObjectID, from, to int) (*KnowledgeBaseVersionDiff, error) {
+	var newer *models.KnowledgeBaseDocument
+	var err error
+	if to == 0 {
+		newer, err = currentKnowledgeBaseVersion(logicalID, companyID)
+	} else {
+		newer, err = GetKnowledgeBaseVersion(logicalID, companyID, to)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if from == 0 {
+		from = newer.Version - 1
+	}
+	older, err := GetKnowledgeBaseVersion(logicalID, companyID, from)
+	if err != nil {
+		return nil, err
+	}
+
+	hunks, added, removed := utils.LineDiff(older.ExtractedText, newer.ExtractedText, kbDiffContext)
+	return &KnowledgeBaseVersionDiff{
+		LogicalID: logicalID,
+		From:      older.Version,
+		To:        newer.Version,
+		Added:     added,
+		Removed:   removed,
+		Hunks:     hunks,
+	}, nil
+}
+
+func currentKnowledgeBaseVersion(logicalID, companyID primitive.ObjectID) (*models.KnowledgeBaseDocument, error) {
+	var doc models.KnowledgeBaseDocument
+	err := knowledgeBaseCollection.FindOne(context.Background(), bson.M{
+		"logical_id": logicalID,
+		"company_id": companyID,
+		"is_current": true,
+	}).Decode(&doc)
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// RollbackKnowledgeBaseDocument restores an earlier version by adding a new
+// version with its content, so history is never rewritten. It returns the
+// new version and the upload error, if any.
+func RollbackKnowledgeBaseDocument(logicalID, companyID primitive.ObjectID, version int, restoredBy primitive.ObjectID) (*models.KnowledgeBaseDocument, error) {
+	old, err := GetKnowledgeBaseVersion(logicalID, companyID, version)
+	if err != nil {
+		return nil, err
+	}
+	if old.IsCurrent {
+		return nil, ErrDocumentVersionCurrent
+	}
+
+	return CreateKnowledgeBaseVersion(old.ID, companyID, KnowledgeBaseVersionInput{
+		UploadedBy:   restoredBy,
+		Filename:     old.Filename,
+		MimeType:     old.MimeType,
+		ContentHash:  old.ContentHash,
+		Text:         old.ExtractedText,
+		KeepACL:      true,
+		RestoredFrom: old.Version,
+	})
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// defaultFallbackChain is appended after a company's primary provider when the
+// company has no explicit LLMFallbackChain. Override with LLM_FALLBACK_CHAIN.
+const defaultFallbackChain = "gemini,unavailable"
+
+// ErrAllProvidersFailed is returned when every hop of a fallback chain failed
+// or was skipped by an open circuit breaker.
+var ErrAllProvidersFailed = errors.New("all llm providers in the fallback chain failed")
+
+// routeHop is one step of a company's fallback chain.
+type routeHop struct {
+	provider Provider
+	model    string
+}
+
+// ParseRouteSpec splits a chain entry of the form "provider" or
+// "provider:model" and checks the provider is registered.
+func ParseRouteSpec(spec string) (string, string, error) {
+	name, model, _ := strings.Cut(strings.TrimSpace(spec), ":")
+	if name == "" {
+		return "", "", errors.New("empty llm route entry")
+	}
+	if _, err := GetProvider(name); err != nil {
+		return "", "", err
+	}
+	return name, model, nil
+}
+
+// routeForCompany returns the ordered hops to try for a company. An explicit
+// LLMFallbackChain wins; otherwise the primary provider (with LLMModel) is
+// followed by the platform default chain. Unregistered or duplicate entries
+// are dropped.
+func routeForCompany(company *models.Company) []routeHop {
+	var specs []string
+	if company != nil && len(company.Settings.LLMFallbackChain) > 0 {
+		specs = company.Settings.LLMFallbackChain
+	} else {
+		primary := ProviderForCompany(company)
+		spec := primary.Name()
+		if company != nil && company.Settings.LLMProvider == primary.Name() && company.Settings.LLMModel != "" {
+			spec += ":" + company.Settings.LLMModel
+		}
+		specs = append(specs, spec)
+
+		chain := os.Getenv("LLM_FALLBACK_CHAIN")
+		if chain == "" {
+			chain = defaultFallbackChain
+		}
+		specs = append(specs, strings.Split(chain, ",")...)
+	}
+
+	seen := map[string]bool{}
+	hops := make([]routeHop, 0, len(specs))
+	for _, spec := range specs {
+		name, model, err := ParseRouteSpec(spec)
+		if err != nil {
+			continue
+		}
+		key := name + ":" + model
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		provider, _ := GetProvider(name)
+		hops = append(hops, routeHop{provider: provider, model: model})
+	}
+
+	if len(hops) == 0 {
+		hops = append(hops, routeHop{provider: ProviderForCompany(company)})
+	}
+	return hops
+}
+
+// routeCompletion walks the company's fallback chain until a hop answers.
+// Hops whose circuit breaker is open are skipped. call performs the request
+// against a single hop and reports whether any output already reached the
+// client; once it has, the chain stops there since a partial answer cannot be
+// retried elsewhere.
+func routeCompletion(
+	ctx context.Context,
+	companyID primitive.ObjectID,
+	call func(hop routeHop) (*CompletionResponse, bool, error),
+) (*CompletionResponse, error) {
+	company, _ := GetCompanyByID(companyID)
+	hops := routeForCompany(company)
+
+	var lastErr error
+	for i, hop := range hops {
+		breaker := circuitBreakerFor(hop.provider.Name())
+		if !breaker.Allow() {
+			lastErr = fmt.Errorf("%s: circuit open", hop.provider.Name())
+			continue
+		}
+
+		response, started, err := call(hop)
+		if err == nil {
+			breaker.RecordSuccess()
+			response.FallbackHop = i
+			if response.Provider == "" {
+				response.Provider = hop.provider.Name()
+			}
+			if i > 0 {
+				log.Printf("LLM fallback: company %s answered by hop %d (%s) after: %v", companyID.Hex(), i, hop.provider.Name(), lastErr)
+			}
+			return response, nil
+		}
+
+		if ctx.Err() != nil {
+			// The caller went away; this is not the upstream's fault, but a
+			// half-open trial must not be left holding the breaker
+			breaker.Abandon()
+			return response, err
+		}
+
+		breaker.RecordFailure(err)
+		lastErr = fmt.Errorf("%s: %w", hop.provider.Name(), err)
+		if started {
+			if response != nil {
+				response.FallbackHop = i
+			}
+			return response, lastErr
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %v", ErrAllProvidersFailed, lastErr)
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Lockout policy defaults. Override with LOGIN_MAX_FAILURES,
+// LOGIN_IP_MAX_FAILURES and LOGIN_FAILURE_WINDOW_MINUTES.
+const (
+	defaultLoginMaxFailures   = 5  // Per (company, email)
+	defaultLoginIPMaxFailures = 20 // Per IP, across companies
+	defaultLoginFailureWindow = 15 * time.Minute
+
+	// A lock that ended longer ago than this no longer counts towards the
+	// progressive duration.
+	lockCountDecay = 24 * time.Hour
+)
+
+// lockoutDurations are applied to the 1st, 2nd, 3rd... consecutive lock.
+var lockoutDurations = []time.Duration{
+	5 * time.Minute,
+	15 * time.Minute,
+	time.Hour,
+	4 * time.Hour,
+	24 * time.Hour,
+}
+
+// LoginLockedError is returned by MultiTenantLoginUser while an account or IP
+// is locked out.
+type LoginLockedError struct {
+	Subject string
+	Until   time.Time
+}
+
+func (e *LoginLockedError) Error() string {
+	wait := time.Until(e.Until).Round(time.Minute)
+	if wait < time.Minute {
+		wait = time.Minute
+	}
+	if e.Subject == models.LockoutSubjectIP {
+		return fmt.Sprintf("too many failed login attempts from this network; try again in %s", wait)
+	}
+	return fmt.Sprintf("account temporarily locked after too many failed login attempts; try again in %s", wait)
+}
+
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n > 0 {
+		return n
+	}
+	return fallback
+}
+
+func loginFailureWindow() time.Duration {
+	return time.Duration(envInt("LOGIN_FAILURE_WINDOW_MINUTES", int(defaultLoginFailureWindow/time.Minute))) * time.Minute
+}
+
+func accountLockoutFilter(companyID primitive.ObjectID, email string) bson.M {
+	return bson.M{"subject": models.LockoutSubjectAccount, "company_id": companyID, "email": email}
+}
+
+func ipLockoutFilter(ip string) bson.M {
+	return bson.M{"subject": models.LockoutSubjectIP, "ip_address": ip}
+}
+
+// findLockout returns the lockout document for filter, or an empty one.
+func findLockout(ctx context.Context, filter bson.M) models.LoginLockout {
+	var lockout models.LoginLockout
+	loginLockoutCollection.FindOne(ctx, filter).Decode(&lockout)
+	return lockout
+}
+
+// CheckLoginLockout returns a *LoginLockedError if the account or the IP is
+// currently locked out.
+func CheckLoginLockout(companyID primitive.ObjectID, email, ip string) error {
+	ctx := context.Background()
+	now := time.Now()
+
+	if account := findLockout(ctx, accountLockoutFilter(companyID, email)); account.LockedUntil.Time().After(now) {
+		return &LoginLockedError{Subject: models.LockoutSubjectAccount, Until: account.LockedUntil.Time()}
+	}
+	if ip != "" {
+		if byIP := findLockout(ctx, ipLockoutFilter(ip)); byIP.LockedUntil.Time().After(now) {
+			return &LoginLockedError{Subject: models.LockoutSubjectIP, Until: byIP.LockedUntil.Time()}
+		}
+	}
+	return nil
+}
+
+// RecordLoginFailure is called after a failed login has been logged. It
+// counts recent failed_login entries for the account and the IP and locks
+// whichever has reached its threshold.
+func RecordLoginFailure(companyID, userID primitive.ObjectID, email, ip string) {
+	ctx := context.Background()
+	now := time.Now()
+	windowStart := now.Add(-loginFailureWindow())
+
+	account := findLockout(ctx, accountLockoutFilter(companyID, email))
+	failures, err := activityLogCollection.CountDocuments(ctx, bson.M{
+		"company_id":     companyID,
+		"action":         models.ActionFailedLogin,
+		"metadata.email": email,
+		"timestamp":      bson.M{"$gte": primitive.NewDateTimeFromTime(latest(windowStart, account.ResetAt.Time()))},
+	})
+	if err == nil && failures >= int64(envInt("LOGIN_MAX_FAILURES", defaultLoginMaxFailures)) {
+		lockLogin(ctx, account, accountLockoutFilter(companyID, email), companyID, userID, email, ip, failures)
+	}
+
+	if ip == "" {
+		return
+	}
+	byIP := findLockout(ctx, ipLockoutFilter(ip))
+	failures, err = activityLogCollection.CountDocuments(ctx, bson.M{
+		"action":     models.ActionFailedLogin,
+		"ip_address": ip,
+		"timestamp":  bson.M{"$gte": primitive.NewDateTimeFromTime(latest(windowStart, byIP.ResetAt.Time()))},
+	})
+	if err == nil && failures >= int64(envInt("LOGIN_IP_MAX_FAILURES", defaultLoginIPMaxFailures)) {
+		lockLogin(ctx, byIP, ipLockoutFilter(ip), companyID, userID, email, ip, failures)
+	}
+}
+
+// lockLogin locks an account or IP for the next progressive duration and
+// records an account_locked entry in the activity log.
+func lockLogin(ctx context.Context, lockout models.LoginLockout, filter bson.M, companyID, userID primitive.ObjectID, email, ip string, failures int64) {
+	now := time.Now()
+
+	lockCount := lockout.LockCount
+	if now.Sub(lockout.LockedUntil.Time()) > lockCountDecay {
+		lockCount = 0
+	}
+	lockCount++
+	duration := lockoutDurations[min(lockCount, len(lockoutDurations))-1]
+	until := now.Add(duration)
+
+	set := bson.M{
+		"lock_count":   lockCount,
+		"locked_until": primitive.NewDateTimeFromTime(until),
+		"reset_at":     primitive.NewDateTimeFromTime(now), // Start counting afresh once the lock ends
+		"updated_at":   primitive.NewDateTimeFromTime(now),
+	}
+	for k, v := range filter {
+		set[k] = v
+	}
+	_, err := loginLockoutCollection.UpdateOne(ctx, filter, bson.M{"$set": set}, options.Update().SetUpsert(true))
+	if err != nil {
+		return
+	}
+
+	subject := filter["subject"].(string)
+	description := fmt.Sprintf("Account %s locked for %s after %d failed login attempts", email, duration, failures)
+	resourceID := userID.Hex()
+	if subject == models.LockoutSubjectIP {
+		description = fmt.Sprintf("IP %s locked for %s after %d failed login attempts", ip, duration, failures)
+		resourceID = ip
+	}
+
+	LogActivity(
+		companyID,
+		userID,
+		models.ActionAccountLocked,
+		models.ResourceUser,
+		resourceID,
+		description,
+		false,
+		map[string]interface{}{
+			"subject":      subject,
+			"email":        email,
+			"failures":     failures,
+			"lock_count":   lockCount,
+			"locked_until": until,
+		},
+		ip,
+		"",
+		"POST",
+		"/auth/login",
+		429,
+		"Account locked",
+	)
+}
+
+// ResetLoginFailures clears an account's failure count and lock history after
+// a successful login.
+func ResetLoginFailures(companyID primitive.ObjectID, email string) {
+	now := primitive.NewDateTimeFromTime(time.Now())
+	loginLockoutCollection.UpdateOne(context.Background(), accountLockoutFilter(companyID, email), bson.M{
+		"$set": bson.M{"lock_count": 0, "reset_at": now, "updated_at": now},
+	})
+}
+
+// UnlockAccount lifts an account lockout and clears its failure count. It
+// reports whether the account was locked.
+func UnlockAccount(companyID primitive.ObjectID, email string) (bool, error) {
+	now := time.Now()
+	result, err := loginLockoutCollection.UpdateOne(context.Background(),
+		bson.M{
+			"subject":      models.LockoutSubjectAccount,
+			"company_id":   companyID,
+			"email":        email,
+			"locked_until": bson.M{"$gt": primitive.NewDateTimeFromTime(now)},
+		},
+		bson.M{"$set": bson.M{
+			"locked_until": primitive.NewDateTimeFromTime(now),
+			"lock_count":   0,
+			"reset_at":     primitive.NewDateTimeFromTime(now),
+			"updated_at":   primitive.NewDateTimeFromTime(now),
+		}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount > 0, nil
+}
+
+// GetActiveLockouts lists a company's currently locked accounts.
+func GetActiveLockouts(companyID primitive.ObjectID) ([]models.LoginLockout, error) {
+	ctx := context.Background()
+	cursor, err := loginLockoutCollection.Find(ctx, bson.M{
+		"subject":      models.LockoutSubjectAccount,
+		"company_id":   companyID,
+		"locked_until": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())},
+	}, options.Find().SetSort(bson.D{{Key: "locked_until", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	lockouts := []models.LoginLockout{}
+	if err := cursor.All(ctx, &lockouts); err != nil {
+		return nil, err
+	}
+	return lockouts, nil
+}
+
+func latest(a, b time.Time) time.Time {
+	if b.After(a) {
+		return b
+	}
+	return a
+}
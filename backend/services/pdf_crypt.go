@@ -0,0 +1,280 @@
+package services
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+)
+
+// pdfPasswordPadding pads passwords of the standard security handler
+var pdfPasswordPadding = []byte{
+	0x28, 0xBF, 0x4E, 0x5E, 0x4E, 0x75, 0x8A, 0x41, 0x64, 0x00, 0x4E, 0x56, 0xFF, 0xFA, 0x01, 0x08,
+	0x2E, 0x2E, 0x00, 0xB6, 0xD0, 0x68, 0x3E, 0x80, 0x2F, 0x0C, 0xA9, 0xFE, 0x64, 0x53, 0x69, 0x7A,
+}
+
+// pdfCrypt decrypts files of the standard security handler that open
+// without a password, i.e. that only restrict permissions. Files that need
+// a user password cannot be read.
+type pdfCrypt struct {
+	key      []byte
+	revision int
+	// Whether streams and strings are encrypted (crypt filters may leave
+	// either as Identity), and with AES rather than RC4
+	streams, streamAES bool
+	strings, stringAES bool
+}
+
+func newPDFCrypt(encrypt pdfDict, fileID []byte) (*pdfCrypt, error) {
+	if filter, _ := encrypt["Filter"].(pdfName); filter != "Standard" {
+		return nil, fmt.Errorf("%w: unsupported security handler %s", errPDFEncrypted, filter)
+	}
+	v, _ := encrypt["V"].(int64)
+	r, _ := encrypt["R"].(int64)
+	o, _ := encrypt["O"].(pdfString)
+	u, _ := encrypt["U"].(pdfString)
+	p, _ := encrypt["P"].(int64)
+	c := &pdfCrypt{revision: int(r), streams: true, strings: true}
+
+	// Crypt filters (V4 and V5) choose the cipher of streams and strings
+	if v >= 4 {
+		filters, _ := encrypt["CF"].(pdfDict)
+		method := func(key pdfName) (enabled, aes bool) {
+			name, _ := encrypt[key].(pdfName)
+			if name == "" || name == "Identity" {
+				return false, false
+			}
+			filter, _ := filters[name].(pdfDict)
+			cfm, _ := filter["CFM"].(pdfName)
+			switch cfm {
+			case "V2":
+				return true, false
+			case "AESV2", "AESV3":
+				return true, true
+			}
+			return false, false
+		}
+		c.streams, c.streamAES = method("StmF")
+		c.strings, c.stringAES = method("StrF")
+	}
+
+	var err error
+	switch {
+	case r >= 5:
+		c.key, err = pdfAES256Key(encrypt, int(r), u)
+	case r >= 2:
+		length := 40
+		if l, ok := encrypt["Length"].(int64); ok && l >= 40 && l <= 128 && r >= 3 {
+			length = int(l)
+		}
+		encryptMetadata := true
+		if m, ok := encrypt["EncryptMetadata"].(bool); ok {
+			encryptMetadata = m
+		}
+		c.key = pdfRC4Key(o, int32(p), fileID, int(r), length/8, encryptMetadata)
+		if !c.checkUserPassword(u, fileID) {
+			err = errPDFEncrypted
+		}
+	default:
+		err = fmt.Errorf("%w: unsupported encryption revision %d", errPDFEncrypted, r)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// pdfRC4Key computes the file key for the empty user password (revisions 2
+// to 4)
+func pdfRC4Key(owner []byte, permissions int32, fileID []byte, revision, length int, encryptMetadata bool) []byte {
+	h := md5.New()
+	h.Write(pdfPasswordPadding)
+	h.Write(owner)
+	binary.Write(h, binary.LittleEndian, permissions)
+	h.Write(fileID)
+	if revision >= 4 && !encryptMetadata {
+		h.Write([]byte{0xFF, 0xFF, 0xFF, 0xFF})
+	}
+	key := h.Sum(nil)
+	if revision >= 3 {
+		for i := 0; i < 50; i++ {
+			sum := md5.Sum(key[:length])
+			key = sum[:]
+		}
+	}
+	return key[:length]
+}
+
+func (c *pdfCrypt) checkUserPassword(u, fileID []byte) bool {
+	if c.revision == 2 {
+		out := make([]byte, len(pdfPasswordPadding))
+		rc, err := rc4.NewCipher(c.key)
+		if err != nil {
+			return false
+		}
+		rc.XORKeyStream(out, pdfPasswordPadding)
+		return bytes.Equal(out, u)
+	}
+
+	h := md5.New()
+	h.Write(pdfPasswordPadding)
+	h.Write(fileID)
+	out := h.Sum(nil)
+	for i := 0; i < 20; i++ {
+		key := make([]byte, len(c.key))
+		for j := range key {
+			key[j] = c.key[j] ^ byte(i)
+		}
+		rc, err := rc4.NewCipher(key)
+		if err != nil {
+			return false
+		}
+		rc.XORKeyStream(out, out)
+	}
+	return len(u) >= 16 && bytes.Equal(out, u[:16])
+}
+
+// pdfAES256Key computes the file key for the empty user password
+// (revisions 5 and 6)
+func pdfAES256Key(encrypt pdfDict, revision int, u []byte) ([]byte, error) {
+	ue, _ := encrypt["UE"].(pdfString)
+	if len(u) < 48 || len(ue) < 32 {
+		return nil, fmt.Errorf("%w: bad encryption dictionary", errPDFMalformed)
+	}
+	if !bytes.Equal(pdfAES256Hash(revision, nil, u[32:40]), u[:32]) {
+		return nil, errPDFEncrypted
+	}
+
+	block, err := aes.NewCipher(pdfAES256Hash(revision, nil, u[40:48]))
+	if err != nil {
+		return nil, err
+	}
+	key := make([]byte, 32)
+	cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(key, ue[:32])
+	return key, nil
+}
+
+// pdfAES256Hash is the password hash of revision 5 (SHA-256) and revision 6
+// (ISO 32000-2 algorithm 2.B), without the owner key data
+func pdfAES256Hash(revision int, password, salt []byte) []byte {
+	sum := sha256.Sum256(append(append([]byte{}, password...), salt...))
+	k := sum[:]
+	if revision < 6 {
+		return k
+	}
+
+	for round := 0; ; round++ {
+		block := append(append([]byte{}, password...), k...)
+		k1 := bytes.Repeat(block, 64)
+		aesBlock, err := aes.NewCipher(k[:16])
+		if err != nil {
+			return nil
+		}
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(aesBlock, k[16:32]).CryptBlocks(e, k1)
+
+		var remainder int
+		for _, b := range e[:16] {
+			remainder += int(b)
+		}
+		var next hash.Hash
+		switch remainder % 3 {
+		case 0:
+			next = sha256.New()
+		case 1:
+			next = sha512.New384()
+		default:
+			next = sha512.New()
+		}
+		next.Write(e)
+		k = next.Sum(nil)
+
+		if round >= 63 && int(e[len(e)-1]) <= round-31 {
+			break
+		}
+	}
+	return k[:32]
+}
+
+// objectKey derives the key of one object (revisions 2 to 4)
+func (c *pdfCrypt) objectKey(ref pdfRef, aes bool) []byte {
+	if c.revision >= 5 {
+		return c.key
+	}
+	h := md5.New()
+	h.Write(c.key)
+	h.Write([]byte{byte(ref.num), byte(ref.num >> 8), byte(ref.num >> 16), byte(ref.gen), byte(ref.gen >> 8)})
+	if aes {
+		h.Write([]byte("sAlT"))
+	}
+	return h.Sum(nil)[:min(len(c.key)+5, 16)]
+}
+
+func (c *pdfCrypt) decrypt(data []byte, ref pdfRef, aes bool) ([]byte, error) {
+	key := c.objectKey(ref, aes)
+	if !aes {
+		rc, err := rc4.NewCipher(key)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]byte, len(data))
+		rc.XORKeyStream(out, data)
+		return out, nil
+	}
+	return decryptPDFAES(key, data)
+}
+
+// decryptPDFAES decrypts AES-CBC data prefixed with its IV
+func decryptPDFAES(key, data []byte) ([]byte, error) {
+	if len(data) < 2*aes.BlockSize || len(data)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("%w: bad encrypted data", errPDFMalformed)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(data)-aes.BlockSize)
+	cipher.NewCBCDecrypter(block, data[:aes.BlockSize]).CryptBlocks(out, data[aes.BlockSize:])
+	if pad := int(out[len(out)-1]); pad >= 1 && pad <= aes.BlockSize {
+		out = out[:len(out)-pad]
+	}
+	return out, nil
+}
+
+func (c *pdfCrypt) decryptStream(data []byte, ref pdfRef, dict pdfDict) ([]byte, error) {
+	if !c.streams || dict["Type"] == pdfName("Metadata") && c.revision >= 4 {
+		return data, nil
+	}
+	return c.decrypt(data, ref, c.streamAES)
+}
+
+// decryptStrings decrypts the strings of an object read from the file
+func (c *pdfCrypt) decryptStrings(obj any, ref pdfRef) any {
+	if !c.strings {
+		return obj
+	}
+	switch v := obj.(type) {
+	case pdfString:
+		if out, err := c.decrypt(v, ref, c.stringAES); err == nil {
+			return pdfString(out)
+		}
+		return v
+	case pdfArray:
+		for i := range v {
+			v[i] = c.decryptStrings(v[i], ref)
+		}
+	case pdfDict:
+		for key, value := range v {
+			v[key] = c.decryptStrings(value, ref)
+		}
+	case *pdfStream:
+		c.decryptStrings(v.dict, ref)
+	}
+	return obj
+}
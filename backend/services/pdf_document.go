@@ -0,0 +1,553 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// pdfXrefEntry locates an object: at a file offset, or inside an object stream
+type pdfXrefEntry struct {
+	offset    int
+	gen       int
+	inStream  bool
+	streamNum int
+}
+
+// pdfObjectStream is a decoded object stream and the offsets of its objects
+type pdfObjectStream struct {
+	data    []byte
+	offsets map[int]int
+}
+
+// pdfDocument is a parsed PDF file. Objects are read lazily through the
+// cross-reference table.
+type pdfDocument struct {
+	data      []byte
+	xref      map[int]pdfXrefEntry
+	trailer   pdfDict
+	objects   map[int]any
+	loading   map[int]bool // Objects being read, to break reference cycles
+	objStms   map[int]*pdfObjectStream
+	crypt     *pdfCrypt
+	decodeCap int // Remaining budget of decoded stream bytes
+}
+
+func openPDFDocument(data []byte) (*pdfDocument, error) {
+	// Offsets count from the header, even when junk precedes it
+	header := bytes.Index(data, []byte("%PDF-"))
+	if header < 0 {
+		return nil, fmt.Errorf("%w: missing header", errPDFMalformed)
+	}
+	doc := &pdfDocument{
+		data:      data[header:],
+		xref:      map[int]pdfXrefEntry{},
+		trailer:   pdfDict{},
+		objects:   map[int]any{},
+		loading:   map[int]bool{},
+		objStms:   map[int]*pdfObjectStream{},
+		decodeCap: pdfMaxDecodedSize,
+	}
+
+	if err := doc.loadXref(); err != nil || doc.catalog() == nil {
+		// Damaged cross-reference data: find the objects by scanning
+		doc.xref, doc.trailer, doc.objects, doc.objStms = map[int]pdfXrefEntry{}, pdfDict{}, map[int]any{}, map[int]*pdfObjectStream{}
+		doc.reconstructXref()
+		if doc.catalog() == nil {
+			return nil, fmt.Errorf("%w: no document catalog", errPDFMalformed)
+		}
+	}
+
+	if encrypt, ok := doc.resolve(doc.trailer["Encrypt"]).(pdfDict); ok {
+		crypt, err := newPDFCrypt(encrypt, doc.fileID())
+		if err != nil {
+			return nil, err
+		}
+		doc.crypt = crypt
+		// Objects read before the key was known hold encrypted strings
+		doc.objects = map[int]any{}
+		doc.objStms = map[int]*pdfObjectStream{}
+	}
+	return doc, nil
+}
+
+func (d *pdfDocument) catalog() pdfDict {
+	catalog, _ := d.resolve(d.trailer["Root"]).(pdfDict)
+	return catalog
+}
+
+func (d *pdfDocument) fileID() []byte {
+	if ids, ok := d.resolve(d.trailer["ID"]).(pdfArray); ok && len(ids) > 0 {
+		if id, ok := ids[0].(pdfString); ok {
+			return id
+		}
+	}
+	return nil
+}
+
+// loadXref reads the cross-reference sections from startxref back through
+// the /Prev chain. Newer sections win.
+func (d *pdfDocument) loadXref() error {
+	at := bytes.LastIndex(d.data, []byte("startxref"))
+	if at < 0 {
+		return fmt.Errorf("%w: missing startxref", errPDFMalformed)
+	}
+	lexer := &pdfLexer{data: d.data, pos: at + len("startxref")}
+	lexer.skipSpace()
+	offset, err := strconv.Atoi(string(lexer.regular()))
+	if err != nil {
+		return fmt.Errorf("%w: bad startxref", errPDFMalformed)
+	}
+
+	visited := map[int]bool{}
+	for chain := 0; chain < pdfMaxXrefChain && !visited[offset]; chain++ {
+		visited[offset] = true
+
+		trailer, err := d.readXrefSection(offset)
+		if err != nil {
+			return err
+		}
+		for key, value := range trailer {
+			if _, ok := d.trailer[key]; !ok && key != "Prev" && key != "XRefStm" {
+				d.trailer[key] = value
+			}
+		}
+		// Hybrid files keep the entries of compressed objects in a stream
+		if stm, ok := trailer["XRefStm"].(int64); ok && !visited[int(stm)] {
+			visited[int(stm)] = true
+			if _, err := d.readXrefSection(int(stm)); err != nil {
+				return err
+			}
+		}
+		prev, ok := trailer["Prev"].(int64)
+		if !ok {
+			break
+		}
+		offset = int(prev)
+	}
+	return nil
+}
+
+// readXrefSection reads a classic table with its trailer, or a
+// cross-reference stream, at offset
+func (d *pdfDocument) readXrefSection(offset int) (pdfDict, error) {
+	if offset <= 0 || offset >= len(d.data) {
+		return nil, fmt.Errorf("%w: cross-reference offset out of range", errPDFMalformed)
+	}
+	lexer := &pdfLexer{data: d.data, pos: offset}
+	lexer.skipSpace()
+	if bytes.HasPrefix(d.data[lexer.pos:], []byte("xref")) {
+		lexer.pos += len("xref")
+		return d.readXrefTable(lexer)
+	}
+
+	_, obj, err := d.readIndirectObject(offset)
+	if err != nil {
+		return nil, err
+	}
+	stream, ok := obj.(*pdfStream)
+	if !ok || stream.dict["Type"] != pdfName("XRef") {
+		return nil, fmt.Errorf("%w: no cross-reference data at %d", errPDFMalformed, offset)
+	}
+	return stream.dict, d.readXrefStream(stream)
+}
+
+func (d *pdfDocument) readXrefTable(lexer *pdfLexer) (pdfDict, error) {
+	for {
+		lexer.skipSpace()
+		word := lexer.regular()
+		if string(word) == "trailer" {
+			obj, err := lexer.readObject(true, 0)
+			if err != nil {
+				return nil, err
+			}
+			trailer, ok := obj.(pdfDict)
+			if !ok {
+				return nil, fmt.Errorf("%w: bad trailer", errPDFMalformed)
+			}
+			return trailer, nil
+		}
+
+		start, err1 := strconv.Atoi(string(word))
+		lexer.skipSpace()
+		count, err2 := strconv.Atoi(string(lexer.regular()))
+		if err1 != nil || err2 != nil || start < 0 || count < 0 {
+			return nil, fmt.Errorf("%w: bad cross-reference table", errPDFMalformed)
+		}
+		for i := 0; i < count; i++ {
+			lexer.skipSpace()
+			offset, errOffset := strconv.Atoi(string(lexer.regular()))
+			lexer.skipSpace()
+			gen, errGen := strconv.Atoi(string(lexer.regular()))
+			lexer.skipSpace()
+			kind := string(lexer.regular())
+			if errOffset != nil || errGen != nil || (kind != "n" && kind != "f") {
+				return nil, fmt.Errorf("%w: bad cross-reference entry", errPDFMalformed)
+			}
+			num := start + i
+			if _, seen := d.xref[num]; seen || kind == "f" || offset == 0 {
+				continue
+			}
+			d.xref[num] = pdfXrefEntry{offset: offset, gen: gen}
+		}
+	}
+}
+
+func (d *pdfDocument) readXrefStream(stream *pdfStream) error {
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return err
+	}
+
+	widths, _ := stream.dict["W"].(pdfArray)
+	if len(widths) < 3 {
+		return fmt.Errorf("%w: bad cross-reference stream widths", errPDFMalformed)
+	}
+	var w [3]int
+	for i := range w {
+		n, _ := widths[i].(int64)
+		if n < 0 || n > 8 {
+			return fmt.Errorf("%w: bad cross-reference stream widths", errPDFMalformed)
+		}
+		w[i] = int(n)
+	}
+	rowSize := w[0] + w[1] + w[2]
+	if rowSize == 0 {
+		return fmt.Errorf("%w: bad cross-reference stream widths", errPDFMalformed)
+	}
+
+	index, _ := stream.dict["Index"].(pdfArray)
+	if len(index) == 0 {
+		size, _ := stream.dict["Size"].(int64)
+		index = pdfArray{int64(0), size}
+	}
+
+	field := func(row []byte) int {
+		value := 0
+		for _, b := range row {
+			value = value<<8 | int(b)
+		}
+		return value
+	}
+	pos := 0
+	for i := 0; i+1 < len(index); i += 2 {
+		start, _ := index[i].(int64)
+		count, _ := index[i+1].(int64)
+		for n := 0; n < int(count) && pos+rowSize <= len(data); n++ {
+			row := data[pos : pos+rowSize]
+			pos += rowSize
+			kind := 1 // Type defaults to 1 when its field is omitted
+			if w[0] > 0 {
+				kind = field(row[:w[0]])
+			}
+			second, third := field(row[w[0]:w[0]+w[1]]), field(row[w[0]+w[1]:])
+
+			num := int(start) + n
+			if _, seen := d.xref[num]; seen {
+				continue
+			}
+			switch kind {
+			case 1:
+				if second > 0 {
+					d.xref[num] = pdfXrefEntry{offset: second, gen: third}
+				}
+			case 2:
+				d.xref[num] = pdfXrefEntry{inStream: true, streamNum: second}
+			}
+		}
+	}
+	return nil
+}
+
+// reconstructXref rebuilds the cross-reference table of a damaged file by
+// scanning it for object headers. The last definition of an object wins.
+func (d *pdfDocument) reconstructXref() {
+	var streams []int
+	for _, match := range pdfObjectHeaderPattern.FindAllSubmatchIndex(d.data, -1) {
+		// Skip matches inside longer numbers, e.g. "112 0 obj" read as "12 0 obj"
+		if match[0] > 0 && d.data[match[0]-1] >= '0' && d.data[match[0]-1] <= '9' {
+			continue
+		}
+		num, _ := strconv.Atoi(string(d.data[match[2]:match[3]]))
+		gen, _ := strconv.Atoi(string(d.data[match[4]:match[5]]))
+		d.xref[num] = pdfXrefEntry{offset: match[0], gen: gen}
+		streams = append(streams, num)
+	}
+
+	for _, num := range streams {
+		obj := d.object(num)
+		switch v := obj.(type) {
+		case pdfDict:
+			if v["Type"] == pdfName("Catalog") && d.trailer["Root"] == nil {
+				d.trailer["Root"] = pdfRef{num, d.xref[num].gen}
+			}
+		case *pdfStream:
+			// Register objects of object streams that have no definition of their own
+			if v.dict["Type"] != pdfName("ObjStm") {
+				continue
+			}
+			stm := d.objectStream(num)
+			if stm == nil {
+				continue
+			}
+			for inner := range stm.offsets {
+				if _, ok := d.xref[inner]; !ok {
+					d.xref[inner] = pdfXrefEntry{inStream: true, streamNum: num}
+				}
+			}
+		}
+	}
+
+	// Trailers, if any survived, name the catalog and encryption
+	for at := 0; ; {
+		i := bytes.Index(d.data[at:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		at += i + len("trailer")
+		lexer := &pdfLexer{data: d.data, pos: at}
+		if trailer, err := lexer.readObject(true, 0); err == nil {
+			if dict, ok := trailer.(pdfDict); ok {
+				for key, value := range dict {
+					d.trailer[key] = value
+				}
+			}
+		}
+	}
+	if d.catalog() == nil {
+		for num, entry := range d.xref {
+			if dict, ok := d.object(num).(pdfDict); ok && dict["Type"] == pdfName("Catalog") {
+				d.trailer["Root"] = pdfRef{num, entry.gen}
+				break
+			}
+		}
+	}
+}
+
+// readIndirectObject reads "num gen obj ... endobj" at offset, including
+// the data of a stream
+func (d *pdfDocument) readIndirectObject(offset int) (pdfRef, any, error) {
+	if offset < 0 || offset >= len(d.data) {
+		return pdfRef{}, nil, fmt.Errorf("%w: object offset out of range", errPDFMalformed)
+	}
+	lexer := &pdfLexer{data: d.data, pos: offset}
+	num, err1 := lexer.readObject(false, 0)
+	gen, err2 := lexer.readObject(false, 0)
+	keyword, err3 := lexer.readObject(false, 0)
+	n, okNum := num.(int64)
+	g, okGen := gen.(int64)
+	if err1 != nil || err2 != nil || err3 != nil || !okNum || !okGen || keyword != pdfKeyword("obj") {
+		return pdfRef{}, nil, fmt.Errorf("%w: no object at %d", errPDFMalformed, offset)
+	}
+	ref := pdfRef{int(n), int(g)}
+
+	obj, err := lexer.readObject(true, 0)
+	if err != nil {
+		return ref, nil, err
+	}
+	dict, ok := obj.(pdfDict)
+	if !ok {
+		return ref, obj, nil
+	}
+	lexer.skipSpace()
+	if !bytes.HasPrefix(d.data[lexer.pos:], []byte("stream")) {
+		return ref, obj, nil
+	}
+
+	// Stream data starts after the end of line following "stream"
+	start := lexer.pos + len("stream")
+	if start < len(d.data) && d.data[start] == '\r' {
+		start++
+	}
+	if start < len(d.data) && d.data[start] == '\n' {
+		start++
+	}
+	end := -1
+	if length, ok := d.resolveLength(dict["Length"], ref.num); ok && length >= 0 && start+length <= len(d.data) {
+		rest := &pdfLexer{data: d.data, pos: start + length}
+		rest.skipSpace()
+		if bytes.HasPrefix(d.data[rest.pos:], []byte("endstream")) {
+			end = start + length
+		}
+	}
+	if end < 0 {
+		// Wrong or missing length: the data runs up to "endstream"
+		i := bytes.Index(d.data[start:], []byte("endstream"))
+		if i < 0 {
+			return ref, nil, fmt.Errorf("%w: unterminated stream", errPDFMalformed)
+		}
+		end = start + i
+		if end > start && d.data[end-1] == '\n' {
+			end--
+		}
+		if end > start && d.data[end-1] == '\r' {
+			end--
+		}
+	}
+	return ref, &pdfStream{dict: dict, raw: d.data[start:end], ref: ref}, nil
+}
+
+// resolveLength reads a stream's /Length, which may be an indirect object
+func (d *pdfDocument) resolveLength(v any, self int) (int, bool) {
+	if ref, ok := v.(pdfRef); ok {
+		if ref.num == self {
+			return 0, false
+		}
+		v = d.object(ref.num)
+	}
+	n, ok := v.(int64)
+	return int(n), ok
+}
+
+// object returns object num, or nil if it is missing or unreadable
+func (d *pdfDocument) object(num int) any {
+	if obj, ok := d.objects[num]; ok {
+		return obj
+	}
+	entry, ok := d.xref[num]
+	if !ok || d.loading[num] {
+		return nil
+	}
+	d.loading[num] = true
+	defer delete(d.loading, num)
+
+	var obj any
+	if entry.inStream {
+		obj = d.objectFromStream(num, entry)
+	} else {
+		ref, read, err := d.readIndirectObject(entry.offset)
+		if err == nil && ref.num == num {
+			obj = read
+			if d.crypt != nil {
+				obj = d.crypt.decryptStrings(obj, ref)
+			}
+		}
+	}
+	d.objects[num] = obj
+	return obj
+}
+
+func (d *pdfDocument) objectFromStream(num int, entry pdfXrefEntry) any {
+	stm := d.objectStream(entry.streamNum)
+	if stm == nil {
+		return nil
+	}
+	offset, ok := stm.offsets[num]
+	if !ok {
+		return nil
+	}
+	lexer := &pdfLexer{data: stm.data, pos: offset}
+	obj, err := lexer.readObject(true, 0)
+	if err != nil {
+		return nil
+	}
+	return obj
+}
+
+// objectStream decodes object stream num and indexes the objects in it
+func (d *pdfDocument) objectStream(num int) *pdfObjectStream {
+	if stm, ok := d.objStms[num]; ok {
+		return stm
+	}
+	d.objStms[num] = nil // Not retried, and not recursed into
+
+	stream, ok := d.object(num).(*pdfStream)
+	if !ok {
+		return nil
+	}
+	data, err := d.decodeStream(stream)
+	if err != nil {
+		return nil
+	}
+	count, _ := stream.dict["N"].(int64)
+	first, _ := stream.dict["First"].(int64)
+	if first < 0 || int(first) > len(data) {
+		return nil
+	}
+
+	stm := &pdfObjectStream{data: data, offsets: map[int]int{}}
+	lexer := &pdfLexer{data: data[:first]}
+	for i := 0; i < int(count); i++ {
+		objNum, err1 := lexer.readObject(false, 0)
+		objOffset, err2 := lexer.readObject(false, 0)
+		n, ok1 := objNum.(int64)
+		o, ok2 := objOffset.(int64)
+		if err1 != nil || err2 != nil || !ok1 || !ok2 {
+			break
+		}
+		if _, dup := stm.offsets[int(n)]; !dup && int(first+o) < len(data) {
+			stm.offsets[int(n)] = int(first + o)
+		}
+	}
+	d.objStms[num] = stm
+	return stm
+}
+
+// resolve follows references, returning nil for missing objects
+func (d *pdfDocument) resolve(v any) any {
+	for i := 0; i < pdfMaxNesting; i++ {
+		ref, ok := v.(pdfRef)
+		if !ok {
+			return v
+		}
+		v = d.object(ref.num)
+	}
+	return nil
+}
+
+func (d *pdfDocument) dict(v any) pdfDict {
+	switch obj := d.resolve(v).(type) {
+	case pdfDict:
+		return obj
+	case *pdfStream:
+		return obj.dict
+	}
+	return nil
+}
+
+// decodeStream returns a stream's data, decrypted and unfiltered
+func (d *pdfDocument) decodeStream(stream *pdfStream) ([]byte, error) {
+	data := stream.raw
+	if d.crypt != nil && stream.dict["Type"] != pdfName("XRef") {
+		var err error
+		if data, err = d.crypt.decryptStream(data, stream.ref, stream.dict); err != nil {
+			return nil, err
+		}
+	}
+
+	filters := d.resolve(stream.dict["Filter"])
+	params := d.resolve(stream.dict["DecodeParms"])
+	if filters == nil {
+		return data, nil
+	}
+	filterList, ok := filters.(pdfArray)
+	if !ok {
+		filterList = pdfArray{filters}
+	}
+	paramList, ok := params.(pdfArray)
+	if !ok {
+		paramList = pdfArray{params}
+	}
+
+	for i, f := range filterList {
+		name, _ := d.resolve(f).(pdfName)
+		var param pdfDict
+		if i < len(paramList) {
+			param = d.dict(paramList[i])
+		}
+		decoded, err := decodePDFFilter(name, data, param, d.decodeCap)
+		if err != nil {
+			return nil, err
+		}
+		d.decodeCap -= len(decoded)
+		if d.decodeCap < 0 {
+			return nil, fmt.Errorf("%w: decoded streams exceed %d bytes", errPDFMalformed, pdfMaxDecodedSize)
+		}
+		data = decoded
+	}
+	return data, nil
+}
+
+// errPDFImageFilter marks image data, which holds no text
+var errPDFImageFilter = errors.New("image stream")
@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"fmt"
+	"io"
+)
+
+// decodePDFFilter applies one stream filter, producing at most limit bytes.
+// Image filters return errPDFImageFilter.
+func decodePDFFilter(name pdfName, data []byte, params pdfDict, limit int) ([]byte, error) {
+	var (
+		out []byte
+		err error
+	)
+	switch name {
+	case "FlateDecode", "Fl":
+		out, err = inflatePDFStream(data, limit)
+	case "LZWDecode", "LZW":
+		earlyChange := true
+		if v, ok := params["EarlyChange"].(int64); ok && v == 0 {
+			earlyChange = false
+		}
+		out, err = decodePDFLZW(data, earlyChange, limit)
+	case "ASCIIHexDecode", "AHx":
+		lexer := &pdfLexer{data: data}
+		return lexer.hexString(), nil
+	case "ASCII85Decode", "A85":
+		return decodePDFASCII85(data)
+	case "RunLengthDecode", "RL":
+		return decodePDFRunLength(data, limit)
+	case "Crypt":
+		return data, nil // Identity; decryption already happened
+	case "DCTDecode", "DCT", "JPXDecode", "CCITTFaxDecode", "CCF", "JBIG2Decode":
+		return nil, errPDFImageFilter
+	default:
+		return nil, fmt.Errorf("%w: unsupported filter %s", errPDFMalformed, name)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return applyPDFPredictor(out, params)
+}
+
+// inflatePDFStream inflates zlib data, tolerating missing headers and
+// truncated or corrupt tails: whatever inflated cleanly is kept
+func inflatePDFStream(data []byte, limit int) ([]byte, error) {
+	var reader io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		defer zr.Close()
+		reader = zr
+	} else {
+		reader = flate.NewReader(bytes.NewReader(data))
+	}
+
+	out, err := io.ReadAll(io.LimitReader(reader, int64(limit)+1))
+	if len(out) > limit {
+		return nil, fmt.Errorf("%w: stream inflates beyond %d bytes", errPDFMalformed, limit)
+	}
+	if err != nil && len(out) == 0 {
+		return nil, fmt.Errorf("%w: corrupt compressed stream: %v", errPDFMalformed, err)
+	}
+	return out, nil
+}
+
+// applyPDFPredictor undoes the PNG and TIFF predictors of Flate and LZW data
+func applyPDFPredictor(data []byte, params pdfDict) ([]byte, error) {
+	predictor, _ := params["Predictor"].(int64)
+	if predictor <= 1 {
+		return data, nil
+	}
+	colors, bits, columns := int64(1), int64(8), int64(1)
+	if v, ok := params["Colors"].(int64); ok && v > 0 {
+		colors = v
+	}
+	if v, ok := params["BitsPerComponent"].(int64); ok && v > 0 {
+		bits = v
+	}
+	if v, ok := params["Columns"].(int64); ok && v > 0 {
+		columns = v
+	}
+	if colors > 32 || bits > 16 || columns > 1<<20 {
+		return nil, fmt.Errorf("%w: bad predictor parameters", errPDFMalformed)
+	}
+	bpp := int(max((colors*bits+7)/8, 1))
+	rowLen := int((columns*colors*bits + 7) / 8)
+
+	if predictor == 2 {
+		// TIFF predictor, for 8 bit components only
+		if bits != 8 {
+			return data, nil
+		}
+		out := append([]byte(nil), data...)
+		for row := 0; row+rowLen <= len(out); row += rowLen {
+			for i := bpp; i < rowLen; i++ {
+				out[row+i] += out[row+i-bpp]
+			}
+		}
+		return out, nil
+	}
+
+	// PNG predictors: every row starts with its filter type
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+1 <= len(data); pos += rowLen + 1 {
+		filter := data[pos]
+		end := min(pos+1+rowLen, len(data))
+		row := make([]byte, rowLen)
+		copy(row, data[pos+1:end])
+		for i := 0; i < rowLen; i++ {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch filter {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paethPredictor(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paethPredictor(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := absInt(p-int(a)), absInt(p-int(b)), absInt(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func absInt(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func decodePDFASCII85(data []byte) ([]byte, error) {
+	var out []byte
+	var group [5]byte
+	n := 0
+	for _, c := range data {
+		switch {
+		case c == '~':
+			goto done
+		case c == 'z' && n == 0:
+			out = append(out, 0, 0, 0, 0)
+			continue
+		case c < '!' || c > 'u':
+			continue // Whitespace and junk
+		}
+		group[n] = c - '!'
+		n++
+		if n == 5 {
+			out = append(out, ascii85Group(group, 4)...)
+			n = 0
+		}
+	}
+done:
+	if n > 1 {
+		for i := n; i < 5; i++ {
+			group[i] = 'u' - '!'
+		}
+		out = append(out, ascii85Group(group, n-1)...)
+	}
+	return out, nil
+}
+
+func ascii85Group(group [5]byte, keep int) []byte {
+	var value uint32
+	for _, digit := range group {
+		value = value*85 + uint32(digit)
+	}
+	word := []byte{byte(value >> 24), byte(value >> 16), byte(value >> 8), byte(value)}
+	return word[:keep]
+}
+
+func decodePDFRunLength(data []byte, limit int) ([]byte, error) {
+	var out []byte
+	for i := 0; i < len(data); {
+		length := int(data[i])
+		i++
+		switch {
+		case length == 128:
+			return out, nil
+		case length < 128:
+			end := min(i+length+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		default:
+			if i < len(data) {
+				out = append(out, bytes.Repeat([]byte{data[i]}, 257-length)...)
+			}
+			i++
+		}
+		if len(out) > limit {
+			return nil, fmt.Errorf("%w: stream decodes beyond %d bytes", errPDFMalformed, limit)
+		}
+	}
+	return out, nil
+}
+
+// decodePDFLZW decodes LZW data. PDF's variant grows the code width one code
+// early unless EarlyChange is 0, which compress/lzw does not support.
+func decodePDFLZW(data []byte, earlyChange bool, limit int) ([]byte, error) {
+	const (
+		clearCode = 256
+		endCode   = 257
+	)
+	var (
+		out    []byte
+		table  [][]byte
+		prev   []byte
+		width  = 9
+		buffer uint32
+		bits   int
+	)
+	reset := func() {
+		table = table[:0]
+		for i := 0; i < 256; i++ {
+			table = append(table, []byte{byte(i)})
+		}
+		table = append(table, nil, nil) // Clear and end codes
+		width, prev = 9, nil
+	}
+	reset()
+
+	early := 0
+	if earlyChange {
+		early = 1
+	}
+	for _, b := range data {
+		buffer = buffer<<8 | uint32(b)
+		bits += 8
+		for bits >= width {
+			code := int(buffer>>(bits-width)) & (1<<width - 1)
+			bits -= width
+			switch {
+			case code == clearCode:
+				reset()
+				continue
+			case code == endCode:
+				return out, nil
+			}
+
+			var entry []byte
+			switch {
+			case code < len(table) && table[code] != nil:
+				entry = table[code]
+			case code == len(table) && prev != nil:
+				entry = append(append([]byte(nil), prev...), prev[0])
+			default:
+				return out, nil // Corrupt; keep what decoded
+			}
+			out = append(out, entry...)
+			if len(out) > limit {
+				return nil, fmt.Errorf("%w: stream decodes beyond %d bytes", errPDFMalformed, limit)
+			}
+			if prev != nil && len(table) < 4096 {
+				table = append(table, append(append([]byte(nil), prev...), entry[0]))
+			}
+			prev = entry
+			if len(table)+early >= 1<<width && width < 12 {
+				width++
+			}
+		}
+	}
+	return out, nil
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestDecodePDFFilter(t *testing.T) {
+	// Rows of three bytes under each PNG filter type: Sub, Up, Average, Paeth
+	pngRows := []byte{
+		1, 10, 5, 5,
+		2, 1, 1, 1,
+		3, 0, 0, 0,
+		4, 0, 0, 0,
+	}
+	zlibData := deflateTestData([]byte("stream text"))
+	tests := []struct {
+		name    string
+		filter  pdfName
+		data    []byte
+		params  pdfDict
+		want    []byte
+		wantErr error
+	}{
+		// The example of the PDF reference, "-----A---B"
+		{"lzw", "LZWDecode", []byte{0x80, 0x0B, 0x60, 0x50, 0x22, 0x0C, 0x0C, 0x85, 0x01}, nil, []byte("-----A---B"), nil},
+		{"ascii85", "ASCII85Decode", []byte("87cURD_*#-\n6q/=~>"), nil, []byte("Hello, PDF!"), nil},
+		{"ascii85 zero group", "A85", []byte("z!!~>"), nil, []byte{0, 0, 0, 0, 0}, nil},
+		{"asciihex", "ASCIIHexDecode", []byte("48 65 6C 6C 6F>"), nil, []byte("Hello"), nil},
+		{"run length", "RunLengthDecode", []byte{2, 'a', 'b', 'c', 254, 'x', 128, 'z'}, nil, []byte("abcxxx"), nil},
+		{"flate", "FlateDecode", zlibData, nil, []byte("stream text"), nil},
+		{"deflate without zlib header", "Fl", zlibData[2 : len(zlibData)-4], nil, []byte("stream text"), nil},
+		{"bad checksum", "FlateDecode", append(zlibData[:len(zlibData)-4:len(zlibData)-4], 0, 0, 0, 0), nil, []byte("stream text"), nil},
+		{"png predictors", "FlateDecode", deflateTestData(pngRows), pdfDict{"Predictor": int64(15), "Columns": int64(3)},
+			[]byte{10, 15, 20, 11, 16, 21, 5, 10, 15, 5, 10, 15}, nil},
+		{"tiff predictor", "FlateDecode", deflateTestData([]byte{1, 1, 1, 5, 0, 1}), pdfDict{"Predictor": int64(2), "Columns": int64(3)}, []byte{1, 2, 3, 5, 5, 6}, nil},
+		{"image", "DCTDecode", []byte{0xff, 0xd8}, nil, nil, errPDFImageFilter},
+		{"unknown", "FooDecode", []byte("x"), nil, nil, errPDFMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := decodePDFFilter(tt.filter, tt.data, tt.params, 1<<20)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("decodePDFFilter: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Fatalf("decoded %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodePDFFilterLimit(t *testing.T) {
+	data := deflateTestData(bytes.Repeat([]byte{0}, 4096))
+	if _, err := decodePDFFilter("FlateDecode", data, nil, 1024); !errors.Is(err, errPDFMalformed) {
+		t.Fatalf("flate: err = %v, want %v", err, errPDFMalformed)
+	}
+	runs := bytes.Repeat([]byte{129, 'x'}, 64) // 128 bytes each
+	if _, err := decodePDFFilter("RunLengthDecode", runs, nil, 1024); !errors.Is(err, errPDFMalformed) {
+		t.Fatalf("run length: err = %v, want %v", err, errPDFMalformed)
+	}
+}
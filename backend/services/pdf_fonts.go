@@ -0,0 +1,514 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/unicode/norm"
+)
+
+// pdfFont maps the character codes of shown strings to text and widths
+type pdfFont struct {
+	composite bool     // Type0: multi-byte codes, widths by CID
+	codespace *pdfCMap // Code lengths of composite fonts, if known
+	utf16     bool     // Composite codes are UTF-16 (Uni*-UCS2 and -UTF16 CMaps)
+	toUnicode *pdfCMap
+	encoding  [256]string // Simple fonts
+	widths    map[int]float64
+	missing   float64 // Width of codes without one
+	scale     float64 // Glyph space to text space: 1/1000, or Type3's FontMatrix
+}
+
+// pdfCMap is the part of a CMap text extraction needs: codespace ranges and
+// bfchar/bfrange mappings to UTF-16
+type pdfCMap struct {
+	codespaces [][2][]byte
+	chars      map[string]string
+	ranges     []pdfCMapRange
+}
+
+type pdfCMapRange struct {
+	low, high []byte
+	dst       []byte   // UTF-16 of low, incremented across the range
+	names     []string // Or one entry per code
+}
+
+// pdfLigatures expands presentation forms, which would otherwise defeat
+// search on words such as "ﬁle"
+var pdfLigatures = strings.NewReplacer(
+	"ﬀ", "ff", "ﬁ", "fi", "ﬂ", "fl", "ﬃ", "ffi", "ﬄ", "ffl", "ﬅ", "st", "ﬆ", "st",
+)
+
+func (x *pdfTextExtractor) font(v any) *pdfFont {
+	ref, isRef := v.(pdfRef)
+	if isRef {
+		if font, ok := x.fonts[ref.num]; ok {
+			return font
+		}
+	}
+	font := x.loadFont(x.doc.dict(v))
+	if isRef {
+		x.fonts[ref.num] = font
+	}
+	return font
+}
+
+func (x *pdfTextExtractor) loadFont(dict pdfDict) *pdfFont {
+	d := x.doc
+	font := &pdfFont{widths: map[int]float64{}, scale: 0.001}
+	if stream, ok := d.resolve(dict["ToUnicode"]).(*pdfStream); ok {
+		if data, err := d.decodeStream(stream); err == nil {
+			font.toUnicode = parsePDFCMap(data)
+		}
+	}
+
+	subtype, _ := d.resolve(dict["Subtype"]).(pdfName)
+	if subtype == "Type0" {
+		font.composite = true
+		font.missing = 1000
+		switch encoding := d.resolve(dict["Encoding"]).(type) {
+		case pdfName:
+			font.utf16 = strings.HasPrefix(string(encoding), "Uni") &&
+				(strings.Contains(string(encoding), "UCS2") || strings.Contains(string(encoding), "UTF16"))
+		case *pdfStream:
+			if data, err := d.decodeStream(encoding); err == nil {
+				font.codespace = parsePDFCMap(data)
+			}
+		}
+		if font.codespace == nil && font.toUnicode != nil && len(font.toUnicode.codespaces) > 0 {
+			font.codespace = font.toUnicode
+		}
+
+		descendants, _ := d.resolve(dict["DescendantFonts"]).(pdfArray)
+		if len(descendants) > 0 {
+			cidFont := d.dict(descendants[0])
+			if dw, ok := pdfNumber(d.resolve(cidFont["DW"])); ok {
+				font.missing = dw
+			}
+			font.readCIDWidths(d, d.resolve(cidFont["W"]))
+		}
+		return font
+	}
+
+	if subtype == "Type3" {
+		if matrix, ok := d.resolve(dict["FontMatrix"]).(pdfArray); ok && len(matrix) > 0 {
+			if scale, ok := pdfNumber(d.resolve(matrix[0])); ok {
+				font.scale = scale
+			}
+		}
+	}
+	font.readEncoding(d, d.resolve(dict["Encoding"]))
+
+	widths, _ := d.resolve(dict["Widths"]).(pdfArray)
+	if descriptor := d.dict(dict["FontDescriptor"]); descriptor != nil {
+		font.missing, _ = pdfNumber(d.resolve(descriptor["MissingWidth"]))
+	}
+	if len(widths) > 0 {
+		first, _ := d.resolve(dict["FirstChar"]).(int64)
+		for i, w := range widths {
+			if width, ok := pdfNumber(d.resolve(w)); ok {
+				font.widths[int(first)+i] = width
+			}
+		}
+	} else {
+		// The standard 14 fonts may omit their widths; approximate them
+		baseFont, _ := d.resolve(dict["BaseFont"]).(pdfName)
+		for code := 32; code < 127; code++ {
+			if strings.Contains(string(baseFont), "Courier") {
+				font.widths[code] = 600
+			} else {
+				font.widths[code] = helveticaWidths[code-32]
+			}
+		}
+	}
+	if font.missing == 0 {
+		font.missing = 500
+	}
+	return font
+}
+
+// readCIDWidths reads the W array of a CIDFont: "c [w1 w2 ...]" and
+// "first last w" entries
+func (f *pdfFont) readCIDWidths(d *pdfDocument, w any) {
+	entries, _ := w.(pdfArray)
+	for i := 0; i < len(entries); {
+		first, ok := d.resolve(entries[i]).(int64)
+		if !ok || i+1 >= len(entries) {
+			return
+		}
+		if list, ok := d.resolve(entries[i+1]).(pdfArray); ok {
+			for j, item := range list {
+				if width, ok := pdfNumber(d.resolve(item)); ok {
+					f.widths[int(first)+j] = width
+				}
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(entries) {
+			return
+		}
+		last, _ := d.resolve(entries[i+1]).(int64)
+		width, _ := pdfNumber(d.resolve(entries[i+2]))
+		for cid := first; cid <= last && cid-first < 1<<16; cid++ {
+			f.widths[int(cid)] = width
+		}
+		i += 3
+	}
+}
+
+// readEncoding builds the code to text table of a simple font from its base
+// encoding and /Differences
+func (f *pdfFont) readEncoding(d *pdfDocument, encoding any) {
+	base := pdfName("WinAnsiEncoding")
+	var differences pdfArray
+	switch v := encoding.(type) {
+	case pdfName:
+		base = v
+	case pdfDict:
+		if name, ok := d.resolve(v["BaseEncoding"]).(pdfName); ok {
+			base = name
+		}
+		differences, _ = d.resolve(v["Differences"]).(pdfArray)
+	}
+
+	for code := 32; code < 256; code++ {
+		var r rune
+		switch base {
+		case "MacRomanEncoding":
+			r = charmap.Macintosh.DecodeByte(byte(code))
+		case "StandardEncoding":
+			if name, ok := standardEncodingNames[byte(code)]; ok {
+				f.encoding[code] = pdfGlyphText(name)
+				continue
+			}
+			if code >= 127 {
+				continue
+			}
+			r = rune(code)
+		default:
+			r = charmap.Windows1252.DecodeByte(byte(code))
+		}
+		if r != utf8.RuneError && r != 0x7F {
+			f.encoding[code] = string(r)
+		}
+	}
+
+	code := 0
+	for _, item := range differences {
+		switch v := d.resolve(item).(type) {
+		case int64:
+			code = int(v)
+		case pdfName:
+			if code >= 0 && code < 256 {
+				f.encoding[code] = pdfGlyphText(string(v))
+			}
+			code++
+		}
+	}
+}
+
+// codes splits a shown string into character codes
+func (f *pdfFont) codes(s []byte) [][]byte {
+	var codes [][]byte
+	for i := 0; i < len(s); {
+		n := 1
+		if f.composite {
+			n = 2
+			if f.codespace != nil {
+				n = f.codespace.codeLength(s[i:])
+			}
+		}
+		n = min(n, len(s)-i)
+		codes = append(codes, s[i:i+n])
+		i += n
+	}
+	return codes
+}
+
+func (f *pdfFont) text(code []byte) string {
+	if f.toUnicode != nil {
+		// Some producers map glyphs they cannot name to U+0000; the
+		// encoding may still know them
+		if text, ok := f.toUnicode.lookup(code); ok && text != "" {
+			return pdfLigatures.Replace(text)
+		}
+	}
+	switch {
+	case f.composite && f.utf16:
+		return decodeUTF16(code)
+	case f.composite:
+		return ""
+	}
+	return pdfLigatures.Replace(f.encoding[code[0]])
+}
+
+// width is the advance of code in text space units per unit of font size
+func (f *pdfFont) width(code []byte) float64 {
+	width, ok := f.widths[codeValue(code)]
+	if !ok {
+		width = f.missing
+	}
+	return width * f.scale
+}
+
+func codeValue(code []byte) int {
+	value := 0
+	for _, b := range code {
+		value = value<<8 | int(b)
+	}
+	return value
+}
+
+// parsePDFCMap reads the codespace ranges and Unicode mappings of a CMap,
+// skipping anything it does not understand
+func parsePDFCMap(data []byte) *pdfCMap {
+	cmap := &pdfCMap{chars: map[string]string{}}
+	lexer := &pdfLexer{data: data}
+	var operands []any
+	for {
+		obj, err := lexer.readObject(false, 0)
+		if errors.Is(err, errPDFDelimiter) {
+			continue
+		}
+		if err != nil {
+			return cmap
+		}
+		keyword, ok := obj.(pdfKeyword)
+		if !ok {
+			operands = append(operands, obj)
+			continue
+		}
+
+		switch keyword {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				low, ok1 := operands[i].(pdfString)
+				high, ok2 := operands[i+1].(pdfString)
+				if ok1 && ok2 && len(low) == len(high) && len(low) > 0 && len(low) <= 4 {
+					cmap.codespaces = append(cmap.codespaces, [2][]byte{low, high})
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok := operands[i].(pdfString)
+				if !ok {
+					continue
+				}
+				switch dst := operands[i+1].(type) {
+				case pdfString:
+					cmap.chars[string(src)] = decodeUTF16(dst)
+				case pdfName:
+					cmap.chars[string(src)] = pdfGlyphText(string(dst))
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				low, ok1 := operands[i].(pdfString)
+				high, ok2 := operands[i+1].(pdfString)
+				if !ok1 || !ok2 || len(low) != len(high) || len(low) == 0 {
+					continue
+				}
+				entry := pdfCMapRange{low: low, high: high}
+				switch dst := operands[i+2].(type) {
+				case pdfString:
+					entry.dst = dst
+				case pdfArray:
+					for _, item := range dst {
+						text, _ := item.(pdfString)
+						entry.names = append(entry.names, decodeUTF16(text))
+					}
+				default:
+					continue
+				}
+				cmap.ranges = append(cmap.ranges, entry)
+			}
+		}
+		operands = operands[:0]
+	}
+}
+
+// codeLength is the length of the code starting s, by the codespace ranges
+func (c *pdfCMap) codeLength(s []byte) int {
+	for n := 1; n <= 4 && n <= len(s); n++ {
+		for _, space := range c.codespaces {
+			low, high := space[0], space[1]
+			if len(low) != n {
+				continue
+			}
+			inside := true
+			for i := 0; i < n; i++ {
+				if s[i] < low[i] || s[i] > high[i] {
+					inside = false
+					break
+				}
+			}
+			if inside {
+				return n
+			}
+		}
+	}
+	if len(c.codespaces) > 0 {
+		return len(c.codespaces[0][0])
+	}
+	return 2
+}
+
+func (c *pdfCMap) lookup(code []byte) (string, bool) {
+	if text, ok := c.chars[string(code)]; ok {
+		return text, true
+	}
+	for _, r := range c.ranges {
+		if len(code) != len(r.low) || bytes.Compare(code, r.low) < 0 || bytes.Compare(code, r.high) > 0 {
+			continue
+		}
+		offset := codeValue(code) - codeValue(r.low)
+		if r.names != nil {
+			if offset < len(r.names) {
+				return r.names[offset], true
+			}
+			return "", false
+		}
+		if len(r.dst) == 0 {
+			return "", false
+		}
+		// The last UTF-16 unit counts up across the range
+		dst := append([]byte(nil), r.dst...)
+		if len(dst) >= 2 {
+			unit := int(dst[len(dst)-2])<<8 | int(dst[len(dst)-1]) + offset
+			dst[len(dst)-2], dst[len(dst)-1] = byte(unit>>8), byte(unit)
+		} else {
+			dst[0] += byte(offset)
+		}
+		return decodeUTF16(dst), true
+	}
+	return "", false
+}
+
+// decodeUTF16 decodes the UTF-16BE of CMaps; single bytes read as Latin-1
+func decodeUTF16(b []byte) string {
+	if len(b) == 1 {
+		return string(rune(b[0]))
+	}
+	units := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		units = append(units, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return strings.ReplaceAll(string(utf16.Decode(units)), "\x00", "")
+}
+
+// pdfGlyphText maps a glyph name to its text, following the Adobe glyph
+// naming conventions for the names fonts commonly use
+func pdfGlyphText(name string) string {
+	if i := strings.IndexByte(name, '.'); i > 0 {
+		name = name[:i] // Variants such as "a.sc"
+	}
+	if strings.Contains(name, "_") {
+		var out strings.Builder
+		for _, part := range strings.Split(name, "_") {
+			out.WriteString(pdfGlyphText(part))
+		}
+		return out.String()
+	}
+
+	if text, ok := glyphNames[name]; ok {
+		return text
+	}
+	if len(name) == 1 && (name[0] >= 'a' && name[0] <= 'z' || name[0] >= 'A' && name[0] <= 'Z') {
+		return name
+	}
+	if hex, ok := strings.CutPrefix(name, "uni"); ok && len(hex) >= 4 && len(hex)%4 == 0 {
+		var units []uint16
+		for i := 0; i < len(hex); i += 4 {
+			unit, err := strconv.ParseUint(hex[i:i+4], 16, 16)
+			if err != nil {
+				return ""
+			}
+			units = append(units, uint16(unit))
+		}
+		return pdfLigatures.Replace(string(utf16.Decode(units)))
+	}
+	if hex, ok := strings.CutPrefix(name, "u"); ok && len(hex) >= 4 && len(hex) <= 6 {
+		if r, err := strconv.ParseUint(hex, 16, 32); err == nil && utf8.ValidRune(rune(r)) {
+			return pdfLigatures.Replace(string(rune(r)))
+		}
+	}
+	// Accented letters: "eacute", "Ccedilla", "scaron"...
+	for accent, mark := range glyphAccents {
+		if base, ok := strings.CutSuffix(name, accent); ok && len(base) == 1 {
+			return norm.NFC.String(base + mark)
+		}
+	}
+	return ""
+}
+
+// glyphAccents maps accent suffixes of glyph names to combining marks
+var glyphAccents = map[string]string{
+	"grave": "̀", "acute": "́", "circumflex": "̂", "tilde": "̃",
+	"macron": "̄", "breve": "̆", "dotaccent": "̇", "dieresis": "̈",
+	"ring": "̊", "hungarumlaut": "̋", "caron": "̌", "cedilla": "̧",
+	"ogonek": "̨",
+}
+
+// glyphNames holds the glyph names that are neither letters, accented
+// letters nor uniXXXX
+var glyphNames = map[string]string{
+	"space": " ", "nbspace": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#",
+	"dollar": "$", "percent": "%", "ampersand": "&", "quotesingle": "'", "quoteright": "’",
+	"parenleft": "(", "parenright": ")", "asterisk": "*", "plus": "+", "comma": ",",
+	"hyphen": "-", "sfthyphen": "-", "minus": "−", "period": ".", "slash": "/",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+	"colon": ":", "semicolon": ";", "less": "<", "equal": "=", "greater": ">",
+	"question": "?", "at": "@", "bracketleft": "[", "backslash": "\\", "bracketright": "]",
+	"asciicircum": "^", "underscore": "_", "grave": "`", "quoteleft": "‘", "braceleft": "{",
+	"bar": "|", "braceright": "}", "asciitilde": "~", "exclamdown": "¡", "cent": "¢",
+	"sterling": "£", "fraction": "⁄", "yen": "¥", "florin": "ƒ", "section": "§",
+	"currency": "¤", "quotedblleft": "“", "quotedblright": "”", "quotesinglbase": "‚", "quotedblbase": "„",
+	"guillemotleft": "«", "guillemotright": "»", "guilsinglleft": "‹", "guilsinglright": "›",
+	"endash": "–", "emdash": "—", "dagger": "†", "daggerdbl": "‡", "periodcentered": "·",
+	"paragraph": "¶", "bullet": "•", "ellipsis": "…", "perthousand": "‰", "questiondown": "¿",
+	"acute": "´", "circumflex": "ˆ", "tilde": "˜", "macron": "¯", "breve": "˘",
+	"dotaccent": "˙", "dieresis": "¨", "ring": "˚", "cedilla": "¸", "hungarumlaut": "˝",
+	"ogonek": "˛", "caron": "ˇ", "AE": "Æ", "ae": "æ", "OE": "Œ",
+	"oe": "œ", "Oslash": "Ø", "oslash": "ø", "Lslash": "Ł", "lslash": "ł",
+	"dotlessi": "ı", "germandbls": "ß", "Eth": "Ð", "eth": "ð", "Thorn": "Þ",
+	"thorn": "þ", "ordfeminine": "ª", "ordmasculine": "º", "trademark": "™", "copyright": "©",
+	"registered": "®", "degree": "°", "plusminus": "±", "multiply": "×", "divide": "÷",
+	"logicalnot": "¬", "brokenbar": "¦", "mu": "µ", "onehalf": "½", "onequarter": "¼",
+	"threequarters": "¾", "onesuperior": "¹", "twosuperior": "²", "threesuperior": "³", "Euro": "€",
+	"ff": "ff", "fi": "fi", "fl": "fl", "ffi": "ffi", "ffl": "ffl",
+}
+
+// standardEncodingNames is the upper half of StandardEncoding, plus the
+// quotes where it departs from ASCII
+var standardEncodingNames = map[byte]string{
+	0x27: "quoteright", 0x60: "quoteleft",
+	0xA1: "exclamdown", 0xA2: "cent", 0xA3: "sterling", 0xA4: "fraction", 0xA5: "yen",
+	0xA6: "florin", 0xA7: "section", 0xA8: "currency", 0xA9: "quotesingle", 0xAA: "quotedblleft",
+	0xAB: "guillemotleft", 0xAC: "guilsinglleft", 0xAD: "guilsinglright", 0xAE: "fi", 0xAF: "fl",
+	0xB1: "endash", 0xB2: "dagger", 0xB3: "daggerdbl", 0xB4: "periodcentered", 0xB6: "paragraph",
+	0xB7: "bullet", 0xB8: "quotesinglbase", 0xB9: "quotedblbase", 0xBA: "quotedblright", 0xBB: "guillemotright",
+	0xBC: "ellipsis", 0xBD: "perthousand", 0xBF: "questiondown", 0xC1: "grave", 0xC2: "acute",
+	0xC3: "circumflex", 0xC4: "tilde", 0xC5: "macron", 0xC6: "breve", 0xC7: "dotaccent",
+	0xC8: "dieresis", 0xCA: "ring", 0xCB: "cedilla", 0xCD: "hungarumlaut", 0xCE: "ogonek",
+	0xCF: "caron", 0xD0: "emdash", 0xE1: "AE", 0xE3: "ordfeminine", 0xE8: "Lslash",
+	0xE9: "Oslash", 0xEA: "OE", 0xEB: "ordmasculine", 0xF1: "ae", 0xF5: "dotlessi",
+	0xF8: "lslash", 0xF9: "oslash", 0xFA: "oe", 0xFB: "germandbls",
+}
+
+// helveticaWidths are Helvetica's widths of codes 32 to 126, the fallback
+// for standard fonts embedded without /Widths
+var helveticaWidths = [95]float64{
+	278, 278, 355, 556, 556, 889, 667, 222, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	222, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
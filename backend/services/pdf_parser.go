@@ -0,0 +1,364 @@
+package services
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// PDF parser limits, bounding the work a malformed or hostile file can cause
+const (
+	pdfMaxNesting     = 64
+	pdfMaxXrefChain   = 64
+	pdfMaxDecodedSize = 256 << 20 // All streams of one document, decoded
+)
+
+var (
+	errPDFEncrypted = errors.New("pdf is password protected")
+	errPDFMalformed = errors.New("malformed pdf")
+
+	pdfObjectHeaderPattern = regexp.MustCompile(`(\d+)[ \t\r\n\f\x00]+(\d+)[ \t\r\n\f\x00]+obj\b`)
+)
+
+// PDF object types. Integers are int64, reals float64, booleans bool and
+// null nil.
+type (
+	pdfName    string
+	pdfKeyword string // Operators and other bare words
+	pdfString  []byte
+	pdfArray   []any
+	pdfDict    map[pdfName]any
+	pdfRef     struct{ num, gen int }
+	pdfStream  struct {
+		dict pdfDict
+		raw  []byte // Still filtered and, in encrypted files, encrypted
+		ref  pdfRef
+	}
+)
+
+func isPDFWhitespace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isPDFDelimiter(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// pdfLexer reads objects from a file or a content stream
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func (l *pdfLexer) eof() bool { return l.pos >= len(l.data) }
+
+func (l *pdfLexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFWhitespace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// regular reads a run of regular characters: a number, name body or keyword
+func (l *pdfLexer) regular() []byte {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFWhitespace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return l.data[start:l.pos]
+}
+
+// errPDFDelimiter is returned by readObject for a closing "]" or ">>", which
+// the enclosing array or dictionary consumes
+var errPDFDelimiter = errors.New("unexpected delimiter")
+
+// readObject reads the next object. References ("1 0 R") are recognised
+// when allowRefs is set, i.e. outside content streams.
+func (l *pdfLexer) readObject(allowRefs bool, depth int) (any, error) {
+	if depth > pdfMaxNesting {
+		return nil, fmt.Errorf("%w: objects nested too deeply", errPDFMalformed)
+	}
+	l.skipSpace()
+	if l.eof() {
+		return nil, fmt.Errorf("%w: unexpected end of data", errPDFMalformed)
+	}
+
+	switch c := l.data[l.pos]; c {
+	case '/':
+		l.pos++
+		return pdfName(decodePDFName(l.regular())), nil
+	case '(':
+		l.pos++
+		return l.literalString(), nil
+	case '<':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+			l.pos += 2
+			return l.dictionary(allowRefs, depth)
+		}
+		l.pos++
+		return l.hexString(), nil
+	case '>':
+		if l.pos+1 < len(l.data) && l.data[l.pos+1] == '>' {
+			l.pos += 2
+		} else {
+			l.pos++
+		}
+		return nil, errPDFDelimiter
+	case '[':
+		l.pos++
+		var array pdfArray
+		for {
+			item, err := l.readObject(allowRefs, depth+1)
+			if errors.Is(err, errPDFDelimiter) {
+				return array, nil
+			}
+			if err != nil {
+				return array, err
+			}
+			array = append(array, item)
+		}
+	case ']':
+		l.pos++
+		return nil, errPDFDelimiter
+	case '{', '}', ')':
+		l.pos++
+		return pdfKeyword(c), nil
+	}
+
+	word := l.regular()
+	if len(word) == 0 {
+		// A stray delimiter; skip it
+		l.pos++
+		return pdfKeyword(""), nil
+	}
+	switch string(word) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if num, ok := parsePDFNumber(word); ok {
+		if n, isInt := num.(int64); isInt && allowRefs && n >= 0 {
+			if ref, ok := l.reference(int(n)); ok {
+				return ref, nil
+			}
+		}
+		return num, nil
+	}
+	return pdfKeyword(word), nil
+}
+
+// reference completes "num gen R" after num, or leaves the lexer untouched
+func (l *pdfLexer) reference(num int) (pdfRef, bool) {
+	start := l.pos
+	l.skipSpace()
+	gen, ok := parsePDFNumber(l.regular())
+	if g, isInt := gen.(int64); ok && isInt && g >= 0 {
+		l.skipSpace()
+		if l.pos < len(l.data) && l.data[l.pos] == 'R' &&
+			(l.pos+1 == len(l.data) || isPDFWhitespace(l.data[l.pos+1]) || isPDFDelimiter(l.data[l.pos+1])) {
+			l.pos++
+			return pdfRef{num, int(g)}, true
+		}
+	}
+	l.pos = start
+	return pdfRef{}, false
+}
+
+func (l *pdfLexer) dictionary(allowRefs bool, depth int) (pdfDict, error) {
+	dict := pdfDict{}
+	for {
+		key, err := l.readObject(allowRefs, depth+1)
+		if errors.Is(err, errPDFDelimiter) {
+			return dict, nil
+		}
+		if err != nil {
+			return dict, err
+		}
+		name, ok := key.(pdfName)
+		if !ok {
+			continue // Tolerate junk between entries
+		}
+		value, err := l.readObject(allowRefs, depth+1)
+		if errors.Is(err, errPDFDelimiter) {
+			return dict, nil
+		}
+		if err != nil {
+			return dict, err
+		}
+		if value != nil {
+			dict[name] = value
+		}
+	}
+}
+
+func (l *pdfLexer) literalString() pdfString {
+	var out []byte
+	nesting := 0
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			nesting++
+			out = append(out, c)
+		case ')':
+			if nesting == 0 {
+				return out
+			}
+			nesting--
+			out = append(out, c)
+		case '\r':
+			// End of line markers read as \n
+			if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+				l.pos++
+			}
+			out = append(out, '\n')
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+				// Line continuation
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				value := int(e - '0')
+				for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+					value = value*8 + int(l.data[l.pos]-'0')
+					l.pos++
+				}
+				out = append(out, byte(value))
+			default:
+				out = append(out, e)
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+func (l *pdfLexer) hexString() pdfString {
+	var out []byte
+	var high byte
+	half := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		v, ok := hexValue(c)
+		if !ok {
+			continue
+		}
+		if half {
+			out = append(out, high<<4|v)
+		} else {
+			high = v
+		}
+		half = !half
+	}
+	if half {
+		out = append(out, high<<4)
+	}
+	return out
+}
+
+func hexValue(c byte) (byte, bool) {
+	switch {
+	case c >= '0' && c <= '9':
+		return c - '0', true
+	case c >= 'a' && c <= 'f':
+		return c - 'a' + 10, true
+	case c >= 'A' && c <= 'F':
+		return c - 'A' + 10, true
+	}
+	return 0, false
+}
+
+func decodePDFName(raw []byte) string {
+	if bytes.IndexByte(raw, '#') < 0 {
+		return string(raw)
+	}
+	out := make([]byte, 0, len(raw))
+	for i := 0; i < len(raw); i++ {
+		if raw[i] == '#' && i+2 < len(raw) {
+			h, okH := hexValue(raw[i+1])
+			lo, okL := hexValue(raw[i+2])
+			if okH && okL {
+				out = append(out, h<<4|lo)
+				i += 2
+				continue
+			}
+		}
+		out = append(out, raw[i])
+	}
+	return string(out)
+}
+
+func parsePDFNumber(word []byte) (any, bool) {
+	if len(word) == 0 {
+		return nil, false
+	}
+	c := word[0]
+	if !(c >= '0' && c <= '9' || c == '+' || c == '-' || c == '.') {
+		return nil, false
+	}
+	if n, err := strconv.ParseInt(string(word), 10, 64); err == nil {
+		return n, true
+	}
+	if f, err := strconv.ParseFloat(string(word), 64); err == nil {
+		return f, true
+	}
+	// Malformed numbers such as "--5" read as zero
+	return 0.0, true
+}
+
+// pdfNumber reads an integer or real operand
+func pdfNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
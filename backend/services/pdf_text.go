@@ -0,0 +1,468 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Content stream limits: nesting of form XObjects, and the operators one
+// document may run, which bounds forms drawn many times over
+const (
+	pdfMaxFormDepth = 8
+	pdfMaxOperators = 20_000_000
+)
+
+// pdfMatrix is an affine transform [a b c d e f]
+type pdfMatrix [6]float64
+
+var pdfIdentity = pdfMatrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m followed by n
+func (m pdfMatrix) mul(n pdfMatrix) pdfMatrix {
+	return pdfMatrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m pdfMatrix) apply(x, y float64) (float64, float64) {
+	return x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]
+}
+
+// pdfGraphicsState is the part of the graphics state that places text
+type pdfGraphicsState struct {
+	ctm         pdfMatrix
+	font        *pdfFont
+	fontSize    float64
+	charSpace   float64
+	wordSpace   float64
+	scale       float64 // Horizontal scaling, 1 for 100%
+	leading     float64
+	rise        float64
+	textMatrix  pdfMatrix
+	lineMatrix  pdfMatrix
+	resources   pdfDict
+	formDepth   int
+	fontsByName map[pdfName]*pdfFont
+}
+
+// pdfTextExtractor extracts the text of a document's pages
+type pdfTextExtractor struct {
+	doc   *pdfDocument
+	ctx   context.Context
+	fonts map[int]*pdfFont // By font dictionary object number
+	ops   int
+
+	out        strings.Builder
+	hasLast    bool
+	lastX      float64 // End of the previous glyph, in device space
+	lastY      float64
+	lastHeight float64
+}
+
+var errPDFTooComplex = fmt.Errorf("%w: content too complex", errPDFMalformed)
+
+// extractPDFPages returns the text of every page of a PDF, in page order.
+// Pages without text are empty strings, so indexes stay page numbers.
+func extractPDFPages(ctx context.Context, data []byte) (pages []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			pages, err = nil, fmt.Errorf("%w: %v", errPDFMalformed, r)
+		}
+	}()
+
+	doc, err := openPDFDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	x := &pdfTextExtractor{doc: doc, ctx: ctx, fonts: map[int]*pdfFont{}}
+	pageDicts := x.pages()
+	if len(pageDicts) == 0 {
+		return nil, fmt.Errorf("%w: no pages", errPDFMalformed)
+	}
+	for _, page := range pageDicts {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		text, err := x.pageText(page)
+		if err != nil && !errors.Is(err, errPDFMalformed) {
+			return nil, err
+		}
+		pages = append(pages, text)
+	}
+	return pages, nil
+}
+
+// pages walks the page tree, passing inherited resources down to each page
+func (x *pdfTextExtractor) pages() []pdfDict {
+	var pages []pdfDict
+	visited := map[int]bool{}
+	var walk func(node any, resources any, depth int)
+	walk = func(node any, resources any, depth int) {
+		if ref, ok := node.(pdfRef); ok {
+			if visited[ref.num] {
+				return
+			}
+			visited[ref.num] = true
+		}
+		dict := x.doc.dict(node)
+		if dict == nil || depth > pdfMaxNesting {
+			return
+		}
+		if own, ok := dict["Resources"]; ok {
+			resources = own
+		}
+
+		kids, hasKids := x.doc.resolve(dict["Kids"]).(pdfArray)
+		if dict["Type"] == pdfName("Pages") || hasKids && dict["Type"] != pdfName("Page") {
+			for _, kid := range kids {
+				walk(kid, resources, depth+1)
+			}
+			return
+		}
+		page := pdfDict{}
+		for key, value := range dict {
+			page[key] = value
+		}
+		if resources != nil {
+			page["Resources"] = resources
+		}
+		pages = append(pages, page)
+	}
+	walk(x.doc.catalog()["Pages"], nil, 0)
+	return pages
+}
+
+// pageText interprets one page's content streams. A page that fails part
+// way keeps the text read up to the failure.
+func (x *pdfTextExtractor) pageText(page pdfDict) (text string, err error) {
+	x.out.Reset()
+	x.hasLast = false
+	defer func() {
+		if r := recover(); r != nil {
+			text, err = x.out.String(), fmt.Errorf("%w: %v", errPDFMalformed, r)
+		}
+	}()
+
+	var content [][]byte
+	switch contents := x.doc.resolve(page["Contents"]).(type) {
+	case *pdfStream:
+		content = append(content, x.streamData(contents))
+	case pdfArray:
+		for _, part := range contents {
+			if stream, ok := x.doc.resolve(part).(*pdfStream); ok {
+				content = append(content, x.streamData(stream))
+			}
+		}
+	}
+	state := &pdfGraphicsState{
+		ctm:       pdfIdentity,
+		scale:     1,
+		resources: x.doc.dict(page["Resources"]),
+	}
+	err = x.run(bytes.Join(content, []byte("\n")), state)
+	return x.out.String(), err
+}
+
+func (x *pdfTextExtractor) streamData(stream *pdfStream) []byte {
+	data, err := x.doc.decodeStream(stream)
+	if err != nil {
+		return nil
+	}
+	return data
+}
+
+// run interprets a content stream, writing the text it shows
+func (x *pdfTextExtractor) run(content []byte, state *pdfGraphicsState) error {
+	lexer := &pdfLexer{data: content}
+	var stack []*pdfGraphicsState
+	var operands []any
+	for {
+		obj, err := lexer.readObject(false, 0)
+		if errors.Is(err, errPDFDelimiter) {
+			continue
+		}
+		if err != nil {
+			return nil // End of the stream
+		}
+		op, ok := obj.(pdfKeyword)
+		if !ok {
+			if len(operands) < 64 {
+				operands = append(operands, obj)
+			}
+			continue
+		}
+
+		x.ops++
+		if x.ops > pdfMaxOperators {
+			return errPDFTooComplex
+		}
+		if x.ops%100_000 == 0 {
+			if err := x.ctx.Err(); err != nil {
+				return err
+			}
+		}
+
+		nums := func(n int) ([]float64, bool) {
+			if len(operands) < n {
+				return nil, false
+			}
+			values := make([]float64, n)
+			for i, operand := range operands[len(operands)-n:] {
+				v, ok := pdfNumber(operand)
+				if !ok {
+					return nil, false
+				}
+				values[i] = v
+			}
+			return values, true
+		}
+
+		switch op {
+		case "q":
+			if len(stack) < 256 {
+				saved := *state
+				stack = append(stack, &saved)
+			}
+		case "Q":
+			if len(stack) > 0 {
+				*state = *stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+		case "cm":
+			if v, ok := nums(6); ok {
+				state.ctm = pdfMatrix(v).mul(state.ctm)
+			}
+		case "BT":
+			state.textMatrix, state.lineMatrix = pdfIdentity, pdfIdentity
+		case "Tf":
+			if len(operands) >= 2 {
+				name, _ := operands[len(operands)-2].(pdfName)
+				state.font = x.resourceFont(state, name)
+				state.fontSize, _ = pdfNumber(operands[len(operands)-1])
+			}
+		case "Tc":
+			if v, ok := nums(1); ok {
+				state.charSpace = v[0]
+			}
+		case "Tw":
+			if v, ok := nums(1); ok {
+				state.wordSpace = v[0]
+			}
+		case "Tz":
+			if v, ok := nums(1); ok {
+				state.scale = v[0] / 100
+			}
+		case "TL":
+			if v, ok := nums(1); ok {
+				state.leading = v[0]
+			}
+		case "Ts":
+			if v, ok := nums(1); ok {
+				state.rise = v[0]
+			}
+		case "Td", "TD":
+			if v, ok := nums(2); ok {
+				if op == "TD" {
+					state.leading = -v[1]
+				}
+				state.moveLine(v[0], v[1])
+			}
+		case "T*":
+			state.moveLine(0, -state.leading)
+		case "Tm":
+			if v, ok := nums(6); ok {
+				state.textMatrix, state.lineMatrix = pdfMatrix(v), pdfMatrix(v)
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				x.show(state, operands[len(operands)-1])
+			}
+		case "'":
+			state.moveLine(0, -state.leading)
+			if len(operands) >= 1 {
+				x.show(state, operands[len(operands)-1])
+			}
+		case "\"":
+			if len(operands) >= 3 {
+				state.wordSpace, _ = pdfNumber(operands[len(operands)-3])
+				state.charSpace, _ = pdfNumber(operands[len(operands)-2])
+				state.moveLine(0, -state.leading)
+				x.show(state, operands[len(operands)-1])
+			}
+		case "TJ":
+			if len(operands) >= 1 {
+				items, _ := operands[len(operands)-1].(pdfArray)
+				for _, item := range items {
+					if adjust, ok := pdfNumber(item); ok {
+						state.advance(-adjust / 1000 * state.fontSize * state.scale)
+						continue
+					}
+					x.show(state, item)
+				}
+			}
+		case "Do":
+			if len(operands) >= 1 {
+				name, _ := operands[len(operands)-1].(pdfName)
+				if err := x.drawForm(state, name); err != nil {
+					return err
+				}
+			}
+		case "BI":
+			skipPDFInlineImage(lexer)
+		}
+		operands = operands[:0]
+	}
+}
+
+func (s *pdfGraphicsState) moveLine(tx, ty float64) {
+	s.lineMatrix = pdfMatrix{1, 0, 0, 1, tx, ty}.mul(s.lineMatrix)
+	s.textMatrix = s.lineMatrix
+}
+
+func (s *pdfGraphicsState) advance(tx float64) {
+	s.textMatrix = pdfMatrix{1, 0, 0, 1, tx, 0}.mul(s.textMatrix)
+}
+
+func (x *pdfTextExtractor) resourceFont(state *pdfGraphicsState, name pdfName) *pdfFont {
+	if font, ok := state.fontsByName[name]; ok {
+		return font
+	}
+	fonts := x.doc.dict(state.resources["Font"])
+	value, ok := fonts[name]
+	if !ok {
+		return nil
+	}
+	font := x.font(value)
+	if state.fontsByName == nil {
+		state.fontsByName = map[pdfName]*pdfFont{}
+	}
+	state.fontsByName[name] = font
+	return font
+}
+
+// show writes a shown string, glyph by glyph, placing separators from the
+// gaps between glyphs
+func (x *pdfTextExtractor) show(state *pdfGraphicsState, operand any) {
+	s, ok := operand.(pdfString)
+	if !ok || state.font == nil {
+		return
+	}
+	font := state.font
+	for _, code := range font.codes(s) {
+		render := pdfMatrix{state.fontSize * state.scale, 0, 0, state.fontSize, 0, state.rise}.
+			mul(state.textMatrix).mul(state.ctm)
+		width := font.width(code)
+		startX, startY := render.apply(0, 0)
+		endX, endY := render.apply(width, 0)
+		x.glyph(font.text(code), startX, startY, endX, endY, render)
+
+		advance := width*state.fontSize + state.charSpace
+		if len(code) == 1 && code[0] == ' ' {
+			advance += state.wordSpace
+		}
+		state.advance(advance * state.scale)
+	}
+}
+
+// glyph writes one glyph's text, preceded by a line break when it sits on
+// another line than the previous glyph or by a space when it is set apart
+func (x *pdfTextExtractor) glyph(text string, startX, startY, endX, endY float64, render pdfMatrix) {
+	height := math.Hypot(render[2], render[3])
+	if height < 0.01 {
+		height = 1
+	}
+	if text == "" {
+		// Unmapped glyphs still take up room on the line
+		if x.hasLast {
+			x.lastX, x.lastY = endX, endY
+		}
+		return
+	}
+
+	if x.hasLast {
+		// Measure the gap along and across the baseline
+		dirX, dirY := render[0], render[1]
+		if length := math.Hypot(dirX, dirY); length > 0 {
+			dirX, dirY = dirX/length, dirY/length
+		} else {
+			dirX, dirY = 1, 0
+		}
+		dx, dy := startX-x.lastX, startY-x.lastY
+		along := dx*dirX + dy*dirY
+		across := -dx*dirY + dy*dirX
+		lineHeight := max(height, x.lastHeight)
+
+		switch {
+		case math.Abs(across) > 0.5*lineHeight:
+			x.out.WriteByte('\n')
+		case along > 0.15*lineHeight || along < -3*lineHeight:
+			x.out.WriteByte(' ')
+		}
+	}
+	x.out.WriteString(text)
+	x.hasLast = true
+	x.lastX, x.lastY, x.lastHeight = endX, endY, height
+}
+
+// drawForm runs a form XObject with its own resources and matrix
+func (x *pdfTextExtractor) drawForm(state *pdfGraphicsState, name pdfName) error {
+	if state.formDepth >= pdfMaxFormDepth {
+		return nil
+	}
+	xobjects := x.doc.dict(state.resources["XObject"])
+	stream, ok := x.doc.resolve(xobjects[name]).(*pdfStream)
+	if !ok || stream.dict["Subtype"] != pdfName("Form") {
+		return nil
+	}
+
+	form := *state
+	form.formDepth++
+	form.fontsByName = nil
+	if resources := x.doc.dict(stream.dict["Resources"]); resources != nil {
+		form.resources = resources
+	}
+	if matrix, ok := x.doc.resolve(stream.dict["Matrix"]).(pdfArray); ok && len(matrix) == 6 {
+		var m pdfMatrix
+		for i, v := range matrix {
+			m[i], _ = pdfNumber(x.doc.resolve(v))
+		}
+		form.ctm = m.mul(state.ctm)
+	}
+	return x.run(x.streamData(stream), &form)
+}
+
+// skipPDFInlineImage moves past the dictionary and binary data of an inline
+// image, which ends at an "EI" standing on its own
+func skipPDFInlineImage(lexer *pdfLexer) {
+	for {
+		obj, err := lexer.readObject(false, 0)
+		if err != nil && !errors.Is(err, errPDFDelimiter) {
+			return
+		}
+		if obj == pdfKeyword("ID") {
+			break
+		}
+	}
+	lexer.pos++ // The single white-space character after ID
+
+	data := lexer.data
+	for i := lexer.pos; i+1 < len(data); i++ {
+		if data[i] != 'E' || data[i+1] != 'I' || i == 0 || !isPDFWhitespace(data[i-1]) {
+			continue
+		}
+		if i+2 == len(data) || isPDFWhitespace(data[i+2]) || isPDFDelimiter(data[i+2]) {
+			lexer.pos = i + 2
+			return
+		}
+	}
+	lexer.pos = len(data)
+}
@@ -0,0 +1,474 @@
+package services
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rc4"
+	"crypto/sha256"
+	"crypto/sha512"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testPDFObject is one indirect object of a generated fixture: an object, or
+// the extra dictionary entries and data of a stream
+type testPDFObject struct {
+	body   string
+	stream []byte
+}
+
+// testPDFEncrypter encrypts the data of stream object num
+type testPDFEncrypter func(num int, data []byte) []byte
+
+// buildTestPDF writes objects 1..n with a classic cross-reference table.
+// Object 1 must be the catalog.
+func buildTestPDF(objects []testPDFObject, trailer string, encrypt testPDFEncrypter) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n%\xe2\xe3\xcf\xd3\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = buf.Len()
+		writeTestPDFObject(&buf, i+1, obj, encrypt)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R %s >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, trailer, xref)
+	return buf.Bytes()
+}
+
+// buildTestPDFWithXrefStream writes the streams of objects directly and packs
+// everything else into an object stream, indexed by a cross-reference stream
+// with the PNG Up predictor
+func buildTestPDFWithXrefStream(objects []testPDFObject) []byte {
+	objStmNum, xrefNum := len(objects)+1, len(objects)+2
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.7\n")
+	type entry struct{ kind, field2, field3 int }
+	entries := make([]entry, xrefNum+1)
+
+	var header, body bytes.Buffer
+	packed := 0
+	for i, obj := range objects {
+		num := i + 1
+		if obj.stream != nil {
+			entries[num] = entry{1, buf.Len(), 0}
+			writeTestPDFObject(&buf, num, obj, nil)
+			continue
+		}
+		fmt.Fprintf(&header, "%d %d ", num, body.Len())
+		body.WriteString(obj.body + "\n")
+		entries[num] = entry{2, objStmNum, packed}
+		packed++
+	}
+	entries[objStmNum] = entry{1, buf.Len(), 0}
+	writeTestPDFObject(&buf, objStmNum, testPDFObject{
+		body:   fmt.Sprintf("/Type /ObjStm /N %d /First %d /Filter /FlateDecode", packed, header.Len()),
+		stream: deflateTestData(append(header.Bytes(), body.Bytes()...)),
+	}, nil)
+
+	xref := buf.Len()
+	entries[xrefNum] = entry{1, xref, 0}
+	var rows []byte
+	previous := make([]byte, 7)
+	for _, e := range entries {
+		row := []byte{byte(e.kind), byte(e.field2 >> 24), byte(e.field2 >> 16), byte(e.field2 >> 8), byte(e.field2), byte(e.field3 >> 8), byte(e.field3)}
+		rows = append(rows, 2) // PNG Up
+		for i := range row {
+			rows = append(rows, row[i]-previous[i])
+		}
+		previous = row
+	}
+	writeTestPDFObject(&buf, xrefNum, testPDFObject{
+		body: fmt.Sprintf("/Type /XRef /Size %d /Root 1 0 R /W [1 4 2] /Filter /FlateDecode /DecodeParms << /Predictor 12 /Columns 7 >>",
+			xrefNum+1),
+		stream: deflateTestData(rows),
+	}, nil)
+	fmt.Fprintf(&buf, "startxref\n%d\n%%%%EOF\n", xref)
+	return buf.Bytes()
+}
+
+func writeTestPDFObject(buf *bytes.Buffer, num int, obj testPDFObject, encrypt testPDFEncrypter) {
+	if obj.stream == nil {
+		fmt.Fprintf(buf, "%d 0 obj\n%s\nendobj\n", num, obj.body)
+		return
+	}
+	data := obj.stream
+	if encrypt != nil {
+		data = encrypt(num, data)
+	}
+	fmt.Fprintf(buf, "%d 0 obj\n<< %s /Length %d >>\nstream\n%s\nendstream\nendobj\n", num, obj.body, len(data), data)
+}
+
+func deflateTestData(data []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// testPDFPages returns a catalog, a page tree and a Helvetica font (objects
+// 1 to 3) and a page with its content stream for each entry of contents
+func testPDFPages(contents ...string) []testPDFObject {
+	var kids []string
+	for i := range contents {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 4+2*i))
+	}
+	objects := []testPDFObject{
+		{body: "<< /Type /Catalog /Pages 2 0 R >>"},
+		{body: fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /Resources << /Font << /F1 3 0 R >> >> >>", strings.Join(kids, " "), len(contents))},
+		{body: "<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>"},
+	}
+	for i, content := range contents {
+		objects = append(objects,
+			testPDFObject{body: fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Contents %d 0 R >>", 5+2*i)},
+			testPDFObject{stream: []byte(content)},
+		)
+	}
+	return objects
+}
+
+const (
+	testPDFFirstPage  = "BT /F1 12 Tf 72 720 Td (Hello) Tj ( world) Tj 0 -14 Td [(Next)-250(line)] TJ ET"
+	testPDFSecondPage = "BT /F1 12 Tf 72 720 Td (Second page) Tj ET"
+)
+
+var testPDFWantPages = []string{"Hello world\nNext line", "Second page"}
+
+// --- Encryption (standard security handler, empty user password) ---
+
+// The fixtures derive their keys from the specification rather than the
+// extractor's own helpers, so a mistake there does not cancel out.
+
+var (
+	testPDFFileID = []byte("0123456789abcdef")
+	// Padding of the empty password (ISO 32000-1, 7.6.3.3)
+	testPDFPadding = []byte("\x28\xBF\x4E\x5E\x4E\x75\x8A\x41\x64\x00\x4E\x56\xFF\xFA\x01\x08" +
+		"\x2E\x2E\x00\xB6\xD0\x68\x3E\x80\x2F\x0C\xA9\xFE\x64\x53\x69\x7A")
+)
+
+// testPDFFileKey is algorithm 2 for the empty password and a 128-bit key
+// (revisions 3 and 4)
+func testPDFFileKey(owner []byte, permissions int32) []byte {
+	p := uint32(permissions)
+	h := md5.New()
+	h.Write(testPDFPadding)
+	h.Write(owner)
+	h.Write([]byte{byte(p), byte(p >> 8), byte(p >> 16), byte(p >> 24)})
+	h.Write(testPDFFileID)
+	key := h.Sum(nil)
+	for i := 0; i < 50; i++ {
+		sum := md5.Sum(key)
+		key = sum[:]
+	}
+	return key
+}
+
+// testPDFUserKey returns the U entry of revisions 3 and 4 for key
+// (algorithm 5)
+func testPDFUserKey(key []byte) []byte {
+	h := md5.New()
+	h.Write(testPDFPadding)
+	h.Write(testPDFFileID)
+	u := h.Sum(nil)
+	for i := 0; i < 20; i++ {
+		roundKey := make([]byte, len(key))
+		for j := range roundKey {
+			roundKey[j] = key[j] ^ byte(i)
+		}
+		c, _ := rc4.NewCipher(roundKey)
+		c.XORKeyStream(u, u)
+	}
+	return append(u, make([]byte, 16)...)
+}
+
+func testPDFObjectKey(key []byte, num int, aes bool) []byte {
+	h := md5.New()
+	h.Write(key)
+	h.Write([]byte{byte(num), byte(num >> 8), byte(num >> 16), 0, 0})
+	if aes {
+		h.Write([]byte("sAlT"))
+	}
+	return h.Sum(nil)[:min(len(key)+5, 16)]
+}
+
+func encryptTestAES(key, data []byte) []byte {
+	pad := aes.BlockSize - len(data)%aes.BlockSize
+	data = append(append([]byte{}, data...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	iv := []byte("fixed test iv 16")
+	block, _ := aes.NewCipher(key)
+	out := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, data)
+	return append(iv, out...)
+}
+
+// buildRC4TestPDF encrypts the fixture with 128-bit RC4 (revision 3). With
+// userPassword the U entry no longer matches the empty password.
+func buildRC4TestPDF(userPassword bool) []byte {
+	owner := bytes.Repeat([]byte{0x5a}, 32)
+	permissions := int32(-3904)
+	key := testPDFFileKey(owner, permissions)
+	u := testPDFUserKey(key)
+	if userPassword {
+		u[0] ^= 1
+	}
+
+	objects := append(testPDFPages(testPDFFirstPage, testPDFSecondPage), testPDFObject{
+		body: fmt.Sprintf("<< /Filter /Standard /V 2 /R 3 /Length 128 /O <%x> /U <%x> /P %d >>", owner, u, permissions),
+	})
+	trailer := fmt.Sprintf("/Encrypt %d 0 R /ID [<%x> <%x>]", len(objects), testPDFFileID, testPDFFileID)
+	return buildTestPDF(objects, trailer, func(num int, data []byte) []byte {
+		c, _ := rc4.NewCipher(testPDFObjectKey(key, num, false))
+		out := make([]byte, len(data))
+		c.XORKeyStream(out, data)
+		return out
+	})
+}
+
+// buildAESV2TestPDF encrypts the fixture with AES-128 crypt filters
+// (revision 4)
+func buildAESV2TestPDF() []byte {
+	owner := bytes.Repeat([]byte{0xa5}, 32)
+	permissions := int32(-1028)
+	key := testPDFFileKey(owner, permissions)
+
+	objects := append(testPDFPages(testPDFFirstPage, testPDFSecondPage), testPDFObject{
+		body: fmt.Sprintf("<< /Filter /Standard /V 4 /R 4 /Length 128 /CF << /StdCF << /CFM /AESV2 /Length 16 >> >> /StmF /StdCF /StrF /StdCF /O <%x> /U <%x> /P %d >>",
+			owner, testPDFUserKey(key), permissions),
+	})
+	trailer := fmt.Sprintf("/Encrypt %d 0 R /ID [<%x> <%x>]", len(objects), testPDFFileID, testPDFFileID)
+	return buildTestPDF(objects, trailer, func(num int, data []byte) []byte {
+		return encryptTestAES(testPDFObjectKey(key, num, true), data)
+	})
+}
+
+// buildAES256TestPDF encrypts the fixture with AES-256 (revision 5 or 6)
+func buildAES256TestPDF(revision int) []byte {
+	fileKey := []byte("0123456789abcdef0123456789abcdef")
+	salts := []byte("validatekeysalt!")
+	u := append(testPDFAES256Hash(revision, salts[:8]), salts...)
+	block, _ := aes.NewCipher(testPDFAES256Hash(revision, salts[8:]))
+	ue := make([]byte, 32)
+	cipher.NewCBCEncrypter(block, make([]byte, aes.BlockSize)).CryptBlocks(ue, fileKey)
+
+	objects := append(testPDFPages(testPDFFirstPage, testPDFSecondPage), testPDFObject{
+		body: fmt.Sprintf("<< /Filter /Standard /V 5 /R %d /Length 256 /CF << /StdCF << /CFM /AESV3 /Length 32 >> >> /StmF /StdCF /StrF /StdCF /O <%x> /U <%x> /OE <%x> /UE <%x> /Perms <%x> /P -1028 >>",
+			revision, make([]byte, 48), u, make([]byte, 32), ue, make([]byte, 16)),
+	})
+	return buildTestPDF(objects, fmt.Sprintf("/Encrypt %d 0 R", len(objects)), func(num int, data []byte) []byte {
+		return encryptTestAES(fileKey, data)
+	})
+}
+
+// testPDFAES256Hash hashes the empty password with salt: SHA-256 for
+// revision 5, algorithm 2.B of ISO 32000-2 for revision 6
+func testPDFAES256Hash(revision int, salt []byte) []byte {
+	sum := sha256.Sum256(salt)
+	k := sum[:]
+	if revision == 5 {
+		return k
+	}
+	for round := 0; ; round++ {
+		k1 := bytes.Repeat(k, 64) // Password and user key data are empty
+		block, _ := aes.NewCipher(k[:16])
+		e := make([]byte, len(k1))
+		cipher.NewCBCEncrypter(block, k[16:32]).CryptBlocks(e, k1)
+
+		var remainder int
+		for _, b := range e[:16] {
+			remainder += int(b)
+		}
+		switch remainder % 3 {
+		case 0:
+			s := sha256.Sum256(e)
+			k = s[:]
+		case 1:
+			s := sha512.Sum384(e)
+			k = s[:]
+		case 2:
+			s := sha512.Sum512(e)
+			k = s[:]
+		}
+		if round >= 63 && int(e[len(e)-1]) <= round-31 {
+			return k[:32]
+		}
+	}
+}
+
+// buildToUnicodeTestPDF shows two-byte codes of a Type0 font whose ToUnicode
+// CMap has bfchar, bfrange and array bfrange entries and a ligature
+func buildToUnicodeTestPDF() []byte {
+	cmap := `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+/CMapName /Test-UCS def
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+4 beginbfchar
+<0001> <0048>
+<0002> <00E9>
+<0003> <006C>
+<0007> <FB01>
+endbfchar
+2 beginbfrange
+<0004> <0006> <006D>
+<0008> <000A> [<0020> <0021> <0065>]
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+	return buildTestPDF([]testPDFObject{
+		{body: "<< /Type /Catalog /Pages 2 0 R >>"},
+		{body: "<< /Type /Pages /Kids [3 0 R] /Count 1 >>"},
+		{body: "<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 4 0 R >> >> /Contents 7 0 R >>"},
+		{body: "<< /Type /Font /Subtype /Type0 /BaseFont /TestSans /Encoding /Identity-H /DescendantFonts [5 0 R] /ToUnicode 6 0 R >>"},
+		{body: "<< /Type /Font /Subtype /CIDFontType2 /BaseFont /TestSans /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /DW 500 >>"},
+		{body: "/Filter /FlateDecode", stream: deflateTestData([]byte(cmap))},
+		// H é l l o(range) space fi l e ! -> "Héllo file!"
+		{stream: []byte("BT /F1 12 Tf 72 720 Td <00010002000300030006000800070003000A0009> Tj ET")},
+	}, "", nil)
+}
+
+func TestExtractPDFPages(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want []string
+	}{
+		{"plain", buildTestPDF(testPDFPages(testPDFFirstPage, testPDFSecondPage), "", nil), testPDFWantPages},
+		{"xref and object streams", buildTestPDFWithXrefStream(testPDFPages(testPDFFirstPage, testPDFSecondPage)), testPDFWantPages},
+		{"rc4 with empty user password", buildRC4TestPDF(false), testPDFWantPages},
+		{"aes-128 with empty user password", buildAESV2TestPDF(), testPDFWantPages},
+		{"aes-256 revision 5", buildAES256TestPDF(5), testPDFWantPages},
+		{"aes-256 revision 6", buildAES256TestPDF(6), testPDFWantPages},
+		{"tounicode cmap", buildToUnicodeTestPDF(), []string{"Héllo file!"}},
+		{"page without text", buildTestPDF(testPDFPages(testPDFFirstPage, "q 0 0 10 10 re f Q"), "", nil), []string{"Hello world\nNext line", ""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pages, err := extractPDFPages(context.Background(), tt.data)
+			if err != nil {
+				t.Fatalf("extractPDFPages: %v", err)
+			}
+			if len(pages) != len(tt.want) {
+				t.Fatalf("got %d pages %q, want %d", len(pages), pages, len(tt.want))
+			}
+			for i := range pages {
+				if got := strings.TrimSpace(pages[i]); got != tt.want[i] {
+					t.Errorf("page %d = %q, want %q", i+1, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestExtractPDFPagesWithUserPassword(t *testing.T) {
+	_, err := extractPDFPages(context.Background(), buildRC4TestPDF(true))
+	if !errors.Is(err, errPDFEncrypted) {
+		t.Fatalf("err = %v, want %v", err, errPDFEncrypted)
+	}
+}
+
+func TestExtractPDFPagesRebuildsDamagedXref(t *testing.T) {
+	data := buildTestPDF(testPDFPages(testPDFFirstPage, testPDFSecondPage), "", nil)
+	data = bytes.Replace(data, []byte("startxref\n"), []byte("startxref\n9"), 1)
+
+	pages, err := extractPDFPages(context.Background(), data)
+	if err != nil {
+		t.Fatalf("extractPDFPages: %v", err)
+	}
+	if len(pages) != 2 || strings.TrimSpace(pages[1]) != testPDFWantPages[1] {
+		t.Fatalf("pages = %q", pages)
+	}
+}
+
+// checkPDFError fails the test unless err is nil or one of the extractor's
+// own errors. Panics are recovered into errPDFMalformed, so a runtime error
+// in the message is a bug too.
+func checkPDFError(t *testing.T, err error) {
+	t.Helper()
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, errPDFMalformed) && !errors.Is(err, errPDFEncrypted) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if strings.Contains(err.Error(), "runtime error") {
+		t.Fatalf("extractor panicked: %v", err)
+	}
+}
+
+func TestExtractPDFPagesMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"not a pdf", []byte("hello, world")},
+		{"header only", []byte("%PDF-1.7\n")},
+		{"garbage after header", []byte("%PDF-1.4\n<< /Root 1 0 R >> ] ) obj endobj stream\x00\xff")},
+		{"no catalog", []byte("%PDF-1.4\n1 0 obj\n<< /Type /Font >>\nendobj\ntrailer\n<< /Root 1 0 R >>\n%%EOF")},
+		{"unterminated dictionary", []byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages << << << <<")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := extractPDFPages(context.Background(), tt.data)
+			if !errors.Is(err, errPDFMalformed) {
+				t.Fatalf("err = %v, want %v", err, errPDFMalformed)
+			}
+			checkPDFError(t, err)
+		})
+	}
+}
+
+func TestExtractPDFPagesTruncated(t *testing.T) {
+	fixtures := map[string][]byte{
+		"plain":       buildTestPDF(testPDFPages(testPDFFirstPage, testPDFSecondPage), "", nil),
+		"xref stream": buildTestPDFWithXrefStream(testPDFPages(testPDFFirstPage, testPDFSecondPage)),
+		"aes":         buildAESV2TestPDF(),
+		"tounicode":   buildToUnicodeTestPDF(),
+	}
+	for name, data := range fixtures {
+		t.Run(name, func(t *testing.T) {
+			for n := 0; n < len(data); n += 7 {
+				_, err := extractPDFPages(context.Background(), data[:n])
+				checkPDFError(t, err)
+			}
+		})
+	}
+}
+
+func TestExtractPDFPagesCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	data := buildTestPDF(testPDFPages(testPDFFirstPage), "", nil)
+	if _, err := extractPDFPages(ctx, data); !errors.Is(err, context.Canceled) {
+		t.Fatalf("err = %v, want %v", err, context.Canceled)
+	}
+}
+
+func FuzzExtractPDFPages(f *testing.F) {
+	f.Add(buildTestPDF(testPDFPages(testPDFFirstPage, testPDFSecondPage), "", nil))
+	f.Add(buildTestPDFWithXrefStream(testPDFPages(testPDFFirstPage)))
+	f.Add(buildRC4TestPDF(false))
+	f.Add(buildAESV2TestPDF())
+	f.Add(buildToUnicodeTestPDF())
+	f.Add([]byte("%PDF-1.4\n1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		_, err := extractPDFPages(context.Background(), data)
+		checkPDFError(t, err)
+	})
+}
@@ -0,0 +1,141 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// defaultPermissionCacheTTL bounds how stale a cached entry can get. Local
+// changes invalidate the cache immediately; the TTL covers changes made on
+// other instances. Override with PERMISSION_CACHE_TTL_SECONDS.
+const defaultPermissionCacheTTL = 30 * time.Second
+
+// ErrUserInactive is returned when resolving access for a deactivated user.
+var ErrUserInactive = errors.New("user account is deactivated")
+
+// Access is what a user may do right now, resolved from their role.
+type Access struct {
+	UserID       primitive.ObjectID
+	CompanyID    primitive.ObjectID
+	RoleID       primitive.ObjectID
+	RoleName     string
+	Permissions  []string
+	IsSuperAdmin bool
+}
+
+// HasPermission reports whether the access includes permission.
+func (a *Access) HasPermission(permission string) bool {
+	return slices.Contains(a.Permissions, permission)
+}
+
+type userAccessEntry struct {
+	companyID    primitive.ObjectID
+	roleID       primitive.ObjectID
+	isSuperAdmin bool
+	isActive     bool
+	expiresAt    time.Time
+}
+
+type rolePermissionsEntry struct {
+	name        string
+	permissions []string
+	expiresAt   time.Time
+}
+
+// permissionCache keeps users' role assignments and roles' permissions
+// separately, so that a role change invalidates one entry instead of every
+// user holding the role.
+var permissionCache = struct {
+	sync.Mutex
+	users map[primitive.ObjectID]userAccessEntry
+	roles map[primitive.ObjectID]rolePermissionsEntry
+}{
+	users: map[primitive.ObjectID]userAccessEntry{},
+	roles: map[primitive.ObjectID]rolePermissionsEntry{},
+}
+
+func permissionCacheTTL() time.Duration {
+	return time.Duration(envInt("PERMISSION_CACHE_TTL_SECONDS", int(defaultPermissionCacheTTL/time.Second))) * time.Second
+}
+
+// ResolveAccess returns a user's current role and permissions.
+func ResolveAccess(userID primitive.ObjectID) (*Access, error) {
+	now := time.Now()
+
+	permissionCache.Lock()
+	user, userCached := permissionCache.users[userID]
+	permissionCache.Unlock()
+
+	if !userCached || now.After(user.expiresAt) {
+		u, err := GetUserByID(userID)
+		if err != nil {
+			return nil, err
+		}
+		user = userAccessEntry{
+			companyID:    u.CompanyID,
+			roleID:       u.RoleID,
+			isSuperAdmin: u.IsSuperAdmin,
+			isActive:     u.IsActive,
+			expiresAt:    now.Add(permissionCacheTTL()),
+		}
+		permissionCache.Lock()
+		permissionCache.users[userID] = user
+		permissionCache.Unlock()
+	}
+	if !user.isActive {
+		return nil, ErrUserInactive
+	}
+
+	permissionCache.Lock()
+	role, roleCached := permissionCache.roles[user.roleID]
+	permissionCache.Unlock()
+
+	if !roleCached || now.After(role.expiresAt) {
+		r, err := GetRoleByID(user.roleID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			// A missing role grants nothing rather than failing the request
+			r = &models.Role{Permissions: []string{}}
+		} else if err != nil {
+			return nil, err
+		}
+		role = rolePermissionsEntry{
+			name:        r.Name,
+			permissions: r.Permissions,
+			expiresAt:   now.Add(permissionCacheTTL()),
+		}
+		permissionCache.Lock()
+		permissionCache.roles[user.roleID] = role
+		permissionCache.Unlock()
+	}
+
+	return &Access{
+		UserID:       userID,
+		CompanyID:    user.companyID,
+		RoleID:       user.roleID,
+		RoleName:     role.name,
+		Permissions:  role.permissions,
+		IsSuperAdmin: user.isSuperAdmin,
+	}, nil
+}
+
+// InvalidateUserAccess drops a user's cached role assignment. Call it after
+// changing a user's role, status or super admin flag.
+func InvalidateUserAccess(userID primitive.ObjectID) {
+	permissionCache.Lock()
+	delete(permissionCache.users, userID)
+	permissionCache.Unlock()
+}
+
+// InvalidateRoleAccess drops a role's cached permissions. Call it after
+// changing or deleting a role.
+func InvalidateRoleAccess(roleID primitive.ObjectID) {
+	permissionCache.Lock()
+	delete(permissionCache.roles, roleID)
+	permissionCache.Unlock()
+}
@@ -0,0 +1,54 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"os"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func TestResolveAccessRoleLookup(t *testing.T) {
+	setupTestDB(t)
+
+	user := models.User{ID: primitive.NewObjectID(), CompanyID: primitive.NewObjectID(), RoleID: primitive.NewObjectID(), IsActive: true}
+	mustInsert(t, userCollection, user)
+	t.Cleanup(func() {
+		InvalidateUserAccess(user.ID)
+		InvalidateRoleAccess(user.RoleID)
+	})
+
+	// A role that failed to load must not be cached as granting nothing
+	healthy := roleCollection
+	client, err := mongo.Connect(context.Background(), options.Client().ApplyURI(os.Getenv("TEST_MONGODB_URI")))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	client.Disconnect(context.Background())
+	roleCollection = client.Database(healthy.Database().Name()).Collection(healthy.Name())
+	_, err = ResolveAccess(user.ID)
+	roleCollection = healthy
+	if err == nil {
+		t.Fatal("ResolveAccess succeeded while the role could not be loaded")
+	}
+
+	mustInsert(t, roleCollection, models.Role{ID: user.RoleID, CompanyID: user.CompanyID, Name: "Editors", Permissions: []string{models.PermissionViewUsers}})
+	access, err := ResolveAccess(user.ID)
+	if err != nil || !access.HasPermission(models.PermissionViewUsers) {
+		t.Fatalf("access = %+v, err %v; want the role's permissions", access, err)
+	}
+
+	// A role that no longer exists grants nothing
+	if _, err := roleCollection.DeleteOne(context.Background(), bson.M{"_id": user.RoleID}); err != nil {
+		t.Fatalf("delete role: %v", err)
+	}
+	InvalidateRoleAccess(user.RoleID)
+	access, err = ResolveAccess(user.ID)
+	if err != nil || len(access.Permissions) != 0 {
+		t.Fatalf("access = %+v, err %v; want no permissions", access, err)
+	}
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Registered provider names (CompanySettings.LLMProvider).
+const (
+	ProviderEnterpriseAssistant = "enterprise_assistant"
+	ProviderGemini              = "gemini"
+	ProviderOpenAI              = "openai"
+	ProviderEcho                = "echo"
+)
+
+// ErrNotSupported is returned by providers for operations they cannot perform,
+// e.g. embeddings on the enterprise assistant, which embeds upstream.
+var ErrNotSupported = errors.New("operation not supported by provider")
+
+// CompletionRequest is a provider-neutral chat completion request.
+type CompletionRequest struct {
+	CompanyID    string
+	Prompt       string             // The new user message
+	History      ConversationWindow // Prior turns sent as context
+	SystemPrompt string             // Empty means the provider default (SystemPrompt)
+	Model        string             // Empty means the provider default model
+	TopK         int                // Retrieval depth for RAG providers
+	Access       *RetrievalFilter   // Documents the asking user may not be answered from
+}
+
+// CompletionResponse is a provider-neutral completion result. Token counts are
+// zero when the upstream does not report usage, until estimateUsage fills them.
+type CompletionResponse struct {
+	Content          string
+	Provider         string
+	Model            string
+	PromptTokens     int
+	CompletionTokens int
+	TokensEstimated  bool // Token counts were estimated locally
+	FallbackHop      int  // Index in the company's fallback chain that answered (0 = primary)
+}
+
+// TotalTokens is the prompt plus completion token count.
+func (r *CompletionResponse) TotalTokens() int {
+	return r.PromptTokens + r.CompletionTokens
+}
+
+// ModelLabel is the "provider/model" string stored in Message.ModelUsed.
+func (r *CompletionResponse) ModelLabel() string {
+	if r.Model == "" {
+		return r.Provider
+	}
+	return r.Provider + "/" + r.Model
+}
+
+// Provider is implemented by every LLM backend the assistant can talk to.
+type Provider interface {
+	// Name is the registry key, e.g. "gemini".
+	Name() string
+	// Generate returns a complete answer.
+	Generate(ctx context.Context, req CompletionRequest) (*CompletionResponse, error)
+	// Stream calls onChunk for each fragment and returns the assembled answer.
+	Stream(ctx context.Context, req CompletionRequest, onChunk func(string) error) (*CompletionResponse, error)
+	// Embed returns one vector per input text.
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// CountTokens returns the provider's token count for text.
+	CountTokens(ctx context.Context, text string) (int, error)
+}
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]Provider{}
+)
+
+// RegisterProvider adds (or replaces) a provider in the registry.
+func RegisterProvider(p Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[p.Name()] = p
+}
+
+// GetProvider looks up a registered provider by name.
+func GetProvider(name string) (Provider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("llm provider %q is not registered", name)
+	}
+	return p, nil
+}
+
+// RegisteredProviders returns the names of all registered providers, sorted.
+func RegisteredProviders() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// InitProviders registers the built-in providers. Gemini and the
+// OpenAI-compatible provider are only registered when configured, and the echo
+// provider only when ENABLE_ECHO_PROVIDER=true, so that companies cannot pick
+// it in production. Init calls it; handler tests call it alone.
+func InitProviders() {
+	RegisterProvider(&enterpriseAssistantProvider{})
+	RegisterProvider(&unavailableProvider{})
+	if strings.EqualFold(os.Getenv("ENABLE_ECHO_PROVIDER"), "true") {
+		RegisterProvider(&echoProvider{})
+	}
+
+	if geminiModel != nil {
+		RegisterProvider(&geminiProvider{})
+	}
+	if openAI := newOpenAIProviderFromEnv(); openAI != nil {
+		RegisterProvider(openAI)
+	}
+
+	log.Printf("LLM providers registered: %s (default: %s)", strings.Join(RegisteredProviders(), ", "), defaultProviderName())
+}
+
+// defaultProviderName is the provider used when a company has not chosen one.
+// LLM_PROVIDER overrides it; CHAT_BACKEND=gemini is honoured for older deployments.
+func defaultProviderName() string {
+	if name := strings.TrimSpace(os.Getenv("LLM_PROVIDER")); name != "" {
+		return name
+	}
+	if strings.EqualFold(os.Getenv("CHAT_BACKEND"), ProviderGemini) {
+		return ProviderGemini
+	}
+	return ProviderEnterpriseAssistant
+}
+
+// ProviderForCompany resolves the chat provider configured in a company's
+// settings, falling back to the platform default (and finally the enterprise
+// assistant) when the setting is empty or names an unregistered provider.
+func ProviderForCompany(company *models.Company) Provider {
+	if company != nil && company.Settings.LLMProvider != "" {
+		if p, err := GetProvider(company.Settings.LLMProvider); err == nil {
+			return p
+		}
+		log.Printf("Warning: company %s uses unknown llm provider %q; using default", company.ID.Hex(), company.Settings.LLMProvider)
+	}
+	if p, err := GetProvider(defaultProviderName()); err == nil {
+		return p
+	}
+	p, _ := GetProvider(ProviderEnterpriseAssistant)
+	return p
+}
+
+// SummaryProviderForCompany picks a general-purpose model for tasks such as
+// document summaries. The enterprise assistant only answers retrieval queries,
+// so companies routed to it summarise with Gemini when that is available.
+func SummaryProviderForCompany(company *models.Company) Provider {
+	p := ProviderForCompany(company)
+	if p.Name() != ProviderEnterpriseAssistant {
+		return p
+	}
+	if gemini, err := GetProvider(ProviderGemini); err == nil {
+		return gemini
+	}
+	return p
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"hash/fnv"
+	"strings"
+)
+
+const (
+	echoModel          = "echo-1"
+	echoEmbeddingWidth = 8
+)
+
+// echoProvider is a deterministic provider for tests and local development.
+// It repeats the prompt back and never calls the network.
+type echoProvider struct{}
+
+func (p *echoProvider) Name() string { return ProviderEcho }
+
+func (p *echoProvider) Generate(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	content := "Echo: " + req.Prompt
+	return &CompletionResponse{
+		Content:          content,
+		Provider:         ProviderEcho,
+		Model:            echoModel,
+		PromptTokens:     EstimateTokens(req.Prompt),
+		CompletionTokens: EstimateTokens(content),
+	}, nil
+}
+
+func (p *echoProvider) Stream(ctx context.Context, req CompletionRequest, onChunk func(string) error) (*CompletionResponse, error) {
+	full, err := p.Generate(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	response := *full
+	var sent strings.Builder
+	for _, word := range strings.SplitAfter(full.Content, " ") {
+		if err := ctx.Err(); err != nil {
+			response.Content = sent.String()
+			return &response, err
+		}
+		sent.WriteString(word)
+		if err := onChunk(word); err != nil {
+			response.Content = sent.String()
+			return &response, err
+		}
+	}
+	return &response, nil
+}
+
+// Embed returns small stable vectors derived from an FNV hash of each text.
+func (p *echoProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	vectors := make([][]float32, len(texts))
+	for i, text := range texts {
+		h := fnv.New64a()
+		h.Write([]byte(text))
+		sum := h.Sum64()
+
+		vector := make([]float32, echoEmbeddingWidth)
+		for j := range vector {
+			vector[j] = float32((sum>>(uint(j)*8))&0xff) / 255
+		}
+		vectors[i] = vector
+	}
+	return vectors, nil
+}
+
+func (p *echoProvider) CountTokens(ctx context.Context, text string) (int, error) {
+	return EstimateTokens(text), nil
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"context"
+)
+
+// enterpriseAssistantModel is the model label for answers from the Python RAG backend.
+const enterpriseAssistantModel = "rag"
+
+// enterpriseAssistantProvider answers through the Python Enterprise Assistant
+// (retrieval-augmented generation over the company knowledge base).
+type enterpriseAssistantProvider struct{}
+
+func (p *enterpriseAssistantProvider) Name() string { return ProviderEnterpriseAssistant }
+
+func (p *enterpriseAssistantProvider) Generate(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	result, err := queryEnterpriseAssistant(ctx, enterpriseAssistantQueryRequest{
+		CompanyID:      req.CompanyID,
+		Message:        req.Prompt,
+		TopK:           enterpriseTopK(req),
+		History:        req.History.Turns,
+		HistorySummary: req.History.Summary,
+		Filter:         req.Access,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &CompletionResponse{
+		Content:  result.Answer,
+		Provider: ProviderEnterpriseAssistant,
+		Model:    enterpriseAssistantModel,
+	}, nil
+}
+
+func (p *enterpriseAssistantProvider) Stream(ctx context.Context, req CompletionRequest, onChunk func(string) error) (*CompletionResponse, error) {
+	response := &CompletionResponse{Provider: ProviderEnterpriseAssistant, Model: enterpriseAssistantModel}
+
+	var received []byte
+	result, err := StreamEnterpriseAssistant(ctx, req.CompanyID, req.Prompt, req.History, enterpriseTopK(req), req.Access, func(chunk string) error {
+		received = append(received, chunk...)
+		return onChunk(chunk)
+	})
+	if err != nil {
+		response.Content = string(received)
+		return response, err
+	}
+	response.Content = result.Answer
+	return response, nil
+}
+
+// Embed is not supported: the Python backend embeds documents itself.
+func (p *enterpriseAssistantProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *enterpriseAssistantProvider) CountTokens(ctx context.Context, text string) (int, error) {
+	return EstimateTokens(text), nil
+}
+
+func enterpriseTopK(req CompletionRequest) int {
+	if req.TopK > 0 {
+		return req.TopK
+	}
+	return 3
+}
@@ -0,0 +1,152 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/generative-ai-go/genai"
+	"google.golang.org/api/iterator"
+)
+
+const defaultGeminiEmbeddingModel = "text-embedding-004"
+
+// geminiProvider talks to Google Gemini through the shared geminiClient.
+type geminiProvider struct{}
+
+func (p *geminiProvider) Name() string { return ProviderGemini }
+
+func (p *geminiProvider) model(req CompletionRequest) (*genai.GenerativeModel, string) {
+	name := req.Model
+	model := geminiModel
+	if name == "" {
+		name = defaultGeminiModel
+	} else if name != defaultGeminiModel {
+		model = newGeminiModel(name)
+	}
+	if req.SystemPrompt != "" {
+		// Copy so the shared model keeps the default system prompt.
+		custom := *model
+		custom.SystemInstruction = &genai.Content{Parts: []genai.Part{genai.Text(req.SystemPrompt)}}
+		model = &custom
+	}
+	return model, name
+}
+
+func (p *geminiProvider) Generate(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	if geminiModel == nil {
+		return nil, errors.New("AI client not initialized")
+	}
+
+	model, name := p.model(req)
+	chat := model.StartChat()
+	chat.History = req.History.ToGeminiHistory()
+
+	resp, err := chat.SendMessage(ctx, genai.Text(req.Prompt))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate content: %w", err)
+	}
+
+	content := geminiResponseText(resp)
+	if content == "" {
+		return nil, errors.New("received an empty response from Gemini API")
+	}
+
+	result := &CompletionResponse{Content: content, Provider: ProviderGemini, Model: name}
+	applyGeminiUsage(result, resp)
+	return result, nil
+}
+
+func (p *geminiProvider) Stream(ctx context.Context, req CompletionRequest, onChunk func(string) error) (*CompletionResponse, error) {
+	if geminiModel == nil {
+		return nil, errors.New("AI client not initialized")
+	}
+
+	model, name := p.model(req)
+	chat := model.StartChat()
+	chat.History = req.History.ToGeminiHistory()
+
+	result := &CompletionResponse{Provider: ProviderGemini, Model: name}
+	var reply strings.Builder
+	iter := chat.SendMessageStream(ctx, genai.Text(req.Prompt))
+	for {
+		resp, err := iter.Next()
+		if errors.Is(err, iterator.Done) {
+			break
+		}
+		if err != nil {
+			result.Content = reply.String()
+			return result, fmt.Errorf("failed to stream content: %w", err)
+		}
+
+		if text := geminiResponseText(resp); text != "" {
+			reply.WriteString(text)
+			if err := onChunk(text); err != nil {
+				result.Content = reply.String()
+				return result, err
+			}
+		}
+	}
+
+	result.Content = reply.String()
+	if result.Content == "" {
+		return nil, errors.New("received an empty response from Gemini API")
+	}
+	applyGeminiUsage(result, iter.MergedResponse())
+	return result, nil
+}
+
+func (p *geminiProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if geminiClient == nil {
+		return nil, errors.New("AI client not initialized")
+	}
+
+	batch := geminiClient.EmbeddingModel(defaultGeminiEmbeddingModel).NewBatch()
+	for _, text := range texts {
+		batch.AddContent(genai.Text(text))
+	}
+	resp, err := geminiClient.EmbeddingModel(defaultGeminiEmbeddingModel).BatchEmbedContents(ctx, batch)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed content: %w", err)
+	}
+
+	vectors := make([][]float32, 0, len(resp.Embeddings))
+	for _, embedding := range resp.Embeddings {
+		vectors = append(vectors, embedding.Values)
+	}
+	return vectors, nil
+}
+
+func (p *geminiProvider) CountTokens(ctx context.Context, text string) (int, error) {
+	if geminiModel == nil {
+		return EstimateTokens(text), nil
+	}
+	resp, err := geminiModel.CountTokens(ctx, genai.Text(text))
+	if err != nil {
+		return 0, err
+	}
+	return int(resp.TotalTokens), nil
+}
+
+// geminiResponseText concatenates the text parts of the first candidate.
+func geminiResponseText(resp *genai.GenerateContentResponse) string {
+	if resp == nil || len(resp.Candidates) == 0 || resp.Candidates[0].Content == nil {
+		return ""
+	}
+	var out strings.Builder
+	for _, part := range resp.Candidates[0].Content.Parts {
+		if text, ok := part.(genai.Text); ok {
+			out.WriteString(string(text))
+		}
+	}
+	return out.String()
+}
+
+func applyGeminiUsage(result *CompletionResponse, resp *genai.GenerateContentResponse) {
+	if resp == nil || resp.UsageMetadata == nil {
+		return
+	}
+	result.PromptTokens = int(resp.UsageMetadata.PromptTokenCount)
+	result.CompletionTokens = int(resp.UsageMetadata.CandidatesTokenCount)
+}
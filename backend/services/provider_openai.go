@@ -0,0 +1,242 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultOpenAIBaseURL        = "https://api.openai.com/v1"
+	defaultOpenAIModel          = "gpt-4o-mini"
+	defaultOpenAIEmbeddingModel = "text-embedding-3-small"
+)
+
+// openAIProvider speaks the OpenAI chat completions API, which is also served
+// by OpenRouter, vLLM, Ollama, LiteLLM and most self-hosted gateways.
+type openAIProvider struct {
+	baseURL        string
+	apiKey         string
+	model          string
+	embeddingModel string
+	client         *http.Client
+}
+
+type openAIMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+type openAIUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+type openAIChatRequest struct {
+	Model         string                 `json:"model"`
+	Messages      []openAIMessage        `json:"messages"`
+	Stream        bool                   `json:"stream,omitempty"`
+	StreamOptions map[string]interface{} `json:"stream_options,omitempty"`
+}
+
+type openAIChatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message openAIMessage `json:"message"`
+		Delta   openAIMessage `json:"delta"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage"`
+}
+
+// newOpenAIProviderFromEnv returns nil unless OPENAI_API_KEY or OPENAI_BASE_URL is set.
+func newOpenAIProviderFromEnv() *openAIProvider {
+	apiKey := os.Getenv("OPENAI_API_KEY")
+	baseURL := os.Getenv("OPENAI_BASE_URL")
+	if apiKey == "" && baseURL == "" {
+		return nil
+	}
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+
+	model := os.Getenv("OPENAI_MODEL")
+	if model == "" {
+		model = defaultOpenAIModel
+	}
+	embeddingModel := os.Getenv("OPENAI_EMBEDDING_MODEL")
+	if embeddingModel == "" {
+		embeddingModel = defaultOpenAIEmbeddingModel
+	}
+
+	return &openAIProvider{
+		baseURL:        strings.TrimRight(baseURL, "/"),
+		apiKey:         apiKey,
+		model:          model,
+		embeddingModel: embeddingModel,
+		client:         &http.Client{Timeout: 10 * time.Minute},
+	}
+}
+
+func (p *openAIProvider) Name() string { return ProviderOpenAI }
+
+func (p *openAIProvider) chatRequest(req CompletionRequest, stream bool) openAIChatRequest {
+	model := req.Model
+	if model == "" {
+		model = p.model
+	}
+
+	systemPrompt := req.SystemPrompt
+	if systemPrompt == "" {
+		systemPrompt = SystemPrompt
+	}
+	messages := []openAIMessage{{Role: "system", Content: systemPrompt}}
+	if req.History.Summary != "" {
+		messages = append(messages, openAIMessage{Role: "system", Content: "Summary of the earlier conversation:\n" + req.History.Summary})
+	}
+	for _, turn := range req.History.Turns {
+		messages = append(messages, openAIMessage{Role: turn.Role, Content: turn.Content})
+	}
+	messages = append(messages, openAIMessage{Role: "user", Content: req.Prompt})
+
+	chatReq := openAIChatRequest{Model: model, Messages: messages, Stream: stream}
+	if stream {
+		chatReq.StreamOptions = map[string]interface{}{"include_usage": true}
+	}
+	return chatReq
+}
+
+func (p *openAIProvider) post(ctx context.Context, path string, payload interface{}, accept string) (*http.Response, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal openai payload: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, p.baseURL+path, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", accept)
+	if p.apiKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call openai-compatible API: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("openai-compatible API returned %d: %s", resp.StatusCode, string(respBody))
+	}
+	return resp, nil
+}
+
+func (p *openAIProvider) Generate(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	chatReq := p.chatRequest(req, false)
+	resp, err := p.post(ctx, "/chat/completions", chatReq, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var parsed openAIChatResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse openai-compatible response: %w", err)
+	}
+	if len(parsed.Choices) == 0 || parsed.Choices[0].Message.Content == "" {
+		return nil, errors.New("received an empty response from openai-compatible API")
+	}
+
+	result := &CompletionResponse{
+		Content:  parsed.Choices[0].Message.Content,
+		Provider: ProviderOpenAI,
+		Model:    chatReq.Model,
+	}
+	if parsed.Usage != nil {
+		result.PromptTokens = parsed.Usage.PromptTokens
+		result.CompletionTokens = parsed.Usage.CompletionTokens
+	}
+	return result, nil
+}
+
+func (p *openAIProvider) Stream(ctx context.Context, req CompletionRequest, onChunk func(string) error) (*CompletionResponse, error) {
+	chatReq := p.chatRequest(req, true)
+	result := &CompletionResponse{Provider: ProviderOpenAI, Model: chatReq.Model}
+
+	resp, err := p.post(ctx, "/chat/completions", chatReq, "text/event-stream")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var reply strings.Builder
+	err = readSSE(resp.Body, func(event, data string) error {
+		if data == "[DONE]" {
+			return errSSEDone
+		}
+		var chunk openAIChatResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to parse openai-compatible stream chunk: %w", err)
+		}
+		if chunk.Usage != nil {
+			result.PromptTokens = chunk.Usage.PromptTokens
+			result.CompletionTokens = chunk.Usage.CompletionTokens
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			return nil
+		}
+		reply.WriteString(chunk.Choices[0].Delta.Content)
+		return onChunk(chunk.Choices[0].Delta.Content)
+	})
+	result.Content = reply.String()
+	if err != nil {
+		return result, err
+	}
+	if result.Content == "" {
+		return nil, errors.New("received an empty response from openai-compatible API")
+	}
+	return result, nil
+}
+
+func (p *openAIProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := p.post(ctx, "/embeddings", map[string]interface{}{
+		"model": p.embeddingModel,
+		"input": texts,
+	}, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var parsed struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse openai-compatible embeddings: %w", err)
+	}
+
+	vectors := make([][]float32, len(texts))
+	for _, item := range parsed.Data {
+		if item.Index >= 0 && item.Index < len(vectors) {
+			vectors[item.Index] = item.Embedding
+		}
+	}
+	return vectors, nil
+}
+
+// CountTokens estimates locally; the chat completions API has no count endpoint.
+func (p *openAIProvider) CountTokens(ctx context.Context, text string) (int, error) {
+	return EstimateTokens(text), nil
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"context"
+	"strings"
+)
+
+// ProviderUnavailable is the last hop of a fallback chain: it always succeeds
+// with a canned answer so the user is never left without a reply.
+const ProviderUnavailable = "unavailable"
+
+const unavailableAnswer = "I'm sorry, the assistant service is temporarily unavailable. Your message has been saved — please try again in a few minutes, or contact your IT helpdesk if the problem persists."
+
+type unavailableProvider struct{}
+
+func (p *unavailableProvider) Name() string { return ProviderUnavailable }
+
+func (p *unavailableProvider) Generate(ctx context.Context, req CompletionRequest) (*CompletionResponse, error) {
+	return &CompletionResponse{Content: unavailableAnswer, Provider: ProviderUnavailable, Model: "canned"}, nil
+}
+
+func (p *unavailableProvider) Stream(ctx context.Context, req CompletionRequest, onChunk func(string) error) (*CompletionResponse, error) {
+	response, _ := p.Generate(ctx, req)
+	for _, word := range strings.SplitAfter(response.Content, " ") {
+		if err := onChunk(word); err != nil {
+			return response, err
+		}
+	}
+	return response, nil
+}
+
+func (p *unavailableProvider) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, ErrNotSupported
+}
+
+func (p *unavailableProvider) CountTokens(ctx context.Context, text string) (int, error) {
+	return EstimateTokens(text), nil
+}
@@ -0,0 +1,247 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// defaultMaxDocumentSize applies when a company has no MaxDocumentSize set.
+const defaultMaxDocumentSize = 10 * 1024 * 1024 // 10MB
+
+// messagesPerExchange is how many messages one question adds to a chat: the
+// user's message and the assistant's reply.
+const messagesPerExchange = 2
+
+// Quota error codes returned to clients.
+const (
+	QuotaCodeDocumentUploadDisabled = "document_upload_disabled"
+	QuotaCodeDocumentTooLarge       = "document_too_large"
+	QuotaCodeChatLimit              = "chat_limit_reached"
+	QuotaCodeMessageLimit           = "message_limit_reached"
+	QuotaCodeSeatLimit              = "seat_limit_reached"
+)
+
+// QuotaError reports a company policy or quota violation. Status is the HTTP
+// status the controller should answer with (403, 413 or 429).
+type QuotaError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"-"`
+	Limit   int64  `json:"limit"`
+	Current int64  `json:"current"`
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf("%s (limit %d, current %d)", e.Message, e.Limit, e.Current)
+}
+
+// companySettings loads the settings that quota checks are based on.
+func companySettings(companyID primitive.ObjectID) (*models.CompanySettings, error) {
+	company, err := GetCompanyByID(companyID)
+	if err != nil {
+		return nil, err
+	}
+	return &company.Settings, nil
+}
+
+// CheckChatQuota enforces CompanySettings.MaxChatsPerUser before a chat is created.
+func CheckChatQuota(companyID, userID primitive.ObjectID) error {
+	settings, err := companySettings(companyID)
+	if err != nil {
+		return err
+	}
+	if settings.MaxChatsPerUser <= 0 {
+		return nil // Unlimited
+	}
+
+	count, err := chatCollection.CountDocuments(context.Background(), bson.M{
+		"company_id": companyID,
+		"user_id":    userID,
+	})
+	if err != nil {
+		return err
+	}
+
+	if count >= int64(settings.MaxChatsPerUser) {
+		return &QuotaError{
+			Status:  http.StatusTooManyRequests,
+			Code:    QuotaCodeChatLimit,
+			Message: fmt.Sprintf("Chat limit reached: your company allows %d chats per user. Delete an old chat to start a new one.", settings.MaxChatsPerUser),
+			Limit:   int64(settings.MaxChatsPerUser),
+			Current: count,
+		}
+	}
+	return nil
+}
+
+// CheckMessageQuota enforces CompanySettings.MaxMessagesPerChat before a new
+// exchange is added to a chat; both of its messages must fit.
+func CheckMessageQuota(companyID, chatID primitive.ObjectID) error {
+	settings, err := companySettings(companyID)
+	if err != nil {
+		return err
+	}
+	if settings.MaxMessagesPerChat <= 0 {
+		return nil // Unlimited
+	}
+
+	count, err := CountMessagesInChat(chatID)
+	if err != nil {
+		return err
+	}
+
+	if count+messagesPerExchange > int64(settings.MaxMessagesPerChat) {
+		return &QuotaError{
+			Status:  http.StatusTooManyRequests,
+			Code:    QuotaCodeMessageLimit,
+			Message: fmt.Sprintf("Message limit reached: a chat can hold at most %d messages. Please start a new chat.", settings.MaxMessagesPerChat),
+			Limit:   int64(settings.MaxMessagesPerChat),
+			Current: count,
+		}
+	}
+	return nil
+}
+
+// CheckDocumentUpload enforces CompanySettings.EnableDocumentUpload and
+// MaxDocumentSize for chat and knowledge base uploads.
+func CheckDocumentUpload(companyID primitive.ObjectID, size int64) error {
+	settings, err := companySettings(companyID)
+	if err != nil {
+		return err
+	}
+
+	if !settings.EnableDocumentUpload {
+		return &QuotaError{
+			Status:  http.StatusForbidden,
+			Code:    QuotaCodeDocumentUploadDisabled,
+			Message: "Document upload is disabled for your company",
+			Limit:   0,
+			Current: size,
+		}
+	}
+
+	maxSize := settings.MaxDocumentSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxDocumentSize
+	}
+	if size > maxSize {
+		return &QuotaError{
+			Status:  http.StatusRequestEntityTooLarge,
+			Code:    QuotaCodeDocumentTooLarge,
+			Message: fmt.Sprintf("File size exceeds the %s limit", formatBytes(maxSize)),
+			Limit:   maxSize,
+			Current: size,
+		}
+	}
+	return nil
+}
+
+// ReserveSeat takes one of Company.MaxUsers seats before a user is created or
+// reactivated. Only active users occupy a seat. The seat counter is checked and
+// incremented in a single update, so concurrent requests cannot overfill the
+// company; callers give the seat back with ReleaseSeat if the user is not
+// stored after all.
+func ReserveSeat(companyID primitive.ObjectID) error {
+	ctx := context.Background()
+
+	result, err := companyCollection.UpdateOne(ctx,
+		bson.M{
+			"_id": companyID,
+			"$or": bson.A{
+				bson.M{"max_users": bson.M{"$lte": 0}}, // Unlimited
+				bson.M{"$expr": bson.M{"$lt": bson.A{"$active_users", "$max_users"}}},
+			},
+		},
+		bson.M{"$inc": bson.M{"active_users": 1}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount > 0 {
+		return nil
+	}
+
+	company, err := GetCompanyByID(companyID)
+	if err != nil {
+		return err
+	}
+	return &QuotaError{
+		Status:  http.StatusForbidden,
+		Code:    QuotaCodeSeatLimit,
+		Message: fmt.Sprintf("Seat limit reached: your %s plan allows %d active users. Deactivate a user or upgrade your plan.", company.SubscriptionTier, company.MaxUsers),
+		Limit:   int64(company.MaxUsers),
+		Current: int64(company.ActiveUsers),
+	}
+}
+
+// ReleaseSeat gives back a seat taken by ReserveSeat when a user is
+// deactivated or could not be stored.
+func ReleaseSeat(companyID primitive.ObjectID) {
+	_, err := companyCollection.UpdateOne(context.Background(),
+		bson.M{"_id": companyID, "active_users": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"active_users": -1}},
+	)
+	if err != nil {
+		log.Printf("Warning: Failed to release a seat of company %s: %v", companyID.Hex(), err)
+	}
+}
+
+// migrateCompanySeats counts the active users of companies stored before
+// seats were counted. It must run before requests are served.
+func migrateCompanySeats() {
+	ctx := context.Background()
+
+	cursor, err := companyCollection.Find(ctx, bson.M{"active_users": bson.M{"$exists": false}},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		log.Printf("Warning: Failed to migrate company seats: %v", err)
+		return
+	}
+	var companies []models.Company
+	if err := cursor.All(ctx, &companies); err != nil {
+		log.Printf("Warning: Failed to migrate company seats: %v", err)
+		return
+	}
+
+	for _, company := range companies {
+		count, err := userCollection.CountDocuments(ctx, bson.M{"company_id": company.ID, "is_active": true})
+		if err != nil {
+			log.Printf("Warning: Failed to count the seats of company %s: %v", company.ID.Hex(), err)
+			continue
+		}
+		_, err = companyCollection.UpdateOne(ctx,
+			bson.M{"_id": company.ID, "active_users": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"active_users": count}},
+		)
+		if err != nil {
+			log.Printf("Warning: Failed to store the seats of company %s: %v", company.ID.Hex(), err)
+		}
+	}
+	if len(companies) > 0 {
+		log.Printf("Counted the seats of %d companies", len(companies))
+	}
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	value := float64(n) / float64(div)
+	if value == float64(int64(value)) {
+		return fmt.Sprintf("%d%cB", int64(value), "KMGT"[exp])
+	}
+	return fmt.Sprintf("%.1f%cB", value, "KMGT"[exp])
+}
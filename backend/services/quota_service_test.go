@@ -0,0 +1,74 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"errors"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCheckMessageQuota(t *testing.T) {
+	setupTestDB(t)
+
+	companyID, chatID := primitive.NewObjectID(), primitive.NewObjectID()
+	mustInsert(t, companyCollection, models.Company{ID: companyID, Name: "Acme", Domain: "acme", IsActive: true,
+		Settings: models.CompanySettings{MaxMessagesPerChat: 4}})
+
+	for stored, wantErr := range []bool{false, false, false, true, true} {
+		if stored > 0 {
+			mustInsert(t, messageCollection, models.Message{ID: primitive.NewObjectID(), ChatID: chatID, Role: "user", Content: "Hi"})
+		}
+		err := CheckMessageQuota(companyID, chatID)
+		var quotaErr *QuotaError
+		if got := errors.As(err, &quotaErr); got != wantErr || (!got && err != nil) {
+			t.Fatalf("%d messages stored: err = %v, want quota error %v", stored, err, wantErr)
+		}
+	}
+}
+
+func TestReserveSeatConcurrently(t *testing.T) {
+	setupTestDB(t)
+
+	companyID := primitive.NewObjectID()
+	mustInsert(t, companyCollection, models.Company{ID: companyID, Name: "Acme", Domain: "acme", IsActive: true, MaxUsers: 3})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- ReserveSeat(companyID)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	reserved := 0
+	for err := range errs {
+		var quotaErr *QuotaError
+		switch {
+		case err == nil:
+			reserved++
+		case !errors.As(err, &quotaErr) || quotaErr.Code != QuotaCodeSeatLimit:
+			t.Fatalf("err = %v, want a seat limit error", err)
+		}
+	}
+	if reserved != 3 {
+		t.Fatalf("%d seats reserved, want 3", reserved)
+	}
+
+	ReleaseSeat(companyID)
+	if err := ReserveSeat(companyID); err != nil {
+		t.Fatalf("released seat not reusable: %v", err)
+	}
+	company, err := GetCompanyByID(companyID)
+	if err != nil {
+		t.Fatalf("load company: %v", err)
+	}
+	if company.ActiveUsers != 3 {
+		t.Fatalf("%d seats taken, want 3", company.ActiveUsers)
+	}
+}
@@ -0,0 +1,315 @@
+package services
+
+import (
+	"chatgpt-clone/backend/config"
+	"chatgpt-clone/backend/models"
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Rate limit groups (route groups with their own budgets)
+const (
+	RateLimitGroupAuth    = "auth"    // Login and registration
+	RateLimitGroupRefresh = "refresh" // Access token refresh
+	RateLimitGroupChat    = "chat"    // Sending messages and uploads
+	RateLimitGroupAPI     = "api"     // Everything else behind authentication
+)
+
+// Rate limit scopes (what a bucket is keyed by)
+const (
+	RateLimitScopeIP      = "ip"
+	RateLimitScopeUser    = "user"
+	RateLimitScopeCompany = "company"
+)
+
+// Rate is a token bucket: Requests is the burst size and the bucket refills
+// completely over Per.
+type Rate struct {
+	Requests int
+	Per      time.Duration
+}
+
+// refillPerSecond is the bucket's refill speed.
+func (r Rate) refillPerSecond() float64 {
+	return float64(r.Requests) / r.Per.Seconds()
+}
+
+// ParseRate parses "N/s", "N/m", "N/h" or "N/d", e.g. "30/m".
+func ParseRate(spec string) (Rate, error) {
+	count, unit, ok := strings.Cut(strings.TrimSpace(spec), "/")
+	n, err := strconv.Atoi(count)
+	if !ok || err != nil || n <= 0 {
+		return Rate{}, fmt.Errorf("invalid rate %q", spec)
+	}
+	per := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour, "d": 24 * time.Hour}[unit]
+	if per == 0 {
+		return Rate{}, fmt.Errorf("invalid rate unit in %q", spec)
+	}
+	return Rate{Requests: n, Per: per}, nil
+}
+
+// RateLimitResult is the outcome of taking one token from a bucket.
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // Until the next token when denied
+	ResetAfter time.Duration // Until the bucket is full again
+}
+
+// RateLimitStore holds token buckets. Take must be atomic per key.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error)
+}
+
+// resultFromTokens builds a result from a bucket's token count after a take.
+func resultFromTokens(rate Rate, tokens float64, allowed bool) RateLimitResult {
+	perSecond := rate.refillPerSecond()
+	result := RateLimitResult{
+		Allowed:    allowed,
+		Limit:      rate.Requests,
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration((float64(rate.Requests) - tokens) / perSecond * float64(time.Second)),
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration((1 - tokens) / perSecond * float64(time.Second))
+	}
+	return result
+}
+
+// --- In-memory store (single node) ---
+
+type memoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	per       time.Duration
+}
+
+// MemoryRateLimitStore keeps buckets in process memory.
+type MemoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+// NewMemoryRateLimitStore creates an empty in-memory store.
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: map[string]*memoryBucket{}, lastSweep: time.Now()}
+}
+
+// Take implements RateLimitStore.
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &memoryBucket{tokens: float64(rate.Requests), updatedAt: now}
+		s.buckets[key] = b
+	}
+	b.per = rate.Per
+	b.tokens = math.Min(float64(rate.Requests), b.tokens+now.Sub(b.updatedAt).Seconds()*rate.refillPerSecond())
+	b.updatedAt = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return resultFromTokens(rate, b.tokens, allowed), nil
+}
+
+// sweep drops buckets that have been idle long enough to be full again.
+func (s *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updatedAt) > b.per {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// --- MongoDB store (multi-instance) ---
+
+// MongoRateLimitStore keeps buckets in the rate_limits collection so that all
+// instances share them. Each take is a single atomic pipeline update.
+type MongoRateLimitStore struct {
+	collection *mongo.Collection
+}
+
+// NewMongoRateLimitStore creates the store and its TTL index.
+func NewMongoRateLimitStore(collection *mongo.Collection) *MongoRateLimitStore {
+	_, err := collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		log.Printf("Warning: Failed to create rate limit indexes: %v", err)
+	}
+	return &MongoRateLimitStore{collection: collection}
+}
+
+// Take implements RateLimitStore.
+func (s *MongoRateLimitStore) Take(ctx context.Context, key string, rate Rate) (RateLimitResult, error) {
+	now := time.Now()
+	capacity := float64(rate.Requests)
+
+	refilled := bson.M{"$min": bson.A{
+		capacity,
+		bson.M{"$add": bson.A{
+			bson.M{"$ifNull": bson.A{"$tokens", capacity}},
+			bson.M{"$multiply": bson.A{
+				bson.M{"$divide": bson.A{
+					bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", now}}}},
+					1000,
+				}},
+				rate.refillPerSecond(),
+			}},
+		}},
+	}}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"tokens": refilled, "updated_at": now, "expires_at": now.Add(rate.Per)}}},
+		{{Key: "$set", Value: bson.M{
+			"allowed": bson.M{"$gte": bson.A{"$tokens", 1}},
+			"tokens":  bson.M{"$cond": bson.A{bson.M{"$gte": bson.A{"$tokens", 1}}, bson.M{"$subtract": bson.A{"$tokens", 1}}, "$tokens"}},
+		}}},
+	}
+
+	var bucket struct {
+		Tokens  float64 `bson:"tokens"`
+		Allowed bool    `bson:"allowed"`
+	}
+	err := s.collection.FindOneAndUpdate(ctx, bson.M{"_id": key}, pipeline,
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&bucket)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return resultFromTokens(rate, bucket.Tokens, bucket.Allowed), nil
+}
+
+// --- Limits ---
+
+// defaultRateLimits are the base limits per group and scope, for the free
+// tier. Override with RATE_LIMIT_<GROUP>_<SCOPE>, e.g. RATE_LIMIT_CHAT_USER=60/m.
+var defaultRateLimits = map[string]map[string]Rate{
+	RateLimitGroupAuth: {
+		RateLimitScopeIP: {Requests: 10, Per: time.Minute},
+	},
+	// Every signed-in tab refreshes every few minutes, and a whole office may
+	// share one NAT address; a refresh token cannot be guessed, so this only
+	// has to stop floods.
+	RateLimitGroupRefresh: {
+		RateLimitScopeIP: {Requests: 300, Per: time.Minute},
+	},
+	RateLimitGroupChat: {
+		RateLimitScopeUser:    {Requests: 20, Per: time.Minute},
+		RateLimitScopeCompany: {Requests: 200, Per: time.Minute},
+	},
+	RateLimitGroupAPI: {
+		RateLimitScopeUser: {Requests: 300, Per: time.Minute},
+	},
+}
+
+// rateLimitTierMultipliers scale user and company limits by subscription tier.
+var rateLimitTierMultipliers = map[string]int{
+	models.TierFree:       1,
+	models.TierBasic:      2,
+	models.TierPremium:    4,
+	models.TierEnterprise: 10,
+}
+
+var (
+	rateLimitStore RateLimitStore = NewMemoryRateLimitStore()
+
+	tierCacheMu sync.Mutex
+	tierCache   = map[primitive.ObjectID]tierCacheEntry{}
+)
+
+type tierCacheEntry struct {
+	tier      string
+	expiresAt time.Time
+}
+
+// initRateLimiter selects the bucket store. RATE_LIMIT_STORE=mongo shares
+// buckets between instances; the default is in-memory.
+func initRateLimiter() {
+	if strings.EqualFold(os.Getenv("RATE_LIMIT_STORE"), "mongo") {
+		SetRateLimitStore(NewMongoRateLimitStore(config.GetCollection("rate_limits")))
+		log.Println("Rate limiter using MongoDB store")
+	}
+}
+
+// SetRateLimitStore replaces the bucket store.
+func SetRateLimitStore(store RateLimitStore) {
+	rateLimitStore = store
+}
+
+// RateLimitFor returns the limit for a group and scope, scaled for the
+// company's tier (IP limits are not scaled). ok is false when the group has no
+// limit for that scope.
+func RateLimitFor(group, scope string, companyID primitive.ObjectID) (Rate, bool) {
+	rate, ok := defaultRateLimits[group][scope]
+	if spec := os.Getenv("RATE_LIMIT_" + strings.ToUpper(group) + "_" + strings.ToUpper(scope)); spec != "" {
+		parsed, err := ParseRate(spec)
+		if err != nil {
+			log.Printf("Warning: ignoring RATE_LIMIT_%s_%s: %v", strings.ToUpper(group), strings.ToUpper(scope), err)
+		} else {
+			rate, ok = parsed, true
+		}
+	}
+	if !ok {
+		return Rate{}, false
+	}
+
+	if scope != RateLimitScopeIP && !companyID.IsZero() {
+		if multiplier, found := rateLimitTierMultipliers[companyTier(companyID)]; found {
+			rate.Requests *= multiplier
+		}
+	}
+	return rate, true
+}
+
+// companyTier returns a company's subscription tier, cached for a minute so
+// the limiter does not hit the database on every request.
+func companyTier(companyID primitive.ObjectID) string {
+	tierCacheMu.Lock()
+	entry, ok := tierCache[companyID]
+	tierCacheMu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		return entry.tier
+	}
+
+	tier := models.TierFree
+	if company, err := GetCompanyByID(companyID); err == nil && company.SubscriptionTier != "" {
+		tier = company.SubscriptionTier
+	}
+
+	tierCacheMu.Lock()
+	tierCache[companyID] = tierCacheEntry{tier: tier, expiresAt: time.Now().Add(time.Minute)}
+	tierCacheMu.Unlock()
+	return tier
+}
+
+// TakeRateLimit takes one token from the bucket for group/scope/id.
+func TakeRateLimit(ctx context.Context, group, scope, id string, rate Rate) (RateLimitResult, error) {
+	return rateLimitStore.Take(ctx, group+":"+scope+":"+id, rate)
+}
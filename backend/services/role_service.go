@@ -4,6 +4,9 @@ import (
 	"chatgpt-clone/backend/models"
 	"context"
 	"errors"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson"
@@ -61,10 +64,91 @@ func createDefaultRoles(companyID primitive.ObjectID) error {
 	return err
 }
 
+// roleNamePattern restricts custom role names to lowercase identifiers
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{1,49}$`)
+
+// CreateRoleInput defines the input for creating a custom role
+type CreateRoleInput struct {
+	Name        string   `json:"name" validate:"required"`
+	DisplayName string   `json:"display_name" validate:"required,min=2,max=100"`
+	Description string   `json:"description" validate:"max=500"`
+	Permissions []string `json:"permissions" validate:"required"`
+}
+
+// UpdateRoleInput defines the fields that can be changed on a role. Nil
+// fields are left unchanged.
+type UpdateRoleInput struct {
+	Name        *string   `json:"name,omitempty"`
+	DisplayName *string   `json:"display_name,omitempty" validate:"omitempty,min=2,max=100"`
+	Description *string   `json:"description,omitempty" validate:"omitempty,max=500"`
+	Permissions *[]string `json:"permissions,omitempty"`
+}
+
+// validateRoleName checks a custom role name's format and that it does not
+// take the name of a system role
+func validateRoleName(name string) error {
+	if !roleNamePattern.MatchString(name) {
+		return errors.New("role name must be 2-50 lowercase letters, digits or underscores, starting with a letter")
+	}
+	if models.IsSystemRoleName(name) {
+		return errors.New("role name is reserved for a system role")
+	}
+	return nil
+}
+
+// ValidatePermissions rejects permission strings that are not in the
+// catalogue and returns the permissions without duplicates
+func ValidatePermissions(permissions []string) ([]string, error) {
+	valid := make([]string, 0, len(permissions))
+	var unknown []string
+	seen := map[string]bool{}
+	for _, p := range permissions {
+		if seen[p] {
+			continue
+		}
+		seen[p] = true
+		if !models.IsKnownPermission(p) {
+			unknown = append(unknown, p)
+			continue
+		}
+		valid = append(valid, p)
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("unknown permissions: %s", strings.Join(unknown, ", "))
+	}
+	return valid, nil
+}
+
+// CheckGrantable rejects permissions the grantor may not hand out: only super
+// admins can grant platform-only permissions
+func CheckGrantable(permissions []string, grantorIsSuperAdmin bool) error {
+	if grantorIsSuperAdmin {
+		return nil
+	}
+	var denied []string
+	for _, p := range permissions {
+		if info, ok := models.GetPermissionInfo(p); ok && info.PlatformOnly {
+			denied = append(denied, p)
+		}
+	}
+	if len(denied) > 0 {
+		return fmt.Errorf("only platform administrators can grant: %s", strings.Join(denied, ", "))
+	}
+	return nil
+}
+
 // CreateRole creates a new custom role
 func CreateRole(companyID primitive.ObjectID, name, displayName, description string, permissions []string) (*models.Role, error) {
 	ctx := context.Background()
 
+	if err := validateRoleName(name); err != nil {
+		return nil, err
+	}
+	permissions, err := ValidatePermissions(permissions)
+	if err != nil {
+		return nil, err
+	}
+
 	// Check if role name already exists in company
 	count, err := roleCollection.CountDocuments(ctx, bson.M{
 		"company_id": companyID,
@@ -150,6 +234,7 @@ func UpdateRole(roleID primitive.ObjectID, updates bson.M) error {
 		bson.M{"_id": roleID},
 		bson.M{"$set": updates},
 	)
+	InvalidateRoleAccess(roleID)
 	return err
 }
 
@@ -178,9 +263,141 @@ func DeleteRole(roleID primitive.ObjectID) error {
 	}
 
 	_, err = roleCollection.DeleteOne(ctx, bson.M{"_id": roleID})
+	InvalidateRoleAccess(roleID)
 	return err
 }
 
+// UpdateCustomRole renames or edits a role. System roles keep their name;
+// renaming a custom role updates its users and role budgets.
+func UpdateCustomRole(roleID primitive.ObjectID, input UpdateRoleInput) (*models.Role, error) {
+	ctx := context.Background()
+
+	role, err := GetRoleByID(roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	updates := bson.M{}
+	renamed := false
+	if input.Name != nil && *input.Name != role.Name {
+		if role.IsSystem {
+			return nil, errors.New("cannot modify system role name")
+		}
+		if err := validateRoleName(*input.Name); err != nil {
+			return nil, err
+		}
+		count, err := roleCollection.CountDocuments(ctx, bson.M{"company_id": role.CompanyID, "name": *input.Name})
+		if err != nil {
+			return nil, err
+		}
+		if count > 0 {
+			return nil, errors.New("role with this name already exists")
+		}
+		updates["name"] = *input.Name
+		renamed = true
+	}
+	if input.DisplayName != nil {
+		updates["display_name"] = *input.DisplayName
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+
+	if len(updates) > 0 {
+		if err := UpdateRole(roleID, updates); err != nil {
+			return nil, err
+		}
+	}
+
+	if input.Permissions != nil {
+		if err := UpdateRolePermissions(roleID, *input.Permissions); err != nil {
+			return nil, err
+		}
+	}
+
+	if renamed {
+		// Keep the denormalised role name, per-role budgets and document ACLs in step
+		if _, err := userCollection.UpdateMany(ctx, bson.M{"role_id": roleID}, bson.M{
+			"$set": bson.M{"role_name": *input.Name, "updated_at": primitive.NewDateTimeFromTime(time.Now())},
+		}); err != nil {
+			return nil, err
+		}
+		budgetKey := "settings.role_monthly_token_budgets."
+		if _, err := companyCollection.UpdateOne(ctx,
+			bson.M{"_id": role.CompanyID, budgetKey + role.Name: bson.M{"$exists": true}},
+			bson.M{"$rename": bson.M{budgetKey + role.Name: budgetKey + *input.Name}},
+		); err != nil {
+			return nil, err
+		}
+		if _, err := knowledgeBaseCollection.UpdateMany(ctx,
+			bson.M{"company_id": role.CompanyID, "acl.roles": role.Name},
+			bson.M{"$set": bson.M{"acl.roles.$": *input.Name}},
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	return GetRoleByID(roleID)
+}
+
+// DeleteRoleAndReassign deletes a custom role. Users holding it are moved to
+// reassignTo first; without a target, a role that is still assigned is not
+// deleted. It returns the number of users reassigned.
+func DeleteRoleAndReassign(roleID primitive.ObjectID, reassignTo *primitive.ObjectID) (int64, error) {
+	ctx := context.Background()
+
+	role, err := GetRoleByID(roleID)
+	if err != nil {
+		return 0, err
+	}
+	if role.IsSystem {
+		return 0, errors.New("cannot delete system role")
+	}
+
+	var reassigned int64
+	if reassignTo != nil {
+		if *reassignTo == roleID {
+			return 0, errors.New("cannot reassign users to the role being deleted")
+		}
+		target, err := GetRoleByID(*reassignTo)
+		if err != nil || target.CompanyID != role.CompanyID {
+			return 0, errors.New("reassignment role not found")
+		}
+
+		userIDs, err := userCollection.Distinct(ctx, "_id", bson.M{"role_id": roleID})
+		if err != nil {
+			return 0, err
+		}
+		result, err := userCollection.UpdateMany(ctx, bson.M{"role_id": roleID}, bson.M{
+			"$set": bson.M{
+				"role_id":     target.ID,
+				"role_name":   target.Name,
+				"permissions": target.Permissions,
+				"updated_at":  primitive.NewDateTimeFromTime(time.Now()),
+			},
+		})
+		if err != nil {
+			return 0, err
+		}
+		reassigned = result.ModifiedCount
+		for _, id := range userIDs {
+			if userID, ok := id.(primitive.ObjectID); ok {
+				InvalidateUserAccess(userID)
+			}
+		}
+	}
+
+	if err := DeleteRole(roleID); err != nil {
+		return reassigned, err
+	}
+
+	// Drop the deleted role's budget
+	_, err = companyCollection.UpdateOne(ctx, bson.M{"_id": role.CompanyID}, bson.M{
+		"$unset": bson.M{"settings.role_monthly_token_budgets." + role.Name: ""},
+	})
+	return reassigned, err
+}
+
 // HasPermission checks if a role has a specific permission
 func HasPermission(roleID primitive.ObjectID, permission string) (bool, error) {
 	var role models.Role
@@ -197,12 +414,19 @@ func HasPermission(roleID primitive.ObjectID, permission string) (bool, error) {
 	return false, nil
 }
 
-// UpdateRolePermissions updates a role's permissions and syncs to all users with that role
+// UpdateRolePermissions updates a role's permissions. The change applies to
+// every user holding the role on their next request; the users' denormalised
+// copies are kept in sync for display.
 func UpdateRolePermissions(roleID primitive.ObjectID, permissions []string) error {
 	ctx := context.Background()
 
+	permissions, err := ValidatePermissions(permissions)
+	if err != nil {
+		return err
+	}
+
 	// Update role
-	_, err := roleCollection.UpdateOne(
+	_, err = roleCollection.UpdateOne(
 		ctx,
 		bson.M{"_id": roleID},
 		bson.M{
@@ -215,6 +439,7 @@ func UpdateRolePermissions(roleID primitive.ObjectID, permissions []string) erro
 	if err != nil {
 		return err
 	}
+	InvalidateRoleAccess(roleID)
 
 	// Update all users with this role to sync permissions
 	_, err = userCollection.UpdateMany(
@@ -0,0 +1,326 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// AccessTokenTTL is the lifetime of an access token. Permissions and role
+	// changes reach a user at the latest when their access token is refreshed.
+	AccessTokenTTL = 15 * time.Minute
+
+	// SessionLifetime is the absolute lifetime of a session and its refresh
+	// token, however active the user is.
+	SessionLifetime = 72 * time.Hour
+
+	// sessionTouchInterval limits how often LastSeenAt is written.
+	sessionTouchInterval = time.Minute
+
+	// refreshReuseGrace tolerates a refresh token replayed right after it
+	// was rotated, e.g. by two browser tabs refreshing at once.
+	refreshReuseGrace = 10 * time.Second
+
+	// maxPreviousRefreshHashes bounds the rotated hashes kept for reuse
+	// detection.
+	maxPreviousRefreshHashes = 20
+)
+
+var (
+	// ErrSessionInvalid is returned for unknown, revoked or expired sessions.
+	ErrSessionInvalid = errors.New("session is no longer valid")
+
+	// ErrRefreshTokenReused is returned when an already rotated refresh token
+	// is presented; the session is revoked since the token may be stolen.
+	ErrRefreshTokenReused = errors.New("refresh token has already been used; please log in again")
+
+	// ErrRefreshRaced is returned when a concurrent refresh with the same
+	// token rotated it first. The session is still valid and the client
+	// already holds, or is about to receive, the new cookies.
+	ErrRefreshRaced = errors.New("session was refreshed by a concurrent request; retry with the current cookies")
+)
+
+// randomToken returns n random bytes, hex encoded.
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// newJTI returns a random token identifier.
+func newJTI() (string, error) {
+	return randomToken(16)
+}
+
+// hashRefreshSecret returns the stored form of a refresh token secret.
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// refreshTokenFor builds the refresh token handed to the client:
+// "<session id>.<secret>".
+func refreshTokenFor(sessionID primitive.ObjectID, secret string) string {
+	return sessionID.Hex() + "." + secret
+}
+
+// parseRefreshToken splits a refresh token into its session ID and secret.
+func parseRefreshToken(token string) (primitive.ObjectID, string, error) {
+	idHex, secret, ok := strings.Cut(token, ".")
+	if !ok || secret == "" {
+		return primitive.NilObjectID, "", ErrSessionInvalid
+	}
+	sessionID, err := primitive.ObjectIDFromHex(idHex)
+	if err != nil {
+		return primitive.NilObjectID, "", ErrSessionInvalid
+	}
+	return sessionID, secret, nil
+}
+
+// idleExpired reports whether a session has been unused for longer than its
+// idle timeout.
+func idleExpired(session *models.Session, now time.Time) bool {
+	if session.IdleTimeout <= 0 {
+		return false
+	}
+	idle := time.Duration(session.IdleTimeout) * time.Minute
+	return now.Sub(session.LastSeenAt.Time()) > idle+sessionTouchInterval
+}
+
+// CreateSession records a new login and returns the session, whose JTI must
+// be embedded in access tokens, and its first refresh token. idleTimeout is
+// the company's session timeout in minutes (0 = none).
+func CreateSession(user *models.User, ipAddress, userAgent string, idleTimeout int) (*models.Session, string, error) {
+	jti, err := newJTI()
+	if err != nil {
+		return nil, "", err
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:               primitive.NewObjectID(),
+		JTI:              jti,
+		UserID:           user.ID,
+		CompanyID:        user.CompanyID,
+		IPAddress:        ipAddress,
+		UserAgent:        userAgent,
+		CreatedAt:        primitive.NewDateTimeFromTime(now),
+		LastSeenAt:       primitive.NewDateTimeFromTime(now),
+		ExpiresAt:        primitive.NewDateTimeFromTime(now.Add(SessionLifetime)),
+		IdleTimeout:      max(idleTimeout, 0),
+		RefreshTokenHash: hashRefreshSecret(secret),
+	}
+
+	if _, err := sessionCollection.InsertOne(context.Background(), session); err != nil {
+		return nil, "", err
+	}
+	return &session, refreshTokenFor(session.ID, secret), nil
+}
+
+// RotateRefreshToken checks a refresh token and replaces it with a new one.
+// Presenting a token that was already rotated revokes the whole session and
+// returns ErrRefreshTokenReused, unless it was rotated moments ago by a
+// concurrent refresh, which returns ErrRefreshRaced. idleTimeout refreshes the session's idle
+// timeout from the company's current settings.
+func RotateRefreshToken(refreshToken, ipAddress, userAgent string, idleTimeout int) (*models.Session, string, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	sessionID, secret, err := parseRefreshToken(refreshToken)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var session models.Session
+	if err := sessionCollection.FindOne(ctx, bson.M{"_id": sessionID}).Decode(&session); err != nil {
+		return nil, "", ErrSessionInvalid
+	}
+	if session.RevokedAt != nil || !session.ExpiresAt.Time().After(now) {
+		return nil, "", ErrSessionInvalid
+	}
+
+	hash := hashRefreshSecret(secret)
+	if hash != session.RefreshTokenHash {
+		if !slices.Contains(session.PreviousRefreshHashes, hash) {
+			return nil, "", ErrSessionInvalid
+		}
+		// The token just rotated: most likely a concurrent refresh from the
+		// same browser, which already holds the new cookie.
+		last := session.PreviousRefreshHashes[len(session.PreviousRefreshHashes)-1]
+		if hash == last && now.Sub(session.RefreshedAt.Time()) < refreshReuseGrace {
+			return nil, "", ErrRefreshRaced
+		}
+
+		revokeSessions(bson.M{"_id": session.ID}, models.SessionRevokedRefreshReused)
+		LogActivity(
+			session.CompanyID,
+			session.UserID,
+			models.ActionRefreshReuse,
+			models.ResourceUser,
+			session.UserID.Hex(),
+			"Rotated refresh token was reused; session revoked",
+			false,
+			map[string]interface{}{"session_id": session.ID.Hex()},
+			ipAddress,
+			userAgent,
+			"POST",
+			"/auth/refresh",
+			401,
+			"Refresh token reused",
+		)
+		return nil, "", ErrRefreshTokenReused
+	}
+
+	if idleExpired(&session, now) {
+		revokeSessions(bson.M{"_id": session.ID}, models.SessionRevokedIdleTimeout)
+		return nil, "", ErrSessionInvalid
+	}
+
+	newSecret, err := randomToken(32)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Filtering on the old hash makes the rotation atomic: of two concurrent
+	// refreshes with the same token only one wins.
+	result, err := sessionCollection.UpdateOne(ctx,
+		bson.M{"_id": session.ID, "refresh_token_hash": hash, "revoked_at": bson.M{"$exists": false}},
+		bson.M{
+			"$set": bson.M{
+				"refresh_token_hash": hashRefreshSecret(newSecret),
+				"refreshed_at":       primitive.NewDateTimeFromTime(now),
+				"last_seen_at":       primitive.NewDateTimeFromTime(now),
+				"ip_address":         ipAddress,
+				"user_agent":         userAgent,
+				"idle_timeout":       max(idleTimeout, 0),
+			},
+			"$push": bson.M{"previous_refresh_hashes": bson.M{"$each": bson.A{hash}, "$slice": -maxPreviousRefreshHashes}},
+		},
+	)
+	if err != nil {
+		return nil, "", err
+	}
+	if result.ModifiedCount == 0 {
+		// Lost the race against a concurrent refresh, or the session was
+		// revoked meanwhile; a retry tells the two apart
+		return nil, "", ErrRefreshRaced
+	}
+
+	return &session, refreshTokenFor(session.ID, newSecret), nil
+}
+
+// ValidateSession returns the active session for a token's jti.
+func ValidateSession(jti string) (*models.Session, error) {
+	ctx := context.Background()
+	now := time.Now()
+
+	var session models.Session
+	err := sessionCollection.FindOne(ctx, bson.M{
+		"jti":        jti,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": primitive.NewDateTimeFromTime(now)},
+	}).Decode(&session)
+	if err != nil {
+		return nil, ErrSessionInvalid
+	}
+	if idleExpired(&session, now) {
+		return nil, ErrSessionInvalid
+	}
+
+	if now.Sub(session.LastSeenAt.Time()) > sessionTouchInterval {
+		sessionCollection.UpdateOne(ctx, bson.M{"_id": session.ID}, bson.M{
+			"$set": bson.M{"last_seen_at": primitive.NewDateTimeFromTime(now)},
+		})
+	}
+	return &session, nil
+}
+
+// GetUserSessions lists a user's active sessions, newest first.
+func GetUserSessions(userID primitive.ObjectID) ([]models.Session, error) {
+	ctx := context.Background()
+	cursor, err := sessionCollection.Find(ctx, bson.M{
+		"user_id":    userID,
+		"revoked_at": bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": primitive.NewDateTimeFromTime(time.Now())},
+	}, options.Find().SetSort(bson.D{{Key: "last_seen_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := []models.Session{}
+	if err := cursor.All(ctx, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// revokeSessions revokes every active session matching filter and returns how
+// many were revoked.
+func revokeSessions(filter bson.M, reason string) (int64, error) {
+	filter["revoked_at"] = bson.M{"$exists": false}
+	result, err := sessionCollection.UpdateMany(context.Background(), filter, bson.M{
+		"$set": bson.M{
+			"revoked_at":     primitive.NewDateTimeFromTime(time.Now()),
+			"revoked_reason": reason,
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return result.ModifiedCount, nil
+}
+
+// RevokeSessionByJTI revokes the session behind a token, e.g. on logout.
+func RevokeSessionByJTI(jti, reason string) error {
+	_, err := revokeSessions(bson.M{"jti": jti}, reason)
+	return err
+}
+
+// RevokeUserSession revokes one of a user's own sessions.
+func RevokeUserSession(sessionID, userID primitive.ObjectID, reason string) error {
+	count, err := revokeSessions(bson.M{"_id": sessionID, "user_id": userID}, reason)
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return errors.New("session not found")
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes all of a user's sessions, except the one with
+// exceptJTI when it is not empty.
+func RevokeUserSessions(userID primitive.ObjectID, reason, exceptJTI string) (int64, error) {
+	filter := bson.M{"user_id": userID}
+	if exceptJTI != "" {
+		filter["jti"] = bson.M{"$ne": exceptJTI}
+	}
+	return revokeSessions(filter, reason)
+}
+
+// RevokeCompanySessions revokes every session in a company, except the one
+// with exceptJTI when it is not empty.
+func RevokeCompanySessions(companyID primitive.ObjectID, reason, exceptJTI string) (int64, error) {
+	filter := bson.M{"company_id": companyID}
+	if exceptJTI != "" {
+		filter["jti"] = bson.M{"$ne": exceptJTI}
+	}
+	return revokeSessions(filter, reason)
+}
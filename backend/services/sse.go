@@ -0,0 +1,60 @@
+package services
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+)
+
+// errSSEDone lets an event handler stop readSSE early without reporting an error.
+var errSSEDone = errors.New("sse stream finished")
+
+// readSSE parses a text/event-stream body and calls handle for every complete
+// event. Multi-line data fields are joined with "\n" as the spec requires.
+func readSSE(body io.Reader, handle func(event, data string) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var event string
+	var data []string
+
+	dispatch := func() error {
+		if len(data) == 0 {
+			event = ""
+			return nil
+		}
+		err := handle(event, strings.Join(data, "\n"))
+		event = ""
+		data = data[:0]
+		return err
+	}
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "":
+			if err := dispatch(); err != nil {
+				if errors.Is(err, errSSEDone) {
+					return nil
+				}
+				return err
+			}
+		case strings.HasPrefix(line, ":"):
+			// Comment / keep-alive line
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	// Flush a trailing event that was not followed by a blank line.
+	if err := dispatch(); err != nil && !errors.Is(err, errSSEDone) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type sseEvent struct{ event, data string }
+
+func TestReadSSE(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []sseEvent
+	}{
+		{"named events", "event: chunk\ndata: {\"delta\":\"Hi\"}\n\nevent: done\ndata: {}\n\n",
+			[]sseEvent{{"chunk", `{"delta":"Hi"}`}, {"done", "{}"}}},
+		{"unnamed event", "data: plain\n\n", []sseEvent{{"", "plain"}}},
+		{"multi-line data", "event: chunk\ndata: one\ndata: two\n\n", []sseEvent{{"chunk", "one\ntwo"}}},
+		{"data without space", "data:tight\n\n", []sseEvent{{"", "tight"}}},
+		{"comments and keep-alives", ": keep-alive\n\n: ping\nevent: chunk\ndata: x\n\n", []sseEvent{{"chunk", "x"}}},
+		{"event name without data is dropped", "event: chunk\n\ndata: y\n\n", []sseEvent{{"", "y"}}},
+		{"trailing event without blank line", "event: done\ndata: {}", []sseEvent{{"done", "{}"}}},
+		{"crlf line endings", "event: chunk\r\ndata: z\r\n\r\n", []sseEvent{{"chunk", "z"}}},
+		{"empty body", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []sseEvent
+			err := readSSE(strings.NewReader(tt.body), func(event, data string) error {
+				got = append(got, sseEvent{event, data})
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("readSSE: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("events = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadSSEStopsEarly(t *testing.T) {
+	body := "event: done\ndata: {}\n\nevent: chunk\ndata: late\n\n"
+	var got []string
+	err := readSSE(strings.NewReader(body), func(event, data string) error {
+		got = append(got, event)
+		if event == "done" {
+			return errSSEDone
+		}
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(got, []string{"done"}) {
+		t.Fatalf("events %q, err %v; want only done and no error", got, err)
+	}
+
+	handlerErr := errors.New("stop")
+	err = readSSE(strings.NewReader("data: a\n\ndata: b\n\n"), func(event, data string) error {
+		return handlerErr
+	})
+	if !errors.Is(err, handlerErr) {
+		t.Fatalf("err = %v, want the handler's error", err)
+	}
+}
@@ -0,0 +1,332 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Team scope errors
+var (
+	ErrTeamPermission  = errors.New("insufficient permissions")
+	ErrNotTeamManager  = errors.New("team not found or not managed by you")
+	ErrNotTeamMember   = errors.New("not found in the teams you manage")
+	ErrTeamNameInUse   = errors.New("team with this name already exists")
+	ErrInvalidTeamUser = errors.New("team members and managers must be users of the company")
+)
+
+// TeamInput defines the input for creating a team
+type TeamInput struct {
+	Name        string   `json:"name" validate:"required,min=2,max=100"`
+	Description string   `json:"description" validate:"max=500"`
+	ManagerIDs  []string `json:"manager_ids"`
+	MemberIDs   []string `json:"member_ids"`
+}
+
+// UpdateTeamInput defines the fields that can be changed on a team. Nil
+// fields are left unchanged.
+type UpdateTeamInput struct {
+	Name        *string   `json:"name,omitempty" validate:"omitempty,min=2,max=100"`
+	Description *string   `json:"description,omitempty" validate:"omitempty,max=500"`
+	ManagerIDs  *[]string `json:"manager_ids,omitempty"`
+	MemberIDs   *[]string `json:"member_ids,omitempty"`
+}
+
+// companyUserIDs parses user IDs and checks that they all belong to the company
+func companyUserIDs(companyID primitive.ObjectID, ids []string) ([]primitive.ObjectID, error) {
+	userIDs := make([]primitive.ObjectID, 0, len(ids))
+	for _, idStr := range ids {
+		id, err := primitive.ObjectIDFromHex(idStr)
+		if err != nil {
+			return nil, ErrInvalidTeamUser
+		}
+		if !slices.Contains(userIDs, id) {
+			userIDs = append(userIDs, id)
+		}
+	}
+	if len(userIDs) == 0 {
+		return userIDs, nil
+	}
+
+	count, err := userCollection.CountDocuments(context.Background(), bson.M{
+		"_id":        bson.M{"$in": userIDs},
+		"company_id": companyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if count != int64(len(userIDs)) {
+		return nil, ErrInvalidTeamUser
+	}
+	return userIDs, nil
+}
+
+// CreateTeam creates a team in a company
+func CreateTeam(companyID, createdBy primitive.ObjectID, input TeamInput) (*models.Team, error) {
+	managerIDs, err := companyUserIDs(companyID, input.ManagerIDs)
+	if err != nil {
+		return nil, err
+	}
+	memberIDs, err := companyUserIDs(companyID, input.MemberIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	now := primitive.NewDateTimeFromTime(time.Now())
+	team := models.Team{
+		ID:          primitive.NewObjectID(),
+		CompanyID:   companyID,
+		Name:        strings.TrimSpace(input.Name),
+		Description: input.Description,
+		ManagerIDs:  managerIDs,
+		MemberIDs:   memberIDs,
+		CreatedBy:   createdBy,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if _, err := teamCollection.InsertOne(context.Background(), team); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrTeamNameInUse
+		}
+		return nil, err
+	}
+	return &team, nil
+}
+
+// GetTeamByID retrieves a team within a company
+func GetTeamByID(teamID, companyID primitive.ObjectID) (*models.Team, error) {
+	var team models.Team
+	err := teamCollection.FindOne(context.Background(), bson.M{"_id": teamID, "company_id": companyID}).Decode(&team)
+	if err != nil {
+		return nil, err
+	}
+	return &team, nil
+}
+
+// GetTeamsByCompany lists a company's teams by name
+func GetTeamsByCompany(companyID primitive.ObjectID) ([]models.Team, error) {
+	return findTeams(bson.M{"company_id": companyID})
+}
+
+func findTeams(filter bson.M) ([]models.Team, error) {
+	ctx := context.Background()
+	cursor, err := teamCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "name", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+
+	teams := []models.Team{}
+	if err := cursor.All(ctx, &teams); err != nil {
+		return nil, err
+	}
+	return teams, nil
+}
+
+// UpdateTeam changes a team's name, description, managers or members
+func UpdateTeam(teamID, companyID primitive.ObjectID, input UpdateTeamInput) (*models.Team, error) {
+	updates := bson.M{"updated_at": primitive.NewDateTimeFromTime(time.Now())}
+	if input.Name != nil {
+		updates["name"] = strings.TrimSpace(*input.Name)
+	}
+	if input.Description != nil {
+		updates["description"] = *input.Description
+	}
+	if input.ManagerIDs != nil {
+		managerIDs, err := companyUserIDs(companyID, *input.ManagerIDs)
+		if err != nil {
+			return nil, err
+		}
+		updates["manager_ids"] = managerIDs
+	}
+	if input.MemberIDs != nil {
+		memberIDs, err := companyUserIDs(companyID, *input.MemberIDs)
+		if err != nil {
+			return nil, err
+		}
+		updates["member_ids"] = memberIDs
+	}
+
+	result, err := teamCollection.UpdateOne(context.Background(),
+		bson.M{"_id": teamID, "company_id": companyID},
+		bson.M{"$set": updates},
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, ErrTeamNameInUse
+		}
+		return nil, err
+	}
+	if result.MatchedCount == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	return GetTeamByID(teamID, companyID)
+}
+
+// DeleteTeam deletes a team; its users are not affected
+func DeleteTeam(teamID, companyID primitive.ObjectID) error {
+	result, err := teamCollection.DeleteOne(context.Background(), bson.M{"_id": teamID, "company_id": companyID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// --- Manager scope ---
+
+// teamScope checks that the manager currently holds permission and returns
+// the teams they manage (only teamID when given) and the union of their
+// members.
+func teamScope(managerID primitive.ObjectID, permission string, teamID *primitive.ObjectID) (*Access, []models.Team, []primitive.ObjectID, error) {
+	access, err := ResolveAccess(managerID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if !access.HasPermission(permission) {
+		return nil, nil, nil, ErrTeamPermission
+	}
+
+	filter := bson.M{"company_id": access.CompanyID, "manager_ids": managerID}
+	if teamID != nil {
+		filter["_id"] = *teamID
+	}
+	teams, err := findTeams(filter)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if teamID != nil && len(teams) == 0 {
+		return nil, nil, nil, ErrNotTeamManager
+	}
+
+	memberIDs := []primitive.ObjectID{}
+	for _, team := range teams {
+		for _, id := range team.MemberIDs {
+			if !slices.Contains(memberIDs, id) {
+				memberIDs = append(memberIDs, id)
+			}
+		}
+	}
+	return access, teams, memberIDs, nil
+}
+
+// GetManagedTeams lists the teams a user manages
+func GetManagedTeams(managerID primitive.ObjectID) ([]models.Team, error) {
+	_, teams, _, err := teamScope(managerID, models.PermissionViewTeamUsers, nil)
+	return teams, err
+}
+
+// GetTeamMembers lists the members of the manager's teams, or of one team
+func GetTeamMembers(managerID primitive.ObjectID, teamID *primitive.ObjectID) ([]models.User, error) {
+	ctx := context.Background()
+
+	access, _, memberIDs, err := teamScope(managerID, models.PermissionViewTeamUsers, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	users := []models.User{}
+	if len(memberIDs) == 0 {
+		return users, nil
+	}
+
+	cursor, err := userCollection.Find(ctx,
+		bson.M{"_id": bson.M{"$in": memberIDs}, "company_id": access.CompanyID},
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}).SetProjection(bson.M{"password": 0}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+// GetTeamActivityLogs returns activity logs of the manager's team members,
+// optionally limited to one team or one member
+func GetTeamActivityLogs(managerID primitive.ObjectID, teamID, memberID *primitive.ObjectID, page, limit int, action string) ([]models.ActivityLog, int64, error) {
+	access, _, memberIDs, err := teamScope(managerID, models.PermissionViewTeamActivity, teamID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if memberID != nil {
+		if !slices.Contains(memberIDs, *memberID) {
+			return nil, 0, ErrNotTeamMember
+		}
+		memberIDs = []primitive.ObjectID{*memberID}
+	}
+	if len(memberIDs) == 0 {
+		return []models.ActivityLog{}, 0, nil
+	}
+
+	ctx := context.Background()
+	filter := bson.M{"company_id": access.CompanyID, "user_id": bson.M{"$in": memberIDs}}
+	if action != "" {
+		filter["action"] = action
+	}
+
+	cursor, err := activityLogCollection.Find(ctx, filter, options.Find().
+		SetSkip(int64((page-1)*limit)).
+		SetLimit(int64(limit)).
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	logs := []models.ActivityLog{}
+	if err := cursor.All(ctx, &logs); err != nil {
+		return nil, 0, err
+	}
+
+	total, err := activityLogCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+	return logs, total, nil
+}
+
+// GetTeamChats lists the chats of the manager's team members, optionally
+// limited to one team or one member
+func GetTeamChats(managerID primitive.ObjectID, teamID, memberID *primitive.ObjectID) ([]models.Chat, error) {
+	access, _, memberIDs, err := teamScope(managerID, models.PermissionManageTeamChats, teamID)
+	if err != nil {
+		return nil, err
+	}
+
+	if memberID != nil {
+		if !slices.Contains(memberIDs, *memberID) {
+			return nil, ErrNotTeamMember
+		}
+		memberIDs = []primitive.ObjectID{*memberID}
+	}
+
+	chats := []models.Chat{}
+	if len(memberIDs) == 0 {
+		return chats, nil
+	}
+
+	ctx := context.Background()
+	cursor, err := chatCollection.Find(ctx,
+		bson.M{"company_id": access.CompanyID, "user_id": bson.M{"$in": memberIDs}},
+		options.Find().SetSort(bson.D{{Key: "updated_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &chats); err != nil {
+		return nil, err
+	}
+	return chats, nil
+}
@@ -0,0 +1,55 @@
+package services
+
+import (
+	"chatgpt-clone/backend/config"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// setupTestDB points the collections at a throwaway database on the server
+// TEST_MONGODB_URI names, with the app's indexes, and drops it when the test
+// ends. Tests needing MongoDB are skipped when the variable is not set.
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	uri := os.Getenv("TEST_MONGODB_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGODB_URI not set")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	if err != nil {
+		t.Fatalf("connect to test database: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Fatalf("ping test database: %v", err)
+	}
+
+	name := "chatgpt_clone_test_" + primitive.NewObjectID().Hex()
+	t.Setenv("MONGODB_DATABASE", name)
+	previous := config.DB
+	config.DB = client
+	InitCollections()
+	createIndexes()
+
+	t.Cleanup(func() {
+		_ = client.Database(name).Drop(context.Background())
+		_ = client.Disconnect(context.Background())
+		config.DB = previous
+	})
+}
+
+// mustInsert inserts documents into coll, failing the test on error
+func mustInsert(t *testing.T, coll *mongo.Collection, docs ...interface{}) {
+	t.Helper()
+	if _, err := coll.InsertMany(context.Background(), docs); err != nil {
+		t.Fatalf("insert into %s: %v", coll.Name(), err)
+	}
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"chatgpt-clone/backend/models"
+	"context"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// UsageTotals sums token usage over a period.
+type UsageTotals struct {
+	PromptTokens      int64 `bson:"prompt_tokens" json:"prompt_tokens"`
+	CompletionTokens  int64 `bson:"completion_tokens" json:"completion_tokens"`
+	TotalTokens       int64 `bson:"total_tokens" json:"total_tokens"`
+	Requests          int64 `bson:"requests" json:"requests"`
+	EstimatedRequests int64 `bson:"estimated_requests" json:"estimated_requests"`
+}
+
+// UserUsage is one user's usage over a period.
+type UserUsage struct {
+	UserID      primitive.ObjectID `bson:"_id" json:"user_id"`
+	Name        string             `bson:"name" json:"name"`
+	Email       string             `bson:"email" json:"email"`
+	Department  string             `bson:"department" json:"department"`
+	UsageTotals `bson:",inline"`
+}
+
+// DepartmentUsage is one department's usage over a period. Users without a
+// department are grouped under an empty name.
+type DepartmentUsage struct {
+	Department string `json:"department"`
+	Users      int    `json:"users"`
+	UsageTotals
+}
+
+// UsageReport is the response of the admin usage endpoint.
+type UsageReport struct {
+	From         string              `json:"from"`
+	To           string              `json:"to"`
+	Totals       UsageTotals         `json:"totals"`
+	Daily        []models.UsageDaily `json:"daily"`
+	ByUser       []UserUsage         `json:"by_user"`
+	ByDepartment []DepartmentUsage   `json:"by_department"`
+}
+
+// RecordUsage adds an answered request's tokens to today's per-user and
+// per-company rollups. The canned reply of the unavailable provider is not a
+// model answer and is not billed.
+func RecordUsage(companyID, userID primitive.ObjectID, usage *CompletionResponse) error {
+	if usage == nil || usage.TotalTokens() == 0 || usage.Provider == ProviderUnavailable {
+		return nil
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	date := now.UTC().Format(models.UsageDateLayout)
+
+	inc := bson.M{
+		"prompt_tokens":     int64(usage.PromptTokens),
+		"completion_tokens": int64(usage.CompletionTokens),
+		"total_tokens":      int64(usage.TotalTokens()),
+		"requests":          int64(1),
+	}
+	if usage.TokensEstimated {
+		inc["estimated_requests"] = int64(1)
+	}
+	if usage.Provider != "" {
+		inc["providers."+usage.Provider] = int64(usage.TotalTokens())
+	}
+
+	userSet := bson.M{"updated_at": primitive.NewDateTimeFromTime(now)}
+	if user, err := GetUserByID(userID); err == nil {
+		userSet["department"] = user.Department
+	}
+
+	upsert := options.Update().SetUpsert(true)
+	_, err := usageDailyCollection.UpdateOne(ctx,
+		bson.M{"company_id": companyID, "scope": models.UsageScopeUser, "user_id": userID, "date": date},
+		bson.M{"$inc": inc, "$set": userSet},
+		upsert,
+	)
+	if err != nil {
+		return err
+	}
+
+	_, err = usageDailyCollection.UpdateOne(ctx,
+		bson.M{"company_id": companyID, "scope": models.UsageScopeCompany, "date": date},
+		bson.M{"$inc": inc, "$set": bson.M{"updated_at": primitive.NewDateTimeFromTime(now)}},
+		upsert,
+	)
+	return err
+}
+
+// GetUsageReport returns a company's token usage between two UTC dates
+// ("2006-01-02", inclusive), optionally limited to one user.
+func GetUsageReport(companyID primitive.ObjectID, from, to string, userID *primitive.ObjectID) (*UsageReport, error) {
+	ctx := context.Background()
+	report := &UsageReport{
+		From:         from,
+		To:           to,
+		Daily:        []models.UsageDaily{},
+		ByUser:       []UserUsage{},
+		ByDepartment: []DepartmentUsage{},
+	}
+
+	dateRange := bson.M{"$gte": from, "$lte": to}
+	userFilter := bson.M{"company_id": companyID, "scope": models.UsageScopeUser, "date": dateRange}
+	if userID != nil && !userID.IsZero() {
+		userFilter["user_id"] = *userID
+	}
+
+	// Daily series: the company rollup, or the user's own documents when filtered
+	dailyFilter := bson.M{"company_id": companyID, "scope": models.UsageScopeCompany, "date": dateRange}
+	if userID != nil && !userID.IsZero() {
+		dailyFilter = userFilter
+	}
+	cursor, err := usageDailyCollection.Find(ctx, dailyFilter, options.Find().SetSort(bson.D{{Key: "date", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &report.Daily); err != nil {
+		return nil, err
+	}
+	for _, day := range report.Daily {
+		report.Totals.PromptTokens += day.PromptTokens
+		report.Totals.CompletionTokens += day.CompletionTokens
+		report.Totals.TotalTokens += day.TotalTokens
+		report.Totals.Requests += day.Requests
+		report.Totals.EstimatedRequests += day.EstimatedRequests
+	}
+
+	sums := bson.M{
+		"prompt_tokens":      bson.M{"$sum": "$prompt_tokens"},
+		"completion_tokens":  bson.M{"$sum": "$completion_tokens"},
+		"total_tokens":       bson.M{"$sum": "$total_tokens"},
+		"requests":           bson.M{"$sum": "$requests"},
+		"estimated_requests": bson.M{"$sum": "$estimated_requests"},
+	}
+
+	// Per user, with the department they were in on their latest day
+	byUserGroup := bson.M{"_id": "$user_id", "department": bson.M{"$last": "$department"}}
+	for k, v := range sums {
+		byUserGroup[k] = v
+	}
+	byUserPipeline := mongo.Pipeline{
+		{{Key: "$match", Value: userFilter}},
+		{{Key: "$sort", Value: bson.M{"date": 1}}},
+		{{Key: "$group", Value: byUserGroup}},
+		{{Key: "$lookup", Value: bson.M{"from": "users", "localField": "_id", "foreignField": "_id", "as": "user"}}},
+		{{Key: "$set", Value: bson.M{
+			"name":  bson.M{"$first": "$user.name"},
+			"email": bson.M{"$first": "$user.email"},
+		}}},
+		{{Key: "$project", Value: bson.M{"user": 0}}},
+		{{Key: "$sort", Value: bson.M{"total_tokens": -1}}},
+	}
+	cursor, err = usageDailyCollection.Aggregate(ctx, byUserPipeline)
+	if err != nil {
+		return nil, err
+	}
+	if err := cursor.All(ctx, &report.ByUser); err != nil {
+		return nil, err
+	}
+
+	// Per department, for chargeback
+	departments := map[string]*DepartmentUsage{}
+	for _, u := range report.ByUser {
+		d, ok := departments[u.Department]
+		if !ok {
+			d = &DepartmentUsage{Department: u.Department}
+			departments[u.Department] = d
+		}
+		d.Users++
+		d.PromptTokens += u.PromptTokens
+		d.CompletionTokens += u.CompletionTokens
+		d.TotalTokens += u.TotalTokens
+		d.Requests += u.Requests
+		d.EstimatedRequests += u.EstimatedRequests
+	}
+	for _, d := range departments {
+		report.ByDepartment = append(report.ByDepartment, *d)
+	}
+	sort.Slice(report.ByDepartment, func(i, j int) bool {
+		return report.ByDepartment[i].TotalTokens > report.ByDepartment[j].TotalTokens
+	})
+
+	return report, nil
+}
@@ -101,8 +101,18 @@ func CreateUserWithRole(input CreateUserInput, createdBy primitive.ObjectID) (*m
 		CreatedBy:     createdBy,
 	}
 
+	// Active users take a seat
+	if input.IsActive {
+		if err := ReserveSeat(companyID); err != nil {
+			return nil, err
+		}
+	}
+
 	_, err = userCollection.InsertOne(ctx, newUser)
 	if err != nil {
+		if input.IsActive {
+			ReleaseSeat(companyID)
+		}
 		return nil, err
 	}
 
@@ -171,10 +181,6 @@ func UpdateUserByID(userID primitive.ObjectID, input UpdateUserInput) error {
 	if input.Position != "" {
 		updates["position"] = input.Position
 	}
-	if input.IsActive != nil {
-		updates["is_active"] = *input.IsActive
-	}
-
 	// If role is being changed, update role and permissions
 	if input.RoleID != "" {
 		roleID, err := primitive.ObjectIDFromHex(input.RoleID)
@@ -192,6 +198,13 @@ func UpdateUserByID(userID primitive.ObjectID, input UpdateUserInput) error {
 		updates["permissions"] = role.Permissions
 	}
 
+	if input.IsActive != nil {
+		// Reactivating a user takes a seat, deactivating one frees it
+		if err := setUserActive(userID, *input.IsActive); err != nil {
+			return err
+		}
+	}
+
 	updates["updated_at"] = primitive.NewDateTimeFromTime(time.Now())
 
 	_, err := userCollection.UpdateOne(
@@ -199,26 +212,65 @@ func UpdateUserByID(userID primitive.ObjectID, input UpdateUserInput) error {
 		bson.M{"_id": userID},
 		bson.M{"$set": updates},
 	)
+	if err != nil {
+		return err
+	}
+	InvalidateUserAccess(userID)
 
+	// Deactivated users are signed out everywhere
+	if input.IsActive != nil && !*input.IsActive {
+		_, err = RevokeUserSessions(userID, models.SessionRevokedUserDeactivated, "")
+	}
 	return err
 }
 
-// DeleteUser soft deletes a user by deactivating them
+// DeleteUser soft deletes a user by deactivating them and revoking their sessions
 func DeleteUser(userID primitive.ObjectID) error {
-	_, err := userCollection.UpdateOne(
-		context.Background(),
-		bson.M{"_id": userID},
-		bson.M{
-			"$set": bson.M{
-				"is_active":  false,
-				"updated_at": primitive.NewDateTimeFromTime(time.Now()),
-			},
-		},
+	if err := setUserActive(userID, false); err != nil {
+		return err
+	}
+	InvalidateUserAccess(userID)
+
+	_, err := RevokeUserSessions(userID, models.SessionRevokedUserDeactivated, "")
+	return err
+}
+
+// setUserActive activates or deactivates a user and takes or frees their
+// seat. The flag is only written when it changes, so concurrent requests for
+// the same user cannot take or free its seat twice.
+func setUserActive(userID primitive.ObjectID, active bool) error {
+	ctx := context.Background()
+
+	var user models.User
+	if err := userCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user); err != nil {
+		return err
+	}
+	if user.IsActive == active {
+		return nil
+	}
+
+	if active {
+		if err := ReserveSeat(user.CompanyID); err != nil {
+			return err
+		}
+	}
+
+	result, err := userCollection.UpdateOne(ctx,
+		bson.M{"_id": userID, "is_active": !active},
+		bson.M{"$set": bson.M{
+			"is_active":  active,
+			"updated_at": primitive.NewDateTimeFromTime(time.Now()),
+		}},
 	)
+	changed := err == nil && result.ModifiedCount > 0
+	if active != changed {
+		// Give back the reserved seat, or free the deactivated user's one
+		ReleaseSeat(user.CompanyID)
+	}
 	return err
 }
 
-// ResetUserPassword resets a user's password
+// ResetUserPassword resets a user's password and revokes their sessions
 func ResetUserPassword(userID primitive.ObjectID, newPassword string) error {
 	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
 	if err != nil {
@@ -235,6 +287,11 @@ func ResetUserPassword(userID primitive.ObjectID, newPassword string) error {
 			},
 		},
 	)
+	if err != nil {
+		return err
+	}
+
+	_, err = RevokeUserSessions(userID, models.SessionRevokedPasswordChanged, "")
 	return err
 }
 
@@ -0,0 +1,236 @@
+package utils
+
+import "strings"
+
+// Diff line operations
+const (
+	DiffEqual  = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+)
+
+// maxDiffEdits bounds the Myers search; texts further apart than this are
+// reported as one replaced block rather than a minimal diff.
+const maxDiffEdits = 2000
+
+// DiffLine is one line of a diff. OldLine and NewLine are 1-based and zero
+// when the line does not exist on that side.
+type DiffLine struct {
+	Op      string `json:"op"`
+	Text    string `json:"text"`
+	OldLine int    `json:"old_line,omitempty"`
+	NewLine int    `json:"new_line,omitempty"`
+}
+
+// DiffHunk is a run of changes with surrounding context, as in a unified diff
+type DiffHunk struct {
+	OldStart int        `json:"old_start"`
+	OldLines int        `json:"old_lines"`
+	NewStart int        `json:"new_start"`
+	NewLines int        `json:"new_lines"`
+	Lines    []DiffLine `json:"lines"`
+}
+
+// LineDiff compares two texts line by line and returns the changed hunks with
+// up to context unchanged lines around each, plus the added and removed line
+// counts.
+func LineDiff(oldText, newText string, context int) ([]DiffHunk, int, int) {
+	lines := diffLines(splitLines(oldText), splitLines(newText))
+
+	added, removed := 0, 0
+	for _, line := range lines {
+		switch line.Op {
+		case DiffInsert:
+			added++
+		case DiffDelete:
+			removed++
+		}
+	}
+	return groupHunks(lines, context), added, removed
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines returns the full edit script turning a into b
+func diffLines(a, b []string) []DiffLine {
+	// Common prefix and suffix need no search
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var result []DiffLine
+	for i := 0; i < prefix; i++ {
+		result = append(result, DiffLine{Op: DiffEqual, Text: a[i], OldLine: i + 1, NewLine: i + 1})
+	}
+	for _, line := range myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		if line.OldLine > 0 {
+			line.OldLine += prefix
+		}
+		if line.NewLine > 0 {
+			line.NewLine += prefix
+		}
+		result = append(result, line)
+	}
+	for i := 0; i < suffix; i++ {
+		oldIndex, newIndex := len(a)-suffix+i, len(b)-suffix+i
+		result = append(result, DiffLine{Op: DiffEqual, Text: a[oldIndex], OldLine: oldIndex + 1, NewLine: newIndex + 1})
+	}
+	return result
+}
+
+// myers computes a shortest edit script with Myers' O(ND) algorithm. Line
+// numbers in the result are relative to a and b.
+func myers(a, b []string) []DiffLine {
+	n, m := len(a), len(b)
+	limit := min(n+m, maxDiffEdits)
+	offset := limit + 1
+	v := make([]int, 2*limit+3)
+
+	// trace[d] holds v for diagonals -d..d before step d
+	var trace [][]int
+	found := false
+	for d := 0; d <= limit && !found; d++ {
+		snapshot := make([]int, 2*d+1)
+		copy(snapshot, v[offset-d:offset+d+1])
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				found = true
+				break
+			}
+		}
+	}
+	if !found {
+		return replaceAll(a, b)
+	}
+
+	// Walk back from (n, m) collecting the script in reverse
+	var reversed []DiffLine
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		prev := trace[d]
+		at := func(k int) int { return prev[k+d] }
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && at(k-1) < at(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = at(prevK)
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, DiffLine{Op: DiffEqual, Text: a[x], OldLine: x + 1, NewLine: y + 1})
+		}
+		if d == 0 {
+			break
+		}
+		if x == prevX {
+			y--
+			reversed = append(reversed, DiffLine{Op: DiffInsert, Text: b[y], NewLine: y + 1})
+		} else {
+			x--
+			reversed = append(reversed, DiffLine{Op: DiffDelete, Text: a[x], OldLine: x + 1})
+		}
+	}
+
+	result := make([]DiffLine, len(reversed))
+	for i, line := range reversed {
+		result[len(reversed)-1-i] = line
+	}
+	return result
+}
+
+func replaceAll(a, b []string) []DiffLine {
+	result := make([]DiffLine, 0, len(a)+len(b))
+	for i, line := range a {
+		result = append(result, DiffLine{Op: DiffDelete, Text: line, OldLine: i + 1})
+	}
+	for i, line := range b {
+		result = append(result, DiffLine{Op: DiffInsert, Text: line, NewLine: i + 1})
+	}
+	return result
+}
+
+// groupHunks cuts an edit script into hunks of changes with context lines
+func groupHunks(lines []DiffLine, context int) []DiffHunk {
+	hunks := []DiffHunk{}
+	for i := 0; i < len(lines); {
+		if lines[i].Op == DiffEqual {
+			i++
+			continue
+		}
+
+		start := max(i-context, 0)
+		end := i
+		// Extend while the next change is within 2*context equal lines
+		for end < len(lines) {
+			if lines[end].Op != DiffEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].Op == DiffEqual {
+				run++
+			}
+			if run == len(lines) || run-end > 2*context {
+				end = min(end+context, len(lines))
+				break
+			}
+			end = run
+		}
+
+		hunks = append(hunks, newHunk(lines[start:end]))
+		i = end
+	}
+	return hunks
+}
+
+func newHunk(lines []DiffLine) DiffHunk {
+	hunk := DiffHunk{Lines: lines}
+	for _, line := range lines {
+		if line.OldLine > 0 {
+			if hunk.OldStart == 0 {
+				hunk.OldStart = line.OldLine
+			}
+			hunk.OldLines++
+		}
+		if line.NewLine > 0 {
+			if hunk.NewStart == 0 {
+				hunk.NewStart = line.NewLine
+			}
+			hunk.NewLines++
+		}
+	}
+	return hunk
+}
@@ -0,0 +1,234 @@
+package utils
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func lines(n int, format string) string {
+	var b strings.Builder
+	for i := 1; i <= n; i++ {
+		fmt.Fprintf(&b, format+"\n", i)
+	}
+	return b.String()
+}
+
+func TestLineDiff(t *testing.T) {
+	tests := []struct {
+		name        string
+		old, new    string
+		context     int
+		want        []DiffHunk
+		wantAdded   int
+		wantRemoved int
+	}{
+		{
+			name: "both empty",
+			want: []DiffHunk{},
+		},
+		{
+			name: "identical",
+			old:  "a\nb\n", new: "a\nb",
+			context: 3,
+			want:    []DiffHunk{},
+		},
+		{
+			name: "empty to text",
+			new:  "a\nb\n", context: 3,
+			want: []DiffHunk{{OldStart: 0, OldLines: 0, NewStart: 1, NewLines: 2, Lines: []DiffLine{
+				{Op: DiffInsert, Text: "a", NewLine: 1},
+				{Op: DiffInsert, Text: "b", NewLine: 2},
+			}}},
+			wantAdded: 2,
+		},
+		{
+			name: "text to empty",
+			old:  "a\nb", context: 3,
+			want: []DiffHunk{{OldStart: 1, OldLines: 2, NewStart: 0, NewLines: 0, Lines: []DiffLine{
+				{Op: DiffDelete, Text: "a", OldLine: 1},
+				{Op: DiffDelete, Text: "b", OldLine: 2},
+			}}},
+			wantRemoved: 2,
+		},
+		{
+			name: "pure insert",
+			old:  "a\nb\nc\nd", new: "a\nb\nX\nc\nd", context: 1,
+			want: []DiffHunk{{OldStart: 2, OldLines: 2, NewStart: 2, NewLines: 3, Lines: []DiffLine{
+				{Op: DiffEqual, Text: "b", OldLine: 2, NewLine: 2},
+				{Op: DiffInsert, Text: "X", NewLine: 3},
+				{Op: DiffEqual, Text: "c", OldLine: 3, NewLine: 4},
+			}}},
+			wantAdded: 1,
+		},
+		{
+			name: "pure delete",
+			old:  "a\nb\nX\nY\nc\nd", new: "a\nb\nc\nd", context: 1,
+			want: []DiffHunk{{OldStart: 2, OldLines: 4, NewStart: 2, NewLines: 2, Lines: []DiffLine{
+				{Op: DiffEqual, Text: "b", OldLine: 2, NewLine: 2},
+				{Op: DiffDelete, Text: "X", OldLine: 3},
+				{Op: DiffDelete, Text: "Y", OldLine: 4},
+				{Op: DiffEqual, Text: "c", OldLine: 5, NewLine: 3},
+			}}},
+			wantRemoved: 2,
+		},
+		{
+			// The common prefix and suffix are trimmed before the search;
+			// the numbering must still count them
+			name: "prefix and suffix offsets",
+			old:  "p1\np2\nold\ns1\ns2", new: "p1\np2\nnew1\nnew2\ns1\ns2", context: 0,
+			want: []DiffHunk{{OldStart: 3, OldLines: 1, NewStart: 3, NewLines: 2, Lines: []DiffLine{
+				{Op: DiffDelete, Text: "old", OldLine: 3},
+				{Op: DiffInsert, Text: "new1", NewLine: 3},
+				{Op: DiffInsert, Text: "new2", NewLine: 4},
+			}}},
+			wantAdded: 2, wantRemoved: 1,
+		},
+		{
+			name: "changes further apart than twice the context are separate hunks",
+			old:  lines(10, "l%d"), new: strings.NewReplacer("l2\n", "L2\n", "l7\n", "L7\n").Replace(lines(10, "l%d")), context: 1,
+			want: []DiffHunk{
+				{OldStart: 1, OldLines: 3, NewStart: 1, NewLines: 3, Lines: []DiffLine{
+					{Op: DiffEqual, Text: "l1", OldLine: 1, NewLine: 1},
+					{Op: DiffDelete, Text: "l2", OldLine: 2},
+					{Op: DiffInsert, Text: "L2", NewLine: 2},
+					{Op: DiffEqual, Text: "l3", OldLine: 3, NewLine: 3},
+				}},
+				{OldStart: 6, OldLines: 3, NewStart: 6, NewLines: 3, Lines: []DiffLine{
+					{Op: DiffEqual, Text: "l6", OldLine: 6, NewLine: 6},
+					{Op: DiffDelete, Text: "l7", OldLine: 7},
+					{Op: DiffInsert, Text: "L7", NewLine: 7},
+					{Op: DiffEqual, Text: "l8", OldLine: 8, NewLine: 8},
+				}},
+			},
+			wantAdded: 2, wantRemoved: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hunks, added, removed := LineDiff(tt.old, tt.new, tt.context)
+			if !reflect.DeepEqual(hunks, tt.want) {
+				t.Errorf("hunks =\n%+v\nwant\n%+v", hunks, tt.want)
+			}
+			if added != tt.wantAdded || removed != tt.wantRemoved {
+				t.Errorf("added, removed = %d, %d; want %d, %d", added, removed, tt.wantAdded, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestLineDiffMergesHunksWithinContext(t *testing.T) {
+	old := lines(10, "l%d")
+	changed := strings.NewReplacer("l2\n", "L2\n", "l7\n", "L7\n").Replace(old)
+
+	// Four equal lines separate the changes: merged when 2*context >= 4
+	for context, wantHunks := range map[int]int{0: 2, 1: 2, 2: 1, 3: 1} {
+		hunks, _, _ := LineDiff(old, changed, context)
+		if len(hunks) != wantHunks {
+			t.Errorf("context %d: %d hunks, want %d", context, len(hunks), wantHunks)
+		}
+	}
+
+	hunks, _, _ := LineDiff(old, changed, 2)
+	want := DiffHunk{OldStart: 1, OldLines: 9, NewStart: 1, NewLines: 9}
+	got := hunks[0]
+	got.Lines = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("merged hunk = %+v, want %+v", got, want)
+	}
+}
+
+func TestLineDiffFallsBackBeyondMaxEdits(t *testing.T) {
+	// A shared middle line would be kept by a minimal diff, but the texts are
+	// more than maxDiffEdits apart, so everything between the common prefix
+	// and suffix is replaced
+	half := maxDiffEdits / 2
+	old := "same\n" + lines(half, "a%d") + "middle\n" + lines(half, "a%d-2") + "end\n"
+	new := "same\n" + lines(half, "b%d") + "middle\n" + lines(half, "b%d-2") + "end\n"
+
+	hunks, added, removed := LineDiff(old, new, 1)
+	if added != 2*half+1 || removed != 2*half+1 {
+		t.Fatalf("added, removed = %d, %d; want %d each", added, removed, 2*half+1)
+	}
+	if len(hunks) != 1 {
+		t.Fatalf("got %d hunks, want 1", len(hunks))
+	}
+	hunk := hunks[0]
+	if hunk.OldStart != 1 || hunk.NewStart != 1 || hunk.OldLines != 2*half+3 || hunk.NewLines != 2*half+3 {
+		t.Fatalf("hunk header = %d,%d %d,%d", hunk.OldStart, hunk.OldLines, hunk.NewStart, hunk.NewLines)
+	}
+
+	body := hunk.Lines[1 : len(hunk.Lines)-1]
+	for i, line := range body {
+		wantOp, wantOld, wantNew := DiffDelete, i+2, 0
+		if i > 2*half {
+			wantOp, wantOld, wantNew = DiffInsert, 0, i-2*half+1
+		}
+		if line.Op != wantOp || line.OldLine != wantOld || line.NewLine != wantNew {
+			t.Fatalf("line %d = %+v, want %s old %d new %d", i, line, wantOp, wantOld, wantNew)
+		}
+	}
+}
+
+// TestDiffLinesIsMinimal checks random edits against the LCS length and that
+// the script rebuilds both texts with consecutive line numbers.
+func TestDiffLinesIsMinimal(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		out := make([]string, r.Intn(12))
+		for i := range out {
+			out[i] = string(rune('a' + r.Intn(4)))
+		}
+		return out
+	}
+
+	for iter := 0; iter < 500; iter++ {
+		a, b := randomLines(), randomLines()
+		script := diffLines(a, b)
+
+		var rebuiltOld, rebuiltNew []string
+		edits := 0
+		for _, line := range script {
+			if line.Op != DiffInsert {
+				rebuiltOld = append(rebuiltOld, line.Text)
+				if line.OldLine != len(rebuiltOld) {
+					t.Fatalf("%q -> %q: old line %d at position %d", a, b, line.OldLine, len(rebuiltOld))
+				}
+			}
+			if line.Op != DiffDelete {
+				rebuiltNew = append(rebuiltNew, line.Text)
+				if line.NewLine != len(rebuiltNew) {
+					t.Fatalf("%q -> %q: new line %d at position %d", a, b, line.NewLine, len(rebuiltNew))
+				}
+			}
+			if line.Op != DiffEqual {
+				edits++
+			}
+		}
+		if strings.Join(rebuiltOld, ",") != strings.Join(a, ",") || strings.Join(rebuiltNew, ",") != strings.Join(b, ",") {
+			t.Fatalf("%q -> %q: script rebuilds %q -> %q", a, b, rebuiltOld, rebuiltNew)
+		}
+		if want := len(a) + len(b) - 2*lcsLength(a, b); edits != want {
+			t.Fatalf("%q -> %q: %d edits, minimal is %d", a, b, edits, want)
+		}
+	}
+}
+
+func lcsLength(a, b []string) int {
+	table := make([][]int, len(a)+1)
+	for i := range table {
+		table[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				table[i][j] = table[i+1][j+1] + 1
+			} else {
+				table[i][j] = max(table[i+1][j], table[i][j+1])
+			}
+		}
+	}
+	return table[0][0]
+}
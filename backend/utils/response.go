@@ -20,10 +20,30 @@ func SuccessResponse(c echo.Context, message string, data interface{}) error {
 	})
 }
 
+// AcceptedResponse sends a standard success response with a 202 Accepted
+// status, for work that continues in the background.
+func AcceptedResponse(c echo.Context, message string, data interface{}) error {
+	return c.JSON(202, Response{
+		Success: true,
+		Message: message,
+		Data:    data,
+	})
+}
+
 // ErrorResponse sends a standard error response with a given status code.
 func ErrorResponse(c echo.Context, statusCode int, message string) error {
 	return c.JSON(statusCode, Response{
 		Success: false,
 		Message: message,
 	})
-}
\ No newline at end of file
+}
+
+// ErrorResponseWithData sends an error response that also carries structured
+// details (e.g. the limit and current usage for quota errors).
+func ErrorResponseWithData(c echo.Context, statusCode int, message string, data interface{}) error {
+	return c.JSON(statusCode, Response{
+		Success: false,
+		Message: message,
+		Data:    data,
+	})
+}
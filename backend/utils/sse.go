@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// SSEStream writes Server-Sent Events to an Echo response.
+type SSEStream struct {
+	c echo.Context
+}
+
+// NewSSEStream sets the event-stream headers, flushes them and returns a stream
+// ready for Send. Once called, the handler must not write a JSON response.
+func NewSSEStream(c echo.Context) *SSEStream {
+	header := c.Response().Header()
+	header.Set(echo.HeaderContentType, "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // Disable proxy buffering (nginx, Render)
+
+	c.Response().WriteHeader(http.StatusOK)
+	c.Response().Flush()
+
+	return &SSEStream{c: c}
+}
+
+// Send writes a single named event with a JSON encoded payload and flushes it.
+func (s *SSEStream) Send(event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(s.c.Response(), "event: %s\ndata: %s\n\n", event, payload); err != nil {
+		return err
+	}
+	s.c.Response().Flush()
+	return nil
+}
+
+// KeepAlive writes a comment line so that proxies do not close an idle stream.
+func (s *SSEStream) KeepAlive() error {
+	if _, err := fmt.Fprint(s.c.Response(), ": keep-alive\n\n"); err != nil {
+		return err
+	}
+	s.c.Response().Flush()
+	return nil
+}
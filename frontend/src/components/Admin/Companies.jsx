@@ -204,7 +204,7 @@ const Companies = () => {
                 <div><label className={labelCls}>Company Email <span className="text-red-400">*</span></label><input type="email" required value={formData.email} onChange={(e) => setFormData({ ...formData, email: e.target.value })} className={inputCls} /></div>
                 <div><label className={labelCls}>Phone</label><input type="tel" value={formData.phone} onChange={(e) => setFormData({ ...formData, phone: e.target.value })} className={inputCls} /></div>
                 <div className="col-span-2"><label className={labelCls}>Address</label><input type="text" value={formData.address} onChange={(e) => setFormData({ ...formData, address: e.target.value })} className={inputCls} /></div>
-                <div className="col-span-2"><label className={labelCls}>Subscription Tier</label><select required value={formData.subscription_tier} onChange={(e) => setFormData({ ...formData, subscription_tier: e.target.value })} className={selectCls}><option value="free">Free (10 users)</option><option value="basic">Basic (50 users)</option><option value="pro">Pro (200 users)</option><option value="enterprise">Enterprise (Unlimited)</option></select></div>
+                <div className="col-span-2"><label className={labelCls}>Subscription Tier</label><select required value={formData.subscription_tier} onChange={(e) => setFormData({ ...formData, subscription_tier: e.target.value })} className={selectCls}><option value="free">Free (10 users)</option><option value="basic">Basic (50 users)</option><option value="premium">Premium (250 users)</option><option value="enterprise">Enterprise (Unlimited)</option></select></div>
               </div>
               <div className="flex gap-3 pt-2 border-t border-zinc-100 dark:border-zinc-800">
                 <button type="button" onClick={() => { setShowEditModal(false); setEditingCompany(null); setFormData(emptyForm); }} className="flex-1 px-4 py-2.5 bg-zinc-100 dark:bg-zinc-800 hover:bg-zinc-200 dark:hover:bg-zinc-700 text-zinc-700 dark:text-zinc-200 rounded-xl text-sm font-medium transition-all">Cancel</button>
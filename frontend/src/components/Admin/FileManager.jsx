@@ -1,5 +1,6 @@
 import { useState, useEffect, useCallback } from "react";
 import axios from "axios";
+import { waitForJob } from "../../services/jobsAPI";
 import toast from "react-hot-toast";
 import { useSelector } from "react-redux";
 
@@ -77,12 +78,17 @@ const FileManager = () => {
     formData.append("document", file);
     setUploading(true);
     try {
-      await axios.post(`${process.env.REACT_APP_API_URL}/knowledge-base/documents`, formData, {
+      const r = await axios.post(`${process.env.REACT_APP_API_URL}/knowledge-base/documents`, formData, {
         headers: { "Content-Type": "multipart/form-data" }, withCredentials: true,
       });
+      if (r.data.data?.duplicate) {
+        toast(`"${file.name}" is already in the knowledge base as "${r.data.data.document.filename}"`);
+        return;
+      }
+      await waitForJob(r.data.data.id);
       toast.success(`"${file.name}" uploaded successfully`);
       fetchDocs();
-    } catch (err) { toast.error(err.response?.data?.message || "Upload failed"); }
+    } catch (err) { toast.error(err.response?.data?.message || err.message || "Upload failed"); }
     finally { setUploading(false); e.target.value = ""; }
   };
 
@@ -1,7 +1,8 @@
-import { useState, useEffect, useCallback } from "react";
+import { Fragment, useState, useEffect, useCallback } from "react";
 import axios from "axios";
 import toast from "react-hot-toast";
 import { useSelector } from "react-redux";
+import { waitForJob, jobProgressLabel } from "../../services/jobsAPI";
 
 const API = process.env.REACT_APP_API_URL;
 
@@ -25,21 +26,29 @@ const KnowledgeBase = () => {
 
   const [selectedFile, setSelectedFile] = useState(null);
   const [isUploading, setIsUploading] = useState(false);
+  const [uploadJob, setUploadJob] = useState(null);
   const [docs, setDocs] = useState([]);
   const [loadingDocs, setLoadingDocs] = useState(true);
   const [dragOver, setDragOver] = useState(false);
+  const [history, setHistory] = useState(null); // { logicalId, versions }
+  const [isImporting, setIsImporting] = useState(false);
+  const [importReport, setImportReport] = useState(null);
+  const [tagFilter, setTagFilter] = useState("");
 
   const fetchDocs = useCallback(async () => {
     try {
       setLoadingDocs(true);
-      const r = await axios.get(`${API}/knowledge-base/documents`, { withCredentials: true });
+      const r = await axios.get(`${API}/knowledge-base/documents`, {
+        params: tagFilter ? { tag: tagFilter } : {},
+        withCredentials: true,
+      });
       setDocs(r.data.data || []);
     } catch {
       // silently fail — list is non-critical
     } finally {
       setLoadingDocs(false);
     }
-  }, []);
+  }, [tagFilter]);
 
   useEffect(() => { fetchDocs(); }, [fetchDocs]);
 
@@ -49,30 +58,76 @@ const KnowledgeBase = () => {
     setSelectedFile(file);
   };
 
+  const postDocument = (onDuplicate) => {
+    const formData = new FormData();
+    formData.append("document", selectedFile);
+    if (onDuplicate) formData.append("on_duplicate", onDuplicate);
+    return axios.post(`${API}/knowledge-base/documents`, formData, {
+      headers: { "Content-Type": "multipart/form-data" },
+      withCredentials: true,
+    });
+  };
+
   const handleUpload = async () => {
     if (!selectedFile) return;
     setIsUploading(true);
-    const formData = new FormData();
-    formData.append("document", selectedFile);
     try {
-      const r = await axios.post(`${API}/knowledge-base/documents`, formData, {
-        headers: { "Content-Type": "multipart/form-data" },
-        withCredentials: true,
-      });
+      let r = await postDocument();
+      if (r.data?.data?.duplicate) {
+        // Identical content is not indexed twice; a renamed copy may become a new version
+        const existing = r.data.data.document;
+        if (existing.filename === selectedFile.name ||
+            !window.confirm(`"${selectedFile.name}" is identical to "${existing.filename}". Save it as a new version of "${existing.filename}"?`)) {
+          toast(`"${selectedFile.name}" is already in the knowledge base`);
+          setSelectedFile(null);
+          return;
+        }
+        r = await postDocument("new_version");
+      }
       if (r.data?.success) {
-        toast.success(`"${selectedFile.name}" uploaded successfully`);
+        // Extraction and indexing run in the background
+        setUploadJob(r.data.data);
+        const job = await waitForJob(r.data.data.id, setUploadJob);
+        const version = job.result?.version;
+        toast.success(version > 1 ? `"${selectedFile.name}" uploaded as version ${version}` : `"${selectedFile.name}" uploaded successfully`);
         setSelectedFile(null);
         fetchDocs();
       }
     } catch (err) {
-      toast.error(err.response?.data?.message || "Upload failed. Please try again.");
+      toast.error(err.response?.data?.message || err.message || "Upload failed. Please try again.");
     } finally {
       setIsUploading(false);
+      setUploadJob(null);
+    }
+  };
+
+  const handleImport = async (file) => {
+    if (!file) return;
+    setIsImporting(true);
+    const formData = new FormData();
+    formData.append("archive", file);
+    try {
+      const r = await axios.post(`${API}/knowledge-base/import`, formData, {
+        headers: { "Content-Type": "multipart/form-data" },
+        withCredentials: true,
+      });
+      // The archive is read in the background; its report is ready once the job finishes
+      const { import_id: importId, job_id: jobId } = r.data.data;
+      await waitForJob(jobId);
+      const { data } = await axios.get(`${API}/knowledge-base/imports/${importId}`, { withCredentials: true });
+      const report = data.data;
+      setImportReport(report);
+      toast.success(`${report.queued} queued, ${report.skipped} skipped, ${report.rejected} rejected`);
+      fetchDocs();
+    } catch (err) {
+      toast.error(err.response?.data?.message || err.message || "Import failed");
+    } finally {
+      setIsImporting(false);
     }
   };
 
   const handleDelete = async (docId, filename) => {
-    if (!window.confirm(`Delete "${filename}"? This cannot be undone.`)) return;
+    if (!window.confirm(`Delete "${filename}" and all its versions? This cannot be undone.`)) return;
     try {
       await axios.delete(`${API}/knowledge-base/documents/${docId}`, { withCredentials: true });
       toast.success("Document deleted");
@@ -82,6 +137,40 @@ const KnowledgeBase = () => {
     }
   };
 
+  const handleResync = async (docId) => {
+    try {
+      const r = await axios.post(`${API}/knowledge-base/documents/${docId}/resync`, {}, { withCredentials: true });
+      toast.success("Document synced");
+      setDocs(prev => prev.map(d => (d.id === docId ? r.data.data : d)));
+    } catch (err) {
+      toast.error(err.response?.data?.message || "Resync failed");
+      const updated = err.response?.data?.data;
+      if (updated?.id) setDocs(prev => prev.map(d => (d.id === docId ? updated : d)));
+    }
+  };
+
+  const toggleHistory = async (doc) => {
+    if (history?.logicalId === doc.logical_id) { setHistory(null); return; }
+    try {
+      const r = await axios.get(`${API}/knowledge-base/documents/${doc.id}/versions`, { withCredentials: true });
+      setHistory({ logicalId: doc.logical_id, docId: doc.id, versions: r.data.data || [] });
+    } catch (err) {
+      toast.error(err.response?.data?.message || "Failed to load versions");
+    }
+  };
+
+  const handleRollback = async (docId, version) => {
+    if (!window.confirm(`Restore version ${version} as the current version?`)) return;
+    try {
+      await axios.post(`${API}/knowledge-base/documents/${docId}/versions/${version}/rollback`, {}, { withCredentials: true });
+      toast.success(`Version ${version} restored`);
+      setHistory(null);
+      fetchDocs();
+    } catch (err) {
+      toast.error(err.response?.data?.message || "Rollback failed");
+    }
+  };
+
   const onDrop = (e) => {
     e.preventDefault();
     setDragOver(false);
@@ -156,21 +245,55 @@ const KnowledgeBase = () => {
                   : "bg-cyan-500 hover:bg-cyan-400 text-white shadow-sm shadow-cyan-500/20"
               }`}
             >
-              {isUploading ? "Uploading…" : "Upload to Knowledge Base"}
+              {isUploading ? jobProgressLabel(uploadJob) : "Upload to Knowledge Base"}
             </button>
             {selectedFile && !isUploading && (
               <button onClick={() => setSelectedFile(null)} className="text-sm text-zinc-400 hover:text-zinc-600 dark:hover:text-zinc-300 transition-colors">
                 Clear
               </button>
             )}
+            <label className={`ml-auto px-4 py-2.5 rounded-xl text-sm font-semibold border transition-colors ${
+              isImporting
+                ? "border-zinc-200 dark:border-zinc-700 text-zinc-400 cursor-not-allowed"
+                : "border-cyan-300 dark:border-cyan-600 text-cyan-600 dark:text-cyan-400 hover:bg-cyan-50 dark:hover:bg-cyan-500/5 cursor-pointer"
+            }`}>
+              {isImporting ? "Importing…" : "Import ZIP"}
+              <input
+                type="file"
+                accept=".zip"
+                disabled={isImporting}
+                onChange={(e) => { handleImport(e.target.files?.[0]); e.target.value = ""; }}
+                className="hidden"
+              />
+            </label>
           </div>
+
+          {importReport && importReport.skipped + importReport.rejected > 0 && (
+            <div className="mt-4 border border-zinc-200 dark:border-zinc-800 rounded-xl max-h-48 overflow-y-auto">
+              {importReport.files.filter(f => f.status !== "queued").map((f) => (
+                <div key={f.path} className="flex justify-between gap-4 px-4 py-2 text-xs border-b last:border-b-0 border-zinc-100 dark:border-zinc-800">
+                  <span className="font-mono text-zinc-600 dark:text-zinc-300 truncate" title={f.path}>{f.path}</span>
+                  <span className={f.status === "rejected" ? "text-red-500 dark:text-red-400" : "text-zinc-400"}>
+                    {f.duplicate_of ? `duplicate of ${f.duplicate_of}` : f.reason}
+                  </span>
+                </div>
+              ))}
+            </div>
+          )}
         </div>
       )}
 
       {/* Documents list */}
       <div className="bg-white dark:bg-zinc-900 border border-zinc-200 dark:border-zinc-800 rounded-2xl overflow-hidden">
         <div className="px-6 py-4 border-b border-zinc-100 dark:border-zinc-800">
-          <h2 className="text-xs font-semibold text-zinc-500 dark:text-zinc-400 uppercase tracking-wider">Documents</h2>
+          <h2 className="text-xs font-semibold text-zinc-500 dark:text-zinc-400 uppercase tracking-wider">
+            Documents
+            {tagFilter && (
+              <button onClick={() => setTagFilter("")} className="ml-2 normal-case font-mono text-cyan-600 dark:text-cyan-400" title="Clear folder filter">
+                in {tagFilter} ×
+              </button>
+            )}
+          </h2>
         </div>
 
         {loadingDocs ? (
@@ -188,9 +311,20 @@ const KnowledgeBase = () => {
             </thead>
             <tbody className="divide-y divide-zinc-100 dark:divide-zinc-800">
               {docs.map((doc) => (
-                <tr key={doc.id} className="hover:bg-zinc-50 dark:hover:bg-zinc-800/50 transition-colors">
+                <Fragment key={doc.id}>
+                <tr className="hover:bg-zinc-50 dark:hover:bg-zinc-800/50 transition-colors">
                   <td className="px-6 py-4 text-sm font-medium text-zinc-800 dark:text-white max-w-xs truncate" title={doc.filename}>
                     {doc.filename}
+                    {doc.version > 1 && (
+                      <button onClick={() => toggleHistory(doc)} className="ml-2 text-xs font-mono text-zinc-400 hover:text-zinc-600 dark:hover:text-zinc-300">
+                        v{doc.version}
+                      </button>
+                    )}
+                    {doc.tags?.length > 0 && (
+                      <button onClick={() => setTagFilter(doc.tags[doc.tags.length - 1])} className="block text-xs font-mono text-zinc-400 hover:text-cyan-600 dark:hover:text-cyan-400">
+                        {doc.tags[doc.tags.length - 1]}
+                      </button>
+                    )}
                   </td>
                   <td className="px-6 py-4 text-xs font-mono text-zinc-500 dark:text-zinc-400">
                     {doc.mime_type?.split("/").pop()?.toUpperCase() || "—"}
@@ -203,13 +337,39 @@ const KnowledgeBase = () => {
                     {doc.created_at ? new Date(doc.created_at).toLocaleDateString() : "—"}
                   </td>
                   {isAdmin && (
-                    <td className="px-6 py-4 text-right">
+                    <td className="px-6 py-4 text-right space-x-3">
+                      {doc.status !== "synced" && (
+                        <button onClick={() => handleResync(doc.id)} className="text-xs font-semibold text-amber-600 dark:text-yellow-400 hover:text-amber-500 transition-colors">
+                          Resync
+                        </button>
+                      )}
                       <button onClick={() => handleDelete(doc.id, doc.filename)} className="text-xs font-semibold text-red-500 dark:text-red-400 hover:text-red-400 transition-colors">
                         Delete
                       </button>
                     </td>
                   )}
                 </tr>
+                {history?.logicalId === doc.logical_id && history.versions.map((v) => (
+                  <tr key={v.id} className="bg-zinc-50/60 dark:bg-zinc-900/60">
+                    <td className="px-6 py-2 pl-10 text-xs text-zinc-500 dark:text-zinc-400 truncate" colSpan={3}>
+                      v{v.version} · {v.filename}{v.restored_from ? ` (restored from v${v.restored_from})` : ""}
+                    </td>
+                    <td className="px-6 py-2"><StatusBadge status={v.is_current ? v.status : "superseded"} /></td>
+                    <td className="px-6 py-2 text-xs text-right text-zinc-400 dark:text-zinc-500">
+                      {v.created_at ? new Date(v.created_at).toLocaleDateString() : "—"}
+                    </td>
+                    {isAdmin && (
+                      <td className="px-6 py-2 text-right">
+                        {!v.is_current && (
+                          <button onClick={() => handleRollback(history.docId, v.version)} className="text-xs font-semibold text-cyan-600 dark:text-cyan-400 hover:text-cyan-500 transition-colors">
+                            Restore
+                          </button>
+                        )}
+                      </td>
+                    )}
+                  </tr>
+                ))}
+                </Fragment>
               ))}
             </tbody>
           </table>
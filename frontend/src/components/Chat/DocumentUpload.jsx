@@ -1,11 +1,13 @@
 import React, { useState } from "react";
 import { DocumentArrowUpIcon, XMarkIcon } from "@heroicons/react/24/outline";
 import axios from "axios";
+import { waitForJob, jobProgressLabel } from "../../services/jobsAPI";
 
 const DocumentUpload = ({ chatId, onDocumentProcessed, onCancel }) => {
   const [selectedFile, setSelectedFile] = useState(null);
   const [isUploading, setIsUploading] = useState(false);
   const [dragActive, setDragActive] = useState(false);
+  const [job, setJob] = useState(null);
 
   const handleDrag = (e) => {
     e.preventDefault();
@@ -52,18 +54,27 @@ const DocumentUpload = ({ chatId, onDocumentProcessed, onCancel }) => {
         },
       );
 
-      if (response.data.success) {
-        onDocumentProcessed(response.data.data);
+      if (response.data.data?.duplicate) {
+        // Identical files are posted to a chat only once
+        alert(`"${selectedFile.name}" is already in this chat.`);
+        setSelectedFile(null);
+      } else if (response.data.success) {
+        // Extraction and the summary run in the background
+        setJob(response.data.data);
+        const finished = await waitForJob(response.data.data.id, setJob);
+        onDocumentProcessed(finished);
         setSelectedFile(null);
       }
     } catch (error) {
       console.error("Document upload failed:", error);
       const errorMsg =
         error.response?.data?.message ||
+        error.message ||
         "Failed to process document. Please try again.";
       alert(errorMsg);
     } finally {
       setIsUploading(false);
+      setJob(null);
     }
   };
 
@@ -166,7 +177,7 @@ const DocumentUpload = ({ chatId, onDocumentProcessed, onCancel }) => {
                   {isUploading ? (
                     <span className="flex items-center justify-center gap-2">
                       <div className="animate-spin rounded-full h-3 w-3 border-b-2 border-white"></div>
-                      Processing...
+                      {jobProgressLabel(job)}
                     </span>
                   ) : (
                     "Upload"
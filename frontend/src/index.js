@@ -4,6 +4,11 @@ import './index.css';
 import App from './App';
 import { Provider } from 'react-redux';
 import { store } from './redux/store';
+import axios from 'axios';
+import { installAuthRefresh } from './utils/authRefresh';
+
+// Access tokens are short-lived; refresh them transparently on 401
+installAuthRefresh(axios);
 
 const root = ReactDOM.createRoot(document.getElementById('root'));
 root.render(
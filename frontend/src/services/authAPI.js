@@ -1,4 +1,5 @@
 import axios from 'axios';
+import { installAuthRefresh } from '../utils/authRefresh';
 
 const API_URL = `${process.env.REACT_APP_API_URL}/auth`;
 
@@ -26,6 +27,8 @@ api.interceptors.request.use((config) => {
   return Promise.reject(error);
 });
 
+installAuthRefresh(api);
+
 // --- API Functions ---
 export const register = (userData) => {
   return api.post('/register', userData);
@@ -44,11 +47,16 @@ export const logout = () => {
   return api.post('/logout');
 };
 
+export const refresh = () => {
+  return api.post('/refresh');
+};
+
 const authAPI = {
   register,
   login,
   getCurrentUser,
   logout,
+  refresh,
 };
 
 export default authAPI;
\ No newline at end of file
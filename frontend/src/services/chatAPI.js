@@ -1,4 +1,5 @@
 import axios from 'axios';
+import { installAuthRefresh } from '../utils/authRefresh';
 
 const API_URL = process.env.REACT_APP_API_URL;
 
@@ -10,6 +11,7 @@ const api = axios.create({
 });
 
 // The old interceptor that reads from localStorage is no longer needed and has been removed.
+installAuthRefresh(api);
 
 // --- API Functions ---
 
@@ -0,0 +1,72 @@
+import axios from 'axios';
+import { installAuthRefresh } from '../utils/authRefresh';
+
+const API_URL = process.env.REACT_APP_API_URL;
+const POLL_INTERVAL_MS = 2000;
+
+const api = axios.create({ baseURL: API_URL, withCredentials: true });
+installAuthRefresh(api);
+
+const STAGE_LABELS = {
+  queued: 'Queued',
+  extracting: 'Extracting text',
+  uploading: 'Indexing',
+  summarizing: 'Summarising',
+  saving: 'Saving',
+  done: 'Done',
+};
+
+export const getJob = (jobId) => {
+  return api.get(`/jobs/${jobId}`);
+};
+
+// Short progress text for a job, e.g. "Extracting text… 10%".
+export const jobProgressLabel = (job) => {
+  if (!job) return 'Uploading…';
+  return `${STAGE_LABELS[job.stage] || 'Processing'}… ${job.progress || 0}%`;
+};
+
+/**
+ * Follows an ingestion job until it finishes, via Server-Sent Events with
+ * polling as the fallback.
+ * @param {string} jobId - The job returned by an upload.
+ * @param {(job: object) => void} onProgress - Called with every update.
+ * @returns {Promise<object>} The succeeded job; rejects with its error.
+ */
+export const waitForJob = (jobId, onProgress = () => {}) =>
+  new Promise((resolve, reject) => {
+    const finish = (job) => {
+      if (job.status === 'succeeded') resolve(job);
+      else reject(new Error(job.error || 'Document processing failed'));
+    };
+
+    const poll = async () => {
+      try {
+        const { data } = await getJob(jobId);
+        const job = data.data;
+        onProgress(job);
+        if (job.status === 'succeeded' || job.status === 'failed') finish(job);
+        else setTimeout(poll, POLL_INTERVAL_MS);
+      } catch (err) {
+        reject(new Error(err.response?.data?.message || 'Lost track of the document'));
+      }
+    };
+
+    if (typeof EventSource === 'undefined') {
+      poll();
+      return;
+    }
+
+    const source = new EventSource(`${API_URL}/jobs/${jobId}/events`, { withCredentials: true });
+    const update = (e) => {
+      const job = JSON.parse(e.data);
+      onProgress(job);
+      return job;
+    };
+    source.addEventListener('progress', update);
+    source.addEventListener('done', (e) => { source.close(); finish(update(e)); });
+    source.addEventListener('failed', (e) => { source.close(); finish(update(e)); });
+    // Expired sessions and dropped connections fall back to polling, which
+    // refreshes the session
+    source.onerror = () => { source.close(); poll(); };
+  });
@@ -0,0 +1,65 @@
+import axios from 'axios';
+
+const REFRESH_URL = `${process.env.REACT_APP_API_URL}/auth/refresh`;
+
+// Requests that must never trigger a refresh themselves.
+const SKIP_REFRESH = ['/auth/login', '/auth/refresh'];
+
+// How long to wait for another tab's refresh response to land its cookies.
+const RACED_REFRESH_DELAY_MS = 300;
+
+// Shared by every axios instance so that concurrent 401s refresh only once.
+let refreshPromise = null;
+
+const refreshSession = () => {
+  if (!refreshPromise) {
+    refreshPromise = axios
+      .post(REFRESH_URL, null, { withCredentials: true, _skipAuthRefresh: true })
+      .catch((error) => {
+        // 409: another tab refreshed with the same cookie first. The session
+        // is still valid and the browser gets the new cookies from that
+        // tab's response, so retry with them instead of failing.
+        if (error.response?.status === 409) {
+          return new Promise((resolve) => setTimeout(resolve, RACED_REFRESH_DELAY_MS));
+        }
+        throw error;
+      })
+      .finally(() => {
+        refreshPromise = null;
+      });
+  }
+  return refreshPromise;
+};
+
+/**
+ * Retries a request once after refreshing the session when the short-lived
+ * access token has expired (any 401 response).
+ * @param {import('axios').AxiosInstance} instance - The axios instance to patch.
+ */
+export const installAuthRefresh = (instance) => {
+  instance.interceptors.response.use(
+    (response) => response,
+    async (error) => {
+      const config = error.config;
+      const url = `${config?.baseURL || ''}${config?.url || ''}`;
+      if (
+        error.response?.status !== 401 ||
+        !config ||
+        config._skipAuthRefresh ||
+        config._retried ||
+        SKIP_REFRESH.some((path) => url.endsWith(path))
+      ) {
+        return Promise.reject(error);
+      }
+
+      try {
+        await refreshSession();
+      } catch (refreshError) {
+        return Promise.reject(error);
+      }
+      return instance.request({ ...config, _retried: true });
+    }
+  );
+};
+
+export default installAuthRefresh;